@@ -12,7 +12,11 @@ import (
 	"github.com/tidepool-org/hydrophone/models"
 )
 
-const CLINIC_ADMIN_ROLE = "CLINIC_ADMIN"
+const (
+	CLINIC_ADMIN_ROLE  = "CLINIC_ADMIN"
+	CLINIC_MEMBER_ROLE = "CLINIC_MEMBER"
+	PRESCRIBER_ROLE    = "PRESCRIBER"
+)
 
 type ClinicInvite struct {
 	ShareCode   string                    `json:"shareCode"`
@@ -143,10 +147,10 @@ func (a *Api) InviteClinic(res http.ResponseWriter, req *http.Request, vars map[
 					fullName = invite.Creator.Profile.Patient.FullName
 				}
 
-				emailContent := map[string]interface{}{
-					"CareteamName": fullName,
-					"ClinicName":   clinic.Name,
-					"WebPath":      "login",
+				emailContent := &models.PatientClinicInviteContent{
+					CareteamName: fullName,
+					ClinicName:   clinic.Name,
+					WebPath:      "login",
 				}
 
 				if a.createAndSendNotification(req, invite, emailContent, recipients...) {
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"strings"
+	"unicode"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	clinics "github.com/tidepool-org/clinic/client"
+	"github.com/tidepool-org/go-common/clients/shoreline"
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+const STATUS_ERR_DECODING_CLINICIAN_INVITE_BATCH = "Error decoding the clinician invite batch"
+
+const (
+	// maxClinicianInviteBatchSize is the most invites in a batch.
+	maxClinicianInviteBatchSize = 500
+	// maxClinicianInviteBatchBytes is the largest batch body accepted.
+	maxClinicianInviteBatchBytes = 1 << 20
+	// clinicianInviteBatchConcurrency is the number of invites of a batch
+	// sent at once.
+	clinicianInviteBatchConcurrency = 8
+)
+
+// ClinicianInviteBatchStatus is the outcome of an invite of a batch.
+type ClinicianInviteBatchStatus string
+
+const (
+	ClinicianInviteBatchCreated       ClinicianInviteBatchStatus = "created"
+	ClinicianInviteBatchDuplicate     ClinicianInviteBatchStatus = "duplicate"
+	ClinicianInviteBatchInvalidEmail  ClinicianInviteBatchStatus = "invalid_email"
+	ClinicianInviteBatchInvalidLocale ClinicianInviteBatchStatus = "invalid_locale"
+	ClinicianInviteBatchClinicError   ClinicianInviteBatchStatus = "clinic_service_error"
+	ClinicianInviteBatchSendError     ClinicianInviteBatchStatus = "send_error"
+)
+
+// ClinicianInviteBatchResult is the outcome of the invite in a row of a
+// batch. Rows are numbered from 1, not counting a CSV header.
+type ClinicianInviteBatchResult struct {
+	Row      int                        `json:"row"`
+	Email    string                     `json:"email"`
+	Status   ClinicianInviteBatchStatus `json:"status"`
+	InviteId string                     `json:"inviteId,omitempty"`
+	Error    string                     `json:"error,omitempty"`
+}
+
+// ClinicianInviteBatchReport has the result of each row of a batch, in
+// order.
+type ClinicianInviteBatchReport struct {
+	Results []ClinicianInviteBatchResult `json:"results"`
+}
+
+// Send a batch of invites to become clinic members
+//
+// The batch is a JSON array of invites, or a CSV file with email and roles
+// columns and an optional locale column, sent as the text/csv body or as the
+// file field of a multipart form. Every row is validated before any invite is
+// sent. The whole batch is rejected if a row's roles are invalid, and of the
+// other rows, the valid ones are sent a few at a time.
+//
+// status: 200 ClinicianInviteBatchReport
+// status: 400 STATUS_ERR_DECODING_CLINICIAN_INVITE_BATCH
+// status: 401 STATUS_NO_TOKEN
+// status: 500 STATUS_ERR_FINDING_CLINIC
+func (a *Api) SendClinicianInviteBatch(res http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if token := a.token(res, req); token != nil {
+		ctx := req.Context()
+		clinicId := vars["clinicId"]
+
+		if err := a.assertClinicAdmin(ctx, clinicId, token, res); err != nil {
+			// assertClinicAdmin will log and send a response
+			return
+		}
+
+		defer req.Body.Close()
+		invites, err := decodeClinicianInviteBatch(res, req)
+		if err != nil {
+			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CLINICIAN_INVITE_BATCH, err)
+			return
+		}
+
+		clinic, err := a.clinics.GetClinicWithResponse(ctx, clinics.ClinicId(clinicId))
+		if err != nil || clinic == nil || clinic.JSON200 == nil {
+			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_CLINIC, err)
+			return
+		}
+
+		results := make([]ClinicianInviteBatchResult, len(invites))
+		locales := make([]models.Locale, len(invites))
+		seen := map[string]bool{}
+		for i, invite := range invites {
+			results[i], locales[i] = validateClinicianInvite(i+1, invite, seen)
+		}
+
+		var group errgroup.Group
+		group.SetLimit(clinicianInviteBatchConcurrency)
+		for i, invite := range invites {
+			if results[i].Status != "" {
+				continue
+			}
+			group.Go(func() error {
+				a.sendBatchClinicianInvite(req, token, clinic.JSON200, invite, locales[i], &results[i])
+				return nil
+			})
+		}
+		group.Wait()
+
+		a.logMetric("clinician_invite_batch", req)
+		a.sendModelAsResWithStatus(ctx, res, &ClinicianInviteBatchReport{Results: results}, http.StatusOK)
+		return
+	}
+}
+
+// validateClinicianInvite returns the result of an invalid or duplicate
+// invite, or a result without a status and the invite's locale if it can be
+// sent. seen has the emails of the rows before it.
+func validateClinicianInvite(row int, invite ClinicianInvite, seen map[string]bool) (ClinicianInviteBatchResult, models.Locale) {
+	result := ClinicianInviteBatchResult{Row: row, Email: invite.Email}
+	address, err := mail.ParseAddress(invite.Email)
+	if err != nil || address.Address != invite.Email {
+		result.Status = ClinicianInviteBatchInvalidEmail
+		return result, ""
+	}
+	email := strings.ToLower(invite.Email)
+	if seen[email] {
+		result.Status = ClinicianInviteBatchDuplicate
+		result.Error = "the email is in an earlier row"
+		return result, ""
+	}
+	seen[email] = true
+
+	locale, err := parseLocale(invite.Locale)
+	if err != nil {
+		result.Status = ClinicianInviteBatchInvalidLocale
+		result.Error = err.Error()
+	}
+	return result, locale
+}
+
+// sendBatchClinicianInvite invites a clinician with inviteClinician, and
+// records the outcome in result.
+func (a *Api) sendBatchClinicianInvite(req *http.Request, token *shoreline.TokenData, clinic *clinics.ClinicV1, invite ClinicianInvite, locale models.Locale, result *ClinicianInviteBatchResult) {
+	log := a.logger(req.Context()).With(zap.Int("row", result.Row))
+
+	confirmation, response, msg, err := a.inviteClinician(req, token, clinic, invite, locale)
+	switch {
+	case err != nil && msg == STATUS_ERR_FINDING_CLINIC:
+		log.With(zap.Error(err)).Error("creating clinician")
+		result.Status, result.Error = ClinicianInviteBatchClinicError, err.Error()
+	case err != nil:
+		log.With(zap.Error(err)).Error(msg)
+		result.Status, result.Error = ClinicianInviteBatchSendError, msg
+	case response.StatusCode() == http.StatusConflict:
+		result.Status, result.Error = ClinicianInviteBatchDuplicate, string(response.Body)
+	case response.StatusCode() != http.StatusOK:
+		result.Status = ClinicianInviteBatchClinicError
+		result.Error = fmt.Sprintf("unexpected status code %d: %s", response.StatusCode(), response.Body)
+	default:
+		result.Status = ClinicianInviteBatchCreated
+		result.InviteId = confirmation.Id
+	}
+}
+
+// decodeClinicianInviteBatch decodes the invites of a batch, by the content
+// type of the request.
+func decodeClinicianInviteBatch(res http.ResponseWriter, req *http.Request) ([]ClinicianInvite, error) {
+	req.Body = http.MaxBytesReader(res, req.Body, maxClinicianInviteBatchBytes)
+
+	var invites []ClinicianInvite
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("content-type"))
+	switch mediaType {
+	case "text/csv":
+		var err error
+		if invites, err = decodeClinicianInviteCSV(req.Body); err != nil {
+			return nil, err
+		}
+	case "multipart/form-data":
+		file, _, err := req.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		if invites, err = decodeClinicianInviteCSV(file); err != nil {
+			return nil, err
+		}
+	default:
+		if err := json.NewDecoder(req.Body).Decode(&invites); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(invites) == 0 {
+		return nil, errors.New("the batch is empty")
+	}
+	if len(invites) > maxClinicianInviteBatchSize {
+		return nil, fmt.Errorf("the batch has more than %d invites", maxClinicianInviteBatchSize)
+	}
+	for i, invite := range invites {
+		if err := validateClinicianRoles(invite.Roles); err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+	return invites, nil
+}
+
+// decodeClinicianInviteCSV decodes a CSV file of invites. Its header names
+// the email, roles and locale columns, in any order. The roles are separated
+// by spaces or semicolons.
+func decodeClinicianInviteCSV(r io.Reader) ([]ClinicianInvite, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	emailColumn, ok := columns["email"]
+	if !ok {
+		return nil, errors.New("the header has no email column")
+	}
+	rolesColumn, hasRoles := columns["roles"]
+	localeColumn, hasLocale := columns["locale"]
+
+	var invites []ClinicianInvite
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return invites, nil
+		} else if err != nil {
+			return nil, err
+		}
+		invite := ClinicianInvite{Email: strings.TrimSpace(record[emailColumn])}
+		if hasRoles {
+			invite.Roles = strings.FieldsFunc(record[rolesColumn], func(r rune) bool {
+				return r == ';' || unicode.IsSpace(r)
+			})
+		}
+		if hasLocale {
+			invite.Locale = strings.TrimSpace(record[localeColumn])
+		}
+		invites = append(invites, invite)
+	}
+}
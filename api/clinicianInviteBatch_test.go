@@ -0,0 +1,185 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/mock/gomock"
+
+	clinicsClient "github.com/tidepool-org/clinic/client"
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/templates"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+// enqueueingStore keeps the recipients of the messages enqueued.
+type enqueueingStore struct {
+	clients.StoreClient
+	mu         sync.Mutex
+	recipients []string
+}
+
+func (s *enqueueingStore) EnqueueMessage(ctx context.Context, message *models.OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recipients = append(s.recipients, message.Recipients...)
+	return nil
+}
+
+// initTestingBatchRouter returns a router whose clinic service has a
+// clinician for every email but taken@example.com, and fails for
+// broken@example.com.
+func initTestingBatchRouter(t *testing.T, store clients.StoreClient) *mux.Router {
+	t.Helper()
+	defaults, err := templates.New()
+	if err != nil {
+		t.Fatalf("error creating templates: %s", err)
+	}
+
+	clinicId := "clinic-id"
+	clinic := clinicsClient.NewMockClientWithResponsesInterface(gomock.NewController(t))
+	clinic.EXPECT().GetClinicWithResponse(gomock.Any(), clinicsClient.ClinicId(clinicId)).
+		Return(&clinicsClient.GetClinicResponse{JSON200: &clinicsClient.ClinicV1{Id: &clinicId, Name: "Clinic"}}, nil).
+		AnyTimes()
+	clinic.EXPECT().CreateClinicianWithResponse(gomock.Any(), clinicsClient.ClinicId(clinicId), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, clinicId clinicsClient.ClinicId, body clinicsClient.CreateClinicianJSONRequestBody, reqEditors ...clinicsClient.RequestEditorFn) (*clinicsClient.CreateClinicianResponse, error) {
+			status := http.StatusOK
+			switch body.Email {
+			case "taken@example.com":
+				status = http.StatusConflict
+			case "broken@example.com":
+				status = http.StatusInternalServerError
+			}
+			return &clinicsClient.CreateClinicianResponse{HTTPResponse: &http.Response{StatusCode: status}, Body: []byte("{}")}, nil
+		}).
+		AnyTimes()
+
+	testRtr := mux.NewRouter()
+	hydrophone := NewApi(EMAIL_CONFIG, clinic, store, mockShoreline, mockGatekeeper, mockMetrics, &namedSeagull{}, nil, defaults, mockNotifierHealth, testutil.NewLogger(t))
+	hydrophone.SetHandlers("", testRtr)
+	return testRtr
+}
+
+func postClinicianInviteBatch(t *testing.T, testRtr *mux.Router, contentType string, body *bytes.Buffer) *httptest.ResponseRecorder {
+	t.Helper()
+	request := MustRequest(t, http.MethodPost, "/confirm/v1/clinics/clinic-id/invites/clinicians/batch", body)
+	request.Header.Set(TP_SESSION_TOKEN, testing_token)
+	request.Header.Set("Content-Type", contentType)
+	response := httptest.NewRecorder()
+	testRtr.ServeHTTP(response, request)
+	return response
+}
+
+func TestSendClinicianInviteBatch(t *testing.T) {
+	const csvBatch = "Roles,Email,Locale\n" +
+		"CLINIC_ADMIN;CLINIC_MEMBER,one@example.com,\n" +
+		"CLINIC_MEMBER,not an email,\n" +
+		"CLINIC_MEMBER,ONE@example.com,\n" +
+		"CLINIC_MEMBER,taken@example.com,\n" +
+		"CLINIC_MEMBER,broken@example.com,\n" +
+		"CLINIC_MEMBER,two@example.com,xx-invalid\n" +
+		"CLINIC_MEMBER,three@example.com,es\n"
+	expected := []ClinicianInviteBatchStatus{
+		ClinicianInviteBatchCreated,
+		ClinicianInviteBatchInvalidEmail,
+		ClinicianInviteBatchDuplicate,
+		ClinicianInviteBatchDuplicate,
+		ClinicianInviteBatchClinicError,
+		ClinicianInviteBatchInvalidLocale,
+		ClinicianInviteBatchCreated,
+	}
+
+	multipartBody := &bytes.Buffer{}
+	form := multipart.NewWriter(multipartBody)
+	file, _ := form.CreateFormFile("file", "clinicians.csv")
+	file.Write([]byte(csvBatch))
+	form.Close()
+
+	var jsonInvites []ClinicianInvite
+	for _, line := range strings.Split(strings.TrimSpace(csvBatch), "\n")[1:] {
+		fields := strings.Split(line, ",")
+		jsonInvites = append(jsonInvites, ClinicianInvite{Email: fields[1], Roles: strings.Split(fields[0], ";"), Locale: fields[2]})
+	}
+	jsonBody := &bytes.Buffer{}
+	json.NewEncoder(jsonBody).Encode(jsonInvites)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        *bytes.Buffer
+	}{
+		{name: "csv", contentType: "text/csv; charset=utf-8", body: bytes.NewBufferString(csvBatch)},
+		{name: "csv upload", contentType: form.FormDataContentType(), body: multipartBody},
+		{name: "json", contentType: "application/json", body: jsonBody},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &enqueueingStore{StoreClient: mockStore}
+			response := postClinicianInviteBatch(t, initTestingBatchRouter(t, store), test.contentType, test.body)
+			if response.Code != http.StatusOK {
+				t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusOK, response.Body)
+			}
+
+			var report ClinicianInviteBatchReport
+			if err := json.NewDecoder(response.Body).Decode(&report); err != nil {
+				t.Fatalf("error decoding response: %s", err)
+			}
+			if len(report.Results) != len(expected) {
+				t.Fatalf("expected %d results, got %+v", len(expected), report.Results)
+			}
+			for i, result := range report.Results {
+				if result.Row != i+1 || result.Status != expected[i] {
+					t.Errorf("expected row %d to be %s, got %+v", i+1, expected[i], result)
+				}
+				if (result.Status == ClinicianInviteBatchCreated) != (result.InviteId != "") {
+					t.Errorf("expected only created invites to have an id, got %+v", result)
+				}
+			}
+
+			sort.Strings(store.recipients)
+			if !reflect.DeepEqual(store.recipients, []string{"one@example.com", "three@example.com"}) {
+				t.Errorf("expected the created invites to be emailed, got %v", store.recipients)
+			}
+		})
+	}
+}
+
+func TestSendClinicianInviteBatchInvalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{name: "empty", contentType: "application/json", body: "[]"},
+		{name: "not json", contentType: "application/json", body: "email"},
+		{name: "no email column", contentType: "text/csv", body: "address,roles\none@example.com,CLINIC_MEMBER\n"},
+		{name: "ragged csv", contentType: "text/csv", body: "email,roles\none@example.com\n"},
+		{name: "too many", contentType: "text/csv", body: "email,roles\n" + strings.Repeat("one@example.com,CLINIC_MEMBER\n", maxClinicianInviteBatchSize+1)},
+		{name: "no roles column", contentType: "text/csv", body: "email\none@example.com\n"},
+		{name: "unknown role", contentType: "text/csv", body: "email,roles\none@example.com,CLINIC_MEMBER\ntwo@example.com,CLINIC_MEMBER;OWNER\n"},
+		{name: "no roles", contentType: "application/json", body: `[{"email":"one@example.com","roles":["CLINIC_MEMBER"]},{"email":"two@example.com"}]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &enqueueingStore{StoreClient: mockStore}
+			response := postClinicianInviteBatch(t, initTestingBatchRouter(t, store), test.contentType, bytes.NewBufferString(test.body))
+			if response.Code != http.StatusBadRequest {
+				t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusBadRequest, response.Body)
+			}
+			if len(store.recipients) != 0 {
+				t.Errorf("expected no invite to be sent, got %v", store.recipients)
+			}
+		})
+	}
+}
@@ -3,8 +3,10 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"go.uber.org/zap"
@@ -15,8 +17,9 @@ import (
 )
 
 type ClinicianInvite struct {
-	Email string   `json:"email"`
-	Roles []string `json:"roles"`
+	Email  string   `json:"email"`
+	Roles  []string `json:"roles"`
+	Locale string   `json:"locale,omitempty"`
 }
 
 // Send an invite to become a clinic member
@@ -42,52 +45,87 @@ func (a *Api) SendClinicianInvite(res http.ResponseWriter, req *http.Request, va
 			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION, err)
 			return
 		}
-
-		confirmation, err := models.NewConfirmation(models.TypeClinicianInvite, models.TemplateNameClinicianInvite, token.UserID)
+		locale, err := parseLocale(body.Locale)
 		if err != nil {
-			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_CREATING_CONFIRMATION, err)
-			return
-		}
-
-		confirmation.Email = body.Email
-		confirmation.ClinicId = *clinic.JSON200.Id
-		confirmation.Creator.ClinicId = *clinic.JSON200.Id
-		confirmation.Creator.ClinicName = clinic.JSON200.Name
-
-		invitedUsr := a.findExistingUser(ctx, body.Email, a.sl.TokenProvide())
-		if invitedUsr != nil && invitedUsr.UserID != "" {
-			confirmation.UserId = invitedUsr.UserID
-		}
-
-		response, err := a.clinics.CreateClinicianWithResponse(ctx, clinics.ClinicId(clinicId), clinics.CreateClinicianJSONRequestBody{
-			InviteId: &confirmation.Key,
-			Email:    body.Email,
-			Roles:    body.Roles,
-		})
-		if err != nil {
-			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_CLINIC, err)
+			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION, err)
 			return
 		}
-		if response.StatusCode() != http.StatusOK {
-			res.Header().Set("content-type", "application/json")
-			res.WriteHeader(response.StatusCode())
-			res.Write(response.Body)
+		if err := validateClinicianRoles(body.Roles); err != nil {
+			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION, err)
 			return
 		}
 
-		msg, err := a.sendClinicianConfirmation(req, confirmation)
+		_, response, msg, err := a.inviteClinician(req, token, clinic.JSON200, *body, locale)
 		if err != nil {
 			a.sendError(ctx, res, http.StatusInternalServerError, msg, err)
 			return
 		}
 
 		res.Header().Set("content-type", "application/json")
-		res.WriteHeader(http.StatusOK)
+		res.WriteHeader(response.StatusCode())
 		res.Write(response.Body)
 		return
 	}
 }
 
+// inviteClinician creates the invite in the clinic service, then saves and
+// emails its confirmation. The clinic service's response is returned even if
+// it refused the invite, in which case nothing is sent. Otherwise an error
+// comes with the status message to report.
+func (a *Api) inviteClinician(req *http.Request, token *shoreline.TokenData, clinic *clinics.ClinicV1, invite ClinicianInvite, locale models.Locale) (*models.Confirmation, *clinics.CreateClinicianResponse, string, error) {
+	ctx := req.Context()
+
+	confirmation, err := models.NewConfirmation(models.TypeClinicianInvite, models.TemplateNameClinicianInvite, token.UserID)
+	if err != nil {
+		return nil, nil, STATUS_ERR_CREATING_CONFIRMATION, err
+	}
+
+	confirmation.Email = invite.Email
+	confirmation.Locale = locale
+	confirmation.ClinicId = *clinic.Id
+	confirmation.Creator.ClinicId = *clinic.Id
+	confirmation.Creator.ClinicName = clinic.Name
+
+	invitedUsr := a.findExistingUser(ctx, invite.Email, a.sl.TokenProvide())
+	if invitedUsr != nil && invitedUsr.UserID != "" {
+		confirmation.UserId = invitedUsr.UserID
+	}
+
+	response, err := a.clinics.CreateClinicianWithResponse(ctx, clinics.ClinicId(*clinic.Id), clinics.CreateClinicianJSONRequestBody{
+		InviteId: &confirmation.Id,
+		Email:    invite.Email,
+		Roles:    invite.Roles,
+	})
+	if err != nil {
+		return nil, nil, STATUS_ERR_FINDING_CLINIC, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return confirmation, response, "", nil
+	}
+
+	if msg, err := a.sendClinicianConfirmation(req, confirmation); err != nil {
+		return confirmation, response, msg, err
+	}
+	return confirmation, response, "", nil
+}
+
+// clinicianRoles are the roles a clinician may be invited with.
+var clinicianRoles = []string{CLINIC_ADMIN_ROLE, CLINIC_MEMBER_ROLE, PRESCRIBER_ROLE}
+
+// validateClinicianRoles checks that a clinician is invited with at least one
+// role, and only with roles of clinicianRoles.
+func validateClinicianRoles(roles []string) error {
+	if len(roles) == 0 {
+		return errors.New("the invite has no roles")
+	}
+	for _, role := range roles {
+		if !slices.Contains(clinicianRoles, role) {
+			return fmt.Errorf("unknown role %q", role)
+		}
+	}
+	return nil
+}
+
 // Resend an invite to become a clinic member
 func (a *Api) ResendClinicianInvite(res http.ResponseWriter, req *http.Request, vars map[string]string) {
 	if token := a.token(res, req); token != nil {
@@ -119,7 +157,7 @@ func (a *Api) ResendClinicianInvite(res http.ResponseWriter, req *http.Request,
 		}
 
 		filter := &models.Confirmation{
-			Key:    inviteId,
+			Id:     inviteId,
 			Type:   models.TypeClinicianInvite,
 			Status: models.StatusPending,
 		}
@@ -134,7 +172,7 @@ func (a *Api) ResendClinicianInvite(res http.ResponseWriter, req *http.Request,
 				a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_CREATING_CONFIRMATION, err)
 				return
 			}
-			confirmation.Key = inviteId
+			confirmation.Id = inviteId
 		}
 
 		confirmation.Email = inviteResponse.JSON200.Email
@@ -184,7 +222,7 @@ func (a *Api) GetClinicianInvite(res http.ResponseWriter, req *http.Request, var
 		}
 
 		filter := &models.Confirmation{
-			Key:    inviteId,
+			Id:     inviteId,
 			Type:   models.TypeClinicianInvite,
 			Status: models.StatusPending,
 		}
@@ -203,7 +241,8 @@ func (a *Api) GetClinicianInvite(res http.ResponseWriter, req *http.Request, var
 	}
 }
 
-// Get the still-pending invitations for a clinician
+// Get the still-pending invitations for a clinician. The list is paginated,
+// filtered and sorted by the parseListOptions query.
 func (a *Api) GetClinicianInvitations(res http.ResponseWriter, req *http.Request, vars map[string]string) {
 	if token := a.token(res, req); token != nil {
 		ctx := req.Context()
@@ -221,12 +260,17 @@ func (a *Api) GetClinicianInvitations(res http.ResponseWriter, req *http.Request
 		// Populate userId of the confirmations for this user's userId if is not set. This will allow us to query by userId.
 		inviteType := models.TypeClinicianInvite
 		inviteStatus := models.StatusPending
+		options, err := parseListOptions(req, inviteStatus)
+		if err != nil {
+			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_PARSING_LIST_OPTIONS, err)
+			return
+		}
 		if err := a.addUserIdsToUserlessInvites(ctx, invitedUsr, inviteType, inviteStatus); err != nil {
 			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_UPDATING_CONFIRMATION, err)
 			return
 		}
 
-		found, err := a.Store.FindConfirmations(ctx, &models.Confirmation{UserId: invitedUsr.UserID, Type: inviteType}, inviteStatus)
+		found, next, err := a.findPage(ctx, &models.Confirmation{UserId: invitedUsr.UserID, Type: inviteType}, options)
 		if err != nil {
 			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_CONFIRMATION, err)
 			return
@@ -244,6 +288,7 @@ func (a *Api) GetClinicianInvitations(res http.ResponseWriter, req *http.Request
 			}
 
 			a.logMetric("get_clinician_invitations", req)
+			setNextLink(res, req, next)
 			a.sendModelAsResWithStatus(ctx, res, invites, http.StatusOK)
 			a.logger(ctx).Infof("invites found and checked: %d", len(invites))
 			return
@@ -268,7 +313,7 @@ func (a *Api) AcceptClinicianInvite(res http.ResponseWriter, req *http.Request,
 		}
 
 		accept := &models.Confirmation{
-			Key:    inviteId,
+			Id:     inviteId,
 			UserId: token.UserID,
 			Type:   models.TypeClinicianInvite,
 			Status: models.StatusPending,
@@ -298,7 +343,7 @@ func (a *Api) AcceptClinicianInvite(res http.ResponseWriter, req *http.Request,
 			return
 		}
 
-		conf.UpdateStatus(models.StatusCompleted)
+		a.updateStatus(req, conf, models.StatusCompleted)
 		// addOrUpdateConfirmation logs and writes a response on errors
 		if !a.addOrUpdateConfirmation(ctx, conf, res) {
 			return
@@ -327,7 +372,7 @@ func (a *Api) DismissClinicianInvite(res http.ResponseWriter, req *http.Request,
 		}
 
 		filter := &models.Confirmation{
-			Key:    inviteId,
+			Id:     inviteId,
 			UserId: userId,
 			Type:   models.TypeClinicianInvite,
 			Status: models.StatusPending,
@@ -358,7 +403,7 @@ func (a *Api) CancelClinicianInvite(res http.ResponseWriter, req *http.Request,
 		}
 
 		filter := &models.Confirmation{
-			Key:      inviteId,
+			Id:       inviteId,
 			ClinicId: clinicId,
 			Type:     models.TypeClinicianInvite,
 			Status:   models.StatusPending,
@@ -394,11 +439,11 @@ func (a *Api) sendClinicianConfirmation(req *http.Request, confirmation *models.
 		webPath = "login"
 	}
 
-	emailContent := map[string]interface{}{
-		"ClinicName":  confirmation.Creator.ClinicName,
-		"CreatorName": fullName,
-		"Email":       confirmation.Email,
-		"WebPath":     webPath,
+	emailContent := &models.ClinicianInviteContent{
+		ClinicName:  confirmation.Creator.ClinicName,
+		CreatorName: fullName,
+		Email:       confirmation.Email,
+		WebPath:     webPath,
 	}
 
 	if !a.createAndSendNotification(req, confirmation, emailContent) {
@@ -414,14 +459,14 @@ func (a *Api) sendClinicianConfirmation(req *http.Request, confirmation *models.
 func (a *Api) cancelClinicianInviteWithStatus(res http.ResponseWriter, req *http.Request, filter, conf *models.Confirmation, statusUpdate models.Status) {
 	ctx := req.Context()
 
-	response, err := a.clinics.DeleteInvitedClinicianWithResponse(ctx, clinics.ClinicId(filter.ClinicId), clinics.InviteId(filter.Key))
+	response, err := a.clinics.DeleteInvitedClinicianWithResponse(ctx, clinics.ClinicId(filter.ClinicId), clinics.InviteId(filter.Id))
 	if err != nil || (response.StatusCode() != http.StatusOK && response.StatusCode() != http.StatusNotFound) {
 		a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_CONFIRMATION, err)
 		return
 	}
 
 	if conf != nil {
-		conf.UpdateStatus(statusUpdate)
+		a.updateStatus(req, conf, statusUpdate)
 		// addOrUpdateConfirmation logs and writes a response on errors
 		if !a.addOrUpdateConfirmation(ctx, conf, res) {
 			return
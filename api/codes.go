@@ -0,0 +1,178 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+const (
+	STATUS_CODE_EXPIRED = "The code has expired, request a new one"
+	STATUS_CODE_LOCKED  = "The code was entered incorrectly too many times, request a new one"
+)
+
+const (
+	// confirmationModeLink emails a link to the confirmation's key. It's the
+	// default.
+	confirmationModeLink = "link"
+	// confirmationModeCode emails a short numeric code instead, for the
+	// mobile apps.
+	confirmationModeCode = "code"
+)
+
+// CodeConfig sets the length of the codes emailed instead of links, how long
+// they're accepted, and how many times they may be entered.
+type CodeConfig struct {
+	Length      int           `default:"6"`
+	TTL         time.Duration `default:"15m"`
+	MaxAttempts int           `split_words:"true" default:"5"`
+}
+
+func (c CodeConfig) Validate() error {
+	if c.Length < 6 || c.Length > 8 {
+		return fmt.Errorf("code length must be between 6 and 8, got %d", c.Length)
+	}
+	if c.TTL <= 0 {
+		return fmt.Errorf("code TTL must be positive, got %s", c.TTL)
+	}
+	if c.MaxAttempts < 1 {
+		return fmt.Errorf("code max attempts must be at least 1, got %d", c.MaxAttempts)
+	}
+	return nil
+}
+
+// codeBody is the body of a request to accept a confirmation with its code.
+// The password and birthday are given as they would be with the key.
+type codeBody struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+	models.Acceptance
+}
+
+// parseConfirmationMode reports whether the mode requests a code.
+func parseConfirmationMode(mode string) (bool, error) {
+	switch mode {
+	case "", confirmationModeLink:
+		return false, nil
+	case confirmationModeCode:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown confirmation mode %q", mode)
+	}
+}
+
+// addCode gives the confirmation a new code, which is kept once the
+// confirmation is stored.
+func (a *Api) addCode(conf *models.Confirmation) error {
+	code, err := models.NewVerificationCode(a.Config.Code.Length, a.Config.Code.TTL)
+	if err != nil {
+		return err
+	}
+	conf.Code = code
+	return nil
+}
+
+// codeValue returns the code to email for the confirmation, if it has one.
+func codeValue(conf *models.Confirmation) string {
+	if conf.Code == nil {
+		return ""
+	}
+	return conf.Code.Value
+}
+
+// findByCode finds the pending confirmation of the type with the email and
+// code of the body, counting the attempt. The code is no longer accepted once
+// it has been entered more than the maximum attempts, even if it's right.
+//
+// If it returns nil, an HTTP response has been sent.
+func (a *Api) findByCode(res http.ResponseWriter, req *http.Request, confirmationType models.Type, body *codeBody, notFound, expired string) *models.Confirmation {
+	ctx := req.Context()
+	if body.Email == "" || body.Code == "" {
+		a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION, "the email and code are required")
+		return nil
+	}
+
+	found, matches, err := a.Store.CheckConfirmationCode(ctx, body.Email, confirmationType, body.Code)
+	if err != nil {
+		a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_CONFIRMATION, err)
+		return nil
+	}
+	if found == nil {
+		a.sendError(ctx, res, http.StatusNotFound, notFound)
+		return nil
+	}
+	if found.Code.Attempts > a.Config.Code.MaxAttempts {
+		a.logMetricAsServer("code locked")
+		a.sendError(ctx, res, http.StatusTooManyRequests, STATUS_CODE_LOCKED)
+		return nil
+	}
+	if !matches {
+		a.sendError(ctx, res, http.StatusNotFound, notFound)
+		return nil
+	}
+	if found.Code.IsExpired() {
+		a.sendError(ctx, res, http.StatusNotFound, STATUS_CODE_EXPIRED)
+		return nil
+	}
+	if found.IsExpired() {
+		a.sendError(ctx, res, http.StatusNotFound, expired)
+		return nil
+	}
+	return found
+}
+
+// Accept a signup with the code emailed instead of a link
+//
+// The body has the email and code, and like the signup accepted with its key,
+// the password and birthday if the account doesn't have a password yet.
+//
+// status: 200
+// status: 400 STATUS_ERR_DECODING_CONFIRMATION
+// status: 404 STATUS_SIGNUP_NOT_FOUND
+// status: 404 STATUS_SIGNUP_EXPIRED
+// status: 404 STATUS_CODE_EXPIRED
+// status: 409 the password or birthday is missing or invalid, as for acceptSignUp
+// status: 429 STATUS_CODE_LOCKED
+func (a *Api) acceptSignUpCode(res http.ResponseWriter, req *http.Request, vars map[string]string) {
+	ctx := req.Context()
+	defer req.Body.Close()
+	body := &codeBody{}
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION, err)
+		return
+	}
+
+	if found := a.findByCode(res, req, models.TypeSignUp, body, STATUS_SIGNUP_NOT_FOUND, STATUS_SIGNUP_EXPIRED); found != nil {
+		a.completeSignUp(res, req, found, func() (*models.Acceptance, error) {
+			return &body.Acceptance, nil
+		})
+	}
+}
+
+// Reset a password with the code emailed instead of a link
+//
+// The body has the email, code and new password.
+//
+// status: 200 STATUS_RESET_ACCEPTED
+// status: 400 STATUS_ERR_DECODING_CONFIRMATION
+// status: 400 STATUS_RESET_ERROR when we can't update the users password
+// status: 404 STATUS_RESET_NOT_FOUND
+// status: 404 STATUS_RESET_EXPIRED
+// status: 404 STATUS_CODE_EXPIRED
+// status: 429 STATUS_CODE_LOCKED
+func (a *Api) acceptPasswordCode(res http.ResponseWriter, req *http.Request, vars map[string]string) {
+	ctx := req.Context()
+	defer req.Body.Close()
+	body := &codeBody{}
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION, err)
+		return
+	}
+
+	if found := a.findByCode(res, req, models.TypePasswordReset, body, STATUS_RESET_NOT_FOUND, STATUS_RESET_EXPIRED); found != nil {
+		a.resetPassword(res, req, found, found.Email, body.Password)
+	}
+}
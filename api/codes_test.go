@@ -0,0 +1,237 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+var testingCodeConfig = CodeConfig{Length: 6, TTL: 15 * time.Minute, MaxAttempts: 3}
+
+// codeStore has a pending confirmation with the code 123456, and counts the
+// attempts at it like the Mongo store. It keeps the confirmations upserted.
+type codeStore struct {
+	clients.StoreClient
+	confirmation *models.Confirmation
+	upserted     []*models.Confirmation
+}
+
+func (s *codeStore) CheckConfirmationCode(ctx context.Context, email string, confirmationType models.Type, code string) (*models.Confirmation, bool, error) {
+	conf := s.confirmation
+	if conf == nil || !strings.EqualFold(conf.Email, email) || conf.Type != confirmationType || conf.Status != models.StatusPending {
+		return nil, false, nil
+	}
+	conf.Code.Attempts++
+	return conf, code == "123456", nil
+}
+
+func (s *codeStore) UpsertConfirmation(ctx context.Context, confirmation *models.Confirmation) error {
+	s.upserted = append(s.upserted, confirmation)
+	return nil
+}
+
+func newCodeStore(confirmationType models.Type, userId string) *codeStore {
+	return &codeStore{
+		StoreClient: mockStore,
+		confirmation: &models.Confirmation{
+			Id:      "confirmation-id",
+			Type:    confirmationType,
+			Email:   "me@myemail.com",
+			UserId:  userId,
+			Status:  models.StatusPending,
+			Created: time.Now(),
+			Code:    &models.VerificationCode{ExpiresAt: time.Now().Add(time.Minute)},
+		},
+	}
+}
+
+func initTestingCodeRouter(t *testing.T, store clients.StoreClient) *mux.Router {
+	t.Helper()
+	cfg := FAKE_CONFIG
+	cfg.Code = testingCodeConfig
+	testRtr := mux.NewRouter()
+	hydrophone := NewApi(cfg, nil, store, mockShoreline, mockGatekeeper, mockMetrics, mockSeagull, nil, mockTemplates, mockNotifierHealth, testutil.NewLogger(t))
+	hydrophone.SetHandlers("", testRtr)
+	return testRtr
+}
+
+func TestPasswordResetCodeEmail(t *testing.T) {
+	store := &codeStore{StoreClient: mockStore}
+	testRtr, mailbox := initTestingEmailRouter(t, store)
+
+	body := &bytes.Buffer{}
+	json.NewEncoder(body).Encode(testJSONObject{"mode": "code"})
+	request := MustRequest(t, http.MethodPost, "/send/forgot/me@myemail.com", body)
+	response := httptest.NewRecorder()
+	testRtr.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusOK, response.Body)
+	}
+
+	if len(store.upserted) != 1 || store.upserted[0].Code == nil {
+		t.Fatalf("expected a confirmation with a code to be stored, got %+v", store.upserted)
+	}
+	code := store.upserted[0].Code
+	if len(code.Value) != testingCodeConfig.Length || time.Until(code.ExpiresAt) > testingCodeConfig.TTL {
+		t.Errorf("expected a %d digit code expiring within %s, got %+v", testingCodeConfig.Length, testingCodeConfig.TTL, code)
+	}
+
+	email := mailbox.Only()
+	if !strings.Contains(email.Text, code.Value) {
+		t.Errorf("expected the code in the email, got %q", email.Text)
+	}
+	if email.HasLink(EMAIL_CONFIG.WebUrl + "/confirm-password-reset?resetKey=") {
+		t.Errorf("expected no password reset link, got %v", email.Links())
+	}
+}
+
+func TestPasswordResetInvalidMode(t *testing.T) {
+	testRtr := initTestingCodeRouter(t, mockStore)
+
+	body := &bytes.Buffer{}
+	json.NewEncoder(body).Encode(testJSONObject{"mode": "sms"})
+	request := MustRequest(t, http.MethodPost, "/send/forgot/me@myemail.com", body)
+	response := httptest.NewRecorder()
+	testRtr.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusBadRequest, response.Body)
+	}
+}
+
+func TestAcceptCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		store    *codeStore
+		attempts int
+		expired  bool
+		body     testJSONObject
+		respCode int
+	}{
+		{
+			name:     "signup",
+			url:      "/confirm/v1/accept/signup",
+			store:    newCodeStore(models.TypeSignUp, "UID"),
+			body:     testJSONObject{"email": "ME@myemail.com", "code": "123456"},
+			respCode: http.StatusOK,
+		},
+		{
+			name:     "signup without a password",
+			url:      "/confirm/v1/accept/signup",
+			store:    newCodeStore(models.TypeSignUp, "WithoutPassword"),
+			body:     testJSONObject{"email": "me@myemail.com", "code": "123456", "password": "12345678", "birthday": "2016-01-01"},
+			respCode: http.StatusOK,
+		},
+		{
+			name:     "signup without a password, password missing",
+			url:      "/confirm/v1/accept/signup",
+			store:    newCodeStore(models.TypeSignUp, "WithoutPassword"),
+			body:     testJSONObject{"email": "me@myemail.com", "code": "123456", "birthday": "2016-01-01"},
+			respCode: http.StatusConflict,
+		},
+		{
+			name:     "password reset",
+			url:      "/v1/accept/forgot",
+			store:    newCodeStore(models.TypePasswordReset, ""),
+			body:     testJSONObject{"email": "me@myemail.com", "code": "123456", "password": "12345678"},
+			respCode: http.StatusOK,
+		},
+		{
+			name:     "wrong code",
+			url:      "/v1/accept/forgot",
+			store:    newCodeStore(models.TypePasswordReset, ""),
+			body:     testJSONObject{"email": "me@myemail.com", "code": "654321", "password": "12345678"},
+			respCode: http.StatusNotFound,
+		},
+		{
+			name:     "other email",
+			url:      "/v1/accept/forgot",
+			store:    newCodeStore(models.TypePasswordReset, ""),
+			body:     testJSONObject{"email": "other@myemail.com", "code": "123456", "password": "12345678"},
+			respCode: http.StatusNotFound,
+		},
+		{
+			name:     "other type",
+			url:      "/v1/accept/signup",
+			store:    newCodeStore(models.TypePasswordReset, ""),
+			body:     testJSONObject{"email": "me@myemail.com", "code": "123456"},
+			respCode: http.StatusNotFound,
+		},
+		{
+			name:     "locked",
+			url:      "/v1/accept/forgot",
+			store:    newCodeStore(models.TypePasswordReset, ""),
+			attempts: testingCodeConfig.MaxAttempts,
+			body:     testJSONObject{"email": "me@myemail.com", "code": "123456", "password": "12345678"},
+			respCode: http.StatusTooManyRequests,
+		},
+		{
+			name:     "expired",
+			url:      "/v1/accept/signup",
+			store:    newCodeStore(models.TypeSignUp, "UID"),
+			expired:  true,
+			body:     testJSONObject{"email": "me@myemail.com", "code": "123456"},
+			respCode: http.StatusNotFound,
+		},
+		{
+			name:     "no code",
+			url:      "/v1/accept/signup",
+			store:    newCodeStore(models.TypeSignUp, "UID"),
+			body:     testJSONObject{"email": "me@myemail.com"},
+			respCode: http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := test.store.confirmation
+			conf.Code.Attempts = test.attempts
+			if test.expired {
+				conf.Code.ExpiresAt = time.Now().Add(-time.Second)
+			}
+			testRtr := initTestingCodeRouter(t, test.store)
+
+			body := &bytes.Buffer{}
+			json.NewEncoder(body).Encode(test.body)
+			request := MustRequest(t, http.MethodPut, test.url, body)
+			response := httptest.NewRecorder()
+			testRtr.ServeHTTP(response, request)
+			if response.Code != test.respCode {
+				t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, test.respCode, response.Body)
+			}
+
+			completed := len(test.store.upserted) == 1 && test.store.upserted[0].Status == models.StatusCompleted
+			if completed != (test.respCode == http.StatusOK) {
+				t.Errorf("expected the confirmation to be completed only when accepted, got %+v", test.store.upserted)
+			}
+		})
+	}
+}
+
+func TestLockedCodeAttempts(t *testing.T) {
+	store := newCodeStore(models.TypePasswordReset, "")
+	testRtr := initTestingCodeRouter(t, store)
+
+	codes := []string{"000000", "111111", "222222", "123456"}
+	expected := []int{http.StatusNotFound, http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests}
+	for i, code := range codes {
+		body := &bytes.Buffer{}
+		json.NewEncoder(body).Encode(testJSONObject{"email": "me@myemail.com", "code": code, "password": "12345678"})
+		request := MustRequest(t, http.MethodPut, "/v1/accept/forgot", body)
+		response := httptest.NewRecorder()
+		testRtr.ServeHTTP(response, request)
+		if response.Code != expected[i] {
+			t.Fatalf("attempt %d: non-expected status code %d (expected %d):\n\tbody: %v", i+1, response.Code, expected[i], response.Body)
+		}
+	}
+}
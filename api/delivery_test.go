@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/sns"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+// deliveryStore returns confirmations with a delivery record, and records
+// delivery status updates.
+type deliveryStore struct {
+	clients.StoreClient
+	delivery *models.Delivery
+	statuses map[string]models.DeliveryStatus
+}
+
+func (s *deliveryStore) FindConfirmationsWithOpts(ctx context.Context, confirmation *models.Confirmation, filter clients.FilterOpts, statuses ...models.Status) ([]*models.Confirmation, error) {
+	found, err := s.StoreClient.FindConfirmationsWithOpts(ctx, confirmation, filter, statuses...)
+	for _, conf := range found {
+		conf.Delivery = s.delivery
+	}
+	return found, err
+}
+
+func (s *deliveryStore) UpdateDeliveryStatus(ctx context.Context, providerMessageId string, status models.DeliveryStatus) error {
+	s.statuses[providerMessageId] = status
+	return nil
+}
+
+func newDeliveryStore() *deliveryStore {
+	return &deliveryStore{
+		StoreClient: mockStore,
+		delivery: &models.Delivery{
+			Status:            models.DeliveryStatusDelivered,
+			Attempts:          2,
+			LastAttemptTime:   time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+			ProviderMessageId: "ses-message-id",
+		},
+		statuses: map[string]models.DeliveryStatus{},
+	}
+}
+
+func TestInvitationsIncludeDelivery(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{name: "sent invitations", url: fmt.Sprintf("/confirm/invite/%s", testing_uid2)},
+		{name: "patient invites", url: "/confirm/v1/clinics/clinic-id/invites/patients"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newDeliveryStore()
+			testRtr := initTestingSuppressionRouter(t, store, mockShoreline, sns.Config{})
+			request := MustRequest(t, http.MethodGet, test.url, nil)
+			request.Header.Set(TP_SESSION_TOKEN, testing_token)
+			response := httptest.NewRecorder()
+			testRtr.ServeHTTP(response, request)
+			if response.Code != http.StatusOK {
+				t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusOK, response.Body)
+			}
+
+			var invites []struct {
+				Delivery *models.Delivery `json:"delivery"`
+			}
+			if err := json.NewDecoder(response.Body).Decode(&invites); err != nil {
+				t.Fatalf("error decoding response: %s", err)
+			}
+			if len(invites) == 0 {
+				t.Fatal("expected invites to be returned")
+			}
+			for _, invite := range invites {
+				if invite.Delivery == nil || *invite.Delivery != *store.delivery {
+					t.Errorf("expected delivery record %+v, got %+v", store.delivery, invite.Delivery)
+				}
+			}
+		})
+	}
+}
+
+func TestReceiveSESDeliveryNotification(t *testing.T) {
+	topic := testutil.NewSNSTopic(t)
+	tests := []struct {
+		name         string
+		notification map[string]any
+		status       models.DeliveryStatus
+	}{
+		{
+			name:         "delivery",
+			notification: map[string]any{"notificationType": sns.SESNotificationDelivery},
+			status:       models.DeliveryStatusDelivered,
+		},
+		{
+			name: "transient bounce",
+			notification: map[string]any{
+				"notificationType": sns.SESNotificationBounce,
+				"bounce":           map[string]any{"bounceType": "Transient"},
+			},
+			status: models.DeliveryStatusBounced,
+		},
+		{
+			name: "complaint",
+			notification: map[string]any{
+				"notificationType": sns.SESNotificationComplaint,
+				"complaint":        map[string]any{"complainedRecipients": []map[string]string{}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newDeliveryStore()
+			testRtr := initTestingSuppressionRouter(t, store, mockShoreline, topic.Config())
+			test.notification["mail"] = map[string]any{"messageId": "ses-message-id"}
+			response := postSNSMessage(t, testRtr, topic.Notification(test.notification))
+			if response.Code != http.StatusOK {
+				t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusOK, response.Body)
+			}
+			if status := store.statuses["ses-message-id"]; status != test.status {
+				t.Errorf("expected delivery status %q, got %q", test.status, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	commonClients "github.com/tidepool-org/go-common/clients"
+
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/templates"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+var EMAIL_CONFIG = Config{
+	ServerSecret: "shhh! don't tell",
+	WebUrl:       "https://app.tidepool.test",
+	AssetUrl:     "https://assets.tidepool.test",
+	Code:         testingCodeConfig,
+}
+
+// deliveringStore sends outbox messages through its notifier as soon as
+// they're enqueued, so that tests can read them.
+type deliveringStore struct {
+	clients.StoreClient
+	notifier clients.Notifier
+}
+
+func (s *deliveringStore) EnqueueMessage(ctx context.Context, message *models.OutboxMessage) error {
+	if result := s.notifier.Send(ctx, message.Recipients, message.Subject, message.Body, message.TextBody); result.Err != nil {
+		return fmt.Errorf("sending message: %w", result.Err)
+	}
+	return nil
+}
+
+// namedSeagull has a profile with a name for every user, so that the emails
+// that show names can be sent.
+type namedSeagull struct {
+	commonClients.SeagullMock
+}
+
+func (s *namedSeagull) GetCollection(userID, collectionName, token string, v interface{}) error {
+	return json.Unmarshal([]byte(`{"fullName": "Sample Patient", "patient": {"birthday": "2016-01-01"}}`), v)
+}
+
+// initTestingEmailRouter returns a router whose emails are written to the
+// returned mailbox.
+func initTestingEmailRouter(t *testing.T, store clients.StoreClient) (*mux.Router, *testutil.Mailbox) {
+	t.Helper()
+	dir := t.TempDir()
+	notifier, err := clients.NewFileNotifier(clients.FileNotifierConfig{
+		Directory:   dir,
+		Format:      clients.FileFormatMaildir,
+		FromAddress: "Tidepool <noreply@tidepool.org>",
+	})
+	if err != nil {
+		t.Fatalf("error creating notifier: %s", err)
+	}
+	defaults, err := templates.New()
+	if err != nil {
+		t.Fatalf("error creating templates: %s", err)
+	}
+
+	testRtr := mux.NewRouter()
+	hydrophone := NewApi(
+		EMAIL_CONFIG,
+		nil,
+		&deliveringStore{StoreClient: store, notifier: notifier},
+		mockShoreline,
+		mockGatekeeper,
+		mockMetrics,
+		&namedSeagull{},
+		nil,
+		defaults,
+		mockNotifierHealth,
+		testutil.NewLogger(t),
+	)
+	hydrophone.SetHandlers("", testRtr)
+	return testRtr, testutil.NewMailbox(t, dir)
+}
+
+func TestPasswordResetEmail(t *testing.T) {
+	testRtr, mailbox := initTestingEmailRouter(t, mockStore)
+
+	request := MustRequest(t, http.MethodPost, "/send/forgot/me@myemail.com", nil)
+	response := httptest.NewRecorder()
+	testRtr.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusOK, response.Body)
+	}
+
+	email := mailbox.Only()
+	if len(email.To) != 1 || email.To[0] != "me@myemail.com" {
+		t.Errorf("expected the email to be sent to me@myemail.com, got %v", email.To)
+	}
+	if email.Subject != "Password reset for your Tidepool account" {
+		t.Errorf("non-expected subject %q", email.Subject)
+	}
+	if !email.HasLink(EMAIL_CONFIG.WebUrl + "/confirm-password-reset?resetKey=") {
+		t.Errorf("expected a password reset link, got %v", email.Links())
+	}
+	if !strings.Contains(email.Text, EMAIL_CONFIG.WebUrl+"/confirm-password-reset?resetKey=") {
+		t.Errorf("expected the password reset link in the text body, got %q", email.Text)
+	}
+}
+
+func TestSendInviteEmail(t *testing.T) {
+	testRtr, mailbox := initTestingEmailRouter(t, mockStoreEmpty)
+
+	invitee := testing_uid2 + "@email.org"
+	body := &bytes.Buffer{}
+	json.NewEncoder(body).Encode(testJSONObject{
+		"email":       invitee,
+		"permissions": testJSONObject{"view": testJSONObject{}},
+	})
+	request := MustRequest(t, http.MethodPost, fmt.Sprintf("/send/invite/%s", testing_uid2), body)
+	request.Header.Set(TP_SESSION_TOKEN, testing_token)
+	response := httptest.NewRecorder()
+	testRtr.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusOK, response.Body)
+	}
+
+	email := mailbox.Only()
+	if len(email.To) != 1 || email.To[0] != invitee {
+		t.Errorf("expected the email to be sent to %s, got %v", invitee, email.To)
+	}
+	if !strings.Contains(email.Subject, "invitation") {
+		t.Errorf("non-expected subject %q", email.Subject)
+	}
+	found := false
+	for _, link := range email.Links() {
+		if strings.HasPrefix(link, EMAIL_CONFIG.WebUrl+"/") && strings.HasSuffix(link, "inviteEmail="+url.QueryEscape(invitee)) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected an invitation link for %s, got %v", invitee, email.Links())
+	}
+}
+
+// pendingInviteStore finds a pending care team invitation from testing_uid1.
+type pendingInviteStore struct {
+	clients.StoreClient
+}
+
+func (s *pendingInviteStore) FindConfirmation(ctx context.Context, confirmation *models.Confirmation) (*models.Confirmation, error) {
+	return &models.Confirmation{
+		Id:        confirmation.Id,
+		Type:      models.TypeCareteamInvite,
+		Status:    models.StatusPending,
+		Email:     "invitee@email.org",
+		CreatorId: testing_uid1,
+	}, nil
+}
+
+// TestHandlerEmails checks that the content each handler renders its email
+// with has every variable its template needs, since executing a template
+// fails without them.
+func TestHandlerEmails(t *testing.T) {
+	tests := []struct {
+		name   string
+		store  clients.StoreClient
+		method string
+		url    string
+		token  string
+		body   testJSONObject
+	}{
+		{name: "password reset", store: mockStore, method: http.MethodPost, url: "/send/forgot/me@myemail.com"},
+		{name: "password reset code", store: mockStore, method: http.MethodPost, url: "/send/forgot/me@myemail.com", body: testJSONObject{"mode": "code"}},
+		{name: "signup", store: mockStoreEmpty, method: http.MethodPost, url: "/send/signup/" + testing_uid1, token: testing_token},
+		{name: "signup resend", store: mockStore, method: http.MethodPost, url: "/resend/signup/me@myemail.com"},
+		{name: "care team invite", store: mockStoreEmpty, method: http.MethodPost, url: "/send/invite/" + testing_uid2, token: testing_token,
+			body: testJSONObject{"email": "invitee@email.org", "permissions": testJSONObject{"view": testJSONObject{}}}},
+		{name: "care team invite resend", store: &pendingInviteStore{StoreClient: mockStore}, method: http.MethodPatch, url: "/resend/invite/invite-id", token: testing_token},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testRtr, mailbox := initTestingEmailRouter(t, test.store)
+			body := &bytes.Buffer{}
+			if test.body != nil {
+				json.NewEncoder(body).Encode(test.body)
+			}
+			request := MustRequest(t, test.method, test.url, body)
+			if test.token != "" {
+				request.Header.Set(TP_SESSION_TOKEN, test.token)
+			}
+			response := httptest.NewRecorder()
+			testRtr.ServeHTTP(response, request)
+			if response.Code != http.StatusOK {
+				t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusOK, response.Body)
+			}
+			if email := mailbox.Only(); email.Subject == "" {
+				t.Errorf("expected an email with a subject, got %+v", email)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 
 	"go.uber.org/zap"
@@ -25,16 +27,26 @@ type (
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
+
+	//optional details of a lost password request
+	passwordResetBody struct {
+		Locale string `json:"locale,omitempty"`
+		// Mode is code to email a code instead of a link.
+		Mode string `json:"mode,omitempty"`
+	}
 )
 
 // Create a lost password request
 //
 // If the request is correctly formed, always returns a 200, even if the email address was not found (this way it can't be used to validate email addresses).
+// Requests over the rate limits for the email address or source IP also return a 200, without sending an email.
 //
 // If the email address is found in the Tidepool system, this will:
 // - Create a confirm record and a random key
 // - Send an email with a link containing the key
 //
+// If the mode is code, the email has a short numeric code instead, which is accepted by acceptPasswordCode.
+//
 // Visiting the URL in the email will fetch a page that offers the user the chance to accept or reject the lost password request.
 // If accepted, the user must then create a new password that will replace the old one.
 //
@@ -48,6 +60,31 @@ func (a *Api) passwordReset(res http.ResponseWriter, req *http.Request, vars map
 		return
 	}
 
+	var body passwordResetBody
+	if req.Body != nil {
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION, err)
+			return
+		}
+	}
+	locale, err := parseLocale(body.Locale)
+	if err != nil {
+		a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION, err)
+		return
+	}
+	withCode, err := parseConfirmationMode(body.Mode)
+	if err != nil {
+		a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION, err)
+		return
+	}
+
+	// Resets are limited whether or not the account exists, and throttled
+	// requests get the same response.
+	if a.throttled(req, models.TypePasswordReset, email) {
+		res.WriteHeader(http.StatusOK)
+		return
+	}
+
 	resetCnf, err := models.NewConfirmation(models.TypePasswordReset, models.TemplateNamePasswordReset, "")
 	if err != nil {
 		a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_CREATING_CONFIRMATION, err)
@@ -55,9 +92,16 @@ func (a *Api) passwordReset(res http.ResponseWriter, req *http.Request, vars map
 	}
 
 	resetCnf.Email = email
+	resetCnf.Locale = locale
 
 	if resetUsr := a.findExistingUser(ctx, resetCnf.Email, a.sl.TokenProvide()); resetUsr != nil {
 		resetCnf.UserId = resetUsr.UserID
+		if withCode {
+			if err := a.addCode(resetCnf); err != nil {
+				a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_CREATING_CONFIRMATION, err)
+				return
+			}
+		}
 	} else {
 		a.logger(ctx).With(zap.String("email", email)).Debug(STATUS_RESET_NO_ACCOUNT)
 		resetCnf, err = models.NewConfirmation(models.TypeNoAccount, models.TemplateNameNoAccount, "")
@@ -67,17 +111,19 @@ func (a *Api) passwordReset(res http.ResponseWriter, req *http.Request, vars map
 		}
 
 		resetCnf.Email = email
+		resetCnf.Locale = locale
 		//there is nothing more to do other than notify the user
-		resetCnf.UpdateStatus(models.StatusCompleted)
+		a.updateStatus(req, resetCnf, models.StatusCompleted)
 	}
 
 	// addOrUpdateConfirmation logs and writes a response on errors
 	if a.addOrUpdateConfirmation(ctx, resetCnf, res) {
 		a.logMetricAsServer("reset confirmation created")
 
-		emailContent := map[string]interface{}{
-			"Key":   resetCnf.Key,
-			"Email": resetCnf.Email,
+		emailContent := &models.PasswordResetContent{
+			Key:   resetCnf.Key,
+			Code:  codeValue(resetCnf),
+			Email: resetCnf.Email,
 		}
 
 		if a.createAndSendNotification(req, resetCnf, emailContent) {
@@ -135,15 +181,22 @@ func (a *Api) acceptPassword(res http.ResponseWriter, req *http.Request, vars ma
 		return
 	}
 
+	a.resetPassword(res, req, conf, rb.Email, rb.Password)
+}
+
+// resetPassword sets the password of the account with the email, and
+// completes the reset confirmation.
+func (a *Api) resetPassword(res http.ResponseWriter, req *http.Request, conf *models.Confirmation, email, password string) {
+	ctx := req.Context()
 	token := a.sl.TokenProvide()
 
-	if usr := a.findExistingUser(ctx, rb.Email, token); usr != nil {
+	if usr := a.findExistingUser(ctx, email, token); usr != nil {
 
-		if err := a.sl.UpdateUser(usr.UserID, shoreline.UserUpdate{Password: &rb.Password}, token); err != nil {
+		if err := a.sl.UpdateUser(usr.UserID, shoreline.UserUpdate{Password: &password}, token); err != nil {
 			a.sendError(ctx, res, http.StatusBadRequest, STATUS_RESET_ERROR, err, "updating user password")
 			return
 		}
-		conf.UpdateStatus(models.StatusCompleted)
+		a.updateStatus(req, conf, models.StatusCompleted)
 		// addOrUpdateConfirmation logs and writes a response on errors
 		if a.addOrUpdateConfirmation(ctx, conf, res) {
 			a.logMetricAsServer("password reset")
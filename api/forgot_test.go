@@ -27,6 +27,24 @@ func TestForgotResponds(t *testing.T) {
 			url:        "/send/forgot/me@myemail.com",
 			respCode:   200,
 		},
+		{
+			// with a preferred locale
+			method:   "POST",
+			url:      "/send/forgot/me@myemail.com",
+			respCode: 200,
+			body: testJSONObject{
+				"locale": "fr-CA",
+			},
+		},
+		{
+			// invalid locale
+			method:   "POST",
+			url:      "/send/forgot/me@myemail.com",
+			respCode: 400,
+			body: testJSONObject{
+				"locale": "not a locale",
+			},
+		},
 		{
 			method:   "PUT",
 			url:      "/accept/forgot",
@@ -68,7 +86,7 @@ func TestForgotResponds(t *testing.T) {
 			store = mockStoreEmpty
 		}
 
-		hydrophone := NewApi(FAKE_CONFIG, nil, store, mockNotifier, mockShoreline, mockGatekeeper, mockMetrics, mockSeagull, nil, mockTemplates, logger)
+		hydrophone := NewApi(FAKE_CONFIG, nil, store, mockShoreline, mockGatekeeper, mockMetrics, mockSeagull, nil, mockTemplates, mockNotifierHealth, logger)
 		hydrophone.SetHandlers("", testRtr)
 
 		var body = &bytes.Buffer{}
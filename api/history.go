@@ -0,0 +1,172 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tidepool-org/go-common/clients/shoreline"
+
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+// ConfirmationHistory is the audit trail of a confirmation.
+type ConfirmationHistory struct {
+	Id        string                `json:"id"`
+	Type      models.Type           `json:"type"`
+	Status    models.Status         `json:"status"`
+	Email     string                `json:"email"`
+	ClinicId  string                `json:"clinicId,omitempty"`
+	CreatorId string                `json:"creatorId"`
+	UserId    string                `json:"userId,omitempty"`
+	Created   time.Time             `json:"created"`
+	Modified  time.Time             `json:"modified"`
+	History   []models.StatusChange `json:"history"`
+}
+
+func newConfirmationHistory(conf *models.Confirmation) *ConfirmationHistory {
+	history := conf.History
+	if history == nil {
+		history = []models.StatusChange{}
+	}
+	return &ConfirmationHistory{
+		Id:        conf.Id,
+		Type:      conf.Type,
+		Status:    conf.Status,
+		Email:     conf.Email,
+		ClinicId:  conf.ClinicId,
+		CreatorId: conf.CreatorId,
+		UserId:    conf.UserId,
+		Created:   conf.Created,
+		Modified:  conf.Modified,
+		History:   history,
+	}
+}
+
+type ctxTokenKey struct{}
+
+// updateStatus sets the status of the confirmation, recording who changed it,
+// from where and through which endpoint in its history.
+func (a *Api) updateStatus(req *http.Request, conf *models.Confirmation, status models.Status) {
+	change := models.StatusChange{
+		SourceIP: a.sourceIP(req),
+		Endpoint: req.Method + " " + req.URL.Path,
+	}
+	if route := mux.CurrentRoute(req); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			change.Endpoint = req.Method + " " + template
+		}
+	}
+	if td, ok := req.Context().Value(ctxTokenKey{}).(*shoreline.TokenData); ok {
+		change.Actor = td.UserID
+		if td.IsServer {
+			change.Actor = models.ActorServer
+		}
+	}
+	conf.UpdateStatusBy(status, change)
+}
+
+// sourceIP returns the address of the client. It's the X-Forwarded-For entry
+// added by the outermost trusted proxy, since the entries before it are set by
+// the client. Requests that didn't come through every trusted proxy use the
+// address they came from.
+func (a *Api) sourceIP(req *http.Request) string {
+	if hops := a.Config.TrustedProxies; hops > 0 {
+		var forwarded []string
+		for _, header := range req.Header.Values("X-Forwarded-For") {
+			forwarded = append(forwarded, strings.Split(header, ",")...)
+		}
+		if len(forwarded) >= hops {
+			if client := strings.TrimSpace(forwarded[len(forwarded)-hops]); client != "" {
+				return client
+			}
+		}
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// Get the status history of a confirmation
+//
+// Only its creator, its recipient, admins of its clinic and servers can read it.
+//
+// status: 200 ConfirmationHistory
+// status: 401 STATUS_NO_TOKEN
+// status: 401 STATUS_UNAUTHORIZED
+// status: 404 STATUS_NOT_FOUND
+func (a *Api) GetConfirmationHistory(res http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if token := a.token(res, req); token != nil {
+		ctx := req.Context()
+		id := vars["confirmationId"]
+
+		conf, err := a.Store.FindConfirmation(ctx, &models.Confirmation{Id: id})
+		if err != nil {
+			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_CONFIRMATION, err)
+			return
+		}
+		if conf == nil || conf.Id != id {
+			a.sendError(ctx, res, http.StatusNotFound, STATUS_NOT_FOUND)
+			return
+		}
+
+		if !token.IsServer && token.UserID != conf.CreatorId && token.UserID != conf.UserId {
+			if conf.ClinicId == "" {
+				a.sendError(ctx, res, http.StatusUnauthorized, STATUS_UNAUTHORIZED)
+				return
+			}
+			if err := a.assertClinicAdmin(ctx, conf.ClinicId, token, res); err != nil {
+				// assertClinicAdmin will log and send a response
+				return
+			}
+		}
+
+		a.sendModelAsResWithStatus(ctx, res, newConfirmationHistory(conf), http.StatusOK)
+	}
+}
+
+// Get the status history of every confirmation of a clinic, a page at a time
+//
+// It takes the same list options as the invitation lists, but since there
+// are no callers relying on getting every confirmation at once, it's always
+// paginated.
+//
+// status: 200 []ConfirmationHistory
+// status: 400 STATUS_ERR_PARSING_LIST_OPTIONS
+// status: 401 STATUS_NO_TOKEN
+// status: 401 STATUS_UNAUTHORIZED - not an admin of the clinic
+func (a *Api) GetClinicConfirmationHistory(res http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if token := a.token(res, req); token != nil {
+		ctx := req.Context()
+		clinicId := vars["clinicId"]
+
+		if err := a.assertClinicAdmin(ctx, clinicId, token, res); err != nil {
+			// assertClinicAdmin will log and send a response
+			return
+		}
+
+		options, err := parseListOptions(req)
+		if err != nil {
+			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_PARSING_LIST_OPTIONS, err)
+			return
+		}
+		if options.pageSize == 0 {
+			options.pageSize = defaultPageSize
+		}
+		confirmations, next, err := a.findPage(ctx, &models.Confirmation{ClinicId: clinicId}, options)
+		if err != nil {
+			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_CONFIRMATION, err)
+			return
+		}
+
+		histories := make([]*ConfirmationHistory, 0, len(confirmations))
+		for _, conf := range confirmations {
+			histories = append(histories, newConfirmationHistory(conf))
+		}
+		setNextLink(res, req, next)
+		a.sendModelAsResWithStatus(ctx, res, histories, http.StatusOK)
+	}
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/tidepool-org/go-common/clients/shoreline"
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+// recordingStore keeps the last confirmation saved, and fails to save it with
+// err if set.
+type recordingStore struct {
+	clients.StoreClient
+	saved *models.Confirmation
+	err   error
+}
+
+func (s *recordingStore) UpsertConfirmation(ctx context.Context, confirmation *models.Confirmation) error {
+	s.saved = confirmation
+	if s.err != nil {
+		return s.err
+	}
+	return s.StoreClient.UpsertConfirmation(ctx, confirmation)
+}
+
+func initTestingHistoryRouter(t *testing.T, store clients.StoreClient, sl shoreline.Client) *mux.Router {
+	t.Helper()
+	cfg := FAKE_CONFIG
+	cfg.TrustedProxies = 1
+	testRtr := mux.NewRouter()
+	hydrophone := NewApi(cfg, nil, store, sl, mockGatekeeper, mockMetrics, mockSeagull, nil, mockTemplates, mockNotifierHealth, testutil.NewLogger(t))
+	hydrophone.SetHandlers("", testRtr)
+	return testRtr
+}
+
+func TestDismissInviteRecordsHistory(t *testing.T) {
+	store := &recordingStore{StoreClient: mockStore}
+	testRtr := initTestingHistoryRouter(t, store, mockShoreline)
+
+	body := &bytes.Buffer{}
+	json.NewEncoder(body).Encode(testJSONObject{"key": "invite-key"})
+	request := MustRequest(t, http.MethodPut, fmt.Sprintf("/confirm/dismiss/invite/%s/%s", testing_uid2, testing_uid1), body)
+	request.Header.Set(TP_SESSION_TOKEN, testing_token)
+	request.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+	response := httptest.NewRecorder()
+	testRtr.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusOK, response.Body)
+	}
+
+	if store.saved == nil || len(store.saved.History) != 1 {
+		t.Fatalf("expected one status change to be saved, got %+v", store.saved)
+	}
+	change := store.saved.History[0]
+	if change.To != models.StatusDeclined || change.Actor != models.ActorServer || change.SourceIP != "203.0.113.7" ||
+		change.Endpoint != "PUT /confirm/dismiss/invite/{userid}/{invitedby}" || change.Time.IsZero() {
+		t.Errorf("non-expected status change %+v", change)
+	}
+}
+
+func TestDismissInviteStatusChanged(t *testing.T) {
+	store := &recordingStore{StoreClient: mockStore, err: clients.ErrStatusChanged}
+	testRtr := initTestingHistoryRouter(t, store, mockShoreline)
+
+	body := &bytes.Buffer{}
+	json.NewEncoder(body).Encode(testJSONObject{"key": "invite-key"})
+	request := MustRequest(t, http.MethodPut, fmt.Sprintf("/confirm/dismiss/invite/%s/%s", testing_uid2, testing_uid1), body)
+	request.Header.Set(TP_SESSION_TOKEN, testing_token)
+	response := httptest.NewRecorder()
+	testRtr.ServeHTTP(response, request)
+	if response.Code != http.StatusConflict {
+		t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusConflict, response.Body)
+	}
+}
+
+func TestSourceIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies int
+		forwarded      []string
+		expected       string
+	}{
+		{name: "no proxies", forwarded: []string{"203.0.113.7"}, expected: "192.0.2.1"},
+		{name: "one proxy", trustedProxies: 1, forwarded: []string{"198.51.100.1, 203.0.113.7"}, expected: "203.0.113.7"},
+		{name: "two proxies", trustedProxies: 2, forwarded: []string{"198.51.100.1, 203.0.113.7", "10.0.0.1"}, expected: "203.0.113.7"},
+		{name: "fewer entries than proxies", trustedProxies: 2, forwarded: []string{"203.0.113.7"}, expected: "192.0.2.1"},
+		{name: "no header", trustedProxies: 1, expected: "192.0.2.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Api{Config: Config{TrustedProxies: test.trustedProxies}}
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, forwarded := range test.forwarded {
+				request.Header.Add("X-Forwarded-For", forwarded)
+			}
+			if ip := a.sourceIP(request); ip != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, ip)
+			}
+		})
+	}
+}
+
+func TestGetConfirmationHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		store    clients.StoreClient
+		sl       shoreline.Client
+		token    string
+		respCode int
+	}{
+		{name: "server", store: mockStore, sl: mockShoreline, token: testing_token, respCode: http.StatusOK},
+		{name: "unrelated user", store: mockStore, sl: mock_uid1Shoreline, token: testing_token_uid1, respCode: http.StatusUnauthorized},
+		{name: "not found", store: mockStoreEmpty, sl: mockShoreline, token: testing_token, respCode: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testRtr := initTestingHistoryRouter(t, test.store, test.sl)
+			request := MustRequest(t, http.MethodGet, "/confirm/v1/confirmations/invite-key/history", nil)
+			request.Header.Set(TP_SESSION_TOKEN, test.token)
+			response := httptest.NewRecorder()
+			testRtr.ServeHTTP(response, request)
+			if response.Code != test.respCode {
+				t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, test.respCode, response.Body)
+			}
+			if response.Code != http.StatusOK {
+				return
+			}
+
+			var history ConfirmationHistory
+			if err := json.NewDecoder(response.Body).Decode(&history); err != nil {
+				t.Fatalf("error decoding response: %s", err)
+			}
+			if history.Id != "invite-key" || history.History == nil {
+				t.Errorf("non-expected history %+v", history)
+			}
+		})
+	}
+}
+
+func TestGetClinicConfirmationHistory(t *testing.T) {
+	store := newPagingStore(defaultPageSize + 1)
+	testRtr := initTestingHistoryRouter(t, store, mockShoreline)
+
+	request := MustRequest(t, http.MethodGet, "/confirm/v1/clinics/clinic-id/invites/history", nil)
+	request.Header.Set(TP_SESSION_TOKEN, testing_token)
+	response := httptest.NewRecorder()
+	testRtr.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusOK, response.Body)
+	}
+
+	var histories []ConfirmationHistory
+	if err := json.NewDecoder(response.Body).Decode(&histories); err != nil {
+		t.Fatalf("error decoding response: %s", err)
+	}
+	if len(histories) != defaultPageSize {
+		t.Errorf("expected a page of %d histories, got %d", defaultPageSize, len(histories))
+	}
+	if link := response.Header().Get("Link"); !nextLinkPattern.MatchString(link) {
+		t.Errorf("expected a next link, got %q", link)
+	}
+}
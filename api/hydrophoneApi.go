@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/kelseyhightower/envconfig"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -21,7 +23,11 @@ import (
 	"github.com/tidepool-org/go-common/clients/shoreline"
 	"github.com/tidepool-org/go-common/clients/status"
 	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/metrics"
 	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/ratelimit"
+	"github.com/tidepool-org/hydrophone/sns"
+	"github.com/tidepool-org/hydrophone/tracing"
 	"github.com/tidepool-org/platform/alerts"
 )
 
@@ -29,13 +35,15 @@ type (
 	Api struct {
 		Store      clients.StoreClient
 		clinics    clinicsClient.ClientWithResponsesInterface
-		notifier   clients.Notifier
-		templates  models.Templates
+		templates  models.TemplateProvider
 		sl         shoreline.Client
 		gatekeeper commonClients.Gatekeeper
 		seagull    commonClients.Seagull
 		metrics    highwater.Client
 		alerts     AlertsClient
+		notifier   clients.NotifierHealth
+		limiter    *ratelimit.Limiter
+		sns        *sns.Verifier
 		baseLogger *zap.SugaredLogger
 		Config     Config
 		mu         sync.Mutex
@@ -45,6 +53,18 @@ type (
 		WebUrl       string `split_words:"true" required:"true"`
 		AssetUrl     string `split_words:"true" required:"true"`
 		Protocol     string `default:"http"`
+		// RateLimit limits the emails sent by unauthenticated requests. A
+		// zero limit disables it.
+		RateLimit ratelimit.Config `split_words:"true"`
+		// SNS controls the SES feedback notifications accepted.
+		SNS sns.Config
+		// Code sets the codes emailed instead of links when they're
+		// requested.
+		Code CodeConfig
+		// TrustedProxies is the number of proxies in front of the service
+		// that append to X-Forwarded-For. Without any, the header is
+		// ignored.
+		TrustedProxies int `split_words:"true" default:"1"`
 	}
 
 	// this just makes it easier to bind a handler for the Handle function
@@ -59,26 +79,30 @@ type AlertsClient interface {
 const (
 	TP_SESSION_TOKEN = "x-tidepool-session-token"
 
-	STATUS_ERR_ACCEPTING_CONFIRMATION = "Error accepting invitation"
-	STATUS_ERR_ADDING_PROFILE         = "Error adding profile"
-	STATUS_ERR_CREATING_ALERTS_CONFIG = "Error creating alerts configuration"
-	STATUS_ERR_CREATING_CONFIRMATION  = "Error creating a confirmation"
-	STATUS_ERR_CREATING_PATIENT       = "Error creating patient"
-	STATUS_ERR_DECODING_CONFIRMATION  = "Error decoding the confirmation"
-	STATUS_ERR_DECODING_CONTEXT       = "Error decoding the confirmation context"
-	STATUS_ERR_DELETING_CONFIRMATION  = "Error deleting a confirmation"
-	STATUS_ERR_FINDING_CLINIC         = "Error finding the clinic"
-	STATUS_ERR_FINDING_CONFIRMATION   = "Error finding the confirmation"
-	STATUS_ERR_MRN_REQUIRED           = "Error creating patient because MRN is required"
-	STATUS_ERR_FINDING_PREVIEW        = "Error finding the invite preview"
-	STATUS_ERR_FINDING_USER           = "Error finding the user"
-	STATUS_ERR_RESETTING_KEY          = "Error resetting key"
-	STATUS_ERR_SAVING_CONFIRMATION    = "Error saving the confirmation"
-	STATUS_ERR_SENDING_EMAIL          = "Error sending email"
-	STATUS_ERR_SETTING_PERMISSIONS    = "Error setting permissions"
-	STATUS_ERR_UPDATING_CONFIRMATION  = "Error updating confirmation"
-	STATUS_ERR_UPDATING_USER          = "Error updating user"
-	STATUS_ERR_VALIDATING_CONTEXT     = "Error validating the confirmation context"
+	STATUS_ERR_ACCEPTING_CONFIRMATION    = "Error accepting invitation"
+	STATUS_ERR_ADDING_PROFILE            = "Error adding profile"
+	STATUS_ERR_CREATING_ALERTS_CONFIG    = "Error creating alerts configuration"
+	STATUS_ERR_CREATING_CONFIRMATION     = "Error creating a confirmation"
+	STATUS_ERR_CREATING_PATIENT          = "Error creating patient"
+	STATUS_ERR_DECODING_CONFIRMATION     = "Error decoding the confirmation"
+	STATUS_ERR_DECODING_CONTEXT          = "Error decoding the confirmation context"
+	STATUS_ERR_DECODING_TEMPLATE_CONTENT = "Error decoding the template content"
+	STATUS_ERR_DELETING_CONFIRMATION     = "Error deleting a confirmation"
+	STATUS_ERR_FINDING_CLINIC            = "Error finding the clinic"
+	STATUS_ERR_FINDING_CONFIRMATION      = "Error finding the confirmation"
+	STATUS_ERR_MRN_REQUIRED              = "Error creating patient because MRN is required"
+	STATUS_ERR_FINDING_PREVIEW           = "Error finding the invite preview"
+	STATUS_ERR_FINDING_TEMPLATE          = "Error finding the template"
+	STATUS_ERR_FINDING_USER              = "Error finding the user"
+	STATUS_ERR_RENDERING_TEMPLATE        = "Error rendering the template"
+	STATUS_ERR_RESETTING_KEY             = "Error resetting key"
+	STATUS_ERR_SAVING_CONFIRMATION       = "Error saving the confirmation"
+	STATUS_CONFIRMATION_CHANGED          = "The confirmation was changed by another request"
+	STATUS_ERR_SENDING_EMAIL             = "Error sending email"
+	STATUS_ERR_SETTING_PERMISSIONS       = "Error setting permissions"
+	STATUS_ERR_UPDATING_CONFIRMATION     = "Error updating confirmation"
+	STATUS_ERR_UPDATING_USER             = "Error updating user"
+	STATUS_ERR_VALIDATING_CONTEXT        = "Error validating the confirmation context"
 
 	STATUS_EXISTING_SIGNUP   = "User already has an existing valid signup confirmation"
 	STATUS_INVALID_BIRTHDAY  = "Birthday specified is invalid"
@@ -111,26 +135,28 @@ func NewApi(
 	cfg Config,
 	clinics clinicsClient.ClientWithResponsesInterface,
 	store clients.StoreClient,
-	ntf clients.Notifier,
 	sl shoreline.Client,
 	gatekeeper commonClients.Gatekeeper,
 	metrics highwater.Client,
 	seagull commonClients.Seagull,
 	alerts AlertsClient,
-	templates models.Templates,
+	templates models.TemplateProvider,
+	notifierHealth clients.NotifierHealth,
 	logger *zap.SugaredLogger,
 ) *Api {
 	return &Api{
 		Store:      store,
 		Config:     cfg,
 		clinics:    clinics,
-		notifier:   ntf,
 		sl:         sl,
 		gatekeeper: gatekeeper,
 		metrics:    metrics,
 		seagull:    seagull,
 		alerts:     alerts,
 		templates:  templates,
+		notifier:   notifierHealth,
+		limiter:    ratelimit.New(cfg.RateLimit, store),
+		sns:        sns.NewVerifier(cfg.SNS, nil),
 		baseLogger: logger,
 	}
 }
@@ -149,11 +175,20 @@ func apiConfigProvider() (Config, error) {
 	if err != nil {
 		return Config{}, err
 	}
+	if err := config.SNS.Validate(); err != nil {
+		return Config{}, err
+	}
+	if err := config.Code.Validate(); err != nil {
+		return Config{}, err
+	}
 	return config, nil
 }
 
-func routerProvider(api *Api) *mux.Router {
+func routerProvider(api *Api, m *metrics.Metrics, provider trace.TracerProvider) *mux.Router {
 	rtr := mux.NewRouter()
+	rtr.Use(tracing.Middleware(provider))
+	rtr.Use(m.Middleware)
+	rtr.Handle("/metrics", m.Handler()).Methods("GET")
 	api.SetHandlers("", rtr)
 	return rtr
 }
@@ -200,7 +235,7 @@ func (a *Api) cloneLogger() *zap.SugaredLogger {
 func (a *Api) ctxLoggerHandler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origCtx := r.Context()
-		ctxLog := a.cloneLogger()
+		ctxLog := a.cloneLogger().Desugar().With(tracing.LogFields(origCtx)...).Sugar()
 		ctxWithLog := context.WithValue(origCtx, ctxLoggerKey{}, ctxLog)
 		rWithLog := r.WithContext(ctxWithLog)
 		h.ServeHTTP(w, rWithLog)
@@ -262,6 +297,14 @@ func (a *Api) SetHandlers(prefix string, rtr *mux.Router) {
 	accept.Handle("/forgot", vars(a.acceptPassword)).Methods("PUT")
 	accept.Handle("/invite/{userid}/{invitedby}", vars(a.AcceptInvite)).Methods("PUT")
 
+	// PUT /confirm/v1/accept/signup
+	// PUT /confirm/v1/accept/forgot
+	c.Handle("/v1/accept/signup", vars(a.acceptSignUpCode)).Methods("PUT")
+	c.Handle("/v1/accept/forgot", vars(a.acceptPasswordCode)).Methods("PUT")
+
+	rtr.Handle("/v1/accept/signup", vars(a.acceptSignUpCode)).Methods("PUT")
+	rtr.Handle("/v1/accept/forgot", vars(a.acceptPasswordCode)).Methods("PUT")
+
 	// GET /confirm/signup/:userid
 	// GET /confirm/invite/:userid
 	c.Handle("/signup/{userid}", vars(a.getSignUp)).Methods("GET")
@@ -315,14 +358,46 @@ func (a *Api) SetHandlers(prefix string, rtr *mux.Router) {
 	rtr.Handle("/v1/clinicians/{userId}/invites/{inviteId}", vars(a.DismissClinicianInvite)).Methods("DELETE")
 
 	c.Handle("/v1/clinics/{clinicId}/invites/clinicians", vars(a.SendClinicianInvite)).Methods("POST")
+	c.Handle("/v1/clinics/{clinicId}/invites/clinicians/batch", vars(a.SendClinicianInviteBatch)).Methods("POST")
 	c.Handle("/v1/clinics/{clinicId}/invites/clinicians/{inviteId}", vars(a.ResendClinicianInvite)).Methods("PATCH")
 	c.Handle("/v1/clinics/{clinicId}/invites/clinicians/{inviteId}", vars(a.GetClinicianInvite)).Methods("GET")
 	c.Handle("/v1/clinics/{clinicId}/invites/clinicians/{inviteId}", vars(a.CancelClinicianInvite)).Methods("DELETE")
 
 	rtr.Handle("/v1/clinics/{clinicId}/invites/clinicians", vars(a.SendClinicianInvite)).Methods("POST")
+	rtr.Handle("/v1/clinics/{clinicId}/invites/clinicians/batch", vars(a.SendClinicianInviteBatch)).Methods("POST")
 	rtr.Handle("/v1/clinics/{clinicId}/invites/clinicians/{inviteId}", vars(a.GetClinicianInvite)).Methods("GET")
 	rtr.Handle("/v1/clinics/{clinicId}/invites/clinicians/{inviteId}", vars(a.ResendClinicianInvite)).Methods("PATCH")
 	rtr.Handle("/v1/clinics/{clinicId}/invites/clinicians/{inviteId}", vars(a.CancelClinicianInvite)).Methods("DELETE")
+
+	// GET /confirm/v1/confirmations/:confirmationId/history
+	// GET /confirm/v1/clinics/:clinicId/invites/history
+	c.Handle("/v1/confirmations/{confirmationId}/history", vars(a.GetConfirmationHistory)).Methods("GET")
+	c.Handle("/v1/clinics/{clinicId}/invites/history", vars(a.GetClinicConfirmationHistory)).Methods("GET")
+
+	rtr.Handle("/v1/confirmations/{confirmationId}/history", vars(a.GetConfirmationHistory)).Methods("GET")
+	rtr.Handle("/v1/clinics/{clinicId}/invites/history", vars(a.GetClinicConfirmationHistory)).Methods("GET")
+
+	// GET /confirm/templates
+	// POST /confirm/templates/:templateName/render
+	c.HandleFunc("/templates", a.GetTemplates).Methods("GET")
+	c.Handle("/templates/{templateName}/render", vars(a.RenderTemplate)).Methods("POST")
+
+	rtr.HandleFunc("/templates", a.GetTemplates).Methods("GET")
+	rtr.Handle("/templates/{templateName}/render", vars(a.RenderTemplate)).Methods("POST")
+
+	// POST /confirm/v1/ses/notifications
+	// GET /confirm/v1/suppressions/:email
+	// PUT /confirm/v1/suppressions/:email
+	// DELETE /confirm/v1/suppressions/:email
+	c.HandleFunc("/v1/ses/notifications", a.ReceiveSESNotification).Methods("POST")
+	c.Handle("/v1/suppressions/{email}", vars(a.GetSuppression)).Methods("GET")
+	c.Handle("/v1/suppressions/{email}", vars(a.AddSuppression)).Methods("PUT")
+	c.Handle("/v1/suppressions/{email}", vars(a.RemoveSuppression)).Methods("DELETE")
+
+	rtr.HandleFunc("/v1/ses/notifications", a.ReceiveSESNotification).Methods("POST")
+	rtr.Handle("/v1/suppressions/{email}", vars(a.GetSuppression)).Methods("GET")
+	rtr.Handle("/v1/suppressions/{email}", vars(a.AddSuppression)).Methods("PUT")
+	rtr.Handle("/v1/suppressions/{email}", vars(a.RemoveSuppression)).Methods("DELETE")
 }
 
 func (h varsHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
@@ -336,6 +411,14 @@ func (a *Api) IsReady(res http.ResponseWriter, req *http.Request) {
 		a.sendError(ctx, res, http.StatusInternalServerError, "store connectivity failure", err)
 		return
 	}
+	if err := a.Store.CheckMigrations(ctx); err != nil {
+		a.sendError(ctx, res, http.StatusInternalServerError, "store migrations pending", err)
+		return
+	}
+	if err := a.notifier.Err(); err != nil {
+		a.sendError(ctx, res, http.StatusInternalServerError, "notifier self-test failure", err)
+		return
+	}
 	res.WriteHeader(http.StatusOK)
 	res.Write([]byte(STATUS_OK))
 }
@@ -348,7 +431,10 @@ func (a *Api) IsAlive(res http.ResponseWriter, req *http.Request) {
 // Save this confirmation or
 // write an error if it all goes wrong
 func (a *Api) addOrUpdateConfirmation(ctx context.Context, conf *models.Confirmation, res http.ResponseWriter) bool {
-	if err := a.Store.UpsertConfirmation(ctx, conf); err != nil {
+	if err := a.Store.UpsertConfirmation(ctx, conf); errors.Is(err, clients.ErrStatusChanged) {
+		a.sendError(ctx, res, http.StatusConflict, STATUS_CONFIRMATION_CHANGED, err)
+		return false
+	} else if err != nil {
 		a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_SAVING_CONFIRMATION, err)
 		return false
 	}
@@ -378,8 +464,63 @@ func (a *Api) addProfileInfoToConfirmations(ctx context.Context, results []*mode
 	return results
 }
 
-// Generate a notification from the given confirmation,write the error if it fails
-func (a *Api) createAndSendNotification(req *http.Request, conf *models.Confirmation, content map[string]interface{}, recipients ...string) bool {
+// notificationLocales returns the locales to try for the notification of the
+// given confirmation, in order of preference: the locale requested when the
+// confirmation was created, the recipient's display language preference, then
+// the request's Accept-Language header.
+func (a *Api) notificationLocales(req *http.Request, conf *models.Confirmation) []models.Locale {
+	var locales []models.Locale
+	if conf.Locale != "" {
+		locales = append(locales, conf.Locale)
+	}
+
+	if conf.UserId != "" {
+		preferences := &struct {
+			DisplayLanguageCode string `json:"displayLanguageCode"`
+		}{}
+		if err := a.seagull.GetCollection(conf.UserId, "preferences", a.sl.TokenProvide(), preferences); err != nil {
+			a.logger(req.Context()).With(zap.Error(err)).Debug("getting preferences")
+		} else if preferences.DisplayLanguageCode != "" {
+			if locale, err := models.ParseLocale(preferences.DisplayLanguageCode); err == nil {
+				locales = append(locales, locale)
+			}
+		}
+	}
+
+	return append(locales, models.ParseAcceptLanguage(req.Header.Get("Accept-Language"))...)
+}
+
+// parseLocale validates the optional locale of a request body.
+func parseLocale(value string) (models.Locale, error) {
+	if value == "" {
+		return "", nil
+	}
+	return models.ParseLocale(value)
+}
+
+// renderNotification executes the best translation of the named template for
+// the given locales, returning the subject, the HTML and plain text bodies, and
+// the locale of the translation used. The WebURL and AssetURL of the content
+// are set from the request and configuration.
+func (a *Api) renderNotification(req *http.Request, templateName models.TemplateName, locales []models.Locale, content models.TemplateContent) (string, string, string, models.Locale, error) {
+	content.Base().WebURL = a.getWebURL(req)
+	content.Base().AssetURL = a.Config.AssetUrl
+
+	subject, body, text, locale, err := models.RenderTemplate(a.templates, templateName, locales, content)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	a.logger(req.Context()).With(zap.String("template", string(templateName)), zap.String("locale", locale.String())).
+		Debug("using template")
+	return subject, body, text, locale, nil
+}
+
+// Generate a notification from the given confirmation and queue it in the
+// outbox for delivery, write the error if it fails
+//
+// The email itself is sent in the background by the outbox dispatcher, so a
+// true result only means the message was stored.
+func (a *Api) createAndSendNotification(req *http.Request, conf *models.Confirmation, content models.TemplateContent, recipients ...string) bool {
 	ctx := req.Context()
 	templateName := conf.TemplateName
 	if templateName == models.TemplateNameUndefined {
@@ -405,22 +546,6 @@ func (a *Api) createAndSendNotification(req *http.Request, conf *models.Confirma
 		}
 	}
 
-	content["WebURL"] = a.getWebURL(req)
-	content["AssetURL"] = a.Config.AssetUrl
-
-	template, ok := a.templates[templateName]
-	if !ok {
-		a.logger(ctx).With(zap.String("template", string(templateName))).
-			Info("unknown template type")
-		return false
-	}
-
-	subject, body, err := template.Execute(content)
-	if err != nil {
-		a.logger(ctx).With(zap.Error(err)).Error("executing email template")
-		return false
-	}
-
 	addresses := recipients
 	if conf.Email != "" {
 		addresses = append(recipients, conf.Email)
@@ -429,13 +554,25 @@ func (a *Api) createAndSendNotification(req *http.Request, conf *models.Confirma
 		return true
 	}
 
-	if status, details := a.notifier.Send(addresses, subject, body); status != http.StatusOK {
-		a.logger(ctx).Errorw(
-			"error sending email",
+	subject, body, text, _, err := a.renderNotification(req, templateName, a.notificationLocales(req, conf), content)
+	if err != nil {
+		a.logger(ctx).With(zap.Error(err), zap.String("template", string(templateName))).
+			Error("rendering email template")
+		return false
+	}
+
+	message, err := models.NewOutboxMessage(templateName, addresses, subject, body, text)
+	if err != nil {
+		a.logger(ctx).With(zap.Error(err)).Error("creating outbox message")
+		return false
+	}
+	message.ConfirmationId = conf.Id
+
+	if err := a.Store.EnqueueMessage(ctx, message); err != nil {
+		a.logger(ctx).With(zap.Error(err)).Errorw(
+			"error queueing email",
 			"email", addresses,
 			"subject", subject,
-			"status", status,
-			"message", details,
 		)
 		return false
 	}
@@ -444,7 +581,8 @@ func (a *Api) createAndSendNotification(req *http.Request, conf *models.Confirma
 
 // find and validate the token
 //
-// The token's userID field is added to the context's logger.
+// The token's userID field is added to the context's logger, and the token to
+// the context, so that status changes can be attributed to it.
 func (a *Api) token(res http.ResponseWriter, req *http.Request) *shoreline.TokenData {
 	ctx := req.Context()
 	if token := req.Header.Get(TP_SESSION_TOKEN); token != "" {
@@ -461,7 +599,8 @@ func (a *Api) token(res http.ResponseWriter, req *http.Request) *shoreline.Token
 		if td.IsServer {
 			ctxLog = a.logger(ctx).With(zap.String("token's userID", "<server>"))
 		}
-		*req = *req.WithContext(context.WithValue(ctx, ctxLoggerKey{}, ctxLog))
+		ctx = context.WithValue(ctx, ctxLoggerKey{}, ctxLog)
+		*req = *req.WithContext(context.WithValue(ctx, ctxTokenKey{}, td))
 
 		return td
 	}
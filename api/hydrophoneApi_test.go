@@ -64,7 +64,9 @@ var (
 	)
 
 	// MockTemplates
-	MockTemplatesModule = fx.Options(fx.Supply(models.Templates{}))
+	MockTemplatesModule = fx.Options(fx.Provide(func() models.TemplateProvider { return models.Templates{} }))
+
+	MockNotifierHealthModule = fx.Options(fx.Provide(func() clients.NotifierHealth { return clients.MockNotifierHealth{} }))
 
 	//MockNoPermsGatekeeperModule mocks gatekeeper
 	MockNoPermsGatekeeperModule = fx.Options(fx.Provide(func() commonClients.Gatekeeper {
@@ -77,12 +79,12 @@ var (
 
 	BaseModuleWithLog = func(rw io.ReadWriter) fx.Option {
 		return fx.Options(
-			clients.MockNotifierModule,
 			MockShorelineModule,
 			MockMetricsModule,
 			MockSeagullModule,
 			MockAlertsModule,
 			MockTemplatesModule,
+			MockNotifierHealthModule,
 			MockConfigModule,
 			fx.Supply(fx.Annotate(rw, fx.As(new(io.ReadWriter)))),
 			fx.Provide(testutil.NewLoggerWithReadWriter),
@@ -152,6 +154,27 @@ func TestGetStatus_StatusInternalServerError(t *testing.T) {
 	}
 }
 
+func TestGetStatus_NotifierUnhealthy(t *testing.T) {
+	hydrophone := NewApi(FAKE_CONFIG, nil, mockStore, mockShoreline, mockGatekeeper, mockMetrics, mockSeagull, nil, mockTemplates, unhealthyNotifier{}, testutil.NewLogger(t))
+
+	request := MustRequest(t, "GET", "/ready", nil)
+	response := httptest.NewRecorder()
+	hydrophone.IsReady(response, request)
+
+	if response.Code != http.StatusInternalServerError {
+		t.Fatalf("Resp given [%d] expected [%d] ", response.Code, http.StatusInternalServerError)
+	}
+	if body := response.Body.String(); body != `{"code":500,"reason":"notifier self-test failure"}` {
+		t.Fatalf("Message given [%s] expected [%s] ", body, "notifier self-test failure")
+	}
+}
+
+type unhealthyNotifier struct{}
+
+func (unhealthyNotifier) Err() error {
+	return errors.New("unreachable")
+}
+
 func (i *testJSONObject) deepCompare(j *testJSONObject) string {
 	for k := range *i {
 		if reflect.DeepEqual((*i)[k], (*j)[k]) == false {
@@ -27,7 +27,8 @@ const (
 
 // Invite details for generating a new invite
 type inviteBody struct {
-	Email string `json:"email"`
+	Email  string `json:"email"`
+	Locale string `json:"locale,omitempty"`
 	models.CareTeamContext
 	// UnmarshalJSON prevents inviteBody from inheriting it from
 	// CareTeamContext.
@@ -90,9 +91,11 @@ func (a *Api) checkAccountAlreadySharedWithUser(ctx context.Context, invitorID,
 
 //Get list of received invitations for logged in user.
 //These are invitations that have been sent to this user but not yet acted upon.
+//The list is paginated, filtered and sorted by the parseListOptions query.
 
 // status: 200
 // status: 400
+// status: 400 STATUS_ERR_PARSING_LIST_OPTIONS
 func (a *Api) GetReceivedInvitations(res http.ResponseWriter, req *http.Request, vars map[string]string) {
 	if token := a.token(res, req); token != nil {
 		ctx := req.Context()
@@ -109,18 +112,24 @@ func (a *Api) GetReceivedInvitations(res http.ResponseWriter, req *http.Request,
 			return
 		}
 
+		inviteType := models.TypeCareteamInvite
+		inviteStatus := models.StatusPending
+		options, err := parseListOptions(req, inviteStatus)
+		if err != nil {
+			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_PARSING_LIST_OPTIONS, err)
+			return
+		}
+
 		invitedUsr := a.findExistingUser(ctx, inviteeID, req.Header.Get(TP_SESSION_TOKEN))
 
 		// Populate userId of the confirmations for this user's userId if is not set. This will allow us to query by userId.
-		inviteType := models.TypeCareteamInvite
-		inviteStatus := models.StatusPending
 		if err := a.addUserIdsToUserlessInvites(ctx, invitedUsr, inviteType, inviteStatus); err != nil {
 			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_UPDATING_CONFIRMATION, err)
 			return
 		}
 
 		//find all oustanding invites were this user is the invite//
-		found, err := a.Store.FindConfirmations(ctx, &models.Confirmation{UserId: invitedUsr.UserID, Type: inviteType}, inviteStatus)
+		found, next, err := a.findPage(ctx, &models.Confirmation{UserId: invitedUsr.UserID, Type: inviteType}, options)
 		if err != nil {
 			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_CONFIRMATION, err,
 				"while finding pending invites")
@@ -133,6 +142,7 @@ func (a *Api) GetReceivedInvitations(res http.ResponseWriter, req *http.Request,
 		if invites := a.addProfileInfoToConfirmations(ctx, found); invites != nil {
 			a.ensureIdSet(ctx, inviteeID, invites)
 			a.logMetric("get received invites", req)
+			setNextLink(res, req, next)
 			a.sendModelAsResWithStatus(ctx, res, invites, http.StatusOK)
 			a.logger(ctx).Debugf("invites found and checked: %d", len(invites))
 			return
@@ -143,9 +153,11 @@ func (a *Api) GetReceivedInvitations(res http.ResponseWriter, req *http.Request,
 // Get the still-pending invitations for a group you own or are an admin of.
 // These are the invitations you have sent that have not been accepted.
 // There is no way to tell if an invitation has been ignored.
+// The list is paginated, filtered and sorted by the parseListOptions query.
 //
 // status: 200
 // status: 400
+// status: 400 STATUS_ERR_PARSING_LIST_OPTIONS
 func (a *Api) GetSentInvitations(res http.ResponseWriter, req *http.Request, vars map[string]string) {
 	if token := a.token(res, req); token != nil {
 		ctx := req.Context()
@@ -165,7 +177,12 @@ func (a *Api) GetSentInvitations(res http.ResponseWriter, req *http.Request, var
 		}
 
 		//find all invites I have sent that are pending or declined
-		found, err := a.Store.FindConfirmations(ctx, &models.Confirmation{CreatorId: invitorID, Type: models.TypeCareteamInvite}, models.StatusPending, models.StatusDeclined)
+		options, err := parseListOptions(req, models.StatusPending, models.StatusDeclined)
+		if err != nil {
+			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_PARSING_LIST_OPTIONS, err)
+			return
+		}
+		found, next, err := a.findPage(ctx, &models.Confirmation{CreatorId: invitorID, Type: models.TypeCareteamInvite}, options)
 		if err != nil {
 			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_CONFIRMATION, err)
 			return
@@ -176,6 +193,7 @@ func (a *Api) GetSentInvitations(res http.ResponseWriter, req *http.Request, var
 		}
 		if invitations := a.addProfileInfoToConfirmations(ctx, found); invitations != nil {
 			a.logMetric("get sent invites", req)
+			setNextLink(res, req, next)
 			a.sendModelAsResWithStatus(ctx, res, invitations, http.StatusOK)
 			return
 		}
@@ -214,9 +232,9 @@ func (a *Api) AcceptInvite(res http.ResponseWriter, req *http.Request, vars map[
 			return
 		}
 
-		if accept.Key == "" {
+		if accept.Key == "" && accept.Id == "" {
 			res.WriteHeader(http.StatusBadRequest)
-			a.logger(ctx).Info("no confirmation key set")
+			a.logger(ctx).Info("no confirmation key or id set")
 			return
 		}
 
@@ -270,7 +288,7 @@ func (a *Api) AcceptInvite(res http.ResponseWriter, req *http.Request, vars map[
 				return
 			}
 		}
-		conf.UpdateStatus(models.StatusCompleted)
+		a.updateStatus(req, conf, models.StatusCompleted)
 		// addOrUpdateConfirmation logs and writes a response on errors
 		if !a.addOrUpdateConfirmation(ctx, conf, res) {
 			return
@@ -320,7 +338,7 @@ func (a *Api) CancelInvite(res http.ResponseWriter, req *http.Request, vars map[
 		}
 		if conf != nil {
 			//cancel the invite
-			conf.UpdateStatus(models.StatusCanceled)
+			a.updateStatus(req, conf, models.StatusCanceled)
 			// addOrUpdateConfirmation logs and writes a response on errors
 			if a.addOrUpdateConfirmation(ctx, conf, res) {
 				a.logMetric("canceled invite", req)
@@ -358,7 +376,7 @@ func (a *Api) DismissInvite(res http.ResponseWriter, req *http.Request, vars map
 			return
 		}
 
-		if dismiss.Key == "" {
+		if dismiss.Key == "" && dismiss.Id == "" {
 			res.WriteHeader(http.StatusBadRequest)
 			return
 		}
@@ -369,7 +387,7 @@ func (a *Api) DismissInvite(res http.ResponseWriter, req *http.Request, vars map
 			return
 		}
 		if conf != nil {
-			conf.UpdateStatus(models.StatusDeclined)
+			a.updateStatus(req, conf, models.StatusDeclined)
 			// addOrUpdateConfirmation logs and writes a response on errors
 			if a.addOrUpdateConfirmation(ctx, conf, res) {
 				a.logMetric("dismissinvite", req)
@@ -424,6 +442,12 @@ func (a *Api) SendInvite(res http.ResponseWriter, req *http.Request, vars map[st
 		return
 	}
 
+	locale, err := parseLocale(ib.Locale)
+	if err != nil {
+		a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION, err)
+		return
+	}
+
 	if a.checkForDuplicateInvite(ctx, ib.Email, invitorID) {
 		a.sendError(ctx, res, http.StatusConflict, statusExistingInviteMessage,
 			zap.String("email", ib.Email))
@@ -470,6 +494,7 @@ func (a *Api) SendInvite(res http.ResponseWriter, req *http.Request, vars map[st
 	}
 
 	invite.Email = ib.Email
+	invite.Locale = locale
 	if invitedUsr != nil {
 		// Not sure if need to another checkForDuplicateInvite here but by userId.
 		// I suppose it's unlikely person A would invite person B, B accepts, B changes their email,
@@ -502,11 +527,10 @@ func (a *Api) SendInvite(res http.ResponseWriter, req *http.Request, vars map[st
 		webPath = "login"
 	}
 
-	emailContent := map[string]interface{}{
-		"CareteamName": fullName,
-		"Email":        invite.Email,
-		"WebPath":      webPath,
-		"Nickname":     ib.Nickname,
+	emailContent := &models.CareteamInviteContent{
+		CareteamName: fullName,
+		Email:        invite.Email,
+		WebPath:      webPath,
 	}
 
 	if a.createAndSendNotification(req, invite, emailContent) {
@@ -532,7 +556,7 @@ func (a *Api) ResendInvite(res http.ResponseWriter, req *http.Request, vars map[
 		}
 
 		find := &models.Confirmation{
-			Key:    inviteId,
+			Id:     inviteId,
 			Status: models.StatusPending,
 			Type:   models.TypeCareteamInvite,
 		}
@@ -564,6 +588,9 @@ func (a *Api) ResendInvite(res http.ResponseWriter, req *http.Request, vars map[
 		// addOrUpdateConfirmation logs and writes a response on errors
 		if a.addOrUpdateConfirmation(ctx, invite, res) {
 			a.logMetric("invite updated", req)
+			if err := a.Store.ResetReminders(ctx, invite.Id); err != nil {
+				a.logger(ctx).With(zap.Error(err)).Warn("resetting invite reminders")
+			}
 
 			if err := a.addProfile(invite); err != nil {
 				a.logger(ctx).With(zap.Error(err)).Warn(STATUS_ERR_ADDING_PROFILE)
@@ -578,10 +605,10 @@ func (a *Api) ResendInvite(res http.ResponseWriter, req *http.Request, vars map[
 					webPath = "login"
 				}
 
-				emailContent := map[string]interface{}{
-					"CareteamName": fullName,
-					"Email":        invite.Email,
-					"WebPath":      webPath,
+				emailContent := &models.CareteamInviteContent{
+					CareteamName: fullName,
+					Email:        invite.Email,
+					WebPath:      webPath,
 				}
 
 				if a.createAndSendNotification(req, invite, emailContent) {
@@ -24,13 +24,13 @@ func initTestingRouterNoPerms(t *testing.T) *mux.Router {
 		FAKE_CONFIG,
 		nil,
 		mockStore,
-		mockNotifier,
 		mock_uid1Shoreline,
 		mock_NoPermsGatekeeper,
 		mockMetrics,
 		mockSeagull,
 		nil,
 		mockTemplates,
+		mockNotifierHealth,
 		testutil.NewLogger(t),
 	)
 	hydrophone.SetHandlers("", testRtr)
@@ -259,13 +259,13 @@ func TestInviteResponds(t *testing.T) {
 			FAKE_CONFIG,
 			nil,
 			store,
-			mockNotifier,
 			mockShoreline,
 			mockGatekeeper,
 			mockMetrics,
 			mockSeagull,
 			nil,
 			mockTemplates,
+			mockNotifierHealth,
 			logger,
 		)
 
@@ -320,13 +320,13 @@ func TestInviteCanAddAlerting(t *testing.T) {
 		FAKE_CONFIG,
 		nil,
 		mockStoreAlerting,
-		mockNotifier,
 		mockShorelineAlerting,
 		mockGatekeeperAlerting,
 		mockMetrics,
 		mockSeagull,
 		nil,
 		mockTemplates,
+		mockNotifierHealth,
 		testutil.NewLogger(t),
 	)
 	testRtr := mux.NewRouter()
@@ -393,13 +393,13 @@ func TestAcceptInviteAlertsConfigRequiresFollowPerm(t *testing.T) {
 		FAKE_CONFIG,
 		nil,
 		mockStoreAlerting,
-		mockNotifier,
 		mockShorelineAlerting,
 		mockGatekeeperAlerting,
 		mockMetrics,
 		mockSeagull,
 		newMockAlertsClientWithFailingUpsert(),
 		mockTemplates,
+		mockNotifierHealth,
 		testutil.NewLogger(t),
 	)
 	c := &models.Confirmation{
@@ -453,13 +453,13 @@ func TestAcceptInviteAlertsConfigOptional(t *testing.T) {
 		FAKE_CONFIG,
 		nil,
 		mockStoreAlerting,
-		mockNotifier,
 		mockShorelineAlerting,
 		mockGatekeeperAlerting,
 		mockMetrics,
 		mockSeagull,
 		newMockAlertsClientWithFailingUpsert(),
 		mockTemplates,
+		mockNotifierHealth,
 		testutil.NewLogger(t),
 	)
 	c := &models.Confirmation{
@@ -515,13 +515,13 @@ func TestInviteAddingAlertingMergesPerms(t *testing.T) {
 		FAKE_CONFIG,
 		nil,
 		mockStoreAlerting,
-		mockNotifier,
 		mockShorelineAlerting,
 		mockGatekeeperAlerting,
 		mockMetrics,
 		mockSeagull,
 		nil,
 		mockTemplates,
+		mockNotifierHealth,
 		testutil.NewLogger(t),
 	)
 	testRtr := mux.NewRouter()
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+const STATUS_ERR_PARSING_LIST_OPTIONS = "Error parsing the list options"
+
+const (
+	// defaultPageSize is the number of invitations listed when a cursor is
+	// given without a limit. Without either, every invitation is listed, as
+	// it was before the lists were paginated.
+	defaultPageSize = 100
+	// maxPageSize is the most invitations listed at once.
+	maxPageSize = 1000
+)
+
+// listOptions are the pagination, filtering and sorting options of an
+// invitation list.
+type listOptions struct {
+	filter   clients.FilterOpts
+	statuses []models.Status
+	// pageSize is zero when every invitation is listed.
+	pageSize int
+}
+
+// parseListOptions parses the query parameters of an invitation list. The
+// invitations with one of defaultStatuses are listed unless the status is
+// given.
+//
+//   - limit: the page size, up to maxPageSize. Without it or a cursor, every
+//     invitation is listed.
+//   - cursor: continues from the previous page's next link
+//   - status: may be repeated, or comma separated
+//   - createdAfter, createdBefore, modifiedAfter, modifiedBefore: RFC 3339
+//     times, excluded from the range
+//   - sort: created, -created (the default), modified or -modified
+func parseListOptions(req *http.Request, defaultStatuses ...models.Status) (*listOptions, error) {
+	query := req.URL.Query()
+	options := &listOptions{statuses: defaultStatuses}
+
+	if limit := query.Get("limit"); limit != "" {
+		size, err := strconv.Atoi(limit)
+		if err != nil || size < 1 || size > maxPageSize {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		options.pageSize = size
+	}
+
+	if values := query["status"]; len(values) > 0 {
+		options.statuses = nil
+		for _, value := range strings.Split(strings.Join(values, ","), ",") {
+			status := models.Status(strings.TrimSpace(value))
+			if !slices.Contains(models.Statuses, status) {
+				return nil, fmt.Errorf("unknown status %q", value)
+			}
+			options.statuses = append(options.statuses, status)
+		}
+	}
+
+	times := map[string]*time.Time{
+		"createdAfter":   &options.filter.CreatedAfter,
+		"createdBefore":  &options.filter.CreatedBefore,
+		"modifiedAfter":  &options.filter.ModifiedAfter,
+		"modifiedBefore": &options.filter.ModifiedBefore,
+	}
+	for name, field := range times {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an RFC 3339 time", name)
+			}
+			*field = parsed
+		}
+	}
+
+	if sort := clients.SortOrder(query.Get("sort")); sort != "" {
+		if !slices.Contains(clients.SortOrders, sort) {
+			return nil, fmt.Errorf("unknown sort order %q", sort)
+		}
+		options.filter.Sort = sort
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := clients.ParseCursor(value)
+		if err != nil {
+			return nil, err
+		}
+		if options.filter.Sort != "" && options.filter.Sort != cursor.Sort {
+			return nil, fmt.Errorf("the cursor is for the %q sort order", cursor.Sort)
+		}
+		options.filter.After = cursor
+		if options.pageSize == 0 {
+			options.pageSize = defaultPageSize
+		}
+	}
+	return options, nil
+}
+
+// findPage finds a page of the confirmations matching the filter, and the
+// cursor of the next page, which is nil if it's the last. Without a page size,
+// they're all found.
+func (a *Api) findPage(ctx context.Context, filter *models.Confirmation, options *listOptions) ([]*models.Confirmation, *clients.Cursor, error) {
+	opts := options.filter
+	if options.pageSize == 0 {
+		found, err := a.Store.FindConfirmationsWithOpts(ctx, filter, opts, options.statuses...)
+		return found, nil, err
+	}
+	// An extra confirmation is found to tell if there's another page.
+	opts.Limit = options.pageSize + 1
+	found, err := a.Store.FindConfirmationsWithOpts(ctx, filter, opts, options.statuses...)
+	if err != nil || len(found) <= options.pageSize {
+		return found, nil, err
+	}
+
+	found = found[:options.pageSize]
+	sort := opts.Sort
+	if opts.After != nil {
+		sort = opts.After.Sort
+	}
+	return found, clients.NewCursor(sort, found[len(found)-1]), nil
+}
+
+// setNextLink links the response to the next page, if there is one, with the
+// same query as the request.
+func setNextLink(res http.ResponseWriter, req *http.Request, next *clients.Cursor) {
+	if next == nil {
+		return
+	}
+	query := req.URL.Query()
+	query.Set("cursor", next.String())
+	query.Del("sort")
+	link := *req.URL
+	link.RawQuery = query.Encode()
+	res.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, link.RequestURI()))
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/sns"
+)
+
+// pagingStore finds its confirmations, latest first, and keeps the options
+// of the last find.
+type pagingStore struct {
+	clients.StoreClient
+	confirmations []*models.Confirmation
+	filter        clients.FilterOpts
+	statuses      []models.Status
+}
+
+func (s *pagingStore) FindConfirmationsWithOpts(ctx context.Context, confirmation *models.Confirmation, filter clients.FilterOpts, statuses ...models.Status) ([]*models.Confirmation, error) {
+	s.filter, s.statuses = filter, statuses
+	var found []*models.Confirmation
+	for _, conf := range s.confirmations {
+		if after := filter.After; after != nil && !conf.Created.Before(after.Time) &&
+			!(conf.Created.Equal(after.Time) && conf.Id < after.Id) {
+			continue
+		}
+		found = append(found, conf)
+		if len(found) == filter.Limit {
+			break
+		}
+	}
+	return found, nil
+}
+
+func newPagingStore(count int) *pagingStore {
+	store := &pagingStore{StoreClient: mockStore}
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := count; i > 0; i-- {
+		store.confirmations = append(store.confirmations, &models.Confirmation{
+			Id:        fmt.Sprintf("key-%d", i),
+			Type:      models.TypeCareteamInvite,
+			ClinicId:  "clinic-id",
+			CreatorId: testing_uid2,
+			Status:    models.StatusPending,
+			Created:   created.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	return store
+}
+
+var nextLinkPattern = regexp.MustCompile(`^<(.+)>; rel="next"$`)
+
+func TestListInvitationsPagination(t *testing.T) {
+	store := newPagingStore(5)
+	testRtr := initTestingSuppressionRouter(t, store, mockShoreline, sns.Config{})
+
+	var keys []string
+	pages := 0
+	next := "/confirm/v1/clinics/clinic-id/invites/patients?limit=2&status=pending"
+	for next != "" {
+		request := MustRequest(t, http.MethodGet, next, nil)
+		request.Header.Set(TP_SESSION_TOKEN, testing_token)
+		response := httptest.NewRecorder()
+		testRtr.ServeHTTP(response, request)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusOK, response.Body)
+		}
+		if store.filter.Limit != 3 {
+			t.Errorf("expected one more invite than the page size to be found, got %d", store.filter.Limit)
+		}
+
+		var invites []models.Confirmation
+		if err := json.NewDecoder(response.Body).Decode(&invites); err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+		if len(invites) > 2 {
+			t.Fatalf("expected at most 2 invites, got %d", len(invites))
+		}
+		for _, invite := range invites {
+			keys = append(keys, invite.Id)
+		}
+
+		next = ""
+		if link := response.Header().Get("Link"); link != "" {
+			match := nextLinkPattern.FindStringSubmatch(link)
+			if match == nil {
+				t.Fatalf("non-expected link %q", link)
+			}
+			next = match[1]
+			if query, _ := url.Parse(next); query.Query().Get("status") != "pending" {
+				t.Errorf("expected the next link to keep the query, got %q", next)
+			}
+		}
+		pages++
+	}
+
+	if pages != 3 {
+		t.Errorf("expected 3 pages, got %d", pages)
+	}
+	if fmt.Sprint(keys) != "[key-5 key-4 key-3 key-2 key-1]" {
+		t.Errorf("expected every invite once, latest first, got %v", keys)
+	}
+}
+
+func TestListInvitationsWithoutLimit(t *testing.T) {
+	store := newPagingStore(defaultPageSize + 1)
+	testRtr := initTestingSuppressionRouter(t, store, mockShoreline, sns.Config{})
+
+	request := MustRequest(t, http.MethodGet, "/confirm/v1/clinics/clinic-id/invites/patients", nil)
+	request.Header.Set(TP_SESSION_TOKEN, testing_token)
+	response := httptest.NewRecorder()
+	testRtr.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusOK, response.Body)
+	}
+
+	var invites []models.Confirmation
+	if err := json.NewDecoder(response.Body).Decode(&invites); err != nil {
+		t.Fatalf("error decoding response: %s", err)
+	}
+	if len(invites) != defaultPageSize+1 {
+		t.Errorf("expected every invite to be listed, got %d", len(invites))
+	}
+	if link := response.Header().Get("Link"); link != "" {
+		t.Errorf("expected no next link, got %q", link)
+	}
+}
+
+func TestListInvitationsOptions(t *testing.T) {
+	store := newPagingStore(1)
+	testRtr := initTestingSuppressionRouter(t, store, mockShoreline, sns.Config{})
+
+	request := MustRequest(t, http.MethodGet, fmt.Sprintf("/confirm/invite/%s?status=pending,completed&status=canceled&sort=modified&createdAfter=2024-01-01T00:00:00Z&modifiedBefore=2024-02-01T12:30:00.5Z", testing_uid2), nil)
+	request.Header.Set(TP_SESSION_TOKEN, testing_token)
+	response := httptest.NewRecorder()
+	testRtr.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusOK, response.Body)
+	}
+
+	if fmt.Sprint(store.statuses) != "[pending completed canceled]" {
+		t.Errorf("non-expected statuses %v", store.statuses)
+	}
+	filter := store.filter
+	if filter.Sort != clients.SortModifiedAscending || filter.Limit != 0 ||
+		!filter.CreatedAfter.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) ||
+		!filter.ModifiedBefore.Equal(time.Date(2024, 2, 1, 12, 30, 0, 5e8, time.UTC)) ||
+		!filter.CreatedBefore.IsZero() || !filter.ModifiedAfter.IsZero() || filter.After != nil {
+		t.Errorf("non-expected filter %+v", filter)
+	}
+	if link := response.Header().Get("Link"); link != "" {
+		t.Errorf("expected no next link on the last page, got %q", link)
+	}
+}
+
+func TestListInvitationsInvalidOptions(t *testing.T) {
+	cursor := clients.NewCursor(clients.SortCreatedAscending, &models.Confirmation{Id: "key-1"})
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "zero limit", query: "limit=0"},
+		{name: "limit too large", query: "limit=1001"},
+		{name: "unknown status", query: "status=pending,unknown"},
+		{name: "invalid time", query: "createdBefore=yesterday"},
+		{name: "unknown sort", query: "sort=key"},
+		{name: "invalid cursor", query: "cursor=abc"},
+		{name: "cursor for another sort", query: "sort=-created&cursor=" + cursor.String()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testRtr := initTestingSuppressionRouter(t, newPagingStore(1), mockShoreline, sns.Config{})
+			request := MustRequest(t, http.MethodGet, fmt.Sprintf("/confirm/invite/%s?%s", testing_uid2, test.query), nil)
+			request.Header.Set(TP_SESSION_TOKEN, testing_token)
+			response := httptest.NewRecorder()
+			testRtr.ServeHTTP(response, request)
+			if response.Code != http.StatusBadRequest {
+				t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusBadRequest, response.Body)
+			}
+		})
+	}
+}
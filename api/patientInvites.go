@@ -16,6 +16,8 @@ import (
 	"github.com/tidepool-org/hydrophone/models"
 )
 
+// Get the pending patient invites of a clinic. The list is paginated,
+// filtered and sorted by the parseListOptions query.
 func (a *Api) GetPatientInvites(res http.ResponseWriter, req *http.Request, vars map[string]string) {
 	if token := a.token(res, req); token != nil {
 		ctx := req.Context()
@@ -32,7 +34,12 @@ func (a *Api) GetPatientInvites(res http.ResponseWriter, req *http.Request, vars
 		}
 
 		// find all outstanding invites that are associated to this clinic
-		found, err := a.Store.FindConfirmations(ctx, &models.Confirmation{ClinicId: clinicId, Type: models.TypeCareteamInvite}, models.StatusPending)
+		options, err := parseListOptions(req, models.StatusPending)
+		if err != nil {
+			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_PARSING_LIST_OPTIONS, err)
+			return
+		}
+		found, next, err := a.findPage(ctx, &models.Confirmation{ClinicId: clinicId, Type: models.TypeCareteamInvite}, options)
 		if err != nil {
 			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_CONFIRMATION, err)
 			return
@@ -44,6 +51,7 @@ func (a *Api) GetPatientInvites(res http.ResponseWriter, req *http.Request, vars
 		}
 		if invites := a.addProfileInfoToConfirmations(ctx, found); invites != nil {
 			a.logMetric("get_patient_invites", req)
+			setNextLink(res, req, next)
 			a.sendModelAsResWithStatus(ctx, res, invites, http.StatusOK)
 			a.logger(ctx).Debugf("confirmations found and checked: %d", len(invites))
 			return
@@ -70,7 +78,7 @@ func (a *Api) AcceptPatientInvite(res http.ResponseWriter, req *http.Request, va
 
 		c := &models.Confirmation{
 			ClinicId: clinicId,
-			Key:      inviteId,
+			Id:       inviteId,
 		}
 		conf, err := a.Store.FindConfirmation(ctx, c)
 		if err != nil {
@@ -126,7 +134,7 @@ func (a *Api) AcceptPatientInvite(res http.ResponseWriter, req *http.Request, va
 			return
 		}
 
-		conf.UpdateStatus(models.StatusCompleted)
+		a.updateStatus(req, conf, models.StatusCompleted)
 		// addOrUpdateConfirmation logs and writes a response on errors
 		if !a.addOrUpdateConfirmation(ctx, conf, res) {
 			return
@@ -152,7 +160,7 @@ func (a *Api) CancelOrDismissPatientInvite(res http.ResponseWriter, req *http.Re
 
 		accept := &models.Confirmation{
 			ClinicId: clinicId,
-			Key:      inviteId,
+			Id:       inviteId,
 		}
 
 		conf, err := a.Store.FindConfirmation(ctx, accept)
@@ -185,7 +193,7 @@ func (a *Api) CancelOrDismissPatientInvite(res http.ResponseWriter, req *http.Re
 			return
 		}
 
-		conf.UpdateStatus(updatedStatus)
+		a.updateStatus(req, conf, updatedStatus)
 		// addOrUpdateConfirmation logs and writes a response on errors
 		if !a.addOrUpdateConfirmation(ctx, conf, res) {
 			return
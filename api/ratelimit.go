@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+// throttled counts a request to email the recipient and reports whether it's
+// over the rate limits. Throttled requests must respond as if the email was
+// sent, so that they can't be used to validate email addresses.
+func (a *Api) throttled(req *http.Request, confirmationType models.Type, email string) bool {
+	ctx := req.Context()
+	ip := a.sourceIP(req)
+	allowed, err := a.limiter.Allow(ctx, confirmationType, email, ip)
+	if err != nil {
+		a.logger(ctx).With(zap.Error(err)).Warn("checking rate limits")
+	}
+	if !allowed {
+		a.logger(ctx).
+			With(zap.String("type", string(confirmationType))).
+			With(zap.String("sourceIP", ip)).
+			Info("rate limit exceeded")
+		a.logMetricAsServer("rate limit exceeded")
+	}
+	return !allowed
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/ratelimit"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+// countingStore counts rate limits in memory, and the confirmations saved.
+type countingStore struct {
+	clients.StoreClient
+	counts map[string]int
+	saved  int
+}
+
+func (s *countingStore) IncrementRateLimit(ctx context.Context, key string, expiresAt time.Time) (int, error) {
+	s.counts[key]++
+	return s.counts[key], nil
+}
+
+func (s *countingStore) UpsertConfirmation(ctx context.Context, confirmation *models.Confirmation) error {
+	s.saved++
+	return s.StoreClient.UpsertConfirmation(ctx, confirmation)
+}
+
+func initTestingRateLimitRouter(t *testing.T, store clients.StoreClient) *mux.Router {
+	t.Helper()
+	cfg := FAKE_CONFIG
+	cfg.RateLimit = ratelimit.Config{Window: time.Hour, EmailLimit: 2}
+	testRtr := mux.NewRouter()
+	hydrophone := NewApi(cfg, nil, store, mockShoreline, mockGatekeeper, mockMetrics, mockSeagull, nil, mockTemplates, mockNotifierHealth, testutil.NewLogger(t))
+	hydrophone.SetHandlers("", testRtr)
+	return testRtr
+}
+
+func TestPasswordResetRateLimit(t *testing.T) {
+	store := &countingStore{StoreClient: mockStore, counts: map[string]int{}}
+	testRtr := initTestingRateLimitRouter(t, store)
+
+	for i := 0; i < 3; i++ {
+		request := MustRequest(t, http.MethodPost, "/send/forgot/me@myemail.com", nil)
+		response := httptest.NewRecorder()
+		testRtr.ServeHTTP(response, request)
+		// Throttled requests respond the same, so they don't leak whether the
+		// account exists.
+		if response.Code != http.StatusOK {
+			t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusOK, response.Body)
+		}
+	}
+
+	if store.saved != 2 {
+		t.Errorf("expected 2 reset confirmations to be saved, got %d", store.saved)
+	}
+}
+
+func TestResendSignUpRateLimit(t *testing.T) {
+	store := &countingStore{StoreClient: mockStore, counts: map[string]int{}}
+	testRtr := initTestingRateLimitRouter(t, store)
+
+	for i := 0; i < 3; i++ {
+		request := MustRequest(t, http.MethodPost, "/resend/signup/me@myemail.com", nil)
+		response := httptest.NewRecorder()
+		testRtr.ServeHTTP(response, request)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusOK, response.Body)
+		}
+	}
+
+	if store.saved != 2 {
+		t.Errorf("expected 2 signup confirmations to be resent, got %d", store.saved)
+	}
+}
@@ -34,12 +34,12 @@ var (
 	/*
 	 * basics setup
 	 */
-	mockNotifier   = clients.NewMockNotifier()
-	mockShoreline  = shoreline.NewMock(testing_token)
-	mockGatekeeper = commonClients.NewGatekeeperMock(nil, &status.StatusError{Status: status.NewStatus(500, "Unable to parse response.")})
-	mockMetrics    = highwater.NewMock()
-	mockSeagull    = commonClients.NewSeagullMock()
-	mockTemplates  = models.Templates{}
+	mockShoreline      = shoreline.NewMock(testing_token)
+	mockGatekeeper     = commonClients.NewGatekeeperMock(nil, &status.StatusError{Status: status.NewStatus(500, "Unable to parse response.")})
+	mockMetrics        = highwater.NewMock()
+	mockSeagull        = commonClients.NewSeagullMock()
+	mockTemplates      = models.Templates{}
+	mockNotifierHealth = clients.MockNotifierHealth{}
 
 	/*
 	 * stores
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"regexp"
@@ -55,7 +56,7 @@ func (a *Api) updateSignupConfirmation(newStatus models.Status, res http.Respons
 	if found != nil {
 		updatedStatus := string(newStatus) + " signup"
 		a.logger(ctx).Debugf("new status: %s", updatedStatus)
-		found.UpdateStatus(newStatus)
+		a.updateStatus(req, found, newStatus)
 
 		// addOrUpdateConfirmation logs and writes a response on errors
 		if a.addOrUpdateConfirmation(ctx, found, res) {
@@ -73,7 +74,8 @@ func (a *Api) updateSignupConfirmation(newStatus models.Status, res http.Respons
 //
 // This post is sent by the signup logic. In this state, the user account has been created but has a flag that
 // forces the user to the confirmation-required page until the signup has been confirmed.
-// It sends an email that contains a random confirmation link.
+// It sends an email that contains a random confirmation link, or a short numeric code if the mode is code, which is
+// accepted by acceptSignUpCode.
 //
 // status: 201
 // status: 400 STATUS_SIGNUP_NO_ID
@@ -113,17 +115,18 @@ func (a *Api) sendSignUp(res http.ResponseWriter, req *http.Request, vars map[st
 
 		a.logger(ctx).
 			With(zap.String("email", newSignUp.Email)).
-			With(zap.String("key", newSignUp.Key)).
+			With(zap.String("id", newSignUp.Id)).
 			Debug("sending email confirmation")
 
-		emailContent := map[string]interface{}{
-			"Key":         newSignUp.Key,
-			"Email":       newSignUp.Email,
-			"FullName":    profile.FullName,
-			"CreatorName": creatorName,
+		emailContent := &models.SignupContent{
+			Key:         newSignUp.Key,
+			Code:        codeValue(newSignUp),
+			Email:       newSignUp.Email,
+			FullName:    profile.FullName,
+			CreatorName: creatorName,
 		}
 		if newSignUp.ClinicId != "" {
-			emailContent["ClinicName"] = clinicName
+			emailContent.ClinicName = clinicName
 		}
 
 		if a.createAndSendNotification(req, newSignUp, emailContent) {
@@ -139,74 +142,113 @@ func (a *Api) sendSignUp(res http.ResponseWriter, req *http.Request, vars map[st
 // If a user didn't receive the confirmation email and logs in, they're directed to the confirmation-required page which can
 // offer to resend the confirmation email.
 //
+// Requests over the rate limits for the email address or source IP, and for an email without a pending signup,
+// return a 200 without sending an email, so that they can't be used to find out whether an account exists.
+// The mode is code to email a new code instead of a link.
+//
 // status: 200
-// status: 404 STATUS_SIGNUP_EXPIRED
+// status: 400 STATUS_ERR_DECODING_CONFIRMATION
 func (a *Api) resendSignUp(res http.ResponseWriter, req *http.Request, vars map[string]string) {
 	ctx := req.Context()
 	email := vars["useremail"]
 
-	toFind := &models.Confirmation{Email: email, Status: models.StatusPending, Type: models.TypeSignUp}
-
-	if found := a.findSignUp(ctx, toFind, res); found != nil {
-		if err := a.Store.RemoveConfirmation(ctx, found); err != nil {
-			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_DELETING_CONFIRMATION, err)
+	var body resendSignUpBody
+	if req.Body != nil {
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION, err)
 			return
 		}
+	}
+	withCode, err := parseConfirmationMode(body.Mode)
+	if err != nil {
+		a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION, err)
+		return
+	}
+
+	if a.throttled(req, models.TypeSignUp, email) {
+		res.WriteHeader(http.StatusOK)
+		return
+	}
+
+	toFind := &models.Confirmation{Email: email, Status: models.StatusPending, Type: models.TypeSignUp}
+
+	found, err := a.Store.FindConfirmation(ctx, toFind)
+	if err != nil {
+		a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_CONFIRMATION, err)
+		return
+	}
+	if found == nil {
+		// Like a throttled request, so that it doesn't tell whether there's a
+		// pending signup for the email.
+		res.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := a.Store.RemoveConfirmation(ctx, found); err != nil {
+		a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_DELETING_CONFIRMATION, err)
+		return
+	}
 
-		if err := found.ResetKey(); err != nil {
+	if err := found.ResetKey(); err != nil {
+		a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_RESETTING_KEY, err)
+		return
+	}
+	if withCode {
+		if err := a.addCode(found); err != nil {
 			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_RESETTING_KEY, err)
 			return
 		}
+	}
 
-		// addOrUpdateConfirmation logs and writes a response on errors
-		if a.addOrUpdateConfirmation(ctx, found, res) {
-			a.logMetricAsServer("signup confirmation recreated")
+	// addOrUpdateConfirmation logs and writes a response on errors
+	if a.addOrUpdateConfirmation(ctx, found, res) {
+		a.logMetricAsServer("signup confirmation recreated")
 
-			if err := a.addProfile(found); err != nil {
-				a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_ADDING_PROFILE, err)
+		if err := a.addProfile(found); err != nil {
+			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_ADDING_PROFILE, err)
+			return
+		} else {
+			profile := &models.Profile{}
+			if err := a.seagull.GetCollection(found.UserId, "profile", a.sl.TokenProvide(), profile); err != nil {
+				a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_USER, err)
 				return
-			} else {
-				profile := &models.Profile{}
-				if err := a.seagull.GetCollection(found.UserId, "profile", a.sl.TokenProvide(), profile); err != nil {
-					a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_USER, err)
-					return
-				}
+			}
 
-				a.logger(ctx).
-					With(zap.String("email", found.Email)).
-					With(zap.String("key", found.Key)).
-					Debug("resending email confirmation")
+			a.logger(ctx).
+				With(zap.String("email", found.Email)).
+				With(zap.String("id", found.Id)).
+				Debug("resending email confirmation")
 
-				emailContent := map[string]interface{}{
-					"Key":      found.Key,
-					"Email":    found.Email,
-					"FullName": profile.FullName,
-				}
+			emailContent := &models.SignupContent{
+				Key:      found.Key,
+				Code:     codeValue(found),
+				Email:    found.Email,
+				FullName: profile.FullName,
+			}
 
-				if found.Creator.Profile != nil {
-					emailContent["CreatorName"] = found.Creator.Profile.FullName
-				}
+			if found.Creator.Profile != nil {
+				emailContent.CreatorName = found.Creator.Profile.FullName
+			}
 
-				if found.ClinicId != "" {
-					resp, err := a.clinics.GetClinicWithResponse(ctx, clinics.ClinicId(found.ClinicId))
-					if err != nil {
-						a.sendError(ctx, res, http.StatusInternalServerError, "unable to fetch clinic")
-						return
-					}
-					if resp.StatusCode() == http.StatusOK && resp.JSON200.Name != "" {
-						emailContent["ClinicName"] = resp.JSON200.Name
-					}
+			if found.ClinicId != "" {
+				resp, err := a.clinics.GetClinicWithResponse(ctx, clinics.ClinicId(found.ClinicId))
+				if err != nil {
+					a.sendError(ctx, res, http.StatusInternalServerError, "unable to fetch clinic")
+					return
 				}
-
-				if a.createAndSendNotification(req, found, emailContent) {
-					a.logMetricAsServer("signup confirmation re-sent")
-				} else {
-					a.logMetricAsServer("signup confirmation failed to be sent")
+				if resp.StatusCode() == http.StatusOK && resp.JSON200.Name != "" {
+					emailContent.ClinicName = resp.JSON200.Name
 				}
 			}
 
-			res.WriteHeader(http.StatusOK)
+			if a.createAndSendNotification(req, found, emailContent) {
+				a.logMetricAsServer("signup confirmation re-sent")
+			} else {
+				a.logMetricAsServer("signup confirmation failed to be sent")
+			}
 		}
+
+		res.WriteHeader(http.StatusOK)
 	}
 }
 
@@ -239,66 +281,80 @@ func (a *Api) acceptSignUp(res http.ResponseWriter, req *http.Request, vars map[
 			return
 		}
 
-		emailVerified := true
-		updates := shoreline.UserUpdate{EmailVerified: &emailVerified}
-
-		if user, err := a.sl.GetUser(found.UserId, a.sl.TokenProvide()); err != nil {
-			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_USER, "trying to get user to check email verified", err)
-			return
-
-		} else if !user.PasswordExists {
+		a.completeSignUp(res, req, found, func() (*models.Acceptance, error) {
 			acceptance := &models.Acceptance{}
 			if req.Body != nil {
 				if err := json.NewDecoder(req.Body).Decode(acceptance); err != nil {
-					a.sendErrorWithCode(ctx, res, http.StatusConflict, ERROR_NO_PASSWORD, STATUS_NO_PASSWORD, "decoding acceptance", err)
-					return
+					return nil, err
 				}
 			}
+			return acceptance, nil
+		})
+	}
+}
 
-			if acceptance.Password == "" {
-				a.sendErrorWithCode(ctx, res, http.StatusConflict, ERROR_MISSING_PASSWORD, STATUS_MISSING_PASSWORD, "missing password")
-				return
-			}
-			if !IsValidPassword(acceptance.Password) {
-				a.sendErrorWithCode(ctx, res, http.StatusConflict, ERROR_INVALID_PASSWORD, STATUS_INVALID_PASSWORD, "invalid password specified")
-				return
-			}
-			if acceptance.Birthday == "" {
-				a.sendErrorWithCode(ctx, res, http.StatusConflict, ERROR_MISSING_BIRTHDAY, STATUS_MISSING_BIRTHDAY, "missing birthday")
-				return
-			}
-			if !IsValidDate(acceptance.Birthday) {
-				a.sendErrorWithCode(ctx, res, http.StatusConflict, ERROR_INVALID_BIRTHDAY, STATUS_INVALID_BIRTHDAY, "invalid birthday specified")
-				return
-			}
+// completeSignUp verifies the email of the signup's account, and sets its
+// password if it doesn't have one yet. The acceptance with the password is
+// only needed then.
+func (a *Api) completeSignUp(res http.ResponseWriter, req *http.Request, found *models.Confirmation, acceptance func() (*models.Acceptance, error)) {
+	ctx := req.Context()
+	emailVerified := true
+	updates := shoreline.UserUpdate{EmailVerified: &emailVerified}
 
-			profile := &models.Profile{}
-			if err := a.seagull.GetCollection(found.UserId, "profile", a.sl.TokenProvide(), profile); err != nil {
-				a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_USER, "getting the users profile", err)
-				return
-			}
+	if user, err := a.sl.GetUser(found.UserId, a.sl.TokenProvide()); err != nil {
+		a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_USER, "trying to get user to check email verified", err)
+		return
 
-			if acceptance.Birthday != profile.Patient.Birthday {
-				a.sendErrorWithCode(ctx, res, http.StatusConflict, ERROR_MISMATCH_BIRTHDAY, STATUS_MISMATCH_BIRTHDAY, "acceptance birthday does not match user patient birthday")
-				return
-			}
+	} else if !user.PasswordExists {
+		acceptance, err := acceptance()
+		if err != nil {
+			a.sendErrorWithCode(ctx, res, http.StatusConflict, ERROR_NO_PASSWORD, STATUS_NO_PASSWORD, "decoding acceptance", err)
+			return
+		}
 
-			updates.Password = &acceptance.Password
+		if acceptance.Password == "" {
+			a.sendErrorWithCode(ctx, res, http.StatusConflict, ERROR_MISSING_PASSWORD, STATUS_MISSING_PASSWORD, "missing password")
+			return
+		}
+		if !IsValidPassword(acceptance.Password) {
+			a.sendErrorWithCode(ctx, res, http.StatusConflict, ERROR_INVALID_PASSWORD, STATUS_INVALID_PASSWORD, "invalid password specified")
+			return
+		}
+		if acceptance.Birthday == "" {
+			a.sendErrorWithCode(ctx, res, http.StatusConflict, ERROR_MISSING_BIRTHDAY, STATUS_MISSING_BIRTHDAY, "missing birthday")
+			return
+		}
+		if !IsValidDate(acceptance.Birthday) {
+			a.sendErrorWithCode(ctx, res, http.StatusConflict, ERROR_INVALID_BIRTHDAY, STATUS_INVALID_BIRTHDAY, "invalid birthday specified")
+			return
 		}
 
-		if err := a.sl.UpdateUser(found.UserId, updates, a.sl.TokenProvide()); err != nil {
-			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_UPDATING_USER, err)
+		profile := &models.Profile{}
+		if err := a.seagull.GetCollection(found.UserId, "profile", a.sl.TokenProvide(), profile); err != nil {
+			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_USER, "getting the users profile", err)
 			return
 		}
 
-		found.UpdateStatus(models.StatusCompleted)
-		// addOrUpdateConfirmation logs and writes a response on errors
-		if a.addOrUpdateConfirmation(ctx, found, res) {
-			a.logMetricAsServer("accept signup")
+		if acceptance.Birthday != profile.Patient.Birthday {
+			a.sendErrorWithCode(ctx, res, http.StatusConflict, ERROR_MISMATCH_BIRTHDAY, STATUS_MISMATCH_BIRTHDAY, "acceptance birthday does not match user patient birthday")
+			return
 		}
 
-		res.WriteHeader(http.StatusOK)
+		updates.Password = &acceptance.Password
+	}
+
+	if err := a.sl.UpdateUser(found.UserId, updates, a.sl.TokenProvide()); err != nil {
+		a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_UPDATING_USER, err)
+		return
 	}
+
+	a.updateStatus(req, found, models.StatusCompleted)
+	// addOrUpdateConfirmation logs and writes a response on errors
+	if a.addOrUpdateConfirmation(ctx, found, res) {
+		a.logMetricAsServer("accept signup")
+	}
+
+	res.WriteHeader(http.StatusOK)
 }
 
 // In the event that someone uses the wrong email address, the receiver could explicitly dismiss a signup attempt with this link (useful for metrics and to identify phishing attempts).
@@ -407,6 +463,11 @@ func (a *Api) upsertSignUp(res http.ResponseWriter, req *http.Request, vars map[
 			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION)
 			return nil
 		}
+		withCode, err := parseConfirmationMode(upsertCustodialSignUpInvite.Mode)
+		if err != nil {
+			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION, err)
+			return nil
+		}
 
 		if usrDetails, err := a.sl.GetUser(userId, a.sl.TokenProvide()); err != nil {
 			a.sendError(ctx, res, http.StatusNotFound, STATUS_ERR_FINDING_USER, err)
@@ -500,6 +561,13 @@ func (a *Api) upsertSignUp(res http.ResponseWriter, req *http.Request, vars map[
 				return nil
 			}
 
+			if withCode {
+				if err := a.addCode(newSignUp); err != nil {
+					a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_CREATING_CONFIRMATION, err)
+					return nil
+				}
+			}
+
 			// addOrUpdateConfirmation logs and writes a response on errors
 			if a.addOrUpdateConfirmation(ctx, newSignUp, res) {
 				a.logMetric("signup confirmation created", req)
@@ -537,6 +605,14 @@ func IsValidDate(date string) bool {
 type UpsertCustodialSignUpInvite struct {
 	ClinicId  string `json:"clinicId"`
 	InvitedBy string `json:"invitedBy"`
+	// Mode is code to email a code instead of a link.
+	Mode string `json:"mode,omitempty"`
+}
+
+// resendSignUpBody has the optional details of a request to resend a signup.
+type resendSignUpBody struct {
+	// Mode is code to email a code instead of a link.
+	Mode string `json:"mode,omitempty"`
 }
 
 var passwordRe = regexp.MustCompile(`\A\S{8,72}\z`)
@@ -55,6 +55,13 @@ func TestSignupResponds(t *testing.T) {
 			url:      "/resend/signup/email@address.org",
 			respCode: 200,
 		},
+		{
+			// nor does it tell whether there's a signup to resend
+			returnNone: true,
+			method:     "POST",
+			url:        "/resend/signup/email@address.org",
+			respCode:   200,
+		},
 		{
 			// you can't accept an invitation you didn't get
 			returnNone: true,
@@ -232,7 +239,7 @@ func TestSignupResponds(t *testing.T) {
 		if test.returnNone {
 			store = mockStoreEmpty
 		}
-		h := NewApi(FAKE_CONFIG, nil, store, mockNotifier, mockShoreline, mockGatekeeper, mockMetrics, mockSeagull, nil, mockTemplates, logger)
+		h := NewApi(FAKE_CONFIG, nil, store, mockShoreline, mockGatekeeper, mockMetrics, mockSeagull, nil, mockTemplates, mockNotifierHealth, logger)
 		h.SetHandlers("", testRtr)
 
 		var body = &bytes.Buffer{}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/sns"
+)
+
+const (
+	STATUS_ERR_DECODING_NOTIFICATION = "Error decoding the notification"
+	STATUS_ERR_CONFIRMING_SNS        = "Error confirming the SNS subscription"
+	STATUS_ERR_FINDING_SUPPRESSION   = "Error finding the suppression"
+	STATUS_ERR_SAVING_SUPPRESSION    = "Error saving the suppression"
+	STATUS_ERR_DELETING_SUPPRESSION  = "Error deleting the suppression"
+	STATUS_INVALID_SIGNATURE         = "The notification's signature was invalid"
+	STATUS_SNS_NOT_CONFIGURED        = "No SNS topics are configured"
+)
+
+// maxNotificationSize limits the size of the SNS messages read.
+const maxNotificationSize = 256 * 1024
+
+type suppressionBody struct {
+	Detail string `json:"detail"`
+}
+
+// Receive an SES delivery, bounce or complaint notification from SNS
+//
+// The SNS message must be signed by a certificate from the configured host,
+// and sent to one of the configured topics. Subscription confirmations are
+// confirmed. Permanent bounces and complaints suppress the recipients.
+// Deliveries and bounces update the delivery record of the confirmation that
+// was emailed. Without configured topics, every notification is refused.
+//
+// status: 200
+// status: 400 STATUS_ERR_DECODING_NOTIFICATION
+// status: 403 STATUS_INVALID_SIGNATURE
+// status: 500 STATUS_ERR_CONFIRMING_SNS
+// status: 500 STATUS_ERR_SAVING_SUPPRESSION
+// status: 500 STATUS_ERR_UPDATING_CONFIRMATION
+// status: 503 STATUS_SNS_NOT_CONFIGURED
+func (a *Api) ReceiveSESNotification(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if !a.Config.SNS.Enabled() {
+		a.sendError(ctx, res, http.StatusServiceUnavailable, STATUS_SNS_NOT_CONFIGURED)
+		return
+	}
+	var message sns.Message
+	if err := json.NewDecoder(io.LimitReader(req.Body, maxNotificationSize)).Decode(&message); err != nil {
+		a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_NOTIFICATION, err)
+		return
+	}
+	if err := a.sns.Verify(ctx, &message); err != nil {
+		a.sendError(ctx, res, http.StatusForbidden, STATUS_INVALID_SIGNATURE, err)
+		return
+	}
+
+	switch message.Type {
+	case sns.TypeSubscriptionConfirmation:
+		if err := a.sns.ConfirmSubscription(ctx, &message); err != nil {
+			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_CONFIRMING_SNS, err)
+			return
+		}
+		a.logger(ctx).With(zap.String("topicArn", message.TopicArn)).Info("confirmed SNS subscription")
+	case sns.TypeNotification:
+		notification, err := sns.ParseSESNotification(&message)
+		if err != nil {
+			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_NOTIFICATION, err)
+			return
+		}
+		for _, suppression := range newSuppressions(notification) {
+			if err := a.Store.UpsertSuppression(ctx, suppression); err != nil {
+				a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_SAVING_SUPPRESSION, err)
+				return
+			}
+			a.logger(ctx).
+				With(zap.String("email", suppression.Email)).
+				With(zap.String("reason", string(suppression.Reason))).
+				Info("suppressed recipient")
+		}
+		if status, ok := deliveryStatus(notification); ok && notification.Mail.MessageId != "" {
+			if err := a.Store.UpdateDeliveryStatus(ctx, notification.Mail.MessageId, status); err != nil {
+				a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_UPDATING_CONFIRMATION, err)
+				return
+			}
+		}
+	}
+	res.WriteHeader(http.StatusOK)
+}
+
+// deliveryStatus returns the delivery status the notification reports, and
+// false if it doesn't report one.
+func deliveryStatus(notification *sns.SESNotification) (models.DeliveryStatus, bool) {
+	switch notification.Type() {
+	case sns.SESNotificationDelivery:
+		return models.DeliveryStatusDelivered, true
+	case sns.SESNotificationBounce:
+		return models.DeliveryStatusBounced, true
+	default:
+		return "", false
+	}
+}
+
+// newSuppressions returns the suppressions of the recipients of a permanent
+// bounce or complaint. Transient bounces may succeed later, so they aren't
+// suppressed.
+func newSuppressions(notification *sns.SESNotification) []*models.Suppression {
+	var reason models.SuppressionReason
+	var detail string
+	var recipients []sns.SESRecipient
+	switch {
+	case notification.Type() == sns.SESNotificationBounce && notification.Bounce != nil:
+		if notification.Bounce.BounceType != sns.SESBounceTypePermanent {
+			return nil
+		}
+		reason = models.SuppressionReasonBounce
+		detail = notification.Bounce.BounceType + "/" + notification.Bounce.BounceSubType
+		recipients = notification.Bounce.BouncedRecipients
+	case notification.Type() == sns.SESNotificationComplaint && notification.Complaint != nil:
+		reason = models.SuppressionReasonComplaint
+		detail = notification.Complaint.ComplaintFeedbackType
+		recipients = notification.Complaint.ComplainedRecipients
+	default:
+		return nil
+	}
+
+	var suppressions []*models.Suppression
+	for _, recipient := range recipients {
+		if suppression, err := models.NewSuppression(recipient.EmailAddress, reason, detail); err == nil {
+			suppressions = append(suppressions, suppression)
+		}
+	}
+	return suppressions
+}
+
+// Get the suppression of an email address
+//
+// status: 200 models.Suppression
+// status: 401 STATUS_NO_TOKEN
+// status: 401 STATUS_UNAUTHORIZED - not a server token
+// status: 404 STATUS_NOT_FOUND
+func (a *Api) GetSuppression(res http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if token := a.token(res, req); token != nil {
+		ctx := req.Context()
+		if !token.IsServer {
+			a.sendError(ctx, res, http.StatusUnauthorized, STATUS_UNAUTHORIZED)
+			return
+		}
+
+		if suppression := a.findSuppression(res, req, vars["email"]); suppression != nil {
+			a.sendModelAsResWithStatus(ctx, res, suppression, http.StatusOK)
+		}
+	}
+}
+
+// Suppress an email address
+//
+// The optional JSON body gives a detail, such as why it was suppressed.
+//
+// status: 200 models.Suppression
+// status: 400 STATUS_ERR_DECODING_CONFIRMATION
+// status: 401 STATUS_NO_TOKEN
+// status: 401 STATUS_UNAUTHORIZED - not a server token
+func (a *Api) AddSuppression(res http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if token := a.token(res, req); token != nil {
+		ctx := req.Context()
+		if !token.IsServer {
+			a.sendError(ctx, res, http.StatusUnauthorized, STATUS_UNAUTHORIZED)
+			return
+		}
+
+		var body suppressionBody
+		if req.Body != nil {
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+				a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_CONFIRMATION, err)
+				return
+			}
+		}
+		suppression, err := models.NewSuppression(vars["email"], models.SuppressionReasonManual, body.Detail)
+		if err != nil {
+			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_SAVING_SUPPRESSION, err)
+			return
+		}
+		if err := a.Store.UpsertSuppression(ctx, suppression); err != nil {
+			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_SAVING_SUPPRESSION, err)
+			return
+		}
+		a.sendModelAsResWithStatus(ctx, res, suppression, http.StatusOK)
+	}
+}
+
+// Stop suppressing an email address
+//
+// status: 200
+// status: 401 STATUS_NO_TOKEN
+// status: 401 STATUS_UNAUTHORIZED - not a server token
+// status: 404 STATUS_NOT_FOUND
+func (a *Api) RemoveSuppression(res http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if token := a.token(res, req); token != nil {
+		ctx := req.Context()
+		if !token.IsServer {
+			a.sendError(ctx, res, http.StatusUnauthorized, STATUS_UNAUTHORIZED)
+			return
+		}
+
+		suppression := a.findSuppression(res, req, vars["email"])
+		if suppression == nil {
+			return
+		}
+		if err := a.Store.RemoveSuppression(ctx, suppression.Email); err != nil {
+			a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_DELETING_SUPPRESSION, err)
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+	}
+}
+
+// findSuppression returns the suppression of the email address, or writes
+// the error and returns nil.
+func (a *Api) findSuppression(res http.ResponseWriter, req *http.Request, email string) *models.Suppression {
+	ctx := req.Context()
+	suppressions, err := a.Store.FindSuppressions(ctx, email)
+	if err != nil {
+		a.sendError(ctx, res, http.StatusInternalServerError, STATUS_ERR_FINDING_SUPPRESSION, err)
+		return nil
+	}
+	if len(suppressions) == 0 {
+		a.sendError(ctx, res, http.StatusNotFound, STATUS_NOT_FOUND)
+		return nil
+	}
+	return suppressions[0]
+}
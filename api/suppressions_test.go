@@ -0,0 +1,208 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/tidepool-org/go-common/clients/shoreline"
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/sns"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+// suppressionStore keeps suppressions in memory, and the last confirmation
+// saved.
+type suppressionStore struct {
+	clients.StoreClient
+	suppressions map[string]*models.Suppression
+}
+
+func newSuppressionStore(emails ...string) *suppressionStore {
+	store := &suppressionStore{StoreClient: mockStore, suppressions: map[string]*models.Suppression{}}
+	for _, email := range emails {
+		suppression, _ := models.NewSuppression(email, models.SuppressionReasonManual, "")
+		store.suppressions[suppression.Email] = suppression
+	}
+	return store
+}
+
+func (s *suppressionStore) UpsertSuppression(ctx context.Context, suppression *models.Suppression) error {
+	s.suppressions[suppression.Email] = suppression
+	return nil
+}
+
+func (s *suppressionStore) FindSuppressions(ctx context.Context, emails ...string) ([]*models.Suppression, error) {
+	var found []*models.Suppression
+	for _, email := range emails {
+		if suppression, ok := s.suppressions[models.SuppressionEmail(email)]; ok {
+			found = append(found, suppression)
+		}
+	}
+	return found, nil
+}
+
+func (s *suppressionStore) RemoveSuppression(ctx context.Context, email string) error {
+	delete(s.suppressions, models.SuppressionEmail(email))
+	return nil
+}
+
+func initTestingSuppressionRouter(t *testing.T, store clients.StoreClient, sl shoreline.Client, snsConfig sns.Config) *mux.Router {
+	t.Helper()
+	cfg := FAKE_CONFIG
+	cfg.SNS = snsConfig
+	testRtr := mux.NewRouter()
+	hydrophone := NewApi(cfg, nil, store, sl, mockGatekeeper, mockMetrics, mockSeagull, nil, mockTemplates, mockNotifierHealth, testutil.NewLogger(t))
+	hydrophone.SetHandlers("", testRtr)
+	return testRtr
+}
+
+func postSNSMessage(t *testing.T, testRtr *mux.Router, message *sns.Message) *httptest.ResponseRecorder {
+	t.Helper()
+	body := &bytes.Buffer{}
+	json.NewEncoder(body).Encode(message)
+	request := MustRequest(t, http.MethodPost, "/confirm/v1/ses/notifications", body)
+	request.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+	response := httptest.NewRecorder()
+	testRtr.ServeHTTP(response, request)
+	return response
+}
+
+func TestReceiveSESNotification(t *testing.T) {
+	topic := testutil.NewSNSTopic(t)
+	bounce := func(bounceType, email string) map[string]any {
+		return map[string]any{
+			"notificationType": sns.SESNotificationBounce,
+			"bounce": map[string]any{
+				"bounceType":        bounceType,
+				"bounceSubType":     "General",
+				"bouncedRecipients": []map[string]string{{"emailAddress": email}},
+			},
+		}
+	}
+	complaint := map[string]any{
+		"eventType": sns.SESNotificationComplaint,
+		"complaint": map[string]any{
+			"complaintFeedbackType": "abuse",
+			"complainedRecipients":  []map[string]string{{"emailAddress": "Complained@Example.org"}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		message    *sns.Message
+		respCode   int
+		suppressed []string
+	}{
+		{name: "permanent bounce", message: topic.Notification(bounce(sns.SESBounceTypePermanent, "bounced@example.org")), respCode: http.StatusOK, suppressed: []string{"bounced@example.org"}},
+		{name: "transient bounce", message: topic.Notification(bounce("Transient", "full@example.org")), respCode: http.StatusOK},
+		{name: "complaint", message: topic.Notification(complaint), respCode: http.StatusOK, suppressed: []string{"complained@example.org"}},
+		{name: "subscription confirmation", message: topic.SubscriptionConfirmation(), respCode: http.StatusOK},
+		{
+			name: "invalid signature",
+			message: func() *sns.Message {
+				message := topic.Notification(bounce(sns.SESBounceTypePermanent, "bounced@example.org"))
+				message.Message = "{}"
+				return message
+			}(),
+			respCode: http.StatusForbidden,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newSuppressionStore()
+			testRtr := initTestingSuppressionRouter(t, store, mockShoreline, topic.Config())
+			response := postSNSMessage(t, testRtr, test.message)
+			if response.Code != test.respCode {
+				t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, test.respCode, response.Body)
+			}
+			if len(store.suppressions) != len(test.suppressed) {
+				t.Errorf("expected %d suppressions, got %v", len(test.suppressed), store.suppressions)
+			}
+			for _, email := range test.suppressed {
+				if store.suppressions[email] == nil {
+					t.Errorf("expected %s to be suppressed", email)
+				}
+			}
+		})
+	}
+
+	if !topic.Confirmed() {
+		t.Error("expected the subscription to be confirmed")
+	}
+}
+
+func TestReceiveSESNotificationWithoutTopics(t *testing.T) {
+	topic := testutil.NewSNSTopic(t)
+	config := topic.Config()
+	config.TopicArns = nil
+	testRtr := initTestingSuppressionRouter(t, newSuppressionStore(), mockShoreline, config)
+	response := postSNSMessage(t, testRtr, topic.SubscriptionConfirmation())
+	if response.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Non-expected status code %d (expected %d):\n\tbody: %v", response.Code, http.StatusServiceUnavailable, response.Body)
+	}
+	if topic.Confirmed() {
+		t.Error("expected the subscription not to be confirmed")
+	}
+}
+
+func TestSuppressionAdmin(t *testing.T) {
+	store := newSuppressionStore()
+	testRtr := initTestingSuppressionRouter(t, store, mockShoreline, sns.Config{})
+
+	send := func(method, token string, body io.Reader) *httptest.ResponseRecorder {
+		request := MustRequest(t, method, "/confirm/v1/suppressions/Someone@Example.org", body)
+		request.Header.Set(TP_SESSION_TOKEN, token)
+		response := httptest.NewRecorder()
+		testRtr.ServeHTTP(response, request)
+		return response
+	}
+
+	if response := send(http.MethodGet, testing_token, nil); response.Code != http.StatusNotFound {
+		t.Fatalf("expected %d before it's added, got %d", http.StatusNotFound, response.Code)
+	}
+
+	body := &bytes.Buffer{}
+	json.NewEncoder(body).Encode(testJSONObject{"detail": "requested by support"})
+	if response := send(http.MethodPut, testing_token, body); response.Code != http.StatusOK {
+		t.Fatalf("expected %d adding it, got %d: %v", http.StatusOK, response.Code, response.Body)
+	}
+	suppression := store.suppressions["someone@example.org"]
+	if suppression == nil || suppression.Reason != models.SuppressionReasonManual || suppression.Detail != "requested by support" {
+		t.Fatalf("non-expected suppression %+v", suppression)
+	}
+
+	response := send(http.MethodGet, testing_token, nil)
+	var found models.Suppression
+	if err := json.NewDecoder(response.Body).Decode(&found); err != nil || found.Email != "someone@example.org" {
+		t.Fatalf("non-expected suppression %+v: %v", found, err)
+	}
+
+	if response := send(http.MethodDelete, testing_token, nil); response.Code != http.StatusOK {
+		t.Fatalf("expected %d removing it, got %d", http.StatusOK, response.Code)
+	}
+	if len(store.suppressions) != 0 {
+		t.Errorf("expected the suppression to be removed, got %v", store.suppressions)
+	}
+}
+
+func TestSuppressionAdminRequiresServerToken(t *testing.T) {
+	testRtr := initTestingSuppressionRouter(t, newSuppressionStore(), mock_uid1Shoreline, sns.Config{})
+
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		request := MustRequest(t, method, "/confirm/v1/suppressions/someone@example.org", nil)
+		request.Header.Set(TP_SESSION_TOKEN, testing_token_uid1)
+		response := httptest.NewRecorder()
+		testRtr.ServeHTTP(response, request)
+		if response.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected %d, got %d", method, http.StatusUnauthorized, response.Code)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+// TemplateDescription describes an email template and its translations.
+type TemplateDescription struct {
+	Name    models.TemplateName `json:"name"`
+	Locales []models.Locale     `json:"locales"`
+	// Variables are the fields of the content used by any translation.
+	Variables []string `json:"variables"`
+}
+
+// RenderedTemplate is an email as it would be sent.
+type RenderedTemplate struct {
+	Name    models.TemplateName `json:"name"`
+	Locale  models.Locale       `json:"locale"`
+	Subject string              `json:"subject"`
+	HTML    string              `json:"html"`
+	Text    string              `json:"text"`
+}
+
+type renderTemplateBody struct {
+	Locale  string          `json:"locale"`
+	Content json.RawMessage `json:"content"`
+}
+
+// List the email templates, with their translations and variables
+//
+// status: 200 []TemplateDescription
+// status: 401 STATUS_NO_TOKEN
+// status: 401 STATUS_UNAUTHORIZED - not a server token
+func (a *Api) GetTemplates(res http.ResponseWriter, req *http.Request) {
+	if token := a.token(res, req); token != nil {
+		ctx := req.Context()
+		if !token.IsServer {
+			a.sendError(ctx, res, http.StatusUnauthorized, STATUS_UNAUTHORIZED)
+			return
+		}
+
+		descriptions := []*TemplateDescription{}
+		for _, key := range a.templates.Keys() {
+			template, locale, ok := a.templates.Find(key.Name, key.Locale)
+			if !ok || locale != key.Locale {
+				// The templates were reloaded since the keys were listed, and
+				// the translation is gone.
+				continue
+			}
+			if len(descriptions) == 0 || descriptions[len(descriptions)-1].Name != key.Name {
+				descriptions = append(descriptions, &TemplateDescription{Name: key.Name})
+			}
+			description := descriptions[len(descriptions)-1]
+			description.Locales = append(description.Locales, key.Locale)
+			description.Variables = append(description.Variables, template.Variables()...)
+		}
+		for _, description := range descriptions {
+			slices.Sort(description.Variables)
+			description.Variables = slices.Compact(description.Variables)
+		}
+
+		a.sendModelAsResWithStatus(ctx, res, descriptions, http.StatusOK)
+	}
+}
+
+// Render an email template without sending it
+//
+// The content given is merged over sample content, so only the variables of
+// interest need to be given. Variables the template's content type doesn't
+// declare are rejected. WebURL and AssetURL are always those that would
+// be sent. The best translation for the locale given, or
+// the Accept-Language header, is rendered.
+//
+// status: 200 RenderedTemplate
+// status: 400 STATUS_ERR_DECODING_TEMPLATE_CONTENT
+// status: 401 STATUS_NO_TOKEN
+// status: 401 STATUS_UNAUTHORIZED - not a server token
+// status: 404 STATUS_ERR_FINDING_TEMPLATE
+// status: 422 STATUS_ERR_RENDERING_TEMPLATE - the content doesn't suit the template
+func (a *Api) RenderTemplate(res http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if token := a.token(res, req); token != nil {
+		ctx := req.Context()
+		if !token.IsServer {
+			a.sendError(ctx, res, http.StatusUnauthorized, STATUS_UNAUTHORIZED)
+			return
+		}
+
+		templateName := models.TemplateName(vars["templateName"])
+
+		var body renderTemplateBody
+		if req.Body != nil {
+			defer req.Body.Close()
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+				a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_TEMPLATE_CONTENT, err)
+				return
+			}
+		}
+		locale, err := parseLocale(body.Locale)
+		if err != nil {
+			a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_TEMPLATE_CONTENT, err)
+			return
+		}
+
+		locales := models.ParseAcceptLanguage(req.Header.Get("Accept-Language"))
+		if locale != "" {
+			locales = []models.Locale{locale}
+		}
+
+		content, err := models.SampleTemplateContent(templateName)
+		if err != nil {
+			a.sendError(ctx, res, http.StatusNotFound, STATUS_ERR_FINDING_TEMPLATE, err)
+			return
+		}
+		if len(body.Content) != 0 {
+			decoder := json.NewDecoder(bytes.NewReader(body.Content))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(content); err != nil {
+				a.sendError(ctx, res, http.StatusBadRequest, STATUS_ERR_DECODING_TEMPLATE_CONTENT, err)
+				return
+			}
+		}
+
+		subject, html, text, locale, err := a.renderNotification(req, templateName, locales, content)
+		if errors.Is(err, models.ErrUnknownTemplate) {
+			a.sendError(ctx, res, http.StatusNotFound, STATUS_ERR_FINDING_TEMPLATE, err)
+			return
+		} else if err != nil {
+			a.sendError(ctx, res, http.StatusUnprocessableEntity, STATUS_ERR_RENDERING_TEMPLATE, err)
+			return
+		}
+
+		a.sendModelAsResWithStatus(ctx, res, &RenderedTemplate{
+			Name:    templateName,
+			Locale:  locale,
+			Subject: subject,
+			HTML:    html,
+			Text:    text,
+		}, http.StatusOK)
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/tidepool-org/go-common/clients/shoreline"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/templates"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+func initTestingTemplatesRouter(t *testing.T, sl shoreline.Client) *mux.Router {
+	t.Helper()
+	defaults, err := templates.New()
+	if err != nil {
+		t.Fatalf("error creating templates: %s", err)
+	}
+	testRtr := mux.NewRouter()
+	hydrophone := NewApi(EMAIL_CONFIG, nil, mockStore, sl, mockGatekeeper, mockMetrics, mockSeagull, nil, defaults, mockNotifierHealth, testutil.NewLogger(t))
+	hydrophone.SetHandlers("", testRtr)
+	return testRtr
+}
+
+func TestGetTemplates(t *testing.T) {
+	testRtr := initTestingTemplatesRouter(t, mockShoreline)
+	request := MustRequest(t, "GET", "/templates", nil)
+	request.Header.Set(TP_SESSION_TOKEN, testing_token)
+	response := httptest.NewRecorder()
+	testRtr.ServeHTTP(response, request)
+
+	if response.Code != 200 {
+		t.Fatalf("Non-expected status code %d (expected 200):\n\tbody: %v", response.Code, response.Body)
+	}
+	var descriptions []TemplateDescription
+	if err := json.NewDecoder(response.Body).Decode(&descriptions); err != nil {
+		t.Fatalf("error decoding response: %s", err)
+	}
+	if len(descriptions) != len(models.TemplateNames) {
+		t.Fatalf("expected %d templates, got %d", len(models.TemplateNames), len(descriptions))
+	}
+	for _, description := range descriptions {
+		if description.Name != models.TemplateNamePasswordReset {
+			continue
+		}
+		if len(description.Locales) < 2 {
+			t.Errorf("expected translations of %s, got %v", description.Name, description.Locales)
+		}
+		if strings.Join(description.Variables, ",") != "AssetURL,Code,Key,WebURL" {
+			t.Errorf("expected the %s variables, got %v", description.Name, description.Variables)
+		}
+	}
+}
+
+// reloadedTemplates lists a translation that's no longer there, like
+// templates reloaded between listing and finding them.
+type reloadedTemplates struct {
+	models.Templates
+}
+
+func (r reloadedTemplates) Keys() []models.TemplateKey {
+	return append(r.Templates.Keys(), models.TemplateKey{Name: models.TemplateNameSignup, Locale: "nl"})
+}
+
+func TestGetTemplatesReloaded(t *testing.T) {
+	defaults, err := templates.New()
+	if err != nil {
+		t.Fatalf("error creating templates: %s", err)
+	}
+	testRtr := mux.NewRouter()
+	hydrophone := NewApi(EMAIL_CONFIG, nil, mockStore, mockShoreline, mockGatekeeper, mockMetrics, mockSeagull, nil, reloadedTemplates{defaults}, mockNotifierHealth, testutil.NewLogger(t))
+	hydrophone.SetHandlers("", testRtr)
+
+	request := MustRequest(t, "GET", "/templates", nil)
+	request.Header.Set(TP_SESSION_TOKEN, testing_token)
+	response := httptest.NewRecorder()
+	testRtr.ServeHTTP(response, request)
+
+	var descriptions []TemplateDescription
+	if err := json.NewDecoder(response.Body).Decode(&descriptions); err != nil {
+		t.Fatalf("error decoding response: %s", err)
+	}
+	for _, description := range descriptions {
+		if description.Name == models.TemplateNameSignup && slices.Contains(description.Locales, "nl") {
+			t.Errorf("expected the missing translation to be left out, got %v", description.Locales)
+		}
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	tests := []struct {
+		sl       shoreline.Client
+		template models.TemplateName
+		body     testJSONObject
+		respCode int
+		contains string
+	}{
+		{
+			// sample content
+			sl:       mockShoreline,
+			template: models.TemplateNamePasswordReset,
+			respCode: 200,
+			contains: "sample-key",
+		},
+		{
+			// caller content and locale
+			sl:       mockShoreline,
+			template: models.TemplateNamePasswordReset,
+			body:     testJSONObject{"locale": "fr-CA", "content": map[string]interface{}{"Key": "my-key"}},
+			respCode: 200,
+			contains: "my-key",
+		},
+		{
+			sl:       mockShoreline,
+			template: models.TemplateNamePasswordReset,
+			body:     testJSONObject{"locale": "not a locale"},
+			respCode: 400,
+		},
+		{
+			// variables the template doesn't declare
+			sl:       mockShoreline,
+			template: models.TemplateNamePasswordReset,
+			body:     testJSONObject{"content": map[string]interface{}{"Nickname": "Sample"}},
+			respCode: 400,
+		},
+		{
+			sl:       mockShoreline,
+			template: "password_rest",
+			respCode: 404,
+		},
+		{
+			// users can't preview templates
+			sl:       mock_uid1Shoreline,
+			template: models.TemplateNamePasswordReset,
+			respCode: 401,
+		},
+	}
+
+	for idx, test := range tests {
+		testRtr := initTestingTemplatesRouter(t, test.sl)
+		var body = &bytes.Buffer{}
+		if len(test.body) != 0 {
+			json.NewEncoder(body).Encode(test.body)
+		}
+		request := MustRequest(t, "POST", fmt.Sprintf("/templates/%s/render", test.template), body)
+		request.Header.Set(TP_SESSION_TOKEN, testing_uid1)
+		response := httptest.NewRecorder()
+		testRtr.ServeHTTP(response, request)
+
+		if response.Code != test.respCode {
+			t.Fatalf("Test %d: non-expected status code %d (expected %d):\n\tbody: %v",
+				idx, response.Code, test.respCode, response.Body)
+		}
+		if test.contains == "" {
+			continue
+		}
+		var rendered RenderedTemplate
+		if err := json.NewDecoder(response.Body).Decode(&rendered); err != nil {
+			t.Fatalf("Test %d: error decoding response: %s", idx, err)
+		}
+		if rendered.Subject == "" || !strings.Contains(rendered.HTML, test.contains) || !strings.Contains(rendered.Text, test.contains) {
+			t.Errorf("Test %d: expected a rendered email containing %q, got %+v", idx, test.contains, rendered)
+		}
+		if locale, ok := test.body["locale"]; ok && rendered.Locale != "fr" {
+			t.Errorf("Test %d: expected the fr translation for %s, got %s", idx, locale, rendered.Locale)
+		}
+	}
+}
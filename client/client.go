@@ -1385,7 +1385,6 @@ func (r GetSentInvitationsResponse) StatusCode() int {
 type ResendAccountSignupResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
-	JSON404      *ConfirmationError
 	JSON500      *ConfirmationError
 }
 
@@ -2104,13 +2103,6 @@ func ParseResendAccountSignupResponse(rsp *http.Response) (*ResendAccountSignupR
 	}
 
 	switch {
-	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
-		var dest ConfirmationError
-		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
-			return nil, err
-		}
-		response.JSON404 = &dest
-
 	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 500:
 		var dest ConfirmationError
 		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
@@ -23,12 +23,22 @@ const (
 	SignupConfirmation  ConfirmationTypeV1 = "signup_confirmation"
 )
 
+// Defines values for DeliveryStatusV1.
+const (
+	Bounced   DeliveryStatusV1 = "bounced"
+	Delivered DeliveryStatusV1 = "delivered"
+	Failed    DeliveryStatusV1 = "failed"
+	Sent      DeliveryStatusV1 = "sent"
+)
+
 // Defines values for StatusV1.
 const (
-	Canceled  StatusV1 = "canceled"
-	Completed StatusV1 = "completed"
-	Declined  StatusV1 = "declined"
-	Pending   StatusV1 = "pending"
+	Canceled      StatusV1 = "canceled"
+	Completed     StatusV1 = "completed"
+	Declined      StatusV1 = "declined"
+	Expired       StatusV1 = "expired"
+	Pending       StatusV1 = "pending"
+	Undeliverable StatusV1 = "undeliverable"
 )
 
 // Defines values for UnitsmgdlV1.
@@ -130,15 +140,27 @@ type ConfirmationV1 struct {
 	// CreatorId String representation of a Tidepool User ID. Old style IDs are 10-digit strings consisting of only hexadeximcal digits. New style IDs are 36-digit [UUID v4](https://en.wikipedia.org/wiki/Universally_unique_identifier#Version_4_(random))
 	CreatorId *Tidepooluserid `json:"creatorId,omitempty"`
 
+	// Delivery The delivery of the most recent email sent for the confirmation.
+	Delivery *DeliveryV1 `json:"delivery,omitempty"`
+
 	// Email An email address, as specified by [RFC 5322](https://datatracker.ietf.org/doc/html/rfc5322).
 	Email EmailaddressV1 `json:"email"`
 
 	// ExpiresAt If specified, the invitation will expire at the given date and time.
 	ExpiresAt *ExpiresAtV1 `json:"expiresAt,omitempty"`
-	Key       KeyV1        `json:"key"`
+
+	// Id Confirmation id that identifies each confirmation in lists and to the clinic service. Unlike the key, it can't be used to accept the confirmation on its own.
+	Id  IdV1   `json:"id"`
+	Key *KeyV1 `json:"key,omitempty"`
+
+	// Locale A [BCP 47](https://www.rfc-editor.org/info/bcp47) language tag. Emails are sent in the closest available translation, falling back to English.
+	Locale *LocaleV1 `json:"locale,omitempty"`
 
 	// Modified [RFC 3339](https://www.ietf.org/rfc/rfc3339.txt) / [ISO 8601](https://www.iso.org/iso-8601-date-and-time-format.html) timestamp _with_ timezone information
-	Modified     *DatetimeV1        `json:"modified,omitempty"`
+	Modified *DatetimeV1 `json:"modified,omitempty"`
+
+	// Reminders The reminders emailed while the confirmation was pending, oldest first.
+	Reminders    *[]ReminderV1      `json:"reminders,omitempty"`
 	Restrictions *RestrictionsV1    `json:"restrictions,omitempty"`
 	Status       StatusV1           `json:"status"`
 	Type         ConfirmationTypeV1 `json:"type"`
@@ -167,6 +189,25 @@ type DelayV1 struct {
 	Delay *int `json:"delay,omitempty"`
 }
 
+// DeliveryStatusV1 defines model for delivery-status.v1.
+type DeliveryStatusV1 string
+
+// DeliveryV1 The delivery of the most recent email sent for the confirmation.
+type DeliveryV1 struct {
+	// Attempts The number of attempts to send the email.
+	Attempts int `json:"attempts"`
+
+	// LastAttemptTime [RFC 3339](https://www.ietf.org/rfc/rfc3339.txt) / [ISO 8601](https://www.iso.org/iso-8601-date-and-time-format.html) timestamp _with_ timezone information
+	LastAttemptTime DatetimeV1 `json:"lastAttemptTime"`
+
+	// LastError Why the last attempt failed.
+	LastError *string `json:"lastError,omitempty"`
+
+	// ProviderMessageId The id the email provider assigned to the last email sent.
+	ProviderMessageId *string          `json:"providerMessageId,omitempty"`
+	Status            DeliveryStatusV1 `json:"status"`
+}
+
 // DiagnosisdateV1 defines model for diagnosisdate.v1.
 type DiagnosisdateV1 = string
 
@@ -218,6 +259,9 @@ type InvitationV1 struct {
 	// Email An email address, as specified by [RFC 5322](https://datatracker.ietf.org/doc/html/rfc5322).
 	Email EmailaddressV1 `json:"email"`
 
+	// Locale A [BCP 47](https://www.rfc-editor.org/info/bcp47) language tag. Emails are sent in the closest available translation, falling back to English.
+	Locale *LocaleV1 `json:"locale,omitempty"`
+
 	// Nickname A user-friendly name for the recipient of the invitation.
 	Nickname    *string `json:"nickname,omitempty"`
 	Permissions struct {
@@ -227,15 +271,23 @@ type InvitationV1 struct {
 	} `json:"permissions"`
 }
 
+// IdV1 Confirmation id that identifies each confirmation in lists and to the clinic service. Unlike the key, it can't be used to accept the confirmation on its own.
+type IdV1 = string
+
 // KeyV1 defines model for key.v1.
 type KeyV1 = string
 
 // ListV1 defines model for list.v1.
 type ListV1 = []ConfirmationV1
 
-// LookupV1 defines model for lookup.v1.
+// LocaleV1 A [BCP 47](https://www.rfc-editor.org/info/bcp47) language tag. Emails are sent in the closest available translation, falling back to English.
+type LocaleV1 = string
+
+// LookupV1 Identifies the confirmation by its key, from the email, or by its id, from a list of invitations.
 type LookupV1 struct {
-	Key KeyV1 `json:"key"`
+	// Id Confirmation id that identifies each confirmation in lists and to the clinic service. Unlike the key, it can't be used to accept the confirmation on its own.
+	Id  *IdV1  `json:"id,omitempty"`
+	Key *KeyV1 `json:"key,omitempty"`
 }
 
 // PasswordV1 Password
@@ -256,6 +308,15 @@ type RepeatV1 struct {
 	Repeat *int `json:"repeat,omitempty"`
 }
 
+// ReminderV1 A reminder emailed while the confirmation was pending.
+type ReminderV1 struct {
+	// Step The index of the reminder in the reminder schedule of the confirmation's type.
+	Step int `json:"step"`
+
+	// Time [RFC 3339](https://www.ietf.org/rfc/rfc3339.txt) / [ISO 8601](https://www.iso.org/iso-8601-date-and-time-format.html) timestamp _with_ timezone information
+	Time DatetimeV1 `json:"time"`
+}
+
 // RestrictionsV1 defines model for restrictions.v1.
 type RestrictionsV1 struct {
 	// CanAccept Whether the invite can be accepted by the current user
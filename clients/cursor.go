@@ -0,0 +1,92 @@
+package clients
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+// SortOrder orders the confirmations found, by a time and then by id so
+// that the order is total.
+type SortOrder string
+
+const (
+	SortCreatedDescending  SortOrder = "-created"
+	SortCreatedAscending   SortOrder = "created"
+	SortModifiedDescending SortOrder = "-modified"
+	SortModifiedAscending  SortOrder = "modified"
+)
+
+// SortOrders are the valid sort orders, the default first.
+var SortOrders = []SortOrder{
+	SortCreatedDescending,
+	SortCreatedAscending,
+	SortModifiedDescending,
+	SortModifiedAscending,
+}
+
+// Field returns the name of the field sorted by.
+func (s SortOrder) Field() string {
+	switch s {
+	case SortModifiedAscending, SortModifiedDescending:
+		return "modified"
+	default:
+		return "created"
+	}
+}
+
+// Descending reports whether the latest come first.
+func (s SortOrder) Descending() bool {
+	return s == "" || s == SortCreatedDescending || s == SortModifiedDescending
+}
+
+// Time returns the time of the confirmation it's sorted by.
+func (s SortOrder) Time(confirmation *models.Confirmation) time.Time {
+	if s.Field() == "modified" {
+		return confirmation.Modified
+	}
+	return confirmation.Created
+}
+
+// Cursor is the position of a confirmation in a sort order, to find the
+// confirmations that follow it.
+type Cursor struct {
+	Sort SortOrder `json:"s"`
+	Time time.Time `json:"t"`
+	Id   string    `json:"i"`
+}
+
+// NewCursor returns the position of the confirmation in the sort order.
+func NewCursor(sort SortOrder, confirmation *models.Confirmation) *Cursor {
+	if sort == "" {
+		sort = SortCreatedDescending
+	}
+	return &Cursor{Sort: sort, Time: sort.Time(confirmation), Id: confirmation.Id}
+}
+
+// ErrInvalidCursor is returned when a cursor can't be parsed.
+var ErrInvalidCursor = errors.New("clients: invalid cursor")
+
+// ParseCursor parses a cursor encoded by Cursor.String.
+func ParseCursor(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Id == "" || !slices.Contains(SortOrders, cursor.Sort) {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// String encodes the cursor. The encoding is opaque to clients, and may
+// change.
+func (c *Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
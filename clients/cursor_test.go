@@ -0,0 +1,35 @@
+package clients
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+func TestCursor(t *testing.T) {
+	confirmation := &models.Confirmation{
+		Id:       "id",
+		Created:  time.Date(2024, 1, 1, 10, 0, 0, 123000000, time.UTC),
+		Modified: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC),
+	}
+
+	cursor := NewCursor(SortModifiedAscending, confirmation)
+	parsed, err := ParseCursor(cursor.String())
+	if err != nil {
+		t.Fatalf("expected the cursor to be parsed, got %s", err)
+	}
+	if parsed.Sort != SortModifiedAscending || parsed.Id != "id" || !parsed.Time.Equal(confirmation.Modified) {
+		t.Errorf("non-expected cursor %+v", parsed)
+	}
+
+	if cursor := NewCursor("", confirmation); cursor.Sort != SortCreatedDescending || !cursor.Time.Equal(confirmation.Created) {
+		t.Errorf("expected the default sort order, got %+v", cursor)
+	}
+
+	for _, invalid := range []string{"", "not base64!", "e30", (&Cursor{Sort: "key", Id: "id"}).String()} {
+		if _, err := ParseCursor(invalid); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
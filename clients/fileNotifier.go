@@ -0,0 +1,144 @@
+package clients
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// File notifier formats
+const (
+	// FileFormatEML writes each email to an .eml file in the directory.
+	FileFormatEML = "eml"
+	// FileFormatMaildir delivers each email to the new folder of a maildir,
+	// so it can be read with a mail client.
+	FileFormatMaildir = "maildir"
+)
+
+// FileNotifierConfig configures where the file notifier writes emails.
+type FileNotifierConfig struct {
+	Directory   string `default:"mail"`
+	Format      string `default:"eml"`
+	FromAddress string `split_words:"true" default:"Tidepool <noreply@tidepool.org>"`
+}
+
+func fileNotifierConfigProvider() (FileNotifierConfig, error) {
+	var config FileNotifierConfig
+	if err := envconfig.Process("hydrophone_notifier_file", &config); err != nil {
+		return FileNotifierConfig{}, err
+	}
+	return config, nil
+}
+
+// FileNotifier writes every email to a directory as an RFC 5322 message,
+// instead of sending it. It's meant for local development and tests.
+type FileNotifier struct {
+	config FileNotifierConfig
+}
+
+// NewFileNotifier creates a notifier that writes emails to the configured
+// directory, creating it if needed.
+func NewFileNotifier(config FileNotifierConfig) (*FileNotifier, error) {
+	if config.Directory == "" {
+		return nil, errors.New("clients: file notifier directory is missing")
+	}
+	dirs := []string{config.Directory}
+	switch config.Format {
+	case FileFormatEML:
+	case FileFormatMaildir:
+		dirs = []string{maildirTmp(config), maildirNew(config), filepath.Join(config.Directory, "cur")}
+	default:
+		return nil, fmt.Errorf("clients: unknown file notifier format %q", config.Format)
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("clients: failure to create file notifier directory: %w", err)
+		}
+	}
+	return &FileNotifier{
+		config: config,
+	}, nil
+}
+
+func (f *FileNotifier) Send(ctx context.Context, to []string, subject string, html string, text string) SendResult {
+	if len(to) < 1 {
+		return SendResult{Err: errors.New("clients: to is missing")}
+	} else if subject == "" {
+		return SendResult{Err: errors.New("clients: subject is missing")}
+	}
+
+	encodedMessage, messageID, err := encodeMessage(f.config.FromAddress, to, subject, html, text)
+	if err != nil {
+		return SendResult{Err: err}
+	}
+
+	if _, err := f.write(encodedMessage); err != nil {
+		return SendResult{Err: err}
+	}
+	return SendResult{ProviderMessageId: messageID}
+}
+
+// SelfTest checks that the directory can be written to.
+func (f *FileNotifier) SelfTest(ctx context.Context) error {
+	dir := f.config.Directory
+	if f.config.Format == FileFormatMaildir {
+		dir = maildirTmp(f.config)
+	}
+	file, err := os.CreateTemp(dir, ".selftest-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// write the message to a uniquely named file, returning its name. It's written
+// to a temporary file first, so that readers never see a partial message.
+func (f *FileNotifier) write(message []byte) (string, error) {
+	unique := make([]byte, 8)
+	if _, err := rand.Read(unique); err != nil {
+		return "", err
+	}
+
+	var name, temporary, final string
+	switch f.config.Format {
+	case FileFormatMaildir:
+		// Maildir names are time.unique.hostname.
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "localhost"
+		}
+		name = fmt.Sprintf("%d.%s.%s", time.Now().Unix(), hex.EncodeToString(unique), strings.ReplaceAll(hostname, "/", "_"))
+		temporary = filepath.Join(maildirTmp(f.config), name)
+		final = filepath.Join(maildirNew(f.config), name)
+	default:
+		name = fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), hex.EncodeToString(unique))
+		temporary = filepath.Join(f.config.Directory, "."+name)
+		final = filepath.Join(f.config.Directory, name)
+	}
+
+	if err := os.WriteFile(temporary, message, 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(temporary, final); err != nil {
+		os.Remove(temporary)
+		return "", err
+	}
+	return name, nil
+}
+
+func maildirTmp(config FileNotifierConfig) string {
+	return filepath.Join(config.Directory, "tmp")
+}
+
+func maildirNew(config FileNotifierConfig) string {
+	return filepath.Join(config.Directory, "new")
+}
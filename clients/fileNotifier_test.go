@@ -0,0 +1,56 @@
+package clients
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+func TestFileNotifier(s *testing.T) {
+	for _, format := range []string{FileFormatEML, FileFormatMaildir} {
+		s.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			notifier, err := NewFileNotifier(FileNotifierConfig{Directory: dir, Format: format, FromAddress: "Tidepool <noreply@tidepool.org>"})
+			if err != nil {
+				t.Fatalf("error creating notifier: %s", err)
+			}
+			if err := notifier.SelfTest(context.Background()); err != nil {
+				t.Fatalf("expected the self-test to pass, got %s", err)
+			}
+
+			html := `<p>Réinitialisez votre <a href="https://app.example.org/reset?key=1234">mot de passe</a></p>`
+			result := notifier.Send(context.Background(), []string{"me@example.org", "you@example.org"}, "Réinitialisation", html, "Réinitialisez")
+			if result.Err != nil {
+				t.Fatalf("expected the email to be written, got %s", result.Err)
+			}
+
+			email := testutil.NewMailbox(t, dir).Only()
+			if strings.Join(email.To, ",") != "me@example.org,you@example.org" {
+				t.Errorf("non-expected recipients %v", email.To)
+			}
+			if email.Subject != "Réinitialisation" {
+				t.Errorf("non-expected subject %q", email.Subject)
+			}
+			if email.HTML != html || email.Text != "Réinitialisez" {
+				t.Errorf("non-expected bodies %q and %q", email.HTML, email.Text)
+			}
+			if !email.HasLink("https://app.example.org/reset?key=1234") {
+				t.Errorf("expected the reset link, got %v", email.Links())
+			}
+			if email.Header.Get("Message-Id") == "" || email.Header.Get("Date") == "" {
+				t.Errorf("expected Message-ID and Date headers, got %v", email.Header)
+			}
+			if result.ProviderMessageId != email.Header.Get("Message-Id") {
+				t.Errorf("expected the Message-ID %q to be returned, got %q", email.Header.Get("Message-Id"), result.ProviderMessageId)
+			}
+		})
+	}
+
+	s.Run("rejects unknown formats", func(t *testing.T) {
+		if _, err := NewFileNotifier(FileNotifierConfig{Directory: t.TempDir(), Format: "mbox"}); err == nil {
+			t.Fatalf("expected an error")
+		}
+	})
+}
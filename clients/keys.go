@@ -0,0 +1,48 @@
+package clients
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// KeyConfig configures the hashing of confirmation keys.
+type KeyConfig struct {
+	// Secret keys the hashes of the confirmation keys. Changing it
+	// invalidates every outstanding key.
+	Secret string `envconfig:"HYDROPHONE_CONFIRMATION_KEY_SECRET" required:"true"`
+}
+
+func keyConfigProvider() (KeyConfig, error) {
+	var config KeyConfig
+	if err := envconfig.Process("", &config); err != nil {
+		return KeyConfig{}, err
+	}
+	return config, nil
+}
+
+// KeyHasher hashes confirmation keys with HMAC-SHA256, so that only their
+// hashes are stored. Without the secret, the hashes of a backup can't be
+// checked against guessed keys.
+type KeyHasher struct {
+	secret []byte
+}
+
+func NewKeyHasher(secret string) *KeyHasher {
+	return &KeyHasher{secret: []byte(secret)}
+}
+
+// Hash returns the hash of the key.
+func (h *KeyHasher) Hash(key string) string {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(key))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// HashCode returns the hash of the code of the confirmation with the id. The
+// id is hashed along with the code, so that equal codes have different hashes.
+func (h *KeyHasher) HashCode(id, code string) string {
+	return h.Hash(id + ":" + code)
+}
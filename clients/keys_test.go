@@ -0,0 +1,20 @@
+package clients
+
+import "testing"
+
+func TestKeyHasher(t *testing.T) {
+	hasher := NewKeyHasher("secret")
+	hash := hasher.Hash("key")
+	if hash == "" || hash == "key" {
+		t.Fatalf("expected the key to be hashed, got %q", hash)
+	}
+	if hasher.Hash("key") != hash {
+		t.Errorf("expected the hash to be the same each time")
+	}
+	if hasher.Hash("other key") == hash {
+		t.Errorf("expected another key to have another hash")
+	}
+	if NewKeyHasher("other secret").Hash("key") == hash {
+		t.Errorf("expected another secret to give another hash")
+	}
+}
@@ -0,0 +1,80 @@
+package clients
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// encodeMessage encodes an email as a multipart/alternative MIME message with
+// a plain text and an HTML part, ready to be handed to an SMTP server. It
+// returns the message's Message-ID, if one could be generated.
+func encodeMessage(from string, to []string, subject string, html string, text string) ([]byte, string, error) {
+	messageBuffer := &bytes.Buffer{}
+	messageWriter := multipart.NewWriter(messageBuffer)
+
+	fmt.Fprintf(messageBuffer, "From: %s\r\n", from)
+	fmt.Fprintf(messageBuffer, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(messageBuffer, "Subject: %s\r\n", mime.QEncoding.Encode(CharSet, subject))
+	fmt.Fprintf(messageBuffer, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	messageID, err := newMessageID(from)
+	if err == nil {
+		fmt.Fprintf(messageBuffer, "Message-ID: %s\r\n", messageID)
+	}
+	fmt.Fprintf(messageBuffer, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(messageBuffer, "Content-Type: multipart/alternative; boundary=\"%s\"\r\n", messageWriter.Boundary())
+	fmt.Fprintf(messageBuffer, "\r\n")
+
+	// Clients display the last part they support, so the HTML part goes last.
+	if err := writeQuotedPrintablePart(messageWriter, "text/plain", text); err != nil {
+		return nil, "", err
+	}
+	if err := writeQuotedPrintablePart(messageWriter, "text/html", html); err != nil {
+		return nil, "", err
+	}
+
+	if err := messageWriter.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return messageBuffer.Bytes(), messageID, nil
+}
+
+func writeQuotedPrintablePart(messageWriter *multipart.Writer, contentType string, content string) error {
+	headers := textproto.MIMEHeader{}
+	headers.Add("Content-Type", fmt.Sprintf("%s; charset=%s", contentType, CharSet))
+	headers.Add("Content-Transfer-Encoding", "quoted-printable")
+	part, err := messageWriter.CreatePart(headers)
+	if err != nil {
+		return err
+	}
+
+	partWriter := quotedprintable.NewWriter(part)
+	if _, err := partWriter.Write([]byte(content)); err != nil {
+		return err
+	}
+	return partWriter.Close()
+}
+
+// newMessageID returns a unique Message-ID in the domain of the from address.
+func newMessageID(from string) (string, error) {
+	domain := "localhost"
+	if address, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(address.Address, "@"); at >= 0 {
+			domain = address.Address[at+1:]
+		}
+	}
+	unique := make([]byte, 16)
+	if _, err := rand.Read(unique); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(unique), domain), nil
+}
@@ -0,0 +1,146 @@
+package clients
+
+import (
+	"context"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/metrics"
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+// MetricsStoreClient records the latency and errors of each operation of the
+// StoreClient it wraps.
+type MetricsStoreClient struct {
+	store   StoreClient
+	metrics *metrics.Metrics
+}
+
+var _ StoreClient = &MetricsStoreClient{}
+
+func NewMetricsStoreClient(store StoreClient, m *metrics.Metrics) *MetricsStoreClient {
+	return &MetricsStoreClient{
+		store:   store,
+		metrics: m,
+	}
+}
+
+func (s *MetricsStoreClient) Ping(ctx context.Context) (err error) {
+	defer s.observe("Ping", time.Now(), &err)
+	return s.store.Ping(ctx)
+}
+
+func (s *MetricsStoreClient) CheckMigrations(ctx context.Context) (err error) {
+	defer s.observe("CheckMigrations", time.Now(), &err)
+	return s.store.CheckMigrations(ctx)
+}
+
+func (s *MetricsStoreClient) UpsertConfirmation(ctx context.Context, confirmation *models.Confirmation) (err error) {
+	defer s.observe("UpsertConfirmation", time.Now(), &err)
+	return s.store.UpsertConfirmation(ctx, confirmation)
+}
+
+func (s *MetricsStoreClient) FindConfirmations(ctx context.Context, confirmation *models.Confirmation, statuses ...models.Status) (results []*models.Confirmation, err error) {
+	defer s.observe("FindConfirmations", time.Now(), &err)
+	return s.store.FindConfirmations(ctx, confirmation, statuses...)
+}
+
+func (s *MetricsStoreClient) FindConfirmationsWithOpts(ctx context.Context, confirmation *models.Confirmation, opts FilterOpts, statuses ...models.Status) (results []*models.Confirmation, err error) {
+	defer s.observe("FindConfirmationsWithOpts", time.Now(), &err)
+	return s.store.FindConfirmationsWithOpts(ctx, confirmation, opts, statuses...)
+}
+
+func (s *MetricsStoreClient) FindConfirmation(ctx context.Context, confirmation *models.Confirmation) (result *models.Confirmation, err error) {
+	defer s.observe("FindConfirmation", time.Now(), &err)
+	return s.store.FindConfirmation(ctx, confirmation)
+}
+
+func (s *MetricsStoreClient) CheckConfirmationCode(ctx context.Context, email string, confirmationType models.Type, code string) (result *models.Confirmation, matches bool, err error) {
+	defer s.observe("CheckConfirmationCode", time.Now(), &err)
+	return s.store.CheckConfirmationCode(ctx, email, confirmationType, code)
+}
+
+func (s *MetricsStoreClient) RemoveConfirmation(ctx context.Context, confirmation *models.Confirmation) (err error) {
+	defer s.observe("RemoveConfirmation", time.Now(), &err)
+	return s.store.RemoveConfirmation(ctx, confirmation)
+}
+
+func (s *MetricsStoreClient) RemoveConfirmationsForUser(ctx context.Context, userId string) (err error) {
+	defer s.observe("RemoveConfirmationsForUser", time.Now(), &err)
+	return s.store.RemoveConfirmationsForUser(ctx, userId)
+}
+
+func (s *MetricsStoreClient) ExpireConfirmations(ctx context.Context, confirmationType models.Type, now time.Time, limit int) (expired []*models.Confirmation, err error) {
+	defer s.observe("ExpireConfirmations", time.Now(), &err)
+	return s.store.ExpireConfirmations(ctx, confirmationType, now, limit)
+}
+
+func (s *MetricsStoreClient) ClaimReminder(ctx context.Context, confirmationType models.Type, step int, createdBefore, now time.Time) (confirmation *models.Confirmation, err error) {
+	defer s.observe("ClaimReminder", time.Now(), &err)
+	return s.store.ClaimReminder(ctx, confirmationType, step, createdBefore, now)
+}
+
+func (s *MetricsStoreClient) ReleaseReminder(ctx context.Context, confirmationId string, step int) (err error) {
+	defer s.observe("ReleaseReminder", time.Now(), &err)
+	return s.store.ReleaseReminder(ctx, confirmationId, step)
+}
+
+func (s *MetricsStoreClient) FailReminder(ctx context.Context, confirmationId string, step int, reason string) (err error) {
+	defer s.observe("FailReminder", time.Now(), &err)
+	return s.store.FailReminder(ctx, confirmationId, step, reason)
+}
+
+func (s *MetricsStoreClient) ResetReminders(ctx context.Context, confirmationId string) (err error) {
+	defer s.observe("ResetReminders", time.Now(), &err)
+	return s.store.ResetReminders(ctx, confirmationId)
+}
+
+func (s *MetricsStoreClient) RecordDeliveryAttempt(ctx context.Context, confirmationId string, attempt models.DeliveryAttempt) (err error) {
+	defer s.observe("RecordDeliveryAttempt", time.Now(), &err)
+	return s.store.RecordDeliveryAttempt(ctx, confirmationId, attempt)
+}
+
+func (s *MetricsStoreClient) UpdateDeliveryStatus(ctx context.Context, providerMessageId string, status models.DeliveryStatus) (err error) {
+	defer s.observe("UpdateDeliveryStatus", time.Now(), &err)
+	return s.store.UpdateDeliveryStatus(ctx, providerMessageId, status)
+}
+
+func (s *MetricsStoreClient) EnqueueMessage(ctx context.Context, message *models.OutboxMessage) (err error) {
+	defer s.observe("EnqueueMessage", time.Now(), &err)
+	return s.store.EnqueueMessage(ctx, message)
+}
+
+func (s *MetricsStoreClient) ClaimMessage(ctx context.Context, now, lockedUntil time.Time) (message *models.OutboxMessage, err error) {
+	defer s.observe("ClaimMessage", time.Now(), &err)
+	return s.store.ClaimMessage(ctx, now, lockedUntil)
+}
+
+func (s *MetricsStoreClient) UpdateMessage(ctx context.Context, message *models.OutboxMessage) (err error) {
+	defer s.observe("UpdateMessage", time.Now(), &err)
+	return s.store.UpdateMessage(ctx, message)
+}
+
+func (s *MetricsStoreClient) IncrementRateLimit(ctx context.Context, key string, expiresAt time.Time) (count int, err error) {
+	defer s.observe("IncrementRateLimit", time.Now(), &err)
+	return s.store.IncrementRateLimit(ctx, key, expiresAt)
+}
+
+func (s *MetricsStoreClient) UpsertSuppression(ctx context.Context, suppression *models.Suppression) (err error) {
+	defer s.observe("UpsertSuppression", time.Now(), &err)
+	return s.store.UpsertSuppression(ctx, suppression)
+}
+
+func (s *MetricsStoreClient) FindSuppressions(ctx context.Context, emails ...string) (suppressions []*models.Suppression, err error) {
+	defer s.observe("FindSuppressions", time.Now(), &err)
+	return s.store.FindSuppressions(ctx, emails...)
+}
+
+func (s *MetricsStoreClient) RemoveSuppression(ctx context.Context, email string) (err error) {
+	defer s.observe("RemoveSuppression", time.Now(), &err)
+	return s.store.RemoveSuppression(ctx, email)
+}
+
+// observe records the operation once it returns. Pointing to the named error
+// result lets it see the error that was returned.
+func (s *MetricsStoreClient) observe(operation string, start time.Time, err *error) {
+	s.metrics.ObserveStoreOperation(operation, start, *err)
+}
@@ -0,0 +1,39 @@
+package clients
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/tidepool-org/hydrophone/metrics"
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+func TestMetricsStoreClient(t *testing.T) {
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+	store := NewMetricsStoreClient(NewMockStoreClient(false, true), metrics.New(registry))
+
+	if err := store.Ping(ctx); err == nil {
+		t.Fatal("expected the store's error to be returned")
+	}
+	if _, err := store.FindConfirmation(ctx, &models.Confirmation{Key: "key"}); err == nil {
+		t.Fatal("expected the store's error to be returned")
+	}
+
+	expected := `
+# HELP hydrophone_store_operation_errors_total Number of store operations that failed, by operation.
+# TYPE hydrophone_store_operation_errors_total counter
+hydrophone_store_operation_errors_total{operation="FindConfirmation"} 1
+hydrophone_store_operation_errors_total{operation="Ping"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "hydrophone_store_operation_errors_total"); err != nil {
+		t.Error(err)
+	}
+	if count := testutil.CollectAndCount(registry, "hydrophone_store_operation_duration_seconds"); count != 2 {
+		t.Errorf("expected 2 operations to be timed, got %d", count)
+	}
+}
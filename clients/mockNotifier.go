@@ -1,6 +1,7 @@
 package clients
 
 import (
+	"context"
 	"fmt"
 
 	"go.uber.org/fx"
@@ -15,13 +16,21 @@ func NewMockNotifier() Notifier {
 	return &MockNotifier{}
 }
 
-func (c *MockNotifier) Send(to []string, subject string, msg string) (int, string) {
-	details := fmt.Sprintf("Send subject[%s] with message[%s] to %v", subject, msg, to)
+func (c *MockNotifier) Send(ctx context.Context, to []string, subject string, html string, text string) SendResult {
+	details := fmt.Sprintf("Send subject[%s] with message[%s] to %v", subject, text, to)
 	zap.S().Info(details)
-	return 200, details
+	return SendResult{}
+}
+
+// MockNotifierHealth is a NotifierHealth that's always healthy.
+type MockNotifierHealth struct{}
+
+func (MockNotifierHealth) Err() error {
+	return nil
 }
 
 // MockNotifierModule is a fx module for this component
 var MockNotifierModule = fx.Options(
 	fx.Provide(NewMockNotifier),
+	fx.Provide(func() NotifierHealth { return MockNotifierHealth{} }),
 )
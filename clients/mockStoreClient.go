@@ -38,10 +38,18 @@ func (d *MockStoreClient) Ping(ctx context.Context) error {
 	return nil
 }
 
+func (d *MockStoreClient) CheckMigrations(ctx context.Context) error {
+	if d.doBad {
+		return errors.New("CheckMigrations failure")
+	}
+	return nil
+}
+
 func (d *MockStoreClient) UpsertConfirmation(ctx context.Context, notification *models.Confirmation) error {
 	if d.doBad {
 		return errors.New("UpsertConfirmation failure")
 	}
+	notification.MarkSaved()
 	return nil
 }
 
@@ -94,6 +102,24 @@ func (d *MockStoreClient) FindConfirmations(ctx context.Context, confirmation *m
 	return []*models.Confirmation{confirmation}, nil
 }
 
+func (d *MockStoreClient) CheckConfirmationCode(ctx context.Context, email string, confirmationType models.Type, code string) (*models.Confirmation, bool, error) {
+	if d.doBad {
+		return nil, false, errors.New("CheckConfirmationCode failure")
+	}
+	if d.returnNone {
+		return nil, false, nil
+	}
+	confirmation := &models.Confirmation{
+		Email:   email,
+		UserId:  email,
+		Type:    confirmationType,
+		Status:  models.StatusPending,
+		Created: time.Now().AddDate(0, 0, -3), // created three days ago
+		Code:    &models.VerificationCode{ExpiresAt: time.Now().Add(time.Hour), Attempts: 1},
+	}
+	return confirmation, true, nil
+}
+
 func (d *MockStoreClient) RemoveConfirmation(ctx context.Context, notification *models.Confirmation) error {
 	if d.doBad {
 		return errors.New("RemoveConfirmation failure")
@@ -107,3 +133,101 @@ func (d *MockStoreClient) RemoveConfirmationsForUser(ctx context.Context, userId
 	}
 	return nil
 }
+
+func (d *MockStoreClient) ExpireConfirmations(ctx context.Context, confirmationType models.Type, now time.Time, limit int) ([]*models.Confirmation, error) {
+	if d.doBad {
+		return nil, errors.New("ExpireConfirmations failure")
+	}
+	return nil, nil
+}
+
+func (d *MockStoreClient) ClaimReminder(ctx context.Context, confirmationType models.Type, step int, createdBefore, now time.Time) (*models.Confirmation, error) {
+	if d.doBad {
+		return nil, errors.New("ClaimReminder failure")
+	}
+	return nil, nil
+}
+
+func (d *MockStoreClient) ReleaseReminder(ctx context.Context, confirmationId string, step int) error {
+	if d.doBad {
+		return errors.New("ReleaseReminder failure")
+	}
+	return nil
+}
+
+func (d *MockStoreClient) FailReminder(ctx context.Context, confirmationId string, step int, reason string) error {
+	if d.doBad {
+		return errors.New("FailReminder failure")
+	}
+	return nil
+}
+
+func (d *MockStoreClient) ResetReminders(ctx context.Context, confirmationId string) error {
+	if d.doBad {
+		return errors.New("ResetReminders failure")
+	}
+	return nil
+}
+
+func (d *MockStoreClient) EnqueueMessage(ctx context.Context, message *models.OutboxMessage) error {
+	if d.doBad {
+		return errors.New("EnqueueMessage failure")
+	}
+	return nil
+}
+
+func (d *MockStoreClient) ClaimMessage(ctx context.Context, now, lockedUntil time.Time) (*models.OutboxMessage, error) {
+	if d.doBad {
+		return nil, errors.New("ClaimMessage failure")
+	}
+	return nil, nil
+}
+
+func (d *MockStoreClient) UpdateMessage(ctx context.Context, message *models.OutboxMessage) error {
+	if d.doBad {
+		return errors.New("UpdateMessage failure")
+	}
+	return nil
+}
+
+func (d *MockStoreClient) IncrementRateLimit(ctx context.Context, key string, expiresAt time.Time) (int, error) {
+	if d.doBad {
+		return 0, errors.New("IncrementRateLimit failure")
+	}
+	return 1, nil
+}
+
+func (d *MockStoreClient) UpsertSuppression(ctx context.Context, suppression *models.Suppression) error {
+	if d.doBad {
+		return errors.New("UpsertSuppression failure")
+	}
+	return nil
+}
+
+func (d *MockStoreClient) FindSuppressions(ctx context.Context, emails ...string) ([]*models.Suppression, error) {
+	if d.doBad {
+		return nil, errors.New("FindSuppressions failure")
+	}
+	return nil, nil
+}
+
+func (d *MockStoreClient) RemoveSuppression(ctx context.Context, email string) error {
+	if d.doBad {
+		return errors.New("RemoveSuppression failure")
+	}
+	return nil
+}
+
+func (d *MockStoreClient) RecordDeliveryAttempt(ctx context.Context, confirmationId string, attempt models.DeliveryAttempt) error {
+	if d.doBad {
+		return errors.New("RecordDeliveryAttempt failure")
+	}
+	return nil
+}
+
+func (d *MockStoreClient) UpdateDeliveryStatus(ctx context.Context, providerMessageId string, status models.DeliveryStatus) error {
+	if d.doBad {
+		return errors.New("UpdateDeliveryStatus failure")
+	}
+	return nil
+}
@@ -0,0 +1,484 @@
+package clients
+
+import (
+	"context"
+	stdErrs "errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+const (
+	migrationsCollectionName = "migrations"
+
+	// terminalTTLIndexName is the name of the optional TTL index that removes
+	// confirmations some time after they reach a terminal status.
+	terminalTTLIndexName = "terminal_status_ttl"
+)
+
+// emailCollation matches email addresses case-insensitively. Queries on email
+// must use the same collation for MongoDB to use the email indexes.
+var emailCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// terminalStatuses are the statuses a confirmation never leaves.
+var terminalStatuses = []models.Status{
+	models.StatusCompleted,
+	models.StatusCanceled,
+	models.StatusDeclined,
+	models.StatusExpired,
+	models.StatusUndeliverable,
+}
+
+// IndexConfig controls the indexes that aren't managed by migrations.
+type IndexConfig struct {
+	// TerminalStatusTTL removes confirmations this long after they were last
+	// modified, once they've reached a terminal status. Zero disables it. It
+	// needs MongoDB 6.0 or later, since the index filters on the statuses
+	// with $in.
+	TerminalStatusTTL time.Duration `split_words:"true" default:"0"`
+}
+
+// minTerminalTTLVersion is the first MongoDB version whose partial indexes
+// can filter with $in.
+var minTerminalTTLVersion = []int32{6}
+
+const (
+	// migrationRetryBackoff is how long migrateOnStart waits before retrying
+	// failed migrations the first time. It doubles on each failure, up to
+	// maxMigrationRetryBackoff.
+	migrationRetryBackoff    = time.Second
+	maxMigrationRetryBackoff = time.Minute
+)
+
+// indexMigration is a versioned change to the indexes of the confirmations
+// collection, and optionally to its documents once the indexes are built.
+// Migrations must be safe to run more than once, since multiple replicas can
+// start at the same time.
+type indexMigration struct {
+	version     int
+	description string
+	indexes     func(c *MongoStoreClient) map[*mongo.Collection][]mongo.IndexModel
+	documents   func(ctx context.Context, c *MongoStoreClient) error
+}
+
+// migrations are applied in order. Never change a migration once it's been
+// released, append a new one instead.
+var migrations = []indexMigration{
+	{
+		version:     1,
+		description: "type and status",
+		indexes: func(c *MongoStoreClient) map[*mongo.Collection][]mongo.IndexModel {
+			return map[*mongo.Collection][]mongo.IndexModel{
+				confirmationsCollection(c): {
+					{Keys: bson.D{{Key: "type", Value: 1}, {Key: "status", Value: 1}}},
+					{Keys: bson.D{{Key: "type", Value: 1}, {Key: "status", Value: 1}, {Key: "expiresAt", Value: 1}}},
+				},
+				outboxCollection(c): {
+					{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+				},
+			}
+		},
+	},
+	{
+		version:     2,
+		description: "case-insensitive email",
+		indexes: func(c *MongoStoreClient) map[*mongo.Collection][]mongo.IndexModel {
+			return map[*mongo.Collection][]mongo.IndexModel{
+				confirmationsCollection(c): {
+					{
+						Keys: bson.D{{Key: "email", Value: 1}, {Key: "type", Value: 1}, {Key: "status", Value: 1}},
+						Options: options.Index().
+							SetName("email_type_status_collated").
+							SetCollation(emailCollation),
+					},
+				},
+			}
+		},
+	},
+	{
+		version:     3,
+		description: "user, creator and clinic lookups",
+		indexes: func(c *MongoStoreClient) map[*mongo.Collection][]mongo.IndexModel {
+			keys := func(field string) bson.D {
+				return bson.D{{Key: field, Value: 1}, {Key: "type", Value: 1}, {Key: "status", Value: 1}, {Key: "created", Value: -1}}
+			}
+			return map[*mongo.Collection][]mongo.IndexModel{
+				confirmationsCollection(c): {
+					{Keys: keys("userId")},
+					{Keys: keys("creatorId")},
+					{Keys: keys("clinicId")},
+				},
+			}
+		},
+	},
+	{
+		version:     4,
+		description: "rate limit expiry",
+		indexes: func(c *MongoStoreClient) map[*mongo.Collection][]mongo.IndexModel {
+			return map[*mongo.Collection][]mongo.IndexModel{
+				rateLimitsCollection(c): {
+					{
+						Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+						Options: options.Index().SetExpireAfterSeconds(0),
+					},
+				},
+			}
+		},
+	},
+	{
+		version:     5,
+		description: "delivery provider message id",
+		indexes: func(c *MongoStoreClient) map[*mongo.Collection][]mongo.IndexModel {
+			return map[*mongo.Collection][]mongo.IndexModel{
+				confirmationsCollection(c): {
+					{
+						Keys:    bson.D{{Key: "delivery.providerMessageId", Value: 1}},
+						Options: options.Index().SetSparse(true),
+					},
+				},
+			}
+		},
+	},
+	{
+		version:     6,
+		description: "keyset pagination",
+		indexes: func(c *MongoStoreClient) map[*mongo.Collection][]mongo.IndexModel {
+			// The id breaks ties between confirmations created at the same
+			// time, so it's needed for the index to give the sort order.
+			keys := func(field string) bson.D {
+				return bson.D{{Key: field, Value: 1}, {Key: "type", Value: 1}, {Key: "status", Value: 1}, {Key: "created", Value: -1}, {Key: "_id", Value: -1}}
+			}
+			return map[*mongo.Collection][]mongo.IndexModel{
+				confirmationsCollection(c): {
+					{Keys: keys("userId")},
+					{Keys: keys("creatorId")},
+					{Keys: keys("clinicId")},
+				},
+			}
+		},
+	},
+	{
+		version:     7,
+		description: "hashed confirmation keys",
+		indexes: func(c *MongoStoreClient) map[*mongo.Collection][]mongo.IndexModel {
+			return map[*mongo.Collection][]mongo.IndexModel{
+				confirmationsCollection(c): {
+					{
+						Keys:    bson.D{{Key: "keyHash", Value: 1}},
+						Options: options.Index().SetUnique(true).SetSparse(true),
+					},
+				},
+			}
+		},
+		documents: hashConfirmationKeys,
+	},
+}
+
+// migrationRecord tracks the last migration applied to a collection.
+type migrationRecord struct {
+	Collection string    `bson:"_id"`
+	Version    int       `bson:"version"`
+	Modified   time.Time `bson:"modified"`
+}
+
+func migrationsCollection(c *MongoStoreClient) *mongo.Collection {
+	return c.client.Database(c.database).Collection(migrationsCollectionName)
+}
+
+// MigrationVersion returns the version of the last migration applied to the
+// confirmations collection.
+func (c *MongoStoreClient) MigrationVersion(ctx context.Context) (int, error) {
+	var record migrationRecord
+	err := migrationsCollection(c).FindOne(ctx, bson.M{"_id": confirmationsCollectionName}).Decode(&record)
+	if stdErrs.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	return record.Version, err
+}
+
+// Migrate applies the pending index migrations, then reconciles the terminal
+// status TTL index with the configuration.
+func (c *MongoStoreClient) Migrate(ctx context.Context, config IndexConfig) error {
+	current, err := c.MigrationVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("reading migration version: %w", err)
+	}
+
+	for _, migration := range migrations {
+		if migration.version <= current {
+			continue
+		}
+		log := c.log.With(zap.Int("version", migration.version), zap.String("description", migration.description))
+		log.Info("applying index migration")
+		for collection, indexes := range migration.indexes(c) {
+			if _, err := collection.Indexes().CreateMany(ctx, indexes); err != nil {
+				return fmt.Errorf("applying migration %d: %w", migration.version, err)
+			}
+		}
+		if migration.documents != nil {
+			if err := migration.documents(ctx, c); err != nil {
+				return fmt.Errorf("applying migration %d: %w", migration.version, err)
+			}
+		}
+
+		// Never move the version backwards if another replica got further.
+		_, err := migrationsCollection(c).UpdateOne(ctx,
+			bson.M{"_id": confirmationsCollectionName, "version": bson.M{"$lt": migration.version}},
+			bson.M{"$set": bson.M{"version": migration.version, "modified": time.Now()}},
+			options.Update().SetUpsert(true))
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("recording migration %d: %w", migration.version, err)
+		}
+	}
+
+	return c.reconcileTerminalTTL(ctx, config.TerminalStatusTTL)
+}
+
+// CheckMigrations returns an error if the confirmations collection is missing
+// any of the index migrations.
+func (c *MongoStoreClient) CheckMigrations(ctx context.Context) error {
+	current, err := c.MigrationVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if latest := migrations[len(migrations)-1].version; current < latest {
+		return fmt.Errorf("index migrations at version %d of %d", current, latest)
+	}
+	return nil
+}
+
+// reconcileTerminalTTL creates, updates or drops the TTL index so that it
+// matches ttl.
+func (c *MongoStoreClient) reconcileTerminalTTL(ctx context.Context, ttl time.Duration) error {
+	indexes := confirmationsCollection(c).Indexes()
+	cursor, err := indexes.List(ctx)
+	if err != nil {
+		return fmt.Errorf("listing indexes: %w", err)
+	}
+	var existing []struct {
+		Name                    string `bson:"name"`
+		ExpireAfterSeconds      *int32 `bson:"expireAfterSeconds"`
+		PartialFilterExpression struct {
+			Status struct {
+				In []models.Status `bson:"$in"`
+			} `bson:"status"`
+		} `bson:"partialFilterExpression"`
+	}
+	if err := cursor.All(ctx, &existing); err != nil {
+		return fmt.Errorf("listing indexes: %w", err)
+	}
+
+	seconds := int32(ttl / time.Second)
+	for _, index := range existing {
+		if index.Name != terminalTTLIndexName {
+			continue
+		}
+		// The index is also replaced when the terminal statuses change.
+		if index.ExpireAfterSeconds != nil && *index.ExpireAfterSeconds == seconds && seconds > 0 &&
+			slices.Equal(index.PartialFilterExpression.Status.In, terminalStatuses) {
+			return nil
+		}
+		c.log.Info("dropping terminal status TTL index")
+		if _, err := indexes.DropOne(ctx, terminalTTLIndexName); err != nil {
+			return fmt.Errorf("dropping terminal status TTL index: %w", err)
+		}
+	}
+	if seconds <= 0 {
+		return nil
+	}
+
+	var info struct {
+		Version      string  `bson:"version"`
+		VersionArray []int32 `bson:"versionArray"`
+	}
+	if err := c.client.Database("admin").RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&info); err != nil {
+		return fmt.Errorf("reading the server version: %w", err)
+	}
+	if slices.Compare(info.VersionArray, minTerminalTTLVersion) < 0 {
+		c.log.With(zap.String("version", info.Version)).
+			Error("the terminal status TTL index needs MongoDB 6.0 or later, so confirmations won't be removed")
+		return nil
+	}
+
+	c.log.With(zap.Duration("ttl", ttl)).Info("creating terminal status TTL index")
+	_, err = indexes.CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "modified", Value: 1}},
+		Options: options.Index().
+			SetName(terminalTTLIndexName).
+			SetExpireAfterSeconds(seconds).
+			SetPartialFilterExpression(bson.M{"status": bson.M{"$in": terminalStatuses}}),
+	})
+	if err != nil {
+		return fmt.Errorf("creating terminal status TTL index: %w", err)
+	}
+	return nil
+}
+
+// hashConfirmationKeys replaces the plaintext keys of the confirmations stored
+// before keys were hashed, which have their key as their id. They're given a
+// new id, and the outbox messages that refer to them are updated. Clinician
+// invites keep their id instead, since the clinic service knows them by it,
+// and are given a new key, which is never used since their emails don't link
+// to it.
+//
+// The bodies of the emails queued before the migration began are dropped,
+// since they may have a key, so those that weren't sent yet are dead-lettered.
+// Events and the emails queued since then are left alone.
+//
+// A confirmation migrated by another replica at the same time has the same
+// hash, so the unique index keeps only one copy of it.
+func hashConfirmationKeys(ctx context.Context, c *MongoStoreClient) error {
+	started := time.Now()
+	_, err := outboxCollection(c).UpdateMany(ctx,
+		bson.M{
+			"status":  bson.M{"$in": []models.OutboxStatus{models.OutboxStatusPending, models.OutboxStatusSending}},
+			"event":   bson.M{"$exists": false},
+			"created": bson.M{"$lt": started},
+		},
+		bson.M{
+			"$set":   bson.M{"status": models.OutboxStatusDead, "lastError": "dropped when confirmation keys were hashed", "modified": started},
+			"$unset": bson.M{"lockedUntil": ""},
+		})
+	if err != nil {
+		return fmt.Errorf("dead-lettering unsent messages: %w", err)
+	}
+	_, err = outboxCollection(c).UpdateMany(ctx,
+		bson.M{
+			"body":    bson.M{"$ne": ""},
+			"event":   bson.M{"$exists": false},
+			"created": bson.M{"$lt": started},
+		},
+		bson.M{"$set": bson.M{"body": "", "textBody": ""}})
+	if err != nil {
+		return fmt.Errorf("dropping the bodies of messages: %w", err)
+	}
+
+	collection := confirmationsCollection(c)
+	cursor, err := collection.Find(ctx, bson.M{"keyHash": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var document bson.M
+		if err := cursor.Decode(&document); err != nil {
+			return err
+		}
+		key, ok := document["_id"].(string)
+		if !ok {
+			continue
+		}
+
+		if models.Type(fmt.Sprint(document["type"])) == models.TypeClinicianInvite {
+			err = c.rekeyConfirmation(ctx, key)
+		} else {
+			err = c.reidentifyConfirmation(ctx, document, key, c.keys.Hash(key))
+		}
+		// The error mustn't include the key.
+		if err != nil {
+			return fmt.Errorf("hashing the key of a %v confirmation: %w", document["type"], err)
+		}
+	}
+	return cursor.Err()
+}
+
+// rekeyConfirmation gives the confirmation with the id the hash of a new key,
+// so that its id is no longer its key.
+func (c *MongoStoreClient) rekeyConfirmation(ctx context.Context, id string) error {
+	key, err := models.NewKey()
+	if err != nil {
+		return err
+	}
+	_, err = confirmationsCollection(c).UpdateOne(ctx,
+		bson.M{"_id": id, "keyHash": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"keyHash": c.keys.Hash(key)}})
+	return err
+}
+
+// reidentifyConfirmation stores the confirmation with the key under a new id,
+// and the hash of its key, then removes the original.
+func (c *MongoStoreClient) reidentifyConfirmation(ctx context.Context, document bson.M, key, keyHash string) error {
+	collection := confirmationsCollection(c)
+	id, err := models.NewKey()
+	if err != nil {
+		return err
+	}
+	document["_id"] = id
+	document["keyHash"] = keyHash
+	if _, err := collection.InsertOne(ctx, document); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	var migrated struct {
+		Id string `bson:"_id"`
+	}
+	if err := collection.FindOne(ctx, bson.M{"keyHash": keyHash}).Decode(&migrated); err != nil {
+		return err
+	}
+	_, err = outboxCollection(c).UpdateMany(ctx,
+		bson.M{"confirmationId": key},
+		bson.M{"$set": bson.M{"confirmationId": migrated.Id}})
+	if err != nil {
+		return err
+	}
+	_, err = collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+func indexConfigProvider() (IndexConfig, error) {
+	var config IndexConfig
+	if err := envconfig.Process("hydrophone_indexes", &config); err != nil {
+		return IndexConfig{}, err
+	}
+	return config, nil
+}
+
+// migrateOnStart applies the index migrations in the background, since index
+// builds on a large collection can outlast the start timeout. Readiness is
+// reported through CheckMigrations in the meantime. Failed migrations are
+// retried with an exponential backoff until they succeed.
+func migrateOnStart(lifecycle fx.Lifecycle, store *MongoStoreClient, config IndexConfig) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				backoff := migrationRetryBackoff
+				for {
+					err := store.Migrate(ctx, config)
+					if err == nil || ctx.Err() != nil {
+						return
+					}
+					store.log.With(zap.Error(err), zap.Duration("retryIn", backoff)).Error("migrating indexes")
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(backoff):
+					}
+					backoff = min(2*backoff, maxMigrationRetryBackoff)
+				}
+			}()
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-stopCtx.Done():
+				return stopCtx.Err()
+			}
+		},
+	})
+}
@@ -2,9 +2,10 @@ package clients
 
 import (
 	"context"
+	"crypto/hmac"
 	stdErrs "errors"
-	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
@@ -12,26 +13,33 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 
 	tpMongo "github.com/tidepool-org/go-common/clients/mongo"
+	"github.com/tidepool-org/hydrophone/metrics"
 	"github.com/tidepool-org/hydrophone/models"
 )
 
 const (
 	confirmationsCollectionName = "confirmations"
+	outboxCollectionName        = "outbox"
+	rateLimitsCollectionName    = "rateLimits"
+	suppressionsCollectionName  = "suppressions"
 )
 
 // MongoStoreClient - Mongo Storage Client
 type MongoStoreClient struct {
 	client   *mongo.Client
 	database string
+	keys     *KeyHasher
 	log      *zap.SugaredLogger
 }
 
-// NewMongoStoreClient creates a new MongoStoreClient
-func NewMongoStoreClient(config *tpMongo.Config, log *zap.SugaredLogger) (*MongoStoreClient, error) {
+// NewMongoStoreClient creates a new MongoStoreClient, which stores the hashes
+// of confirmation keys made by keys.
+func NewMongoStoreClient(config *tpMongo.Config, keys *KeyHasher, log *zap.SugaredLogger) (*MongoStoreClient, error) {
 	connectionString, err := config.ToConnectionString()
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid MongoDB configuration")
@@ -46,30 +54,11 @@ func NewMongoStoreClient(config *tpMongo.Config, log *zap.SugaredLogger) (*Mongo
 	return &MongoStoreClient{
 		client:   mongoClient,
 		database: config.Database,
+		keys:     keys,
 		log:      log,
 	}, nil
 }
 
-// EnsureIndexes exist for the MongoDB collection. EnsureIndexes uses the Background() context, in order
-// to pass back the MongoDB errors, rather than any context errors.
-// TODO: There could be more indexes here for performance reasons.
-// Current performance as of 2020-01 is sufficient.
-func (c *MongoStoreClient) EnsureIndexes(ctx context.Context) error {
-	indexes := []mongo.IndexModel{
-		{
-			Keys: bson.D{{Key: "type", Value: 1}, {Key: "status", Value: 1}},
-			Options: options.Index().
-				SetBackground(true),
-		},
-	}
-
-	if _, err := confirmationsCollection(c).Indexes().CreateMany(ctx, indexes); err != nil {
-		c.log.With(zap.Error(err)).Fatal("creating indexes")
-	}
-
-	return nil
-}
-
 func mongoConfigProvider() (tpMongo.Config, error) {
 	var config tpMongo.Config
 	err := envconfig.Process("", &config)
@@ -79,18 +68,44 @@ func mongoConfigProvider() (tpMongo.Config, error) {
 	return config, nil
 }
 
-func mongoStoreProvider(config tpMongo.Config, log *zap.SugaredLogger) (StoreClient, error) {
-	return NewMongoStoreClient(&config, log)
+func mongoStoreProvider(config tpMongo.Config, keyConfig KeyConfig, log *zap.SugaredLogger) (*MongoStoreClient, error) {
+	return NewMongoStoreClient(&config, NewKeyHasher(keyConfig.Secret), log)
 }
 
 // MongoModule for dependency injection
-var MongoModule = fx.Options(fx.Provide(mongoConfigProvider, mongoStoreProvider))
+var MongoModule = fx.Options(
+	fx.Provide(
+		mongoConfigProvider,
+		keyConfigProvider,
+		indexConfigProvider,
+		mongoStoreProvider,
+		func(c *MongoStoreClient, m *metrics.Metrics, provider trace.TracerProvider) StoreClient {
+			return NewMetricsStoreClient(NewTracingStoreClient(c, provider), m)
+		},
+	),
+	fx.Invoke(migrateOnStart),
+)
 
 // wrapper function for consistent access to the collection
 func confirmationsCollection(c *MongoStoreClient) *mongo.Collection {
 	return c.client.Database(c.database).Collection(confirmationsCollectionName)
 }
 
+// wrapper function for consistent access to the outbox collection
+func outboxCollection(c *MongoStoreClient) *mongo.Collection {
+	return c.client.Database(c.database).Collection(outboxCollectionName)
+}
+
+// wrapper function for consistent access to the rate limits collection
+func rateLimitsCollection(c *MongoStoreClient) *mongo.Collection {
+	return c.client.Database(c.database).Collection(rateLimitsCollectionName)
+}
+
+// wrapper function for consistent access to the suppressions collection
+func suppressionsCollection(c *MongoStoreClient) *mongo.Collection {
+	return c.client.Database(c.database).Collection(suppressionsCollectionName)
+}
+
 // Ping the MongoDB database
 func (c *MongoStoreClient) Ping(ctx context.Context) error {
 	// do we have a store session
@@ -103,13 +118,57 @@ func (c *MongoStoreClient) Disconnect(ctx context.Context) error {
 }
 
 // UpsertConfirmation updates an existing confirmation, or inserts a new one if not already present.
+// The hash of its key is stored if the key is known.
+//
+// Only the status changes made since the confirmation was found are written:
+// its status is only updated if it's still the status it was found with, and
+// the history is appended to rather than replaced. Otherwise ErrStatusChanged
+// is returned, and nothing is saved.
 func (c *MongoStoreClient) UpsertConfirmation(ctx context.Context, confirmation *models.Confirmation) error {
-	opts := options.FindOneAndUpdate().SetUpsert(true)
-	result := confirmationsCollection(c).FindOneAndUpdate(ctx,
-		bson.M{"_id": confirmation.Key}, bson.D{{Key: "$set", Value: confirmation}}, opts)
-	if result.Err() != mongo.ErrNoDocuments {
-		return result.Err()
+	if confirmation.Key != "" {
+		confirmation.KeyHash = c.keys.Hash(confirmation.Key)
+	}
+	if code := confirmation.Code; code != nil && code.Value != "" {
+		code.Hash = c.keys.HashCode(confirmation.Id, code.Value)
+	}
+
+	// The reminders and delivery are only changed by their own methods.
+	stored := *confirmation
+	stored.Reminders = nil
+	stored.ReminderFailures = 0
+	stored.Delivery = nil
+	stored.History = nil
+	data, err := bson.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+	var fields bson.M
+	if err := bson.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	selector := bson.M{"_id": confirmation.Id}
+	update := bson.M{"$set": fields}
+	if previous, changed := confirmation.PreviousStatus(); changed && !confirmation.IsNew() {
+		selector["status"] = previous
+	} else if !changed {
+		delete(fields, "status")
+		update["$setOnInsert"] = bson.M{"status": confirmation.Status}
+	}
+	if history := confirmation.UnsavedHistory(); len(history) > 0 {
+		update["$push"] = bson.M{"history": bson.M{"$each": history}}
 	}
+
+	// When the status has changed since, the upsert tries to insert a
+	// confirmation with the same id.
+	_, err = confirmationsCollection(c).UpdateOne(ctx, selector, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrStatusChanged
+	}
+	if err != nil {
+		return err
+	}
+	confirmation.MarkSaved()
 	return nil
 }
 
@@ -117,15 +176,15 @@ func (c *MongoStoreClient) UpsertConfirmation(ctx context.Context, confirmation
 func (c *MongoStoreClient) FindConfirmation(ctx context.Context, confirmation *models.Confirmation) (result *models.Confirmation, err error) {
 	var query bson.M = bson.M{}
 
+	collate := false
 	if confirmation.Email != "" {
-		// case insensitive match
-		// TODO: should use an index with collation, not a case-insensitive regex, since that can't use an index
-		// However, we need MongoDB 3.2 to do this. See https://tidepool.atlassian.net/browse/BACK-1133
-		// Collated index on type+email
-		query["email"] = bson.M{"$regex": primitive.Regex{Pattern: fmt.Sprintf("^%s$", regexp.QuoteMeta(confirmation.Email)), Options: "i"}}
+		query["email"], collate = emailQuery(confirmation)
+	}
+	if confirmation.Id != "" {
+		query["_id"] = confirmation.Id
 	}
 	if confirmation.Key != "" {
-		query["_id"] = confirmation.Key
+		query["$or"] = c.keyQuery(confirmation.Key)
 	}
 	if string(confirmation.Status) != "" {
 		query["status"] = confirmation.Status
@@ -144,6 +203,9 @@ func (c *MongoStoreClient) FindConfirmation(ctx context.Context, confirmation *m
 	}
 
 	opts := options.FindOne().SetSort(bson.D{{Key: "created", Value: -1}})
+	if collate {
+		opts.SetCollation(emailCollation)
+	}
 
 	if err = confirmationsCollection(c).FindOne(ctx, query, opts).Decode(&result); err != nil && !stdErrs.Is(err, mongo.ErrNoDocuments) {
 		return result, err
@@ -160,15 +222,16 @@ func (c *MongoStoreClient) FindConfirmations(ctx context.Context, confirmation *
 func (c *MongoStoreClient) FindConfirmationsWithOpts(ctx context.Context, confirmation *models.Confirmation, extraFilters FilterOpts, statuses ...models.Status) (results []*models.Confirmation, err error) {
 	var query bson.M = bson.M{}
 
+	collate := false
 	if confirmation.Email != "" {
-		// case insensitive match
-		// TODO: should use an index with collation, not a case-insensitive regex, since that can't use an index
-		// However, we need MongoDB 3.2 to do this. See https://tidepool.atlassian.net/browse/BACK-1133
-		// Collated index on type+email
-		query["email"] = bson.M{"$regex": primitive.Regex{Pattern: fmt.Sprintf("^%s$", regexp.QuoteMeta(confirmation.Email)), Options: "i"}}
+		query["email"], collate = emailQuery(confirmation)
+	}
+	var and []bson.M
+	if confirmation.Id != "" {
+		query["_id"] = confirmation.Id
 	}
 	if confirmation.Key != "" {
-		query["_id"] = confirmation.Key
+		and = append(and, bson.M{"$or": c.keyQuery(confirmation.Key)})
 	}
 	if string(confirmation.Type) != "" {
 		query["type"] = confirmation.Type
@@ -186,22 +249,132 @@ func (c *MongoStoreClient) FindConfirmationsWithOpts(ctx context.Context, confir
 	if len(statuses) > 0 {
 		query["status"] = bson.M{"$in": statuses}
 	}
+	if created := timeRange(extraFilters.CreatedAfter, extraFilters.CreatedBefore); created != nil {
+		query["created"] = created
+	}
+	if modified := timeRange(extraFilters.ModifiedAfter, extraFilters.ModifiedBefore); modified != nil {
+		query["modified"] = modified
+	}
 
-	opts := options.Find().SetSort(bson.D{{Key: "created", Value: -1}})
+	sort := extraFilters.Sort
+	if extraFilters.After != nil {
+		sort = extraFilters.After.Sort
+		and = append(and, bson.M{"$or": afterCursor(extraFilters.After)})
+	}
+	if len(and) > 0 {
+		query["$and"] = and
+	}
+	direction := 1
+	if sort.Descending() {
+		direction = -1
+	}
+	opts := options.Find().SetSort(bson.D{{Key: sort.Field(), Value: direction}, {Key: "_id", Value: direction}})
+	if extraFilters.Limit > 0 {
+		opts.SetLimit(int64(extraFilters.Limit))
+	}
+	if collate {
+		opts.SetCollation(emailCollation)
+	}
 	cursor, err := confirmationsCollection(c).Find(ctx, query, opts)
 	if err != nil {
 		return nil, err
 	}
+	defer cursor.Close(ctx)
+
+	// Decode as the batches arrive, rather than loading them all first.
+	for cursor.Next(ctx) {
+		result := &models.Confirmation{}
+		if err := cursor.Decode(result); err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, cursor.Err()
+}
+
+// timeRange returns the filter of the times strictly between after and
+// before, or nil if both are zero.
+func timeRange(after, before time.Time) bson.M {
+	if after.IsZero() && before.IsZero() {
+		return nil
+	}
+	filter := bson.M{}
+	if !after.IsZero() {
+		filter["$gt"] = after
+	}
+	if !before.IsZero() {
+		filter["$lt"] = before
+	}
+	return filter
+}
 
-	if err = cursor.All(ctx, &results); err != nil {
-		return results, err
+// afterCursor returns the filter of the confirmations that come after the
+// cursor in its sort order.
+func afterCursor(after *Cursor) []bson.M {
+	operator := "$gt"
+	if after.Sort.Descending() {
+		operator = "$lt"
+	}
+	field := after.Sort.Field()
+	return []bson.M{
+		{field: bson.M{operator: after.Time}},
+		{field: after.Time, "_id": bson.M{operator: after.Id}},
 	}
-	return results, nil
+}
+
+// emailQuery returns the filter that matches the confirmation's email
+// case-insensitively, and whether the query must use the email collation.
+//
+// The collation applies to the whole query, so it would also make the id and
+// key matches case-insensitive. Since those select a single confirmation
+// through their own indexes, the email is matched with a case-insensitive
+// regular expression instead when either is given. Otherwise the collated
+// email index is used. The user, creator and clinic ids matched along with it
+// are lowercase hex, so the collation doesn't change what they match.
+func emailQuery(confirmation *models.Confirmation) (interface{}, bool) {
+	if confirmation.Id != "" || confirmation.Key != "" {
+		return primitive.Regex{Pattern: "^" + regexp.QuoteMeta(confirmation.Email) + "$", Options: "i"}, false
+	}
+	return confirmation.Email, true
+}
+
+// keyQuery returns the alternatives that match the confirmation with the key.
+// The confirmations that are yet to be migrated have their key as their id,
+// and no hash.
+func (c *MongoStoreClient) keyQuery(key string) []bson.M {
+	return []bson.M{
+		{"keyHash": c.keys.Hash(key)},
+		{"_id": key, "keyHash": bson.M{"$exists": false}},
+	}
+}
+
+func (c *MongoStoreClient) CheckConfirmationCode(ctx context.Context, email string, confirmationType models.Type, code string) (result *models.Confirmation, matches bool, err error) {
+	query := bson.M{
+		// case insensitive match, using the collated email index
+		"email":     email,
+		"type":      confirmationType,
+		"status":    models.StatusPending,
+		"code.hash": bson.M{"$exists": true},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "created", Value: -1}}).
+		SetCollation(emailCollation).
+		SetReturnDocument(options.After)
+	err = confirmationsCollection(c).FindOneAndUpdate(ctx, query,
+		bson.M{"$inc": bson.M{"code.attempts": 1}}, opts).Decode(&result)
+	if stdErrs.Is(err, mongo.ErrNoDocuments) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	hash := c.keys.HashCode(result.Id, code)
+	return result, hmac.Equal([]byte(hash), []byte(result.Code.Hash)), nil
 }
 
 // RemoveConfirmation - Remove a confirmation from the database
 func (c *MongoStoreClient) RemoveConfirmation(ctx context.Context, confirmation *models.Confirmation) error {
-	result := confirmationsCollection(c).FindOneAndDelete(ctx, bson.M{"_id": confirmation.Key})
+	result := confirmationsCollection(c).FindOneAndDelete(ctx, bson.M{"_id": confirmation.Id})
 	if result.Err() != mongo.ErrNoDocuments {
 		return result.Err()
 	}
@@ -233,3 +406,237 @@ func (c *MongoStoreClient) RemoveConfirmationsForUser(ctx context.Context, userI
 	_, err := confirmationsCollection(c).DeleteMany(ctx, selector)
 	return err
 }
+
+// ExpireConfirmations updates a batch of expired pending confirmations.
+//
+// The confirmations of a batch are looked up first, then each is only updated
+// if it's still pending, so concurrent sweeps from multiple replicas never
+// return the same confirmation twice.
+func (c *MongoStoreClient) ExpireConfirmations(ctx context.Context, confirmationType models.Type, now time.Time, limit int) ([]*models.Confirmation, error) {
+	selector := bson.M{
+		"type":      confirmationType,
+		"status":    models.StatusPending,
+		"expiresAt": bson.M{"$lte": now},
+	}
+	cursor, err := confirmationsCollection(c).Find(ctx, selector, options.Find().SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	var found []*models.Confirmation
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	expired := make([]*models.Confirmation, 0, len(found))
+	change := models.StatusChange{
+		From:  models.StatusPending,
+		To:    models.StatusExpired,
+		Actor: models.ActorServer,
+		Time:  now,
+	}
+	update := bson.M{
+		"$set":  bson.M{"status": models.StatusExpired, "modified": now},
+		"$push": bson.M{"history": change},
+	}
+	for _, confirmation := range found {
+		selector := bson.M{"_id": confirmation.Id, "status": models.StatusPending}
+		result, err := confirmationsCollection(c).UpdateOne(ctx, selector, update)
+		if err != nil {
+			return expired, err
+		}
+		if result.ModifiedCount == 1 {
+			confirmation.Status = models.StatusExpired
+			confirmation.Modified = now
+			confirmation.History = append(confirmation.History, change)
+			expired = append(expired, confirmation)
+		}
+	}
+	return expired, nil
+}
+
+// ClaimReminder atomically records a reminder on a confirmation that's due
+// one. Since the claim is a single FindOneAndUpdate, multiple schedulers can
+// run concurrently without reminding a confirmation twice.
+func (c *MongoStoreClient) ClaimReminder(ctx context.Context, confirmationType models.Type, step int, createdBefore, now time.Time) (*models.Confirmation, error) {
+	selector := bson.M{
+		"type":      confirmationType,
+		"status":    models.StatusPending,
+		"email":     bson.M{"$gt": ""},
+		"created":   bson.M{"$lte": createdBefore},
+		"reminders": bson.M{"$not": bson.M{"$elemMatch": bson.M{"step": bson.M{"$gte": step}}}},
+		"$or": []bson.M{
+			{"expiresAt": nil},
+			{"expiresAt": bson.M{"$gt": now}},
+		},
+	}
+	update := bson.M{
+		"$push": bson.M{"reminders": models.Reminder{Step: step, Time: now}},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "created", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var confirmation *models.Confirmation
+	err := confirmationsCollection(c).FindOneAndUpdate(ctx, selector, update, opts).Decode(&confirmation)
+	if stdErrs.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	return confirmation, err
+}
+
+func (c *MongoStoreClient) ReleaseReminder(ctx context.Context, confirmationId string, step int) error {
+	_, err := confirmationsCollection(c).UpdateOne(ctx,
+		bson.M{"_id": confirmationId},
+		bson.M{
+			"$pull": bson.M{"reminders": bson.M{"step": step}},
+			"$inc":  bson.M{"reminderFailures": 1},
+		})
+	return err
+}
+
+func (c *MongoStoreClient) FailReminder(ctx context.Context, confirmationId string, step int, reason string) error {
+	_, err := confirmationsCollection(c).UpdateOne(ctx,
+		bson.M{"_id": confirmationId, "reminders.step": step},
+		bson.M{"$set": bson.M{"reminders.$.error": reason}})
+	return err
+}
+
+func (c *MongoStoreClient) ResetReminders(ctx context.Context, confirmationId string) error {
+	_, err := confirmationsCollection(c).UpdateOne(ctx,
+		bson.M{"_id": confirmationId},
+		bson.M{"$unset": bson.M{"reminders": "", "reminderFailures": ""}})
+	return err
+}
+
+// EnqueueMessage inserts a new message into the outbox.
+func (c *MongoStoreClient) EnqueueMessage(ctx context.Context, message *models.OutboxMessage) error {
+	_, err := outboxCollection(c).InsertOne(ctx, message)
+	return err
+}
+
+// ClaimMessage atomically locks the oldest message that's due for delivery.
+//
+// Messages that are pending and due, as well as messages whose lock has expired
+// (e.g. the dispatcher holding them crashed), can be claimed. Since the claim is
+// a single FindOneAndUpdate, multiple dispatchers can run concurrently without
+// delivering a message twice.
+func (c *MongoStoreClient) ClaimMessage(ctx context.Context, now, lockedUntil time.Time) (*models.OutboxMessage, error) {
+	selector := bson.M{
+		"$or": []bson.M{
+			{"status": models.OutboxStatusPending, "nextAttemptAt": bson.M{"$lte": now}},
+			{"status": models.OutboxStatusSending, "lockedUntil": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      models.OutboxStatusSending,
+			"lockedUntil": lockedUntil,
+			"modified":    now,
+		},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var message *models.OutboxMessage
+	err := outboxCollection(c).FindOneAndUpdate(ctx, selector, update, opts).Decode(&message)
+	if stdErrs.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	return message, err
+}
+
+// UpdateMessage replaces an outbox message with its updated version.
+func (c *MongoStoreClient) UpdateMessage(ctx context.Context, message *models.OutboxMessage) error {
+	_, err := outboxCollection(c).ReplaceOne(ctx, bson.M{"_id": message.Id}, message)
+	return err
+}
+
+// IncrementRateLimit atomically increments the rate limit counter with the
+// given key. Counters are removed by a TTL index once they've expired.
+func (c *MongoStoreClient) IncrementRateLimit(ctx context.Context, key string, expiresAt time.Time) (int, error) {
+	update := bson.M{
+		"$inc":         bson.M{"count": 1},
+		"$setOnInsert": bson.M{"expiresAt": expiresAt},
+	}
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
+
+	var counter struct {
+		Count int `bson:"count"`
+	}
+	err := rateLimitsCollection(c).FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&counter)
+	if mongo.IsDuplicateKeyError(err) {
+		// Another replica created the counter concurrently, it exists now.
+		err = rateLimitsCollection(c).FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&counter)
+	}
+	return counter.Count, err
+}
+
+// UpsertSuppression adds the suppression, keeping the time an address was
+// first suppressed.
+func (c *MongoStoreClient) UpsertSuppression(ctx context.Context, suppression *models.Suppression) error {
+	update := bson.M{
+		"$set": bson.M{
+			"reason":   suppression.Reason,
+			"detail":   suppression.Detail,
+			"modified": suppression.Modified,
+		},
+		"$setOnInsert": bson.M{"created": suppression.Created},
+	}
+	_, err := suppressionsCollection(c).UpdateOne(ctx, bson.M{"_id": models.SuppressionEmail(suppression.Email)}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (c *MongoStoreClient) FindSuppressions(ctx context.Context, emails ...string) ([]*models.Suppression, error) {
+	keys := make([]string, 0, len(emails))
+	for _, email := range emails {
+		keys = append(keys, models.SuppressionEmail(email))
+	}
+
+	cursor, err := suppressionsCollection(c).Find(ctx, bson.M{"_id": bson.M{"$in": keys}})
+	if err != nil {
+		return nil, err
+	}
+	var suppressions []*models.Suppression
+	if err := cursor.All(ctx, &suppressions); err != nil {
+		return nil, err
+	}
+	return suppressions, nil
+}
+
+func (c *MongoStoreClient) RemoveSuppression(ctx context.Context, email string) error {
+	_, err := suppressionsCollection(c).DeleteOne(ctx, bson.M{"_id": models.SuppressionEmail(email)})
+	return err
+}
+
+// RecordDeliveryAttempt counts the attempt in the confirmation's delivery
+// record. Only the delivery record is updated, so that it doesn't overwrite
+// concurrent changes to the confirmation.
+func (c *MongoStoreClient) RecordDeliveryAttempt(ctx context.Context, confirmationId string, attempt models.DeliveryAttempt) error {
+	set := bson.M{
+		"delivery.status":          attempt.Status(),
+		"delivery.lastAttemptTime": attempt.Time,
+	}
+	update := bson.M{
+		"$inc": bson.M{"delivery.attempts": 1},
+		"$set": set,
+	}
+	if attempt.Error != "" {
+		set["delivery.lastError"] = attempt.Error
+	} else {
+		set["delivery.providerMessageId"] = attempt.ProviderMessageId
+		update["$unset"] = bson.M{"delivery.lastError": ""}
+	}
+	_, err := confirmationsCollection(c).UpdateOne(ctx, bson.M{"_id": confirmationId}, update)
+	return err
+}
+
+func (c *MongoStoreClient) UpdateDeliveryStatus(ctx context.Context, providerMessageId string, status models.DeliveryStatus) error {
+	_, err := confirmationsCollection(c).UpdateOne(ctx,
+		bson.M{"delivery.providerMessageId": providerMessageId},
+		bson.M{"$set": bson.M{"delivery.status": status}})
+	return err
+}
@@ -2,9 +2,13 @@ package clients
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
 	"github.com/tidepool-org/go-common/clients/mongo"
 	"github.com/tidepool-org/hydrophone/models"
 	"github.com/tidepool-org/hydrophone/testutil"
@@ -18,7 +22,7 @@ func TestMongoStoreConfirmationOperations(t *testing.T) {
 	doesNotExist := MustConfirmation(t, models.TypePasswordReset, models.TemplateNamePasswordReset, "123.456")
 	testingConfig := &mongo.Config{ConnectionString: "mongodb://127.0.0.1/confirm_test", Database: "confirm_test"}
 
-	mc, err := NewMongoStoreClient(testingConfig, testutil.NewLogger(t))
+	mc, err := NewMongoStoreClient(testingConfig, testingKeys, testutil.NewLogger(t))
 	if err != nil {
 		t.Fatalf("we could not create the store: %v", err)
 	}
@@ -40,7 +44,7 @@ func TestMongoStoreConfirmationOperations(t *testing.T) {
 		if found == nil {
 			t.Fatalf("the confirmation was not found")
 		}
-		if found.Key == "" {
+		if found.Id == "" || found.KeyHash == "" {
 			t.Fatalf("the confirmation string isn't included %v", found)
 		}
 	} else {
@@ -53,13 +57,21 @@ func TestMongoStoreConfirmationOperations(t *testing.T) {
 		if found == nil {
 			t.Fatalf("the uppercase confirmation was not found")
 		}
-		if found.Key == "" {
+		if found.Id == "" || found.KeyHash == "" {
 			t.Fatalf("the confirmation string isn't included %v", found)
 		}
 	} else {
 		t.Fatalf("no confirmation was returned when it should have been - err[%v]", err)
 	}
 
+	// Only the email matches case-insensitively
+	if found, err := mc.FindConfirmation(context.Background(), &models.Confirmation{Id: strings.ToUpper(confirmation.Id), Email: confirmation.Email}); err != nil || found != nil {
+		t.Fatalf("expected the id to match case-sensitively, got %v: %v", found, err)
+	}
+	if found, err := mc.FindConfirmation(context.Background(), &models.Confirmation{Id: confirmation.Id, Email: confirmation.Email}); err != nil || found == nil {
+		t.Fatalf("expected the uppercase email to match along with the id, got %v: %v", found, err)
+	}
+
 	//when the conf doesn't exist
 	if found, err := mc.FindConfirmation(context.Background(), doesNotExist); err == nil && found != nil {
 		t.Fatalf("there should have been no confirmation found [%v]", found)
@@ -151,6 +163,521 @@ func TestMongoStoreConfirmationOperations(t *testing.T) {
 	}
 }
 
+func TestMongoStoreMigrations(t *testing.T) {
+	testingConfig := &mongo.Config{ConnectionString: "mongodb://127.0.0.1/confirm_test", Database: "confirm_test"}
+
+	mc, err := NewMongoStoreClient(testingConfig, testingKeys, testutil.NewLogger(t))
+	if err != nil {
+		t.Fatalf("we could not create the store: %v", err)
+	}
+
+	ctx := context.Background()
+	confirmationsCollection(mc).Drop(ctx)
+	migrationsCollection(mc).Drop(ctx)
+
+	if err := mc.CheckMigrations(ctx); err == nil {
+		t.Fatalf("migrations should be pending before they're applied")
+	}
+
+	// Running twice must be harmless, since every replica migrates on start.
+	for i := 0; i < 2; i++ {
+		if err := mc.Migrate(ctx, IndexConfig{TerminalStatusTTL: time.Hour}); err != nil {
+			t.Fatalf("we could not migrate: %v", err)
+		}
+	}
+	if err := mc.CheckMigrations(ctx); err != nil {
+		t.Fatalf("migrations should have been applied: %v", err)
+	}
+	if version, err := mc.MigrationVersion(ctx); err != nil || version != migrations[len(migrations)-1].version {
+		t.Fatalf("unexpected migration version %d: %v", version, err)
+	}
+	if !hasIndex(t, mc, terminalTTLIndexName) {
+		t.Fatalf("the terminal status TTL index should have been created")
+	}
+
+	if err := mc.Migrate(ctx, IndexConfig{}); err != nil {
+		t.Fatalf("we could not migrate: %v", err)
+	}
+	if hasIndex(t, mc, terminalTTLIndexName) {
+		t.Fatalf("the terminal status TTL index should have been dropped")
+	}
+}
+
+func TestMongoStoreRateLimits(t *testing.T) {
+	testingConfig := &mongo.Config{ConnectionString: "mongodb://127.0.0.1/confirm_test", Database: "confirm_test"}
+
+	mc, err := NewMongoStoreClient(testingConfig, testingKeys, testutil.NewLogger(t))
+	if err != nil {
+		t.Fatalf("we could not create the store: %v", err)
+	}
+
+	ctx := context.Background()
+	rateLimitsCollection(mc).Drop(ctx)
+
+	expiresAt := time.Now().Add(time.Hour)
+	for want := 1; want <= 3; want++ {
+		if count, err := mc.IncrementRateLimit(ctx, "key", expiresAt); err != nil || count != want {
+			t.Fatalf("expected count %d, got %d: %v", want, count, err)
+		}
+	}
+	if count, err := mc.IncrementRateLimit(ctx, "other", expiresAt); err != nil || count != 1 {
+		t.Fatalf("expected a new counter for another key, got %d: %v", count, err)
+	}
+}
+
+func TestMongoStoreSuppressions(t *testing.T) {
+	testingConfig := &mongo.Config{ConnectionString: "mongodb://127.0.0.1/confirm_test", Database: "confirm_test"}
+
+	mc, err := NewMongoStoreClient(testingConfig, testingKeys, testutil.NewLogger(t))
+	if err != nil {
+		t.Fatalf("we could not create the store: %v", err)
+	}
+
+	ctx := context.Background()
+	suppressionsCollection(mc).Drop(ctx)
+
+	suppression, err := models.NewSuppression("Bounced@Example.org", models.SuppressionReasonBounce, "Permanent/General")
+	if err != nil {
+		t.Fatalf("we could not create the suppression: %v", err)
+	}
+	if err := mc.UpsertSuppression(ctx, suppression); err != nil {
+		t.Fatalf("we could not save the suppression: %v", err)
+	}
+
+	found, err := mc.FindSuppressions(ctx, "other@example.org", "BOUNCED@example.org")
+	if err != nil || len(found) != 1 || found[0].Reason != models.SuppressionReasonBounce {
+		t.Fatalf("expected the suppression to be found case-insensitively, got %v: %v", found, err)
+	}
+
+	if err := mc.RemoveSuppression(ctx, "bounced@example.org"); err != nil {
+		t.Fatalf("we could not remove the suppression: %v", err)
+	}
+	if found, err := mc.FindSuppressions(ctx, "bounced@example.org"); err != nil || len(found) != 0 {
+		t.Fatalf("expected the suppression to be removed, got %v: %v", found, err)
+	}
+}
+
+func TestMongoStoreDelivery(t *testing.T) {
+	testingConfig := &mongo.Config{ConnectionString: "mongodb://127.0.0.1/confirm_test", Database: "confirm_test"}
+
+	mc, err := NewMongoStoreClient(testingConfig, testingKeys, testutil.NewLogger(t))
+	if err != nil {
+		t.Fatalf("we could not create the store: %v", err)
+	}
+
+	ctx := context.Background()
+	confirmationsCollection(mc).Drop(ctx)
+
+	confirmation := MustConfirmation(t, models.TypeCareteamInvite, models.TemplateNameCareteamInvite, "123.456")
+	if err := mc.UpsertConfirmation(ctx, confirmation); err != nil {
+		t.Fatalf("we could not save the confirmation: %v", err)
+	}
+
+	now := time.Now().Truncate(time.Millisecond)
+	if err := mc.RecordDeliveryAttempt(ctx, confirmation.Id, models.DeliveryAttempt{Time: now, Error: "timeout"}); err != nil {
+		t.Fatalf("we could not record the attempt: %v", err)
+	}
+	if err := mc.RecordDeliveryAttempt(ctx, confirmation.Id, models.DeliveryAttempt{Time: now, ProviderMessageId: "ses-id"}); err != nil {
+		t.Fatalf("we could not record the attempt: %v", err)
+	}
+	if err := mc.UpdateDeliveryStatus(ctx, "ses-id", models.DeliveryStatusDelivered); err != nil {
+		t.Fatalf("we could not update the delivery status: %v", err)
+	}
+
+	found, err := mc.FindConfirmation(ctx, &models.Confirmation{Key: confirmation.Key})
+	if err != nil || found == nil || found.Delivery == nil {
+		t.Fatalf("expected the confirmation's delivery record, got %v: %v", found, err)
+	}
+	delivery := found.Delivery
+	if delivery.Status != models.DeliveryStatusDelivered || delivery.Attempts != 2 || delivery.ProviderMessageId != "ses-id" ||
+		delivery.LastError != "" || !delivery.LastAttemptTime.Equal(now) {
+		t.Errorf("non-expected delivery record %+v", delivery)
+	}
+}
+
+func TestMongoStoreStatusChanges(t *testing.T) {
+	testingConfig := &mongo.Config{ConnectionString: "mongodb://127.0.0.1/confirm_test", Database: "confirm_test"}
+
+	mc, err := NewMongoStoreClient(testingConfig, testingKeys, testutil.NewLogger(t))
+	if err != nil {
+		t.Fatalf("we could not create the store: %v", err)
+	}
+
+	ctx := context.Background()
+	confirmationsCollection(mc).Drop(ctx)
+
+	confirmation := MustConfirmation(t, models.TypeCareteamInvite, models.TemplateNameCareteamInvite, "123.456")
+	confirmation.ExpiresAt = nil
+	if err := mc.UpsertConfirmation(ctx, confirmation); err != nil {
+		t.Fatalf("we could not save the confirmation: %v", err)
+	}
+	stale, err := mc.FindConfirmation(ctx, &models.Confirmation{Id: confirmation.Id})
+	if err != nil || stale == nil {
+		t.Fatalf("expected the confirmation, got %v: %v", stale, err)
+	}
+
+	// The sweeper expires it while a handler has it.
+	expiresAt := time.Now().Add(-time.Minute)
+	if _, err := confirmationsCollection(mc).UpdateOne(ctx, bson.M{"_id": confirmation.Id}, bson.M{"$set": bson.M{"expiresAt": expiresAt}}); err != nil {
+		t.Fatal(err)
+	}
+	if expired, err := mc.ExpireConfirmations(ctx, models.TypeCareteamInvite, time.Now(), 10); err != nil || len(expired) != 1 {
+		t.Fatalf("expected the confirmation to expire, got %v: %v", expired, err)
+	}
+
+	// Saving it without a status change leaves it expired.
+	stale.UserId = "789.012"
+	if err := mc.UpsertConfirmation(ctx, stale); err != nil {
+		t.Fatalf("we could not save the confirmation: %v", err)
+	}
+	// Accepting it fails, since it's no longer pending.
+	stale.UpdateStatusBy(models.StatusCompleted, models.StatusChange{Actor: "789.012"})
+	if err := mc.UpsertConfirmation(ctx, stale); err != ErrStatusChanged {
+		t.Fatalf("expected the status change to be refused, got %v", err)
+	}
+
+	found, err := mc.FindConfirmation(ctx, &models.Confirmation{Id: confirmation.Id})
+	if err != nil || found == nil {
+		t.Fatalf("expected the confirmation, got %v: %v", found, err)
+	}
+	if found.Status != models.StatusExpired || found.UserId != "789.012" {
+		t.Errorf("expected the expired confirmation to be kept, got %+v", found)
+	}
+	if len(found.History) != 1 || found.History[0].To != models.StatusExpired {
+		t.Errorf("expected the expiry to be kept in the history, got %+v", found.History)
+	}
+
+	// A status change from its current status is appended to its history.
+	found.UpdateStatusBy(models.StatusCanceled, models.StatusChange{Actor: "123.456"})
+	if err := mc.UpsertConfirmation(ctx, found); err != nil {
+		t.Fatalf("we could not save the confirmation: %v", err)
+	}
+	found, err = mc.FindConfirmation(ctx, &models.Confirmation{Id: confirmation.Id})
+	if err != nil || found == nil || found.Status != models.StatusCanceled || len(found.History) != 2 ||
+		found.History[1].From != models.StatusExpired {
+		t.Errorf("expected the cancellation to be appended, got %+v: %v", found, err)
+	}
+}
+
+func TestMongoStorePagination(t *testing.T) {
+	testingConfig := &mongo.Config{ConnectionString: "mongodb://127.0.0.1/confirm_test", Database: "confirm_test"}
+
+	mc, err := NewMongoStoreClient(testingConfig, testingKeys, testutil.NewLogger(t))
+	if err != nil {
+		t.Fatalf("we could not create the store: %v", err)
+	}
+
+	ctx := context.Background()
+	confirmationsCollection(mc).Drop(ctx)
+
+	// Two of them are created at the same time, to check ties are broken.
+	start := time.Now().Truncate(time.Millisecond)
+	createdAt := []time.Duration{0, time.Minute, time.Minute, 2 * time.Minute, 3 * time.Minute}
+	for _, offset := range createdAt {
+		confirmation := MustConfirmation(t, models.TypeCareteamInvite, models.TemplateNameCareteamInvite, "123.456")
+		confirmation.ClinicId = "clinic"
+		confirmation.Created = start.Add(offset)
+		if err := mc.UpsertConfirmation(ctx, confirmation); err != nil {
+			t.Fatalf("we could not save the confirmation: %v", err)
+		}
+	}
+
+	filter := &models.Confirmation{ClinicId: "clinic", Type: models.TypeCareteamInvite}
+	for _, sort := range []SortOrder{SortCreatedDescending, SortCreatedAscending} {
+		var pages [][]*models.Confirmation
+		opts := FilterOpts{Sort: sort, Limit: 2}
+		for {
+			page, err := mc.FindConfirmationsWithOpts(ctx, filter, opts, models.StatusPending)
+			if err != nil {
+				t.Fatalf("we could not find the page: %v", err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			pages = append(pages, page)
+			opts.After = NewCursor(sort, page[len(page)-1])
+		}
+
+		var seen []*models.Confirmation
+		for _, page := range pages {
+			seen = append(seen, page...)
+		}
+		if len(pages) != 3 || len(seen) != len(createdAt) {
+			t.Fatalf("%s: expected %d confirmations in 3 pages, got %d in %d", sort, len(createdAt), len(seen), len(pages))
+		}
+		for i := 1; i < len(seen); i++ {
+			previous, current := seen[i-1].Created, seen[i].Created
+			if (sort.Descending() && current.After(previous)) || (!sort.Descending() && current.Before(previous)) || seen[i].Id == seen[i-1].Id {
+				t.Errorf("%s: confirmation %d is out of order", sort, i)
+			}
+		}
+	}
+
+	opts := FilterOpts{CreatedAfter: start, CreatedBefore: start.Add(3 * time.Minute)}
+	if found, err := mc.FindConfirmationsWithOpts(ctx, filter, opts); err != nil || len(found) != 3 {
+		t.Errorf("expected 3 confirmations created within the range, got %d: %v", len(found), err)
+	}
+}
+
+func TestMongoStoreHashedKeys(t *testing.T) {
+	testingConfig := &mongo.Config{ConnectionString: "mongodb://127.0.0.1/confirm_test", Database: "confirm_test"}
+
+	mc, err := NewMongoStoreClient(testingConfig, testingKeys, testutil.NewLogger(t))
+	if err != nil {
+		t.Fatalf("we could not create the store: %v", err)
+	}
+
+	ctx := context.Background()
+	confirmationsCollection(mc).Drop(ctx)
+	outboxCollection(mc).Drop(ctx)
+	migrationsCollection(mc).Drop(ctx)
+
+	// Confirmations stored before keys were hashed have their key as their id.
+	invite := MustConfirmation(t, models.TypeCareteamInvite, models.TemplateNameCareteamInvite, "123.456")
+	clinician := MustConfirmation(t, models.TypeClinicianInvite, models.TemplateNameClinicianInvite, "123.456")
+	reset := MustConfirmation(t, models.TypePasswordReset, models.TemplateNamePasswordReset, "123.456")
+	for _, legacy := range []*models.Confirmation{invite, clinician, reset} {
+		legacy.Id = legacy.Key
+		if _, err := confirmationsCollection(mc).InsertOne(ctx, legacy); err != nil {
+			t.Fatalf("we could not save the legacy confirmation: %v", err)
+		}
+	}
+	messages := []*models.OutboxMessage{
+		{Id: "message-id", ConfirmationId: reset.Key, Status: models.OutboxStatusSent, Body: reset.Key},
+		{Id: "dead-message-id", Status: models.OutboxStatusDead, Body: reset.Key, TextBody: reset.Key},
+		{Id: "pending-message-id", Status: models.OutboxStatusPending, Body: reset.Key, TextBody: reset.Key},
+		{Id: "event-message-id", Status: models.OutboxStatusPending, Event: &models.OutboxEvent{Type: "confirmation:created"}},
+		{Id: "new-message-id", Status: models.OutboxStatusPending, Body: "body", Created: time.Now().Add(time.Hour)},
+	}
+	for _, message := range messages {
+		if _, err := outboxCollection(mc).InsertOne(ctx, message); err != nil {
+			t.Fatalf("we could not save the message: %v", err)
+		}
+	}
+
+	if found, err := mc.FindConfirmation(ctx, &models.Confirmation{Key: reset.Key}); err != nil || found == nil {
+		t.Fatalf("the legacy confirmation should be found by its key: %v", err)
+	}
+
+	if err := mc.Migrate(ctx, IndexConfig{}); err != nil {
+		t.Fatalf("we could not migrate: %v", err)
+	}
+
+	found, err := mc.FindConfirmation(ctx, &models.Confirmation{Key: invite.Key})
+	if err != nil || found == nil {
+		t.Fatalf("the invite should be found by its key: %v", err)
+	}
+	if found.Id == invite.Key || found.KeyHash != testingKeys.Hash(invite.Key) {
+		t.Errorf("the invite should have a new id, and the hash of its key, got %+v", found)
+	}
+
+	found, err = mc.FindConfirmation(ctx, &models.Confirmation{Id: clinician.Key})
+	if err != nil || found == nil {
+		t.Fatalf("the clinician invite should be found by its id: %v", err)
+	}
+	if found.KeyHash == "" || found.KeyHash == testingKeys.Hash(clinician.Key) {
+		t.Errorf("the clinician invite should have a new key, got %+v", found)
+	}
+	if stale, err := mc.FindConfirmation(ctx, &models.Confirmation{Key: clinician.Key}); err != nil || stale != nil {
+		t.Errorf("the clinician invite shouldn't be found by its id as its key: %v", err)
+	}
+
+	found, err = mc.FindConfirmation(ctx, &models.Confirmation{Key: reset.Key})
+	if err != nil || found == nil {
+		t.Fatalf("the password reset should be found by its key: %v", err)
+	}
+	if found.Id == reset.Key || found.KeyHash != testingKeys.Hash(reset.Key) {
+		t.Errorf("the password reset should have a new id, and the hash of its key, got %+v", found)
+	}
+	if stale, err := mc.FindConfirmation(ctx, &models.Confirmation{Id: reset.Key}); err != nil || stale != nil {
+		t.Errorf("the password reset shouldn't be found by its key as its id: %v", err)
+	}
+
+	var migrated models.OutboxMessage
+	if err := outboxCollection(mc).FindOne(ctx, bson.M{"_id": "message-id"}).Decode(&migrated); err != nil {
+		t.Fatalf("we could not find the message: %v", err)
+	}
+	if migrated.ConfirmationId != found.Id || migrated.Body != "" {
+		t.Errorf("the sent message should refer to the new id without its body, got %+v", migrated)
+	}
+	for _, id := range []string{"dead-message-id", "pending-message-id"} {
+		var scrubbed models.OutboxMessage
+		if err := outboxCollection(mc).FindOne(ctx, bson.M{"_id": id}).Decode(&scrubbed); err != nil {
+			t.Fatalf("we could not find the message: %v", err)
+		}
+		if scrubbed.Status != models.OutboxStatusDead || scrubbed.Body != "" || scrubbed.TextBody != "" {
+			t.Errorf("the unsent message should be dead-lettered without its bodies, got %+v", scrubbed)
+		}
+	}
+	for _, id := range []string{"event-message-id", "new-message-id"} {
+		var untouched models.OutboxMessage
+		if err := outboxCollection(mc).FindOne(ctx, bson.M{"_id": id}).Decode(&untouched); err != nil {
+			t.Fatalf("we could not find the message: %v", err)
+		}
+		if untouched.Status != models.OutboxStatusPending {
+			t.Errorf("events and messages queued after the migration began should be left alone, got %+v", untouched)
+		}
+	}
+}
+
+func TestMongoStoreConfirmationCodes(t *testing.T) {
+	testingConfig := &mongo.Config{ConnectionString: "mongodb://127.0.0.1/confirm_test", Database: "confirm_test"}
+
+	mc, err := NewMongoStoreClient(testingConfig, testingKeys, testutil.NewLogger(t))
+	if err != nil {
+		t.Fatalf("we could not create the store: %v", err)
+	}
+
+	ctx := context.Background()
+	confirmationsCollection(mc).Drop(ctx)
+
+	confirmation := MustConfirmation(t, models.TypePasswordReset, models.TemplateNamePasswordReset, "")
+	confirmation.Email = "code@test.com"
+	confirmation.Code, err = models.NewVerificationCode(6, time.Minute)
+	if err != nil {
+		t.Fatalf("we could not create the code: %v", err)
+	}
+	code := confirmation.Code.Value
+	if err := mc.UpsertConfirmation(ctx, confirmation); err != nil {
+		t.Fatalf("we could not save the confirmation: %v", err)
+	}
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	found, matches, err := mc.CheckConfirmationCode(ctx, "CODE@test.com", models.TypePasswordReset, wrong)
+	if err != nil || found == nil || matches {
+		t.Fatalf("expected the wrong code not to match: %v", err)
+	}
+	if found.Code.Attempts != 1 || found.Code.Hash == "" || found.Code.Hash == code {
+		t.Errorf("expected the attempt to be counted and only the code's hash to be stored, got %+v", found.Code)
+	}
+
+	found, matches, err = mc.CheckConfirmationCode(ctx, "code@test.com", models.TypePasswordReset, code)
+	if err != nil || found == nil || !matches || found.Code.Attempts != 2 {
+		t.Fatalf("expected the code to match on the second attempt, got %+v: %v", found, err)
+	}
+
+	if found, _, err := mc.CheckConfirmationCode(ctx, "code@test.com", models.TypeSignUp, code); err != nil || found != nil {
+		t.Errorf("expected no signup with a code to be found: %v", err)
+	}
+}
+
+func TestMongoStoreReminders(t *testing.T) {
+	testingConfig := &mongo.Config{ConnectionString: "mongodb://127.0.0.1/confirm_test", Database: "confirm_test"}
+
+	mc, err := NewMongoStoreClient(testingConfig, testingKeys, testutil.NewLogger(t))
+	if err != nil {
+		t.Fatalf("we could not create the store: %v", err)
+	}
+
+	ctx := context.Background()
+	confirmationsCollection(mc).Drop(ctx)
+
+	now := time.Now().Truncate(time.Millisecond)
+	expiresAt := now.Add(3 * 24 * time.Hour)
+	confirmation := MustConfirmation(t, models.TypeCareteamInvite, models.TemplateNameCareteamInvite, "")
+	confirmation.Email = "reminder@test.com"
+	confirmation.Created = now.Add(-4 * 24 * time.Hour)
+	confirmation.ExpiresAt = &expiresAt
+	expired := MustConfirmation(t, models.TypeCareteamInvite, models.TemplateNameCareteamInvite, "")
+	expired.Email = "expired@test.com"
+	expired.Created = confirmation.Created
+	expired.ExpiresAt = &now
+	for _, c := range []*models.Confirmation{confirmation, expired} {
+		if err := mc.UpsertConfirmation(ctx, c); err != nil {
+			t.Fatalf("we could not save the confirmation: %v", err)
+		}
+	}
+
+	claim := func(step int, createdBefore time.Time) *models.Confirmation {
+		t.Helper()
+		found, err := mc.ClaimReminder(ctx, models.TypeCareteamInvite, step, createdBefore, now)
+		if err != nil {
+			t.Fatalf("we could not claim the reminder: %v", err)
+		}
+		return found
+	}
+
+	if found := claim(1, now.Add(-6*24*time.Hour)); found != nil {
+		t.Errorf("expected no reminder to be due yet, got %+v", found.Reminders)
+	}
+	found := claim(0, now.Add(-3*24*time.Hour))
+	if found == nil || found.Id != confirmation.Id || len(found.Reminders) != 1 || found.Reminders[0].Step != 0 {
+		t.Fatalf("expected the first reminder to be recorded, got %+v", found)
+	}
+	if found := claim(0, now.Add(-3*24*time.Hour)); found != nil {
+		t.Errorf("expected the first reminder to be claimed once, got %+v", found.Reminders)
+	}
+	if found := claim(1, now); found == nil || len(found.Reminders) != 2 || found.Reminders[1].Step != 1 {
+		t.Fatalf("expected the second reminder to be recorded, got %+v", found)
+	}
+	if found := claim(0, now); found != nil {
+		t.Errorf("expected no earlier reminder after a later one, got %+v", found.Reminders)
+	}
+
+	// confirmation is a stale copy without the reminders.
+	if err := mc.UpsertConfirmation(ctx, confirmation); err != nil {
+		t.Fatalf("we could not save the confirmation: %v", err)
+	}
+	if found := claim(1, now); found != nil {
+		t.Errorf("expected saving a stale copy to keep the reminders, got %+v", found.Reminders)
+	}
+
+	if err := mc.ReleaseReminder(ctx, confirmation.Id, 1); err != nil {
+		t.Fatalf("we could not release the reminder: %v", err)
+	}
+	if found := claim(1, now); found == nil || len(found.Reminders) != 2 || found.ReminderFailures != 1 {
+		t.Fatalf("expected the released reminder to be claimed again, got %+v", found)
+	}
+	if err := mc.FailReminder(ctx, confirmation.Id, 1, "unavailable"); err != nil {
+		t.Fatalf("we could not record the reminder's failure: %v", err)
+	}
+	if found := claim(1, now); found != nil {
+		t.Errorf("expected the failed reminder not to be claimed again, got %+v", found.Reminders)
+	}
+	if found, err := mc.FindConfirmation(ctx, &models.Confirmation{Id: confirmation.Id}); err != nil || found == nil ||
+		len(found.Reminders) != 2 || found.Reminders[1].Error != "unavailable" {
+		t.Fatalf("expected the reminder's failure to be recorded, got %+v: %v", found, err)
+	}
+
+	confirmation.ResetCreationAttributes()
+	if err := mc.UpsertConfirmation(ctx, confirmation); err != nil {
+		t.Fatalf("we could not save the confirmation: %v", err)
+	}
+	if err := mc.ResetReminders(ctx, confirmation.Id); err != nil {
+		t.Fatalf("we could not reset the reminders: %v", err)
+	}
+	if found := claim(1, now.Add(time.Minute)); found == nil || len(found.Reminders) != 1 {
+		t.Fatalf("expected the reminders to restart once the confirmation is resent, got %+v", found)
+	}
+
+	confirmation.UpdateStatus(models.StatusCanceled)
+	if err := mc.UpsertConfirmation(ctx, confirmation); err != nil {
+		t.Fatalf("we could not save the confirmation: %v", err)
+	}
+	if found := claim(1, now.Add(time.Minute)); found != nil {
+		t.Errorf("expected canceled and expired confirmations not to be reminded, got %+v", found)
+	}
+}
+
+func hasIndex(t *testing.T, mc *MongoStoreClient, name string) bool {
+	specs, err := confirmationsCollection(mc).Indexes().ListSpecifications(context.Background())
+	if err != nil {
+		t.Fatalf("we could not list the indexes: %v", err)
+	}
+	for _, spec := range specs {
+		if spec.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// testingKeys hashes the keys of the confirmations stored by the tests.
+var testingKeys = NewKeyHasher("testing secret")
+
 // MustConfirmation is a helper for tests that fails the test when
 // confirmation creation fails.
 func MustConfirmation(t *testing.T, theType models.Type, templateName models.TemplateName,
@@ -162,3 +689,16 @@ func MustConfirmation(t *testing.T, theType models.Type, templateName models.Tem
 	}
 	return c
 }
+
+func TestEmailQuery(t *testing.T) {
+	byEmail, collate := emailQuery(&models.Confirmation{Email: "Me+1@Example.org"})
+	if byEmail != "Me+1@Example.org" || !collate {
+		t.Errorf("expected the collated email, got %v, %v", byEmail, collate)
+	}
+
+	byId, collate := emailQuery(&models.Confirmation{Id: "id", Email: "Me+1@Example.org"})
+	regex, ok := byId.(primitive.Regex)
+	if !ok || collate || regex.Options != "i" || regex.Pattern != `^Me\+1@Example\.org$` {
+		t.Errorf("expected a case-insensitive regular expression, got %v, %v", byId, collate)
+	}
+}
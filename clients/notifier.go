@@ -1,5 +1,106 @@
 package clients
 
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
 type Notifier interface {
-	Send(addresses []string, subject, content string) (int, string)
+	// Send an email with both an HTML and a plain text body.
+	Send(ctx context.Context, addresses []string, subject, html, text string) SendResult
+}
+
+// SendResult is the outcome of sending an email.
+type SendResult struct {
+	// ProviderMessageId identifies the email with the provider, such as the
+	// SES message ID, so that later delivery notifications can be matched
+	// to it.
+	ProviderMessageId string
+	// Err is why the email couldn't be sent, or nil if the provider accepted
+	// it.
+	Err error
+}
+
+// NotifierSelfTester is implemented by notifiers that can check they're able
+// to send emails without sending one.
+type NotifierSelfTester interface {
+	SelfTest(ctx context.Context) error
+}
+
+// Notifier backends
+const (
+	NotifierBackendSES  = "ses"
+	NotifierBackendSMTP = "smtp"
+	NotifierBackendMock = "mock"
+	NotifierBackendFile = "file"
+)
+
+// NotifierConfig selects the Notifier used to send emails.
+type NotifierConfig struct {
+	Backend string `default:"ses"`
+	// SelfTestInterval is how often a failed self-test is retried.
+	SelfTestInterval time.Duration `split_words:"true" default:"1m"`
+	SelfTestTimeout  time.Duration `split_words:"true" default:"30s"`
 }
+
+func notifierConfigProvider() (NotifierConfig, error) {
+	var config NotifierConfig
+	if err := envconfig.Process("hydrophone_notifier", &config); err != nil {
+		return NotifierConfig{}, err
+	}
+	return config, nil
+}
+
+// NotifierParams are the configurations of every Notifier backend.
+type NotifierParams struct {
+	fx.In
+
+	Config     NotifierConfig
+	SesConfig  SesNotifierConfig
+	SMTPConfig SMTPNotifierConfig
+	FileConfig FileNotifierConfig
+	Log        *zap.SugaredLogger
+}
+
+// NewNotifier creates the Notifier of the configured backend.
+func NewNotifier(p NotifierParams) (Notifier, error) {
+	backend := p.Config.Backend
+	// HYDROPHONE_USE_MOCK_NOTIFIER predates the choice of backend.
+	if p.SesConfig.UseMockNotifier {
+		backend = NotifierBackendMock
+	}
+
+	switch backend {
+	case NotifierBackendSES:
+		return NewSesNotifier(&p.SesConfig, p.Log)
+	case NotifierBackendSMTP:
+		return NewSMTPNotifier(p.SMTPConfig)
+	case NotifierBackendMock:
+		return NewMockNotifier(), nil
+	case NotifierBackendFile:
+		return NewFileNotifier(p.FileConfig)
+	default:
+		return nil, fmt.Errorf("clients: unknown notifier backend %q", backend)
+	}
+}
+
+// NotifierModule provides the Notifier of the configured backend, traced, and
+// self-tests it on start.
+var NotifierModule = fx.Options(
+	fx.Provide(
+		notifierConfigProvider,
+		sesNotifierConfigProvider,
+		smtpNotifierConfigProvider,
+		fileNotifierConfigProvider,
+		NewNotifier,
+		NewNotifierStatus,
+		func(s *NotifierStatus) NotifierHealth { return s },
+	),
+	fx.Decorate(NewTracingNotifier),
+	fx.Invoke(startNotifierStatus),
+)
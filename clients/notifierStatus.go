@@ -0,0 +1,95 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/hydrophone/worker"
+)
+
+// NotifierHealth reports whether the Notifier is able to send emails.
+type NotifierHealth interface {
+	// Err returns why the Notifier can't send emails, or nil.
+	Err() error
+}
+
+var errNotifierSelfTestPending = errors.New("clients: notifier self-test is pending")
+
+// NotifierStatus self-tests the Notifier on start, retrying until it passes,
+// so that readiness can depend on the notifier being able to send.
+type NotifierStatus struct {
+	config   NotifierConfig
+	notifier Notifier
+	log      *zap.SugaredLogger
+
+	err      error
+	mu       sync.Mutex
+	periodic *worker.Periodic
+}
+
+// NewNotifierStatus creates a NotifierStatus whose self-test is pending.
+func NewNotifierStatus(config NotifierConfig, notifier Notifier, log *zap.SugaredLogger) *NotifierStatus {
+	s := &NotifierStatus{
+		config:   config,
+		notifier: notifier,
+		log:      log,
+		err:      errNotifierSelfTestPending,
+	}
+	s.periodic = worker.NewPeriodic(config.SelfTestInterval, s.retry)
+	return s
+}
+
+// Err returns the error of the last self-test, nil once it passed.
+func (s *NotifierStatus) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// SelfTest tests the notifier, recording the result. Notifiers that can't
+// self-test always pass.
+func (s *NotifierStatus) SelfTest(ctx context.Context) error {
+	var err error
+	if tester, ok := s.notifier.(NotifierSelfTester); ok {
+		ctx, cancel := context.WithTimeout(ctx, s.config.SelfTestTimeout)
+		defer cancel()
+		err = tester.SelfTest(ctx)
+	}
+
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	return err
+}
+
+// Start self-testing in the background until the self-test passes or Stop is
+// called.
+func (s *NotifierStatus) Start() {
+	s.periodic.Start()
+}
+
+// Stop self-testing.
+func (s *NotifierStatus) Stop(ctx context.Context) error {
+	return s.periodic.Stop(ctx)
+}
+
+// retry self-tests, returning whether to try again.
+func (s *NotifierStatus) retry(ctx context.Context) bool {
+	err := s.SelfTest(ctx)
+	if err == nil {
+		s.log.With(zap.String("backend", s.config.Backend)).Info("notifier self-test passed")
+		return false
+	}
+	if ctx.Err() == nil {
+		s.log.With(zap.Error(err), zap.String("backend", s.config.Backend)).Error("notifier self-test failed")
+	}
+	return true
+}
+
+func startNotifierStatus(lifecycle fx.Lifecycle, status *NotifierStatus) {
+	lifecycle.Append(worker.Hook(status))
+}
@@ -0,0 +1,80 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+func TestNewNotifier(t *testing.T) {
+	params := NotifierParams{
+		Config:     NotifierConfig{Backend: NotifierBackendFile},
+		FileConfig: FileNotifierConfig{Directory: t.TempDir(), Format: FileFormatEML, FromAddress: "noreply@tidepool.org"},
+		Log:        testutil.NewLogger(t),
+	}
+	if notifier, err := NewNotifier(params); err != nil {
+		t.Fatalf("error creating notifier: %s", err)
+	} else if _, ok := notifier.(*FileNotifier); !ok {
+		t.Errorf("expected a file notifier, got %T", notifier)
+	}
+
+	params.SesConfig.UseMockNotifier = true
+	if notifier, err := NewNotifier(params); err != nil {
+		t.Fatalf("error creating notifier: %s", err)
+	} else if _, ok := notifier.(*MockNotifier); !ok {
+		t.Errorf("expected the mock notifier to be used, got %T", notifier)
+	}
+
+	params.SesConfig.UseMockNotifier = false
+	params.Config.Backend = "pigeon"
+	if _, err := NewNotifier(params); err == nil {
+		t.Errorf("expected an error for an unknown backend")
+	}
+}
+
+func TestNotifierStatus(t *testing.T) {
+	notifier := &selfTestingNotifier{err: errors.New("unreachable")}
+	config := NotifierConfig{SelfTestInterval: 10 * time.Millisecond, SelfTestTimeout: time.Second}
+	status := NewNotifierStatus(config, notifier, testutil.NewLogger(t))
+	if status.Err() == nil {
+		t.Fatalf("expected the self-test to be pending")
+	}
+
+	status.Start()
+	defer status.Stop(context.Background())
+	time.Sleep(50 * time.Millisecond)
+	if err := status.Err(); err == nil || err.Error() != "unreachable" {
+		t.Fatalf("expected the self-test to fail, got %v", err)
+	}
+
+	notifier.setErr(nil)
+	deadline := time.Now().Add(time.Second)
+	for status.Err() != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the self-test to be retried until it passes")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type selfTestingNotifier struct {
+	MockNotifier
+	mu  sync.Mutex
+	err error
+}
+
+func (n *selfTestingNotifier) setErr(err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.err = err
+}
+
+func (n *selfTestingNotifier) SelfTest(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.err
+}
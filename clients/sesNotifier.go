@@ -1,20 +1,20 @@
 package clients
 
 import (
+	"context"
+	"errors"
+
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ses"
 	"github.com/kelseyhightower/envconfig"
-	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
 
 const (
 	// CharSet The character encoding for the email.
 	CharSet = "UTF-8"
-
-	// DefaultTextMessage will be sent to non-HTML email clients that receive our messages
-	DefaultTextMessage = "You need an HTML client to read this email."
 )
 
 type (
@@ -34,7 +34,7 @@ type (
 	}
 )
 
-func notifierConfigProvider() (SesNotifierConfig, error) {
+func sesNotifierConfigProvider() (SesNotifierConfig, error) {
 	var config SesNotifierConfig
 	err := envconfig.Process("ses", &config)
 	if err != nil {
@@ -43,20 +43,6 @@ func notifierConfigProvider() (SesNotifierConfig, error) {
 	return config, nil
 }
 
-func sesNotifierProvider(config SesNotifierConfig, log *zap.SugaredLogger) (Notifier, error) {
-	if config.UseMockNotifier {
-		return NewMockNotifier(), nil
-	}
-	mail, err := NewSesNotifier(&config, log)
-	return mail, err
-}
-
-// SesModule is a fx module for this component
-var SesModule = fx.Options(
-	fx.Provide(sesNotifierProvider),
-	fx.Provide(notifierConfigProvider),
-)
-
 // NewSesNotifier creates a new Amazon SES notifier
 func NewSesNotifier(cfg *SesNotifierConfig, log *zap.SugaredLogger) (*SesNotifier, error) {
 	sess, err := session.NewSession(&aws.Config{
@@ -75,7 +61,7 @@ func NewSesNotifier(cfg *SesNotifierConfig, log *zap.SugaredLogger) (*SesNotifie
 }
 
 // Send a message to a list of recipients with a given subject
-func (c *SesNotifier) Send(to []string, subject string, msg string) (int, string) {
+func (c *SesNotifier) Send(ctx context.Context, to []string, subject string, html string, text string) SendResult {
 	var toAwsAddress = make([]*string, len(to))
 	for i, x := range to {
 		toAwsAddress[i] = aws.String(x)
@@ -90,11 +76,11 @@ func (c *SesNotifier) Send(to []string, subject string, msg string) (int, string
 			Body: &ses.Body{
 				Html: &ses.Content{
 					Charset: aws.String(CharSet),
-					Data:    aws.String(msg),
+					Data:    aws.String(html),
 				},
 				Text: &ses.Content{
 					Charset: aws.String(CharSet),
-					Data:    aws.String(DefaultTextMessage),
+					Data:    aws.String(text),
 				},
 			},
 			Subject: &ses.Content{
@@ -106,12 +92,32 @@ func (c *SesNotifier) Send(to []string, subject string, msg string) (int, string
 	}
 
 	// Attempt to send the email.
-	result, err := c.SES.SendEmail(input)
+	result, err := c.SES.SendEmailWithContext(ctx, input)
 
 	// Display error messages if they occur.
 	if err != nil {
 		c.log.With(zap.Error(err)).Error("sending email")
-		return 400, result.String()
+		return SendResult{Err: err}
+	}
+	return SendResult{ProviderMessageId: aws.StringValue(result.MessageId)}
+}
+
+// SelfTest checks that the SES account can be reached and is allowed to send.
+//
+// It needs the ses:GetSendQuota permission. Without it, the self-test passes
+// with a warning, since sending may still be allowed.
+func (c *SesNotifier) SelfTest(ctx context.Context) error {
+	quota, err := c.SES.GetSendQuotaWithContext(ctx, &ses.GetSendQuotaInput{})
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && (awsErr.Code() == "AccessDenied" || awsErr.Code() == "AccessDeniedException") {
+		c.log.With(zap.Error(err)).Warn("SES send quota can't be checked without the ses:GetSendQuota permission")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if aws.Float64Value(quota.Max24HourSend) <= 0 {
+		return errors.New("clients: SES sending is disabled")
 	}
-	return 200, result.String()
+	return nil
 }
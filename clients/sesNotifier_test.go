@@ -0,0 +1,62 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ses"
+
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+// newTestSesNotifier returns a notifier whose SES API responds with the
+// status and body.
+func newTestSesNotifier(t *testing.T, status int, body string) *SesNotifier {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		t.Fatalf("error creating session: %s", err)
+	}
+	return &SesNotifier{Config: &SesNotifierConfig{}, SES: ses.New(sess), log: testutil.NewLogger(t)}
+}
+
+func TestSesNotifierSelfTest(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		fails  bool
+	}{
+		{name: "sending enabled", status: http.StatusOK, body: `<GetSendQuotaResponse><GetSendQuotaResult><Max24HourSend>200</Max24HourSend></GetSendQuotaResult></GetSendQuotaResponse>`},
+		{name: "sending disabled", status: http.StatusOK, body: `<GetSendQuotaResponse><GetSendQuotaResult><Max24HourSend>0</Max24HourSend></GetSendQuotaResult></GetSendQuotaResponse>`, fails: true},
+		{name: "access denied", status: http.StatusForbidden, body: `<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>denied</Message></Error><RequestId>id</RequestId></ErrorResponse>`},
+		{name: "invalid credentials", status: http.StatusForbidden, body: `<ErrorResponse><Error><Type>Sender</Type><Code>InvalidClientTokenId</Code><Message>invalid</Message></Error><RequestId>id</RequestId></ErrorResponse>`, fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := newTestSesNotifier(t, test.status, test.body).SelfTest(context.Background())
+			if test.fails && err == nil {
+				t.Errorf("expected the self-test to fail")
+			} else if !test.fails && err != nil {
+				t.Errorf("expected the self-test to pass, got: %s", err)
+			}
+		})
+	}
+}
@@ -1,48 +1,97 @@
 package clients
 
 import (
-	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"mime/multipart"
-	"mime/quotedprintable"
-	"net/http"
+	"net"
+	"net/mail"
 	"net/smtp"
-	"net/textproto"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
-	"go.uber.org/fx"
 )
 
-// Implements a simple SMTP-based notifier that can be used with local development. To enable:
-//  - In hydrophone.go, replace "sc.SesModule" with "sc.SMTPModule".
-//  - Set three SMTP environment variables on the hydrophone deployment.
-//      kubectl set env deployment/hydrophone SMTP_HOST="<host>" SMTP_USERNAME="<username>" SMTP_PASSWORD="<password>"
-//  - The hydrophone pod should automatically terminate and start with the SMTP notifier enabled.
+// Implements an SMTP-based notifier. To enable it, set HYDROPHONE_NOTIFIER_BACKEND
+// to "smtp" and configure the server with the SMTP environment variables.
+//
+//	kubectl set env deployment/hydrophone HYDROPHONE_NOTIFIER_BACKEND="smtp" SMTP_HOST="<host>" SMTP_USERNAME="<username>" SMTP_PASSWORD="<password>"
 
+// SMTP TLS modes
 const (
-	SMTPFrom = "noreply@tidepool.org"
-	SMTPPort = 587
+	// SMTPTLSModeStartTLS upgrades the connection with STARTTLS, which the
+	// server must support.
+	SMTPTLSModeStartTLS = "starttls"
+	// SMTPTLSModeImplicit connects with TLS, usually on port 465.
+	SMTPTLSModeImplicit = "implicit"
+	// SMTPTLSModeNone doesn't encrypt the connection. Authentication is only
+	// allowed with localhost.
+	SMTPTLSModeNone = "none"
 )
 
 type SMTPNotifierConfig struct {
-	Host     string
-	Username string
-	Password string
+	Host string
+	Port int `default:"587"`
+	// Username and Password are optional. Without them, no authentication is
+	// attempted.
+	Username              string
+	Password              string
+	FromAddress           string        `split_words:"true" default:"noreply@tidepool.org"`
+	TLSMode               string        `envconfig:"TLS_MODE" default:"starttls"`
+	TLSInsecureSkipVerify bool          `envconfig:"TLS_INSECURE_SKIP_VERIFY" default:"false"`
+	Timeout               time.Duration `default:"30s"`
 }
 
-func (s SMTPNotifierConfig) IsValid() bool {
-	return s.Host != "" && s.Username != "" && s.Password != ""
+func (s SMTPNotifierConfig) Validate() error {
+	if s.Host == "" {
+		return fmt.Errorf("clients: SMTP host is missing")
+	}
+	if s.Port <= 0 {
+		return fmt.Errorf("clients: SMTP port %d is invalid", s.Port)
+	}
+	if _, err := mail.ParseAddress(s.FromAddress); err != nil {
+		return fmt.Errorf("clients: SMTP from address is invalid: %w", err)
+	}
+	if (s.Username == "") != (s.Password == "") {
+		return fmt.Errorf("clients: SMTP username and password must both be set")
+	}
+	switch s.TLSMode {
+	case SMTPTLSModeStartTLS, SMTPTLSModeImplicit, SMTPTLSModeNone:
+	default:
+		return fmt.Errorf("clients: unknown SMTP TLS mode %q", s.TLSMode)
+	}
+	return nil
 }
 
 func (s SMTPNotifierConfig) Address() string {
-	return fmt.Sprintf("%s:%d", s.Host, SMTPPort)
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// EnvelopeFrom returns the bare address of FromAddress, which may include a
+// display name.
+func (s SMTPNotifierConfig) EnvelopeFrom() string {
+	if address, err := mail.ParseAddress(s.FromAddress); err == nil {
+		return address.Address
+	}
+	return s.FromAddress
 }
 
 func (s SMTPNotifierConfig) Auth() smtp.Auth {
+	if s.Username == "" {
+		return nil
+	}
 	return smtp.PlainAuth("", s.Username, s.Password, s.Host)
 }
 
+func (s SMTPNotifierConfig) TLSConfig() *tls.Config {
+	return &tls.Config{
+		ServerName:         s.Host,
+		InsecureSkipVerify: s.TLSInsecureSkipVerify,
+	}
+}
+
 func smtpNotifierConfigProvider() (SMTPNotifierConfig, error) {
 	var config SMTPNotifierConfig
 	if err := envconfig.Process("SMTP", &config); err != nil {
@@ -55,81 +104,114 @@ type SMTPNotifier struct {
 	config SMTPNotifierConfig
 }
 
-func smtpNotifierProvider(config SMTPNotifierConfig) (Notifier, error) {
+// NewSMTPNotifier creates a notifier that sends emails through an SMTP server.
+func NewSMTPNotifier(config SMTPNotifierConfig) (*SMTPNotifier, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 	return &SMTPNotifier{
 		config: config,
 	}, nil
 }
 
-func (s *SMTPNotifier) Send(to []string, subject string, message string) (int, string) {
+func (s *SMTPNotifier) Send(ctx context.Context, to []string, subject string, html string, text string) SendResult {
 	if len(to) < 1 {
-		return http.StatusBadRequest, "to is missing"
+		return SendResult{Err: errors.New("clients: to is missing")}
 	} else if subject == "" {
-		return http.StatusBadRequest, "subject is missing"
-	} else if message == "" {
-		return http.StatusBadRequest, "message is missing"
+		return SendResult{Err: errors.New("clients: subject is missing")}
+	} else if html == "" {
+		return SendResult{Err: errors.New("clients: message is missing")}
 	}
 
-	if !s.config.IsValid() {
-		return http.StatusNotImplemented, "config is invalid"
+	encodedMessage, messageID, err := encodeMessage(s.config.FromAddress, to, subject, html, text)
+	if err != nil {
+		return SendResult{Err: err}
 	}
 
-	encodedMessage, err := s.encodeMessage(to, subject, message)
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	client, err := s.dial(ctx)
 	if err != nil {
-		return http.StatusInternalServerError, err.Error()
+		return SendResult{Err: err}
 	}
+	defer client.Close()
 
-	if err := smtp.SendMail(s.config.Address(), s.config.Auth(), SMTPFrom, to, encodedMessage); err != nil {
-		return http.StatusInternalServerError, err.Error()
+	if err := s.sendMail(client, to, encodedMessage); err != nil {
+		return SendResult{Err: err}
 	}
 
-	return http.StatusOK, ""
+	return SendResult{ProviderMessageId: messageID}
 }
 
-func (s *SMTPNotifier) encodeMessage(to []string, subject string, message string) ([]byte, error) {
-	messageBuffer := &bytes.Buffer{}
-	messageWriter := multipart.NewWriter(messageBuffer)
-
-	fmt.Fprintf(messageBuffer, "To: %s\n", strings.Join(to, ", "))
-	fmt.Fprintf(messageBuffer, "Subject: %s\n", subject)
-	fmt.Fprintf(messageBuffer, "MIME-Version: 1.0\n")
-	fmt.Fprintf(messageBuffer, "Content-Type: multipart/alternative; boundary=\"%s\"\n", messageWriter.Boundary())
-	fmt.Fprintf(messageBuffer, "\n")
+// SelfTest connects and authenticates to the SMTP server.
+func (s *SMTPNotifier) SelfTest(ctx context.Context) error {
+	client, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.Quit()
+}
 
-	textHeaders := textproto.MIMEHeader{}
-	textHeaders.Add("Content-Type", "text/plain; charset=UTF-8")
-	textHeaders.Add("Content-Transfer-Encoding", "7bit")
-	textPart, err := messageWriter.CreatePart(textHeaders)
+// dial connects to the SMTP server, then secures the connection and
+// authenticates as configured.
+func (s *SMTPNotifier) dial(ctx context.Context) (*smtp.Client, error) {
+	dialer := &net.Dialer{Timeout: s.config.Timeout}
+	var conn net.Conn
+	var err error
+	if s.config.TLSMode == SMTPTLSModeImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: s.config.TLSConfig()}).DialContext(ctx, "tcp", s.config.Address())
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", s.config.Address())
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("clients: failure to connect to SMTP server: %w", err)
 	}
-	if _, err := textPart.Write([]byte(DefaultTextMessage)); err != nil {
-		return nil, err
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
 	}
 
-	htmlHeaders := textproto.MIMEHeader{}
-	htmlHeaders.Add("Content-Type", "text/html; charset=UTF-8")
-	htmlHeaders.Add("Content-Transfer-Encoding", "quoted-printable")
-	htmlPart, err := messageWriter.CreatePart(htmlHeaders)
+	client, err := smtp.NewClient(conn, s.config.Host)
 	if err != nil {
-		return nil, err
+		conn.Close()
+		return nil, fmt.Errorf("clients: failure to greet SMTP server: %w", err)
 	}
 
-	htmlBuffer := &bytes.Buffer{}
-	htmlWriter := quotedprintable.NewWriter(htmlBuffer)
-	if _, err := htmlWriter.Write([]byte(message)); err != nil {
-		return nil, err
-	}
-	if _, err := htmlPart.Write(htmlBuffer.Bytes()); err != nil {
-		return nil, err
+	if s.config.TLSMode == SMTPTLSModeStartTLS {
+		if err := client.StartTLS(s.config.TLSConfig()); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("clients: failure to start TLS with SMTP server: %w", err)
+		}
 	}
 
-	messageWriter.Close()
+	if auth := s.config.Auth(); auth != nil {
+		if err := client.Auth(auth); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("clients: failure to authenticate with SMTP server: %w", err)
+		}
+	}
 
-	return messageBuffer.Bytes(), nil
+	return client, nil
 }
 
-var SMTPModule = fx.Options(
-	fx.Provide(smtpNotifierProvider),
-	fx.Provide(smtpNotifierConfigProvider),
-)
+func (s *SMTPNotifier) sendMail(client *smtp.Client, to []string, encodedMessage []byte) error {
+	if err := client.Mail(s.config.EnvelopeFrom()); err != nil {
+		return err
+	}
+	for _, address := range to {
+		if err := client.Rcpt(address); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(encodedMessage); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
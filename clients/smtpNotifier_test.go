@@ -0,0 +1,164 @@
+package clients
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSMTPNotifierConfig(t *testing.T) {
+	valid := SMTPNotifierConfig{Host: "localhost", Port: 587, FromAddress: "Tidepool <noreply@tidepool.org>", TLSMode: SMTPTLSModeStartTLS}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected a valid config, got %s", err)
+	}
+	if from := valid.EnvelopeFrom(); from != "noreply@tidepool.org" {
+		t.Errorf("expected the bare from address, got %q", from)
+	}
+
+	invalid := map[string]func(*SMTPNotifierConfig){
+		"no host":          func(c *SMTPNotifierConfig) { c.Host = "" },
+		"no port":          func(c *SMTPNotifierConfig) { c.Port = 0 },
+		"bad from":         func(c *SMTPNotifierConfig) { c.FromAddress = "noreply" },
+		"no password":      func(c *SMTPNotifierConfig) { c.Username = "user" },
+		"unknown TLS mode": func(c *SMTPNotifierConfig) { c.TLSMode = "tls" },
+	}
+	for name, modify := range invalid {
+		config := valid
+		modify(&config)
+		if err := config.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	notifier, err := NewSMTPNotifier(SMTPNotifierConfig{
+		Host:        host,
+		Port:        portNumber,
+		FromAddress: "Tidepool <noreply@tidepool.org>",
+		TLSMode:     SMTPTLSModeNone,
+		Timeout:     5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("error creating notifier: %s", err)
+	}
+
+	result := notifier.Send(context.Background(), []string{"me@example.org"}, "Hello", "<p>Hello</p>", "Hello")
+	if result.Err != nil {
+		t.Fatalf("expected the email to be sent, got %s", result.Err)
+	}
+	if result.ProviderMessageId == "" {
+		t.Error("expected the Message-ID to be returned")
+	}
+	commands := server.Commands()
+	for _, expected := range []string{"MAIL FROM:<noreply@tidepool.org>", "RCPT TO:<me@example.org>", "DATA", "QUIT"} {
+		if !containsPrefix(commands, expected) {
+			t.Errorf("expected the %q command, got %v", expected, commands)
+		}
+	}
+	if data := server.Data(); !strings.Contains(data, "Subject: Hello") || !strings.Contains(data, "<p>Hello</p>") {
+		t.Errorf("expected the message to be sent, got %q", data)
+	}
+
+	if err := notifier.SelfTest(context.Background()); err != nil {
+		t.Errorf("expected the self-test to pass, got %s", err)
+	}
+
+	server.listener.Close()
+	if err := notifier.SelfTest(context.Background()); err == nil {
+		t.Errorf("expected the self-test to fail once the server is gone")
+	}
+}
+
+func containsPrefix(values []string, prefix string) bool {
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeSMTPServer accepts every message without TLS or authentication.
+type fakeSMTPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	commands []string
+	data     strings.Builder
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeSMTPServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ready")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		switch verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); verb {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 localhost")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data.Write(data)
+			s.mu.Unlock()
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *fakeSMTPServer) Data() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.String()
+}
@@ -2,6 +2,8 @@ package clients
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/tidepool-org/hydrophone/models"
 )
@@ -10,14 +12,89 @@ import (
 // The zero value is fine for the "default" case of filtering on the logical AND of non empty fields.
 type FilterOpts struct {
 	AllowEmptyUserID bool // If true, then specifically query for an empty string userId instead of not including in the query.
+
+	// CreatedAfter, CreatedBefore, ModifiedAfter and ModifiedBefore only
+	// find the confirmations created or modified strictly within the
+	// range. Zero times leave the range open.
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+
+	// Sort orders the confirmations, most recently created first by default.
+	Sort SortOrder
+	// After only finds the confirmations after the cursor, in the cursor's
+	// sort order.
+	After *Cursor
+	// Limit is the most confirmations found. Zero finds them all.
+	Limit int
 }
 
+// ErrStatusChanged is returned when a confirmation's status is updated after
+// it was changed by someone else, since it was found.
+var ErrStatusChanged = errors.New("clients: the confirmation's status has changed")
+
 type StoreClient interface {
 	Ping(ctx context.Context) error
+	// CheckMigrations returns an error until every index migration has been
+	// applied.
+	CheckMigrations(ctx context.Context) error
 	UpsertConfirmation(ctx context.Context, confirmation *models.Confirmation) error
 	FindConfirmations(ctx context.Context, confirmation *models.Confirmation, statuses ...models.Status) (results []*models.Confirmation, err error)
 	FindConfirmationsWithOpts(ctx context.Context, confirmation *models.Confirmation, opts FilterOpts, statuses ...models.Status) (results []*models.Confirmation, err error)
 	FindConfirmation(ctx context.Context, confirmation *models.Confirmation) (result *models.Confirmation, err error)
+	// CheckConfirmationCode counts an attempt at the code of the most recent
+	// pending confirmation of the type for the email that has a code. It
+	// returns the confirmation with the attempt counted, and whether the code
+	// matches, or nil if there's no such confirmation.
+	CheckConfirmationCode(ctx context.Context, email string, confirmationType models.Type, code string) (result *models.Confirmation, matches bool, err error)
 	RemoveConfirmation(ctx context.Context, confirmation *models.Confirmation) error
 	RemoveConfirmationsForUser(ctx context.Context, userId string) error
+	// ExpireConfirmations moves up to limit pending confirmations of the given
+	// type that expired before now to the expired status, returning those that
+	// were updated.
+	ExpireConfirmations(ctx context.Context, confirmationType models.Type, now time.Time, limit int) ([]*models.Confirmation, error)
+	// ClaimReminder records the reminder at step of its type's schedule on
+	// the earliest pending confirmation of the type with an email, created
+	// before createdBefore and not expired at now, that hasn't had that
+	// reminder or a later one. It returns the confirmation with the reminder
+	// recorded, or nil if no reminder is due.
+	ClaimReminder(ctx context.Context, confirmationType models.Type, step int, createdBefore, now time.Time) (*models.Confirmation, error)
+	// ReleaseReminder removes the reminder at step from the confirmation, so
+	// that it's claimed again, and counts it in its ReminderFailures. It's
+	// used when the reminder couldn't be sent.
+	ReleaseReminder(ctx context.Context, confirmationId string, step int) error
+	// FailReminder records why the reminder at step couldn't be sent on the
+	// confirmation, keeping it claimed so that it isn't tried again.
+	FailReminder(ctx context.Context, confirmationId string, step int, reason string) error
+	// ResetReminders removes every reminder and failure from the
+	// confirmation, so that they start over when it's resent. UpsertConfirmation never changes the
+	// reminders, so that saving a stale copy doesn't undo a claim.
+	ResetReminders(ctx context.Context, confirmationId string) error
+	// RecordDeliveryAttempt updates the delivery record of a confirmation
+	// with an attempt to email it.
+	RecordDeliveryAttempt(ctx context.Context, confirmationId string, attempt models.DeliveryAttempt) error
+	// UpdateDeliveryStatus sets the delivery status of the confirmation that
+	// was emailed as the provider's message.
+	UpdateDeliveryStatus(ctx context.Context, providerMessageId string, status models.DeliveryStatus) error
+
+	// EnqueueMessage stores a message in the outbox for later delivery.
+	EnqueueMessage(ctx context.Context, message *models.OutboxMessage) error
+	// ClaimMessage locks the next message that's due for delivery until
+	// lockedUntil. It returns nil if no message is due.
+	ClaimMessage(ctx context.Context, now, lockedUntil time.Time) (*models.OutboxMessage, error)
+	// UpdateMessage saves the outcome of a delivery attempt.
+	UpdateMessage(ctx context.Context, message *models.OutboxMessage) error
+
+	// IncrementRateLimit increments the rate limit counter with the given key,
+	// creating it if needed, and returns its new count. The counter may be
+	// removed after expiresAt.
+	IncrementRateLimit(ctx context.Context, key string, expiresAt time.Time) (int, error)
+
+	// UpsertSuppression adds the suppression, or updates the reason an address
+	// is suppressed for.
+	UpsertSuppression(ctx context.Context, suppression *models.Suppression) error
+	// FindSuppressions returns the suppressions of any of the email addresses.
+	FindSuppressions(ctx context.Context, emails ...string) ([]*models.Suppression, error)
+	RemoveSuppression(ctx context.Context, email string) error
 }
@@ -0,0 +1,45 @@
+package clients
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tidepool-org/hydrophone/tracing"
+)
+
+// TracingNotifier starts a span around each email sent by the Notifier it
+// wraps.
+type TracingNotifier struct {
+	notifier Notifier
+	tracer   trace.Tracer
+}
+
+func NewTracingNotifier(notifier Notifier, provider trace.TracerProvider) Notifier {
+	return &TracingNotifier{
+		notifier: notifier,
+		tracer:   tracing.Tracer(provider),
+	}
+}
+
+func (n *TracingNotifier) Send(ctx context.Context, addresses []string, subject, html, text string) SendResult {
+	ctx, span := n.tracer.Start(ctx, "Notifier.Send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int("email.recipients", len(addresses))),
+	)
+	result := n.notifier.Send(ctx, addresses, subject, html, text)
+	if result.ProviderMessageId != "" {
+		span.SetAttributes(attribute.String("email.provider_message_id", result.ProviderMessageId))
+	}
+	tracing.End(span, result.Err)
+	return result
+}
+
+// SelfTest self-tests the wrapped Notifier, if it can be.
+func (n *TracingNotifier) SelfTest(ctx context.Context) error {
+	if tester, ok := n.notifier.(NotifierSelfTester); ok {
+		return tester.SelfTest(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package clients
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/tracing"
+)
+
+// TracingStoreClient starts a span around each operation of the StoreClient
+// it wraps.
+type TracingStoreClient struct {
+	store  StoreClient
+	tracer trace.Tracer
+}
+
+var _ StoreClient = &TracingStoreClient{}
+
+func NewTracingStoreClient(store StoreClient, provider trace.TracerProvider) *TracingStoreClient {
+	return &TracingStoreClient{
+		store:  store,
+		tracer: tracing.Tracer(provider),
+	}
+}
+
+func (s *TracingStoreClient) Ping(ctx context.Context) (err error) {
+	ctx, span := s.start(ctx, "Ping")
+	defer func() { tracing.End(span, err) }()
+	return s.store.Ping(ctx)
+}
+
+func (s *TracingStoreClient) CheckMigrations(ctx context.Context) (err error) {
+	ctx, span := s.start(ctx, "CheckMigrations")
+	defer func() { tracing.End(span, err) }()
+	return s.store.CheckMigrations(ctx)
+}
+
+func (s *TracingStoreClient) UpsertConfirmation(ctx context.Context, confirmation *models.Confirmation) (err error) {
+	ctx, span := s.start(ctx, "UpsertConfirmation")
+	defer func() { tracing.End(span, err) }()
+	return s.store.UpsertConfirmation(ctx, confirmation)
+}
+
+func (s *TracingStoreClient) FindConfirmations(ctx context.Context, confirmation *models.Confirmation, statuses ...models.Status) (results []*models.Confirmation, err error) {
+	ctx, span := s.start(ctx, "FindConfirmations")
+	defer func() { tracing.End(span, err) }()
+	return s.store.FindConfirmations(ctx, confirmation, statuses...)
+}
+
+func (s *TracingStoreClient) FindConfirmationsWithOpts(ctx context.Context, confirmation *models.Confirmation, opts FilterOpts, statuses ...models.Status) (results []*models.Confirmation, err error) {
+	ctx, span := s.start(ctx, "FindConfirmationsWithOpts")
+	defer func() { tracing.End(span, err) }()
+	return s.store.FindConfirmationsWithOpts(ctx, confirmation, opts, statuses...)
+}
+
+func (s *TracingStoreClient) FindConfirmation(ctx context.Context, confirmation *models.Confirmation) (result *models.Confirmation, err error) {
+	ctx, span := s.start(ctx, "FindConfirmation")
+	defer func() { tracing.End(span, err) }()
+	return s.store.FindConfirmation(ctx, confirmation)
+}
+
+func (s *TracingStoreClient) CheckConfirmationCode(ctx context.Context, email string, confirmationType models.Type, code string) (result *models.Confirmation, matches bool, err error) {
+	ctx, span := s.start(ctx, "CheckConfirmationCode")
+	defer func() { tracing.End(span, err) }()
+	return s.store.CheckConfirmationCode(ctx, email, confirmationType, code)
+}
+
+func (s *TracingStoreClient) RemoveConfirmation(ctx context.Context, confirmation *models.Confirmation) (err error) {
+	ctx, span := s.start(ctx, "RemoveConfirmation")
+	defer func() { tracing.End(span, err) }()
+	return s.store.RemoveConfirmation(ctx, confirmation)
+}
+
+func (s *TracingStoreClient) RemoveConfirmationsForUser(ctx context.Context, userId string) (err error) {
+	ctx, span := s.start(ctx, "RemoveConfirmationsForUser")
+	defer func() { tracing.End(span, err) }()
+	return s.store.RemoveConfirmationsForUser(ctx, userId)
+}
+
+func (s *TracingStoreClient) ExpireConfirmations(ctx context.Context, confirmationType models.Type, now time.Time, limit int) (expired []*models.Confirmation, err error) {
+	ctx, span := s.start(ctx, "ExpireConfirmations")
+	defer func() { tracing.End(span, err) }()
+	return s.store.ExpireConfirmations(ctx, confirmationType, now, limit)
+}
+
+func (s *TracingStoreClient) ClaimReminder(ctx context.Context, confirmationType models.Type, step int, createdBefore, now time.Time) (confirmation *models.Confirmation, err error) {
+	ctx, span := s.start(ctx, "ClaimReminder")
+	defer func() { tracing.End(span, err) }()
+	return s.store.ClaimReminder(ctx, confirmationType, step, createdBefore, now)
+}
+
+func (s *TracingStoreClient) ReleaseReminder(ctx context.Context, confirmationId string, step int) (err error) {
+	ctx, span := s.start(ctx, "ReleaseReminder")
+	defer func() { tracing.End(span, err) }()
+	return s.store.ReleaseReminder(ctx, confirmationId, step)
+}
+
+func (s *TracingStoreClient) FailReminder(ctx context.Context, confirmationId string, step int, reason string) (err error) {
+	ctx, span := s.start(ctx, "FailReminder")
+	defer func() { tracing.End(span, err) }()
+	return s.store.FailReminder(ctx, confirmationId, step, reason)
+}
+
+func (s *TracingStoreClient) ResetReminders(ctx context.Context, confirmationId string) (err error) {
+	ctx, span := s.start(ctx, "ResetReminders")
+	defer func() { tracing.End(span, err) }()
+	return s.store.ResetReminders(ctx, confirmationId)
+}
+
+func (s *TracingStoreClient) RecordDeliveryAttempt(ctx context.Context, confirmationId string, attempt models.DeliveryAttempt) (err error) {
+	ctx, span := s.start(ctx, "RecordDeliveryAttempt")
+	defer func() { tracing.End(span, err) }()
+	return s.store.RecordDeliveryAttempt(ctx, confirmationId, attempt)
+}
+
+func (s *TracingStoreClient) UpdateDeliveryStatus(ctx context.Context, providerMessageId string, status models.DeliveryStatus) (err error) {
+	ctx, span := s.start(ctx, "UpdateDeliveryStatus")
+	defer func() { tracing.End(span, err) }()
+	return s.store.UpdateDeliveryStatus(ctx, providerMessageId, status)
+}
+
+func (s *TracingStoreClient) EnqueueMessage(ctx context.Context, message *models.OutboxMessage) (err error) {
+	ctx, span := s.start(ctx, "EnqueueMessage")
+	defer func() { tracing.End(span, err) }()
+	return s.store.EnqueueMessage(ctx, message)
+}
+
+func (s *TracingStoreClient) ClaimMessage(ctx context.Context, now, lockedUntil time.Time) (message *models.OutboxMessage, err error) {
+	ctx, span := s.start(ctx, "ClaimMessage")
+	defer func() { tracing.End(span, err) }()
+	return s.store.ClaimMessage(ctx, now, lockedUntil)
+}
+
+func (s *TracingStoreClient) UpdateMessage(ctx context.Context, message *models.OutboxMessage) (err error) {
+	ctx, span := s.start(ctx, "UpdateMessage")
+	defer func() { tracing.End(span, err) }()
+	return s.store.UpdateMessage(ctx, message)
+}
+
+func (s *TracingStoreClient) IncrementRateLimit(ctx context.Context, key string, expiresAt time.Time) (count int, err error) {
+	ctx, span := s.start(ctx, "IncrementRateLimit")
+	defer func() { tracing.End(span, err) }()
+	return s.store.IncrementRateLimit(ctx, key, expiresAt)
+}
+
+func (s *TracingStoreClient) UpsertSuppression(ctx context.Context, suppression *models.Suppression) (err error) {
+	ctx, span := s.start(ctx, "UpsertSuppression")
+	defer func() { tracing.End(span, err) }()
+	return s.store.UpsertSuppression(ctx, suppression)
+}
+
+func (s *TracingStoreClient) FindSuppressions(ctx context.Context, emails ...string) (suppressions []*models.Suppression, err error) {
+	ctx, span := s.start(ctx, "FindSuppressions")
+	defer func() { tracing.End(span, err) }()
+	return s.store.FindSuppressions(ctx, emails...)
+}
+
+func (s *TracingStoreClient) RemoveSuppression(ctx context.Context, email string) (err error) {
+	ctx, span := s.start(ctx, "RemoveSuppression")
+	defer func() { tracing.End(span, err) }()
+	return s.store.RemoveSuppression(ctx, email)
+}
+
+// start starts the span of an operation.
+func (s *TracingStoreClient) start(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "StoreClient."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "mongodb")),
+	)
+}
@@ -0,0 +1,52 @@
+package clients
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+func TestTracingStoreClient(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+
+	store := NewTracingStoreClient(NewMockStoreClient(false, true), provider)
+	if _, err := store.FindConfirmation(ctx, &models.Confirmation{Key: "key"}); err == nil {
+		t.Fatal("expected the store's error to be returned")
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "StoreClient.FindConfirmation" || span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("expected a child span of the request, got %q", span.Name())
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("expected the error to be recorded, got %+v", span.Status())
+	}
+}
+
+func TestTracingNotifier(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	notifier := NewTracingNotifier(NewMockNotifier(), provider)
+
+	if result := notifier.Send(context.Background(), []string{"me@example.org"}, "Hello", "<p>Hello</p>", "Hello"); result.Err != nil {
+		t.Fatalf("expected the email to be sent, got %s", result.Err)
+	}
+	if spans := recorder.Ended(); len(spans) != 1 || spans[0].Name() != "Notifier.Send" {
+		t.Errorf("expected a Notifier.Send span, got %v", spans)
+	}
+	if _, ok := notifier.(NotifierSelfTester); !ok {
+		t.Error("expected the notifier to be self-tested through the wrapper")
+	}
+}
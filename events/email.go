@@ -0,0 +1,130 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/go-common/events"
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+const enqueueTimeout = 10 * time.Second
+
+// EmailConfig holds the URLs templated emails link to. They're read from the
+// same variables as the API's configuration.
+type EmailConfig struct {
+	WebUrl   string `split_words:"true" required:"true"`
+	AssetUrl string `split_words:"true" required:"true"`
+}
+
+func EmailConfigProvider() (EmailConfig, error) {
+	var config EmailConfig
+	if err := envconfig.Process("hydrophone", &config); err != nil {
+		return EmailConfig{}, err
+	}
+	return config, nil
+}
+
+// mailer renders templated emails and queues them in the outbox, which
+// delivers them through the notifier.
+type mailer struct {
+	config    EmailConfig
+	store     clients.StoreClient
+	templates models.TemplateProvider
+}
+
+// enqueue renders the best translation of the named template for the given
+// locales with content, and queues it for the recipients. The WebURL and
+// AssetURL of the content are set from the configuration.
+func (m *mailer) enqueue(ctx context.Context, templateName models.TemplateName, locales []models.Locale, content models.TemplateContent, confirmationId string, recipients ...string) error {
+	content.Base().WebURL = m.config.WebUrl
+	content.Base().AssetURL = m.config.AssetUrl
+
+	subject, body, text, _, err := models.RenderTemplate(m.templates, templateName, locales, content)
+	if err != nil {
+		return err
+	}
+	message, err := models.NewOutboxMessage(templateName, recipients, subject, body, text)
+	if err != nil {
+		return err
+	}
+	message.ConfirmationId = confirmationId
+
+	ctx, cancel := context.WithTimeout(ctx, enqueueTimeout)
+	defer cancel()
+	return m.store.EnqueueMessage(ctx, message)
+}
+
+// emailHandler sends the emails other services request with
+// SendEmailTemplateEvent, so that hydrophone is the platform's only mailer.
+type emailHandler struct {
+	mailer *mailer
+	logger *zap.SugaredLogger
+}
+
+var _ events.EmailEventHandler = &emailHandler{}
+
+func NewEmailHandler(config EmailConfig, store clients.StoreClient, templates models.TemplateProvider, logger *zap.SugaredLogger) events.EventHandler {
+	return events.NewDelegatingEmailEventHandler(&emailHandler{
+		mailer: &mailer{config: config, store: store, templates: templates},
+		logger: logger,
+	})
+}
+
+// HandleSendEmailTemplate renders the requested template with the event's
+// variables and queues the email in the outbox, which delivers it through the
+// notifier. Events naming an unknown template, or whose variables don't match
+// the template's, are rejected.
+func (h *emailHandler) HandleSendEmailTemplate(payload events.SendEmailTemplateEvent) error {
+	var err error
+	templateName := models.TemplateName(payload.Template)
+	log := h.logger.With(zap.String("template", payload.Template))
+	defer func() {
+		if err != nil {
+			log.With(zap.Error(err)).Error("sending templated email")
+		} else {
+			log.Info("queued templated email")
+		}
+	}()
+
+	if payload.Recipient == "" {
+		err = errors.New("events: recipient is missing")
+		return err
+	}
+
+	var content models.TemplateContent
+	if content, err = h.content(templateName, payload.Variables); err != nil {
+		return err
+	}
+	err = h.mailer.enqueue(context.Background(), templateName, nil, content, "", payload.Recipient)
+	return err
+}
+
+// content validates the variables against the template, returning the content
+// to execute it with.
+func (h *emailHandler) content(templateName models.TemplateName, variables map[string]string) (models.TemplateContent, error) {
+	template, _, ok := h.mailer.templates.Find(templateName)
+	if !ok {
+		return nil, models.ErrUnknownTemplate
+	}
+	content, err := models.NewTemplateContent(templateName)
+	if err != nil {
+		return nil, err
+	}
+	if err := models.SetTemplateVariables(content, variables); err != nil {
+		return nil, err
+	}
+	for _, variable := range template.Variables() {
+		if _, ok := variables[variable]; !ok && variable != "WebURL" && variable != "AssetURL" && !slices.Contains(models.OptionalVariables, variable) {
+			return nil, fmt.Errorf("events: variable %s is missing", variable)
+		}
+	}
+	return content, nil
+}
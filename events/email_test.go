@@ -0,0 +1,84 @@
+package events
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tidepool-org/go-common/events"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+func newTestEmailHandler(t *testing.T) (*emailHandler, *memoryStore) {
+	t.Helper()
+	store := newMemoryStore()
+	return &emailHandler{
+		mailer: newTestMailer(t, store),
+		logger: testutil.NewLogger(t),
+	}, store
+}
+
+func TestHandleSendEmailTemplate(t *testing.T) {
+	handler, store := newTestEmailHandler(t)
+
+	err := handler.HandleSendEmailTemplate(events.SendEmailTemplateEvent{
+		Recipient: "me@example.org",
+		Template:  string(models.TemplateNamePasswordReset),
+		Variables: map[string]string{"Key": "reset-key", "Email": "me@example.org"},
+	})
+	if err != nil {
+		t.Fatalf("expected the email to be sent, got %s", err)
+	}
+	if len(store.messages) != 1 {
+		t.Fatalf("expected 1 queued message, got %d", len(store.messages))
+	}
+	message := store.messages[0]
+	if len(message.Recipients) != 1 || message.Recipients[0] != "me@example.org" {
+		t.Errorf("expected the message to be sent to me@example.org, got %v", message.Recipients)
+	}
+	if message.TemplateName != models.TemplateNamePasswordReset {
+		t.Errorf("expected the password reset template, got %s", message.TemplateName)
+	}
+	if !strings.Contains(message.Body, "https://app.tidepool.test/confirm-password-reset?resetKey=reset-key") {
+		t.Errorf("expected the reset link in the body, got %q", message.Body)
+	}
+}
+
+func TestHandleSendEmailTemplateInvalid(t *testing.T) {
+	tests := map[string]events.SendEmailTemplateEvent{
+		"unknown template": {
+			Recipient: "me@example.org",
+			Template:  "unknown",
+		},
+		"no recipient": {
+			Template:  string(models.TemplateNamePasswordReset),
+			Variables: map[string]string{"Key": "reset-key", "Email": "me@example.org"},
+		},
+		"missing variable": {
+			Recipient: "me@example.org",
+			Template:  string(models.TemplateNamePasswordReset),
+			Variables: map[string]string{"Email": "me@example.org"},
+		},
+		"undeclared variable": {
+			Recipient: "me@example.org",
+			Template:  string(models.TemplateNamePasswordReset),
+			Variables: map[string]string{"Key": "reset-key", "Email": "me@example.org", "Other": "value"},
+		},
+		"base variable": {
+			Recipient: "me@example.org",
+			Template:  string(models.TemplateNamePasswordReset),
+			Variables: map[string]string{"Key": "reset-key", "Email": "me@example.org", "WebURL": "https://example.org"},
+		},
+	}
+	for name, event := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler, store := newTestEmailHandler(t)
+			if err := handler.HandleSendEmailTemplate(event); err == nil {
+				t.Errorf("expected an error")
+			}
+			if len(store.messages) != 0 {
+				t.Errorf("expected no queued messages, got %d", len(store.messages))
+			}
+		})
+	}
+}
@@ -2,32 +2,131 @@ package events
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/kelseyhightower/envconfig"
 	"go.uber.org/zap"
 
+	clinics "github.com/tidepool-org/clinic/client"
+	commonClients "github.com/tidepool-org/go-common/clients"
+	"github.com/tidepool-org/go-common/clients/shoreline"
 	"github.com/tidepool-org/go-common/events"
 	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
 )
 
-const deleteTimeout = 60 * time.Second
+const (
+	createTimeout = 60 * time.Second
+	deleteTimeout = 60 * time.Second
+	updateTimeout = 60 * time.Second
+)
+
+// UserEventsConfig configures how hydrophone reacts to changes of users.
+type UserEventsConfig struct {
+	// ReissueSignup sends a new signup confirmation to a user's new email
+	// address when it changes, rather than only re-addressing the pending one.
+	ReissueSignup bool `split_words:"true" default:"false"`
+}
+
+func UserEventsConfigProvider() (UserEventsConfig, error) {
+	var config UserEventsConfig
+	if err := envconfig.Process("hydrophone_user_events", &config); err != nil {
+		return UserEventsConfig{}, err
+	}
+	return config, nil
+}
+
+// boundTypes are the types of pending invitations that are bound to the
+// invitee's account as soon as it's created.
+var boundTypes = []models.Type{
+	models.TypeCareteamInvite,
+	models.TypeClinicianInvite,
+}
+
+// readdressedTypes are the types of pending confirmations that follow their
+// recipient to a new email address.
+var readdressedTypes = []models.Type{
+	models.TypeCareteamInvite,
+	models.TypeClinicianInvite,
+	models.TypeSignUp,
+}
 
 type handler struct {
 	events.NoopUserEventsHandler
 
-	store  clients.StoreClient
-	logger *zap.SugaredLogger
+	config  UserEventsConfig
+	mailer  *mailer
+	store   clients.StoreClient
+	clinics clinics.ClientWithResponsesInterface
+	seagull commonClients.Seagull
+	sl      shoreline.Client
+	logger  *zap.SugaredLogger
 }
 
 var _ events.UserEventsHandler = &handler{}
 
-func NewHandler(store clients.StoreClient, logger *zap.SugaredLogger) events.EventHandler {
+func NewHandler(
+	config UserEventsConfig,
+	emailConfig EmailConfig,
+	store clients.StoreClient,
+	templates models.TemplateProvider,
+	clinics clinics.ClientWithResponsesInterface,
+	seagull commonClients.Seagull,
+	sl shoreline.Client,
+	logger *zap.SugaredLogger,
+) events.EventHandler {
 	return events.NewUserEventsHandler(&handler{
-		store:  store,
-		logger: logger,
+		config:  config,
+		mailer:  &mailer{config: emailConfig, store: store, templates: templates},
+		store:   store,
+		clinics: clinics,
+		seagull: seagull,
+		sl:      sl,
+		logger:  logger,
 	})
 }
 
+// HandleCreateUserEvent binds the pending invitations sent to the new user's
+// email addresses before their account existed to it, so that other services
+// can see them without waiting for the invitee to list them.
+func (h *handler) HandleCreateUserEvent(payload events.CreateUserEvent) error {
+	if payload.UserID == "" {
+		return nil
+	}
+
+	var errs []error
+	ctx, cancel := context.WithTimeout(context.Background(), createTimeout)
+	defer cancel()
+	log := h.logger.With(zap.String("userId", payload.UserID))
+	opts := clients.FilterOpts{AllowEmptyUserID: true}
+	for _, email := range userEmails(payload.UserData) {
+		for _, confirmationType := range boundTypes {
+			filter := &models.Confirmation{Email: email, UserId: "", Type: confirmationType}
+			confirmations, err := h.store.FindConfirmationsWithOpts(ctx, filter, opts, models.StatusPending)
+			if err != nil {
+				log.With(zap.Error(err), zap.String("type", string(confirmationType))).Error("finding userless invitations")
+				errs = append(errs, err)
+				continue
+			}
+			for _, confirmation := range confirmations {
+				confirmation.UserId = payload.UserID
+				confirmation.Modified = time.Now()
+				if err := h.store.UpsertConfirmation(ctx, confirmation); err != nil {
+					log.With(zap.Error(err), zap.String("id", confirmation.Id)).Error("binding invitation")
+					errs = append(errs, err)
+					continue
+				}
+				log.With(zap.String("id", confirmation.Id), zap.String("type", string(confirmationType))).Info("bound invitation")
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func (h *handler) HandleDeleteUserEvent(payload events.DeleteUserEvent) error {
 	var err error
 	ctx, cancel := context.WithTimeout(context.Background(), deleteTimeout)
@@ -45,3 +144,139 @@ func (h *handler) HandleDeleteUserEvent(payload events.DeleteUserEvent) error {
 	}
 	return nil
 }
+
+// HandleUpdateUserEvent moves the user's pending invitations and signup
+// confirmation to their new email address, so they can still be found and
+// accepted once the old one is gone.
+func (h *handler) HandleUpdateUserEvent(payload events.UpdateUserEvent) error {
+	previous, current := primaryEmail(payload.Original), primaryEmail(payload.Updated)
+	if previous == "" || current == "" || strings.EqualFold(previous, current) {
+		return nil
+	}
+	userId := payload.Updated.UserID
+	if userId == "" {
+		userId = payload.Original.UserID
+	}
+
+	var errs []error
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+	log := h.logger.With(zap.String("userId", userId))
+	for _, confirmationType := range readdressedTypes {
+		filter := &models.Confirmation{Email: previous, Type: confirmationType}
+		confirmations, err := h.store.FindConfirmations(ctx, filter, models.StatusPending)
+		if err != nil {
+			log.With(zap.Error(err), zap.String("type", string(confirmationType))).Error("finding confirmations to re-address")
+			errs = append(errs, err)
+			continue
+		}
+		for _, confirmation := range confirmations {
+			if confirmation.UserId != "" && confirmation.UserId != userId {
+				// It was sent to the old address, but is bound to another user.
+				continue
+			}
+			if err := h.readdress(ctx, confirmation, userId, current); err != nil {
+				log.With(zap.Error(err), zap.String("id", confirmation.Id)).Error("re-addressing confirmation")
+				errs = append(errs, err)
+				continue
+			}
+			log.With(zap.String("id", confirmation.Id), zap.String("type", string(confirmationType))).Info("re-addressed confirmation")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readdress updates the confirmation's recipient, reissuing it if it's a
+// signup confirmation and that's configured.
+func (h *handler) readdress(ctx context.Context, confirmation *models.Confirmation, userId, email string) error {
+	if confirmation.Type == models.TypeSignUp && h.config.ReissueSignup {
+		return h.reissueSignup(ctx, confirmation, userId, email)
+	}
+	confirmation.Email = email
+	confirmation.UserId = userId
+	confirmation.Modified = time.Now()
+	return h.store.UpsertConfirmation(ctx, confirmation)
+}
+
+// reissueSignup replaces the signup confirmation with one for the new email
+// address, with a new key, and sends it there.
+func (h *handler) reissueSignup(ctx context.Context, confirmation *models.Confirmation, userId, email string) error {
+	content, err := h.signupContent(ctx, confirmation, userId)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.RemoveConfirmation(ctx, confirmation); err != nil {
+		return err
+	}
+	if err := confirmation.ResetKey(); err != nil {
+		return err
+	}
+	confirmation.Email = email
+	confirmation.UserId = userId
+	if err := h.store.UpsertConfirmation(ctx, confirmation); err != nil {
+		return err
+	}
+
+	content.Key = confirmation.Key
+	content.Email = email
+	templateName := confirmation.TemplateName
+	if templateName == models.TemplateNameUndefined {
+		templateName = models.TemplateNameSignup
+	}
+	var locales []models.Locale
+	if confirmation.Locale != "" {
+		locales = append(locales, confirmation.Locale)
+	}
+	return h.mailer.enqueue(ctx, templateName, locales, content, confirmation.Id, email)
+}
+
+// signupContent gathers the names a signup confirmation email shows.
+func (h *handler) signupContent(ctx context.Context, confirmation *models.Confirmation, userId string) (*models.SignupContent, error) {
+	content := &models.SignupContent{}
+
+	profile := &models.Profile{}
+	if err := h.seagull.GetCollection(userId, "profile", h.sl.TokenProvide(), profile); err != nil {
+		return nil, err
+	}
+	content.FullName = profile.FullName
+
+	if confirmation.CreatorId != "" {
+		creator := &models.Profile{}
+		if err := h.seagull.GetCollection(confirmation.CreatorId, "profile", h.sl.TokenProvide(), creator); err != nil {
+			return nil, err
+		}
+		content.CreatorName = creator.FullName
+	}
+
+	if confirmation.ClinicId != "" {
+		resp, err := h.clinics.GetClinicWithResponse(ctx, clinics.ClinicId(confirmation.ClinicId))
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode() == http.StatusOK && resp.JSON200.Name != "" {
+			content.ClinicName = resp.JSON200.Name
+		}
+	}
+	return content, nil
+}
+
+// primaryEmail returns the address the user's email is sent to.
+func primaryEmail(user shoreline.UserData) string {
+	if len(user.Emails) > 0 {
+		return user.Emails[0]
+	}
+	return user.Username
+}
+
+// userEmails returns every email address of the user, without duplicates.
+func userEmails(user shoreline.UserData) []string {
+	var emails []string
+	for _, email := range append(user.Emails[:len(user.Emails):len(user.Emails)], user.Username) {
+		if email == "" || slices.ContainsFunc(emails, func(e string) bool { return strings.EqualFold(e, email) }) {
+			continue
+		}
+		emails = append(emails, email)
+	}
+	return emails
+}
@@ -0,0 +1,227 @@
+package events
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	commonClients "github.com/tidepool-org/go-common/clients"
+	"github.com/tidepool-org/go-common/clients/shoreline"
+	"github.com/tidepool-org/go-common/events"
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/templates"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+// memoryStore keeps confirmations and queued messages in memory.
+type memoryStore struct {
+	clients.StoreClient
+
+	mu            sync.Mutex
+	confirmations map[string]*models.Confirmation
+	messages      []*models.OutboxMessage
+}
+
+func newMemoryStore(confirmations ...*models.Confirmation) *memoryStore {
+	store := &memoryStore{
+		StoreClient:   clients.NewMockStoreClient(false, false),
+		confirmations: map[string]*models.Confirmation{},
+	}
+	for _, confirmation := range confirmations {
+		store.confirmations[confirmation.Id] = confirmation
+	}
+	return store
+}
+
+func (s *memoryStore) UpsertConfirmation(ctx context.Context, confirmation *models.Confirmation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := *confirmation
+	s.confirmations[confirmation.Id] = &saved
+	return nil
+}
+
+func (s *memoryStore) FindConfirmations(ctx context.Context, confirmation *models.Confirmation, statuses ...models.Status) ([]*models.Confirmation, error) {
+	return s.FindConfirmationsWithOpts(ctx, confirmation, clients.FilterOpts{}, statuses...)
+}
+
+func (s *memoryStore) FindConfirmationsWithOpts(ctx context.Context, confirmation *models.Confirmation, opts clients.FilterOpts, statuses ...models.Status) ([]*models.Confirmation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var results []*models.Confirmation
+	for _, found := range s.confirmations {
+		if confirmation.Email != "" && !strings.EqualFold(found.Email, confirmation.Email) ||
+			confirmation.Type != "" && found.Type != confirmation.Type ||
+			(confirmation.UserId != "" || opts.AllowEmptyUserID) && found.UserId != confirmation.UserId ||
+			len(statuses) > 0 && !slices.Contains(statuses, found.Status) {
+			continue
+		}
+		result := *found
+		results = append(results, &result)
+	}
+	return results, nil
+}
+
+func (s *memoryStore) RemoveConfirmation(ctx context.Context, confirmation *models.Confirmation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.confirmations, confirmation.Id)
+	return nil
+}
+
+func (s *memoryStore) EnqueueMessage(ctx context.Context, message *models.OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+func (s *memoryStore) confirmation(key string) *models.Confirmation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.confirmations[key]
+}
+
+func newTestMailer(t *testing.T, store clients.StoreClient) *mailer {
+	t.Helper()
+	defaults, err := templates.New()
+	if err != nil {
+		t.Fatalf("error creating templates: %s", err)
+	}
+	return &mailer{
+		config:    EmailConfig{WebUrl: "https://app.tidepool.test", AssetUrl: "https://assets.tidepool.test"},
+		store:     store,
+		templates: defaults,
+	}
+}
+
+func newTestHandler(t *testing.T, config UserEventsConfig, store *memoryStore) *handler {
+	t.Helper()
+	return &handler{
+		config:  config,
+		mailer:  newTestMailer(t, store),
+		store:   store,
+		seagull: commonClients.NewSeagullMock(),
+		sl:      shoreline.NewMock("token"),
+		logger:  testutil.NewLogger(t),
+	}
+}
+
+func newTestConfirmation(t *testing.T, confirmationType models.Type, email, userId string) *models.Confirmation {
+	t.Helper()
+	confirmation, err := models.NewConfirmation(confirmationType, models.TemplateNameUndefined, "creator")
+	if err != nil {
+		t.Fatalf("error creating confirmation: %s", err)
+	}
+	confirmation.Email = email
+	confirmation.UserId = userId
+	return confirmation
+}
+
+func emailChange(userId, previous, current string) events.UpdateUserEvent {
+	return events.UpdateUserEvent{
+		Original: shoreline.UserData{UserID: userId, Username: previous, Emails: []string{previous}},
+		Updated:  shoreline.UserData{UserID: userId, Username: current, Emails: []string{current}},
+	}
+}
+
+func TestHandleUpdateUserEvent(t *testing.T) {
+	invite := newTestConfirmation(t, models.TypeCareteamInvite, "old@example.org", "")
+	clinicianInvite := newTestConfirmation(t, models.TypeClinicianInvite, "Old@Example.org", "user")
+	signup := newTestConfirmation(t, models.TypeSignUp, "old@example.org", "user")
+	otherUsers := newTestConfirmation(t, models.TypeCareteamInvite, "old@example.org", "other")
+	passwordReset := newTestConfirmation(t, models.TypePasswordReset, "old@example.org", "user")
+	accepted := newTestConfirmation(t, models.TypeCareteamInvite, "old@example.org", "user")
+	accepted.UpdateStatus(models.StatusCompleted)
+	store := newMemoryStore(invite, clinicianInvite, signup, otherUsers, passwordReset, accepted)
+	handler := newTestHandler(t, UserEventsConfig{}, store)
+
+	if err := handler.HandleUpdateUserEvent(emailChange("user", "old@example.org", "new@example.org")); err != nil {
+		t.Fatalf("expected the confirmations to be re-addressed, got %s", err)
+	}
+	for _, confirmation := range []*models.Confirmation{invite, clinicianInvite, signup} {
+		updated := store.confirmation(confirmation.Id)
+		if updated.Email != "new@example.org" || updated.UserId != "user" {
+			t.Errorf("expected the %s to be re-addressed, got %s for %q", confirmation.Type, updated.Email, updated.UserId)
+		}
+	}
+	for _, confirmation := range []*models.Confirmation{otherUsers, passwordReset, accepted} {
+		if unchanged := store.confirmation(confirmation.Id); unchanged.Email != "old@example.org" {
+			t.Errorf("expected the %s %s to be unchanged, got %s", confirmation.Status, confirmation.Type, unchanged.Email)
+		}
+	}
+	if len(store.messages) != 0 {
+		t.Errorf("expected no emails, got %d", len(store.messages))
+	}
+}
+
+func TestHandleUpdateUserEventUnchangedEmail(t *testing.T) {
+	invite := newTestConfirmation(t, models.TypeCareteamInvite, "me@example.org", "")
+	store := newMemoryStore(invite)
+	handler := newTestHandler(t, UserEventsConfig{}, store)
+
+	if err := handler.HandleUpdateUserEvent(emailChange("user", "me@example.org", "ME@example.org")); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if unchanged := store.confirmation(invite.Id); unchanged.Email != "me@example.org" || unchanged.UserId != "" {
+		t.Errorf("expected the invite to be unchanged, got %s for %q", unchanged.Email, unchanged.UserId)
+	}
+}
+
+func TestHandleUpdateUserEventReissueSignup(t *testing.T) {
+	signup := newTestConfirmation(t, models.TypeSignUp, "old@example.org", "user")
+	store := newMemoryStore(signup)
+	handler := newTestHandler(t, UserEventsConfig{ReissueSignup: true}, store)
+
+	if err := handler.HandleUpdateUserEvent(emailChange("user", "old@example.org", "new@example.org")); err != nil {
+		t.Fatalf("expected the signup to be reissued, got %s", err)
+	}
+	if store.confirmation(signup.Id) != nil {
+		t.Errorf("expected the old signup confirmation to be removed")
+	}
+	reissued, _ := store.FindConfirmations(context.Background(), &models.Confirmation{Email: "new@example.org", Type: models.TypeSignUp}, models.StatusPending)
+	if len(reissued) != 1 {
+		t.Fatalf("expected a signup confirmation for the new address, got %d", len(reissued))
+	}
+	if len(store.messages) != 1 {
+		t.Fatalf("expected 1 queued email, got %d", len(store.messages))
+	}
+	message := store.messages[0]
+	if !slices.Equal(message.Recipients, []string{"new@example.org"}) || message.ConfirmationId != reissued[0].Id {
+		t.Errorf("expected the signup email to be sent to the new address, got %v for %s", message.Recipients, message.ConfirmationId)
+	}
+	if !strings.Contains(message.Body, reissued[0].Key) {
+		t.Errorf("expected the new key in the email")
+	}
+}
+
+func TestHandleCreateUserEvent(t *testing.T) {
+	invite := newTestConfirmation(t, models.TypeCareteamInvite, "New@Example.org", "")
+	clinicianInvite := newTestConfirmation(t, models.TypeClinicianInvite, "alias@example.org", "")
+	otherUsers := newTestConfirmation(t, models.TypeCareteamInvite, "new@example.org", "other")
+	signup := newTestConfirmation(t, models.TypeSignUp, "new@example.org", "")
+	canceled := newTestConfirmation(t, models.TypeCareteamInvite, "new@example.org", "")
+	canceled.UpdateStatus(models.StatusCanceled)
+	store := newMemoryStore(invite, clinicianInvite, otherUsers, signup, canceled)
+	handler := newTestHandler(t, UserEventsConfig{}, store)
+
+	err := handler.HandleCreateUserEvent(events.CreateUserEvent{
+		UserData: shoreline.UserData{UserID: "user", Username: "new@example.org", Emails: []string{"new@example.org", "alias@example.org"}},
+	})
+	if err != nil {
+		t.Fatalf("expected the invitations to be bound, got %s", err)
+	}
+	for _, confirmation := range []*models.Confirmation{invite, clinicianInvite} {
+		if bound := store.confirmation(confirmation.Id); bound.UserId != "user" {
+			t.Errorf("expected the %s to %s to be bound, got %q", confirmation.Type, confirmation.Email, bound.UserId)
+		}
+	}
+	for _, confirmation := range []*models.Confirmation{otherUsers, signup, canceled} {
+		if unchanged := store.confirmation(confirmation.Id); unchanged.UserId != confirmation.UserId {
+			t.Errorf("expected the %s %s to be unchanged, got %q", confirmation.Status, confirmation.Type, unchanged.UserId)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package expiry
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/tidepool-org/go-common/clients/highwater"
+	"github.com/tidepool-org/go-common/clients/shoreline"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/worker"
+)
+
+const expiredMetric = "confirmations expired"
+
+// Config controls how often expired confirmations are swept.
+type Config struct {
+	Interval  time.Duration `split_words:"true" default:"15m"`
+	BatchSize int           `split_words:"true" default:"500"`
+}
+
+// Sweeper moves pending confirmations past their expiry to the expired status.
+//
+// Confirmations are only updated while they're still pending, so it's safe
+// for every replica to run a Sweeper at the same time.
+type Sweeper struct {
+	config   Config
+	store    clients.StoreClient
+	metrics  highwater.Client
+	sl       shoreline.Client
+	log      *zap.SugaredLogger
+	now      func() time.Time
+	periodic *worker.Periodic
+}
+
+func NewSweeper(config Config, store clients.StoreClient, metrics highwater.Client, sl shoreline.Client, log *zap.SugaredLogger) *Sweeper {
+	s := &Sweeper{
+		config:  config,
+		store:   store,
+		metrics: metrics,
+		sl:      sl,
+		log:     log,
+		now:     time.Now,
+	}
+	s.periodic = worker.NewPeriodic(config.Interval, s.sweep)
+	return s
+}
+
+// Start sweeps expired confirmations in the background until Stop is called.
+func (s *Sweeper) Start() {
+	s.periodic.Start()
+}
+
+// Stop waits for the current sweep to finish, or for ctx to be done.
+func (s *Sweeper) Stop(ctx context.Context) error {
+	return s.periodic.Stop(ctx)
+}
+
+func (s *Sweeper) sweep(ctx context.Context) bool {
+	if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+		s.log.With(zap.Error(err)).Error("sweeping expired confirmations")
+	}
+	return true
+}
+
+// Sweep expires every pending confirmation that's past its expiry, returning
+// the number of confirmations expired per type.
+func (s *Sweeper) Sweep(ctx context.Context) (map[models.Type]int, error) {
+	counts := make(map[models.Type]int)
+	now := s.now()
+	for _, confirmationType := range models.Types {
+		count, err := s.sweepType(ctx, confirmationType, now)
+		if count > 0 {
+			counts[confirmationType] = count
+			s.log.With(zap.String("type", string(confirmationType)), zap.Int("count", count)).
+				Info("expired confirmations")
+			s.metrics.PostServer(expiredMetric, s.sl.TokenProvide(), map[string]string{
+				"type":  string(confirmationType),
+				"count": strconv.Itoa(count),
+			})
+		}
+		if err != nil {
+			return counts, fmt.Errorf("expiring %s confirmations: %w", confirmationType, err)
+		}
+	}
+	return counts, nil
+}
+
+func (s *Sweeper) sweepType(ctx context.Context, confirmationType models.Type, now time.Time) (int, error) {
+	total := 0
+	for ctx.Err() == nil {
+		expired, err := s.store.ExpireConfirmations(ctx, confirmationType, now, s.config.BatchSize)
+		count := len(expired)
+		total += count
+		if err != nil {
+			return total, err
+		}
+		// A short batch means there's nothing left to expire, or another
+		// replica is sweeping the same confirmations.
+		if count < s.config.BatchSize {
+			break
+		}
+	}
+	return total, nil
+}
+
+func configProvider() (Config, error) {
+	var config Config
+	if err := envconfig.Process("hydrophone_expiry", &config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+func startSweeper(lifecycle fx.Lifecycle, sweeper *Sweeper) {
+	lifecycle.Append(worker.Hook(sweeper))
+}
+
+// Module expires pending confirmations in the background.
+var Module = fx.Options(
+	fx.Provide(configProvider, NewSweeper),
+	fx.Invoke(startSweeper),
+)
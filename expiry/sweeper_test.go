@@ -0,0 +1,135 @@
+package expiry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tidepool-org/go-common/clients/shoreline"
+
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+func TestSweep(s *testing.T) {
+	s.Run("expires pending confirmations past their expiry", func(t *testing.T) {
+		store, metrics, sweeper := newSweeperTest(t)
+		past := sweeper.now().Add(-time.Hour)
+		future := sweeper.now().Add(time.Hour)
+		expired := []*models.Confirmation{
+			store.add(models.TypeCareteamInvite, models.StatusPending, &past),
+			store.add(models.TypeCareteamInvite, models.StatusPending, &past),
+			store.add(models.TypeCareteamInvite, models.StatusPending, &past),
+			store.add(models.TypeSignUp, models.StatusPending, &past),
+		}
+		untouched := []*models.Confirmation{
+			store.add(models.TypeCareteamInvite, models.StatusPending, &future),
+			store.add(models.TypeCareteamInvite, models.StatusCompleted, &past),
+			store.add(models.TypeClinicianInvite, models.StatusPending, nil),
+		}
+
+		counts, err := sweeper.Sweep(context.Background())
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if counts[models.TypeCareteamInvite] != 3 || counts[models.TypeSignUp] != 1 || len(counts) != 2 {
+			t.Fatalf("unexpected counts: %v", counts)
+		}
+		for _, confirmation := range expired {
+			if confirmation.Status != models.StatusExpired {
+				t.Errorf("expected status %q, got %q", models.StatusExpired, confirmation.Status)
+			}
+		}
+		for _, confirmation := range untouched {
+			if confirmation.Status == models.StatusExpired {
+				t.Errorf("expected %s confirmation not to be expired", confirmation.Type)
+			}
+		}
+
+		expectedMetrics := map[string]string{
+			string(models.TypeCareteamInvite): "3",
+			string(models.TypeSignUp):         "1",
+		}
+		if len(metrics.posted) != len(expectedMetrics) {
+			t.Fatalf("expected %d metrics, got %d", len(expectedMetrics), len(metrics.posted))
+		}
+		for _, params := range metrics.posted {
+			if params["count"] != expectedMetrics[params["type"]] {
+				t.Errorf("expected count %s for %s, got %s", expectedMetrics[params["type"]], params["type"], params["count"])
+			}
+		}
+	})
+
+	s.Run("is idempotent", func(t *testing.T) {
+		store, metrics, sweeper := newSweeperTest(t)
+		past := sweeper.now().Add(-time.Hour)
+		store.add(models.TypePasswordReset, models.StatusPending, &past)
+
+		for i := 0; i < 2; i++ {
+			if _, err := sweeper.Sweep(context.Background()); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+		}
+		if len(metrics.posted) != 1 {
+			t.Fatalf("expected 1 metric, got %d", len(metrics.posted))
+		}
+	})
+}
+
+func newSweeperTest(t *testing.T) (*fakeConfirmationStore, *fakeMetrics, *Sweeper) {
+	config := Config{
+		Interval:  time.Minute,
+		BatchSize: 2,
+	}
+	store := &fakeConfirmationStore{}
+	metrics := &fakeMetrics{}
+	sweeper := NewSweeper(config, store, metrics, shoreline.NewMock("token"), testutil.NewLogger(t))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sweeper.now = func() time.Time { return now }
+	return store, metrics, sweeper
+}
+
+// fakeConfirmationStore implements just enough of clients.StoreClient to
+// exercise the Sweeper.
+type fakeConfirmationStore struct {
+	clients.StoreClient
+	confirmations []*models.Confirmation
+}
+
+func (s *fakeConfirmationStore) add(confirmationType models.Type, status models.Status, expiresAt *time.Time) *models.Confirmation {
+	confirmation := &models.Confirmation{
+		Type:      confirmationType,
+		Status:    status,
+		ExpiresAt: expiresAt,
+	}
+	s.confirmations = append(s.confirmations, confirmation)
+	return confirmation
+}
+
+func (s *fakeConfirmationStore) ExpireConfirmations(ctx context.Context, confirmationType models.Type, now time.Time, limit int) ([]*models.Confirmation, error) {
+	var expired []*models.Confirmation
+	for _, confirmation := range s.confirmations {
+		if len(expired) == limit {
+			break
+		}
+		if confirmation.Type == confirmationType && confirmation.Status == models.StatusPending &&
+			confirmation.ExpiresAt != nil && !confirmation.ExpiresAt.After(now) {
+			confirmation.Status = models.StatusExpired
+			expired = append(expired, confirmation)
+		}
+	}
+	return expired, nil
+}
+
+type fakeMetrics struct {
+	posted []map[string]string
+}
+
+func (m *fakeMetrics) PostServer(eventName, token string, params map[string]string) {
+	m.posted = append(m.posted, params)
+}
+
+func (m *fakeMetrics) PostThisUser(eventName, token string, params map[string]string) {}
+
+func (m *fakeMetrics) PostWithUser(userId, eventName, token string, params map[string]string) {}
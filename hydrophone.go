@@ -8,6 +8,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/kelseyhightower/envconfig"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 
@@ -20,8 +21,13 @@ import (
 	"github.com/tidepool-org/hydrophone/api"
 	sc "github.com/tidepool-org/hydrophone/clients"
 	"github.com/tidepool-org/hydrophone/events"
-	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/expiry"
+	"github.com/tidepool-org/hydrophone/metrics"
+	"github.com/tidepool-org/hydrophone/outbox"
+	"github.com/tidepool-org/hydrophone/publisher"
+	"github.com/tidepool-org/hydrophone/reminder"
 	"github.com/tidepool-org/hydrophone/templates"
+	"github.com/tidepool-org/hydrophone/tracing"
 	"github.com/tidepool-org/platform/alerts"
 	"github.com/tidepool-org/platform/auth"
 	authclient "github.com/tidepool-org/platform/auth/client"
@@ -117,12 +123,13 @@ func clientConfigLoaderProvider() client.ConfigLoader {
 	return client.NewEnvconfigLoader()
 }
 
-func clinicProvider(config OutboundConfig, shoreline shoreline.Client) (clinicsClient.ClientWithResponsesInterface, error) {
+func clinicProvider(config OutboundConfig, shoreline shoreline.Client, provider trace.TracerProvider) (clinicsClient.ClientWithResponsesInterface, error) {
 	opts := clinicsClient.WithRequestEditorFn(func(ctx context.Context, req *http.Request) error {
 		req.Header.Add(api.TP_SESSION_TOKEN, shoreline.TokenProvide())
 		return nil
 	})
-	return clinicsClient.NewClientWithResponses(config.ClinicClientAddress, opts)
+	httpClient := &http.Client{Transport: tracing.Transport(http.DefaultTransport, provider)}
+	return clinicsClient.NewClientWithResponses(config.ClinicClientAddress, opts, clinicsClient.WithHTTPClient(httpClient))
 }
 
 func configProvider() (OutboundConfig, error) {
@@ -143,17 +150,12 @@ func serviceConfigProvider() (InboundConfig, error) {
 	return config, nil
 }
 
-func httpClientProvider() *http.Client {
+func httpClientProvider(provider trace.TracerProvider) *http.Client {
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
 
-	return &http.Client{Transport: tr}
-}
-
-func emailTemplateProvider() (models.Templates, error) {
-	emailTemplates, err := templates.New()
-	return emailTemplates, err
+	return &http.Client{Transport: tracing.Transport(tr, provider)}
 }
 
 func serverProvider(config InboundConfig, rtr *mux.Router) *http.Server {
@@ -171,10 +173,23 @@ func cloudEventsConfigProvider() (*ev.CloudEventsConfig, error) {
 	return cfg, nil
 }
 
-func faultTolerantConsumerProvider(config *ev.CloudEventsConfig, handler ev.EventHandler) (ev.EventConsumer, error) {
+// eventHandlers are the handlers of the events hydrophone consumes.
+type eventHandlers struct {
+	fx.In
+	Handlers []ev.EventHandler `group:"eventHandlers"`
+}
+
+func faultTolerantConsumerProvider(config *ev.CloudEventsConfig, handlers eventHandlers, m *metrics.Metrics) (ev.EventConsumer, error) {
+	counted := make([]ev.EventHandler, 0, len(handlers.Handlers))
+	for _, handler := range handlers.Handlers {
+		counted = append(counted, m.EventHandler(handler))
+	}
 	return ev.NewFaultTolerantConsumerGroup(config, func() (ev.MessageConsumer, error) {
-		handlers := []ev.EventHandler{handler}
-		return ev.NewCloudEventsMessageHandler(handlers)
+		consumer, err := ev.NewCloudEventsMessageHandler(counted)
+		if err != nil {
+			return nil, err
+		}
+		return m.MessageConsumer(consumer), nil
 	})
 }
 
@@ -263,13 +278,23 @@ func startServer(p InvocationParams) {
 
 func main() {
 	fx.New(
-		sc.SesModule,
+		metrics.Module,
+		tracing.Module,
+		sc.NotifierModule,
 		sc.MongoModule,
+		outbox.Module,
+		publisher.Module,
+		expiry.Module,
+		reminder.Module,
+		templates.Module,
 		api.RouterModule,
 		fx.Provide(
 			cloudEventsConfigProvider,
 			faultTolerantConsumerProvider,
-			events.NewHandler,
+			events.EmailConfigProvider,
+			events.UserEventsConfigProvider,
+			fx.Annotate(events.NewHandler, fx.ResultTags(`group:"eventHandlers"`)),
+			fx.Annotate(events.NewEmailHandler, fx.ResultTags(`group:"eventHandlers"`)),
 		),
 		authclient.ExternalClientModule,
 		authclient.ProvideServiceName("hydrophone"),
@@ -287,7 +312,6 @@ func main() {
 			configProvider,
 			serviceConfigProvider,
 			httpClientProvider,
-			emailTemplateProvider,
 			serverProvider,
 			clinicProvider,
 			loggerProvider,
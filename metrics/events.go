@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/tidepool-org/go-common/events"
+)
+
+// eventHandler counts the events handled by an events.EventHandler.
+type eventHandler struct {
+	events.EventHandler
+	metrics *Metrics
+}
+
+// EventHandler returns a handler that counts the events handled by handler,
+// by type and outcome.
+func (m *Metrics) EventHandler(handler events.EventHandler) events.EventHandler {
+	return &eventHandler{EventHandler: handler, metrics: m}
+}
+
+func (h *eventHandler) Handle(ce cloudevents.Event) error {
+	err := h.EventHandler.Handle(ce)
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = OutcomeError
+	}
+	h.metrics.eventsHandled.WithLabelValues(ce.Type(), outcome).Inc()
+	return err
+}
+
+// messageConsumer records the lag of the Kafka messages consumed by an
+// events.MessageConsumer.
+type messageConsumer struct {
+	events.MessageConsumer
+	metrics *Metrics
+	now     func() time.Time
+}
+
+// MessageConsumer returns a consumer that records the lag of each message
+// before consumer handles it.
+//
+// The lag is the time since the message was produced, since the high water
+// mark of the partition isn't available to a MessageConsumer.
+func (m *Metrics) MessageConsumer(consumer events.MessageConsumer) events.MessageConsumer {
+	return &messageConsumer{MessageConsumer: consumer, metrics: m, now: time.Now}
+}
+
+func (c *messageConsumer) HandleKafkaMessage(cm *sarama.ConsumerMessage) error {
+	if !cm.Timestamp.IsZero() {
+		c.metrics.consumerLag.
+			WithLabelValues(cm.Topic, strconv.FormatInt(int64(cm.Partition), 10)).
+			Set(c.now().Sub(cm.Timestamp).Seconds())
+	}
+	return c.MessageConsumer.HandleKafkaMessage(cm)
+}
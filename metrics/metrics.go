@@ -0,0 +1,121 @@
+// Package metrics exposes hydrophone's Prometheus metrics.
+//
+// The highwater metrics sent with Api.logMetric predate it, and are still
+// sent for compatibility.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/fx"
+)
+
+const namespace = "hydrophone"
+
+// Outcomes of operations.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// Metrics records hydrophone's metrics in its own registry.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requestDuration *prometheus.HistogramVec
+	storeDuration   *prometheus.HistogramVec
+	storeErrors     *prometheus.CounterVec
+	notifierSends   *prometheus.CounterVec
+	eventsHandled   *prometheus.CounterVec
+	consumerLag     *prometheus.GaugeVec
+}
+
+// New creates the metrics, registered in the registry.
+func New(registry *prometheus.Registry) *Metrics {
+	m := &Metrics{
+		registry: registry,
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of HTTP requests by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		storeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "store",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of store operations by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		storeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "store",
+			Name:      "operation_errors_total",
+			Help:      "Number of store operations that failed, by operation.",
+		}, []string{"operation"}),
+		notifierSends: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "notifier",
+			Name:      "sends_total",
+			Help:      "Number of attempts to send an email, by template and outcome.",
+		}, []string{"template", "outcome"}),
+		eventsHandled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "events",
+			Name:      "handled_total",
+			Help:      "Number of Kafka events handled, by event type and outcome.",
+		}, []string{"type", "outcome"}),
+		consumerLag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "events",
+			Name:      "consumer_lag_seconds",
+			Help:      "Time between the last Kafka message consumed being produced and being consumed, by topic and partition.",
+		}, []string{"topic", "partition"}),
+	}
+	registry.MustRegister(
+		m.requestDuration,
+		m.storeDuration,
+		m.storeErrors,
+		m.notifierSends,
+		m.eventsHandled,
+		m.consumerLag,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveStoreOperation records the duration of a store operation that
+// started at start, and whether it failed.
+func (m *Metrics) ObserveStoreOperation(operation string, start time.Time, err error) {
+	m.storeDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.storeErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// ObserveNotifierSend records the outcome of an attempt to send an email
+// rendered from the template.
+func (m *Metrics) ObserveNotifierSend(template string, outcome string) {
+	m.notifierSends.WithLabelValues(template, outcome).Inc()
+}
+
+func registryProvider() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
+
+// Module provides the metrics, with the Go runtime and process metrics.
+var Module = fx.Options(fx.Provide(registryProvider, New))
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/tidepool-org/go-common/events"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := New(prometheus.NewRegistry())
+	rtr := mux.NewRouter()
+	rtr.Use(m.Middleware)
+	rtr.Handle("/metrics", m.Handler())
+	c := rtr.PathPrefix("/confirm").Subrouter()
+	c.HandleFunc("/invite/{userid}", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusNotFound)
+	}).Methods(http.MethodGet)
+
+	for _, userId := range []string{"one", "two"} {
+		rtr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/confirm/invite/"+userId, nil))
+	}
+
+	response := httptest.NewRecorder()
+	rtr.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected the metrics to be served, got %d", response.Code)
+	}
+	expected := `hydrophone_http_request_duration_seconds_count{method="GET",route="/confirm/invite/{userid}",status="404"} 2`
+	if !strings.Contains(response.Body.String(), expected) {
+		t.Errorf("expected both requests to be observed by route, got:\n%s", response.Body)
+	}
+}
+
+func TestObserveStoreOperation(t *testing.T) {
+	m := New(prometheus.NewRegistry())
+	m.ObserveStoreOperation("FindConfirmation", time.Now(), nil)
+	m.ObserveStoreOperation("FindConfirmation", time.Now(), errors.New("unavailable"))
+
+	if count := testutil.CollectAndCount(m.storeDuration, "hydrophone_store_operation_duration_seconds"); count != 1 {
+		t.Errorf("expected 1 operation to be timed, got %d", count)
+	}
+	if errs := testutil.ToFloat64(m.storeErrors.WithLabelValues("FindConfirmation")); errs != 1 {
+		t.Errorf("expected 1 error, got %v", errs)
+	}
+}
+
+type fakeEventHandler struct {
+	err error
+}
+
+func (h fakeEventHandler) CanHandle(ce cloudevents.Event) bool { return true }
+func (h fakeEventHandler) Handle(ce cloudevents.Event) error   { return h.err }
+
+type fakeMessageConsumer struct {
+	events.MessageConsumer
+	handled int
+}
+
+func (c *fakeMessageConsumer) HandleKafkaMessage(cm *sarama.ConsumerMessage) error {
+	c.handled++
+	return nil
+}
+
+func TestEvents(t *testing.T) {
+	m := New(prometheus.NewRegistry())
+	ce := cloudevents.NewEvent()
+	ce.SetType("users:create")
+
+	m.EventHandler(fakeEventHandler{}).Handle(ce)
+	if err := m.EventHandler(fakeEventHandler{err: errors.New("failed")}).Handle(ce); err == nil {
+		t.Error("expected the handler's error to be returned")
+	}
+	for _, outcome := range []string{OutcomeSuccess, OutcomeError} {
+		if handled := testutil.ToFloat64(m.eventsHandled.WithLabelValues("users:create", outcome)); handled != 1 {
+			t.Errorf("expected 1 %s event, got %v", outcome, handled)
+		}
+	}
+
+	fake := &fakeMessageConsumer{}
+	consumer := m.MessageConsumer(fake)
+	now := time.Now()
+	consumer.(*messageConsumer).now = func() time.Time { return now }
+	consumer.HandleKafkaMessage(&sarama.ConsumerMessage{Topic: "users", Partition: 3, Timestamp: now.Add(-5 * time.Second)})
+	if fake.handled != 1 {
+		t.Errorf("expected the message to be handled, got %d", fake.handled)
+	}
+	if lag := testutil.ToFloat64(m.consumerLag.WithLabelValues("users", "3")); lag != 5 {
+		t.Errorf("expected a lag of 5s, got %v", lag)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"time"
 
 	"github.com/tidepool-org/go-common/clients"
@@ -13,7 +14,14 @@ import (
 
 type (
 	Confirmation struct {
-		Key       string          `json:"key" bson:"_id"`
+		// Id is the public identifier of the confirmation, used to refer to
+		// it in the API.
+		Id string `json:"id" bson:"_id"`
+		// Key is the secret emailed to the recipient, who proves they got the
+		// email with it. It's only known when the confirmation is created or
+		// its key reset, since only its KeyHash is stored.
+		Key       string          `json:"key,omitempty" bson:"-"`
+		KeyHash   string          `json:"-" bson:"keyHash,omitempty"`
 		Type      Type            `json:"type" bson:"type"`
 		Email     string          `json:"email" bson:"email"`
 		ClinicId  string          `json:"clinicId,omitempty" bson:"clinicId,omitempty"`
@@ -24,10 +32,82 @@ type (
 		Modified  time.Time       `json:"modified" bson:"modified"`
 		Status    Status          `json:"status" bson:"status"`
 		ExpiresAt *time.Time      `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+		Locale    Locale          `json:"locale,omitempty" bson:"locale,omitempty"`
+
+		Restrictions *Restrictions  `json:"restrictions" bson:"-"`
+		TemplateName TemplateName   `json:"-" bson:"templateName"`
+		UserId       string         `json:"-" bson:"userId"`
+		History      []StatusChange `json:"-" bson:"history,omitempty"`
+		Delivery     *Delivery      `json:"delivery,omitempty" bson:"delivery,omitempty"`
+		// Code is emailed instead of a link to the key, when it's requested.
+		Code *VerificationCode `json:"-" bson:"code,omitempty"`
+		// Reminders are the reminders emailed while the confirmation was
+		// pending, oldest first.
+		Reminders []Reminder `json:"reminders,omitempty" bson:"reminders,omitempty"`
+		// ReminderFailures counts the reminders that couldn't be sent and were
+		// released to be claimed again.
+		ReminderFailures int `json:"-" bson:"reminderFailures,omitempty"`
+
+		// unsaved tracks the changes made since the confirmation was created
+		// or found, so that the store only writes those.
+		unsaved unsavedChanges
+	}
+
+	unsavedChanges struct {
+		created        bool
+		statusChanged  bool
+		previousStatus Status
+		history        []StatusChange
+	}
+
+	// Reminder records a reminder emailed for a pending confirmation.
+	Reminder struct {
+		// Step is the index of the reminder in the schedule of the
+		// confirmation's type.
+		Step int       `json:"step" bson:"step"`
+		Time time.Time `json:"time" bson:"time"`
+		// Error is why the reminder couldn't be sent, once it's given up on.
+		Error string `json:"-" bson:"error,omitempty"`
+	}
+
+	// VerificationCode is a short numeric code, for apps that can't easily
+	// handle links. It's entered along with the confirmation's email, and is
+	// no longer accepted once it expires or after too many wrong attempts.
+	VerificationCode struct {
+		// Value is the code emailed. Like the key, it's only known when the
+		// code is created, since only its Hash is stored.
+		Value     string    `json:"-" bson:"-"`
+		Hash      string    `json:"-" bson:"hash,omitempty"`
+		ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+		Attempts  int       `json:"attempts" bson:"attempts"`
+	}
+
+	// Delivery records the attempts to email a confirmation, and what the
+	// provider reported happened to the email.
+	Delivery struct {
+		Status            DeliveryStatus `json:"status" bson:"status"`
+		Attempts          int            `json:"attempts" bson:"attempts"`
+		LastAttemptTime   time.Time      `json:"lastAttemptTime" bson:"lastAttemptTime"`
+		ProviderMessageId string         `json:"providerMessageId,omitempty" bson:"providerMessageId,omitempty"`
+		LastError         string         `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	}
+
+	// DeliveryAttempt is the outcome of one attempt to email a confirmation.
+	DeliveryAttempt struct {
+		Time              time.Time
+		ProviderMessageId string
+		Error             string
+	}
 
-		Restrictions *Restrictions `json:"restrictions" bson:"-"`
-		TemplateName TemplateName  `json:"-" bson:"templateName"`
-		UserId       string        `json:"-" bson:"userId"`
+	// StatusChange records who changed the status of a confirmation, and how.
+	// A confirmation's history only ever grows.
+	StatusChange struct {
+		From     Status    `json:"from" bson:"from"`
+		To       Status    `json:"to" bson:"to"`
+		Actor    string    `json:"actor,omitempty" bson:"actor,omitempty"` // the user id, or ActorServer
+		SourceIP string    `json:"sourceIp,omitempty" bson:"sourceIp,omitempty"`
+		Endpoint string    `json:"endpoint,omitempty" bson:"endpoint,omitempty"`
+		Time     time.Time `json:"time" bson:"time"`
 	}
 
 	//basic details for the creator of the confirmation
@@ -67,8 +147,9 @@ type (
 	}
 
 	//Enum type's
-	Status string
-	Type   string
+	Status         string
+	Type           string
+	DeliveryStatus string
 
 	Acceptance struct {
 		Password string `json:"password"`
@@ -84,15 +165,52 @@ const (
 	StatusCompleted Status = "completed"
 	StatusCanceled  Status = "canceled"
 	StatusDeclined  Status = "declined"
+	StatusExpired   Status = "expired"
+	// StatusUndeliverable confirmations were never sent, because their email
+	// address is suppressed.
+	StatusUndeliverable Status = "undeliverable"
+	//Available DeliveryStatus's
+	// DeliveryStatusSent emails were accepted by the provider.
+	DeliveryStatusSent DeliveryStatus = "sent"
+	// DeliveryStatusDelivered emails were accepted by the recipient's server.
+	DeliveryStatusDelivered DeliveryStatus = "delivered"
+	// DeliveryStatusBounced emails were rejected by the recipient's server.
+	DeliveryStatusBounced DeliveryStatus = "bounced"
+	// DeliveryStatusFailed emails couldn't be handed to the provider on the
+	// last attempt. They may be retried.
+	DeliveryStatusFailed DeliveryStatus = "failed"
 	//Available Type's
 	TypePasswordReset   Type = "password_reset"
 	TypeCareteamInvite  Type = "careteam_invitation"
 	TypeClinicianInvite Type = "clinician_invitation"
 	TypeSignUp          Type = "signup_confirmation"
 	TypeNoAccount       Type = "no_account"
+
+	// ActorServer is the actor of status changes made with a server token, or
+	// by hydrophone itself.
+	ActorServer = "server"
 )
 
 var (
+	// Types lists every confirmation Type.
+	Types = []Type{
+		TypePasswordReset,
+		TypeCareteamInvite,
+		TypeClinicianInvite,
+		TypeSignUp,
+		TypeNoAccount,
+	}
+
+	// Statuses lists every confirmation Status.
+	Statuses = []Status{
+		StatusPending,
+		StatusCompleted,
+		StatusCanceled,
+		StatusDeclined,
+		StatusExpired,
+		StatusUndeliverable,
+	}
+
 	Timeouts TypeDurations = TypeDurations{
 		TypeCareteamInvite: 7 * 24 * time.Hour,
 		TypePasswordReset:  7 * 24 * time.Hour,
@@ -103,11 +221,16 @@ var (
 // New confirmation with just the basics
 func NewConfirmation(theType Type, templateName TemplateName, creatorId string) (*Confirmation, error) {
 
-	if key, err := generateKey(); err != nil {
+	id, err := NewKey()
+	if err != nil {
+		return nil, err
+	}
+	if key, err := NewKey(); err != nil {
 		return nil, err
 	} else {
 
 		conf := &Confirmation{
+			Id:           id,
 			Key:          key,
 			Type:         theType,
 			TemplateName: templateName,
@@ -115,6 +238,7 @@ func NewConfirmation(theType Type, templateName TemplateName, creatorId string)
 			Creator:      Creator{}, //set before sending back to client
 			Status:       StatusPending,
 			Created:      time.Now(),
+			unsaved:      unsavedChanges{created: true},
 		}
 
 		if timeout, ok := Timeouts[theType]; ok {
@@ -170,10 +294,49 @@ func (c *Confirmation) DecodeContext(data interface{}) error {
 
 // Set a new status and update the modified time
 func (c *Confirmation) UpdateStatus(newStatus Status) {
+	if !c.unsaved.statusChanged {
+		c.unsaved.statusChanged = true
+		c.unsaved.previousStatus = c.Status
+	}
 	c.Status = newStatus
 	c.Modified = time.Now()
 }
 
+// UpdateStatusBy sets a new status like UpdateStatus, and appends the change
+// to the history. The From, To and Time of change are filled in.
+func (c *Confirmation) UpdateStatusBy(newStatus Status, change StatusChange) {
+	previous := c.Status
+	c.UpdateStatus(newStatus)
+	change.From = previous
+	change.To = newStatus
+	change.Time = c.Modified
+	c.History = append(c.History, change)
+	c.unsaved.history = append(c.unsaved.history, change)
+}
+
+// IsNew reports whether the confirmation was created by NewConfirmation and
+// hasn't been saved since.
+func (c *Confirmation) IsNew() bool {
+	return c.unsaved.created
+}
+
+// PreviousStatus returns the status the confirmation had when it was found or
+// last saved, and whether the status has been updated since.
+func (c *Confirmation) PreviousStatus() (Status, bool) {
+	return c.unsaved.previousStatus, c.unsaved.statusChanged
+}
+
+// UnsavedHistory returns the status changes made since the confirmation was
+// found or last saved.
+func (c *Confirmation) UnsavedHistory() []StatusChange {
+	return c.unsaved.history
+}
+
+// MarkSaved forgets the changes made so far, once the store has saved them.
+func (c *Confirmation) MarkSaved() {
+	c.unsaved = unsavedChanges{}
+}
+
 func (c *Confirmation) ValidateCreatorID(expectedCreatorID string, validationErrors *[]error) *Confirmation {
 	if expectedCreatorID != c.CreatorId {
 		*validationErrors = append(
@@ -249,15 +412,28 @@ func (c *Confirmation) IsExpired() bool {
 	return time.Now().After(*c.ExpiresAt)
 }
 
+// ResetKey replaces the id and key, so that the confirmation is stored anew
+// and the previous key is no longer accepted.
 func (c *Confirmation) ResetKey() error {
-	key, err := generateKey()
+	id, err := NewKey()
+	if err != nil {
+		return err
+	}
+	key, err := NewKey()
 	if err != nil {
 		return err
 	}
 
+	c.Id = id
 	c.Key = key
+	c.KeyHash = ""
 	c.Status = StatusPending
+	// The confirmation will be emailed again.
+	c.Delivery = nil
+	c.Code = nil
 	c.ResetCreationAttributes()
+	// It's saved as a new confirmation, along with its history so far.
+	c.unsaved = unsavedChanges{created: true, history: c.History}
 
 	return nil
 }
@@ -265,9 +441,13 @@ func (c *Confirmation) ResetKey() error {
 func (c *Confirmation) ResetCreationAttributes() {
 	c.Created = time.Now()
 	c.Modified = time.Time{}
+	// The reminders are scheduled from the creation time. The stored ones
+	// are reset by the store's ResetReminders.
+	c.Reminders = nil
 }
 
-func generateKey() (string, error) {
+// NewKey generates a random confirmation key or id.
+func NewKey() (string, error) {
 
 	length := 24 // change the length of the generated random string here
 
@@ -279,6 +459,24 @@ func generateKey() (string, error) {
 	}
 }
 
+// NewVerificationCode generates a random code of length digits, which expires
+// after ttl.
+func NewVerificationCode(length int, ttl time.Duration) (*VerificationCode, error) {
+	digits := make([]byte, length)
+	for i := range digits {
+		digit, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return nil, err
+		}
+		digits[i] = '0' + byte(digit.Int64())
+	}
+	return &VerificationCode{Value: string(digits), ExpiresAt: time.Now().Add(ttl)}, nil
+}
+
+func (v *VerificationCode) IsExpired() bool {
+	return time.Now().After(v.ExpiresAt)
+}
+
 // CareTeamContext specifies details associated with a Care Team Confirmation.
 type CareTeamContext struct {
 	// Permissions to be granted if the Confirmation is accepted.
@@ -344,3 +542,11 @@ func (c *CareTeamContext) Validate() error {
 	}
 	return nil
 }
+
+// Status returns the delivery status after the attempt.
+func (a DeliveryAttempt) Status() DeliveryStatus {
+	if a.Error != "" {
+		return DeliveryStatusFailed
+	}
+	return DeliveryStatusSent
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
@@ -133,7 +134,7 @@ func Test_Confirmation_AddContext(t *testing.T) {
 
 func TestConfirmationKey(t *testing.T) {
 
-	key, err := generateKey()
+	key, err := NewKey()
 	if err != nil {
 		t.Fatalf("error generating key: %s", err)
 	}
@@ -147,6 +148,23 @@ func TestConfirmationKey(t *testing.T) {
 	}
 }
 
+func TestVerificationCode(t *testing.T) {
+	code, err := NewVerificationCode(8, time.Minute)
+	if err != nil {
+		t.Fatalf("error generating code: %s", err)
+	}
+	if len(code.Value) != 8 || strings.Trim(code.Value, "0123456789") != "" {
+		t.Fatalf("expected 8 digits, got %q", code.Value)
+	}
+	if code.IsExpired() {
+		t.Fatal("the code shouldn't have expired yet")
+	}
+	code.ExpiresAt = time.Now().Add(-time.Second)
+	if !code.IsExpired() {
+		t.Fatal("the code should have expired")
+	}
+}
+
 func TestConfirmationContextCustomUnmarshaler(s *testing.T) {
 	s.Run("handles original-recipe Context (aka bare Permissions)", func(t *testing.T) {
 		oldContext := buff(`{"view":{}}`)
@@ -303,3 +321,57 @@ func MustConfirmationWithContext(t *testing.T, theType Type,
 	}
 	return c
 }
+
+func TestConfirmationUpdateStatusBy(t *testing.T) {
+	invite, err := NewConfirmation(TypeCareteamInvite, TemplateNameCareteamInvite, USERID)
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+	invite.UpdateStatusBy(StatusDeclined, StatusChange{Actor: "invitee", Endpoint: "PUT /dismiss"})
+	invite.UpdateStatusBy(StatusCanceled, StatusChange{Actor: ActorServer})
+
+	if invite.Status != StatusCanceled {
+		t.Errorf("expected status %s, got %s", StatusCanceled, invite.Status)
+	}
+	if len(invite.History) != 2 {
+		t.Fatalf("expected 2 status changes, got %d", len(invite.History))
+	}
+	first, second := invite.History[0], invite.History[1]
+	if first.From != StatusPending || first.To != StatusDeclined || first.Actor != "invitee" || first.Endpoint != "PUT /dismiss" {
+		t.Errorf("non-expected first status change %+v", first)
+	}
+	if second.From != StatusDeclined || second.To != StatusCanceled || !second.Time.Equal(invite.Modified) {
+		t.Errorf("non-expected second status change %+v", second)
+	}
+}
+
+func TestConfirmationUnsavedChanges(t *testing.T) {
+	invite, err := NewConfirmation(TypeCareteamInvite, TemplateNameCareteamInvite, USERID)
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+	if !invite.IsNew() {
+		t.Errorf("expected a new confirmation")
+	}
+	invite.MarkSaved()
+	if _, changed := invite.PreviousStatus(); invite.IsNew() || changed {
+		t.Errorf("expected no unsaved changes once saved")
+	}
+
+	invite.UpdateStatusBy(StatusDeclined, StatusChange{Actor: "invitee"})
+	invite.UpdateStatusBy(StatusCanceled, StatusChange{Actor: ActorServer})
+	if previous, changed := invite.PreviousStatus(); !changed || previous != StatusPending {
+		t.Errorf("expected the status to have changed from %s, got %s", StatusPending, previous)
+	}
+	if unsaved := invite.UnsavedHistory(); len(unsaved) != 2 {
+		t.Errorf("expected 2 unsaved status changes, got %d", len(unsaved))
+	}
+
+	invite.MarkSaved()
+	if err := invite.ResetKey(); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+	if !invite.IsNew() || len(invite.UnsavedHistory()) != 2 {
+		t.Errorf("expected a reset confirmation to be saved anew with its history")
+	}
+}
@@ -0,0 +1,216 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// TemplateContent is the content a template is executed with. Each template
+// has a content type, which declares every variable it may use.
+type TemplateContent interface {
+	Base() *BaseContent
+}
+
+// BaseContent holds the variables every template may use. They're set when
+// the template is executed, so the handlers needn't set them.
+type BaseContent struct {
+	WebURL   string
+	AssetURL string
+}
+
+// Base returns the variables common to every template.
+func (b *BaseContent) Base() *BaseContent {
+	return b
+}
+
+// PasswordResetContent is the content of the password reset and no account
+// templates. Code is set instead of linking to the Key when a code was
+// requested.
+type PasswordResetContent struct {
+	BaseContent
+	Key   string
+	Code  string
+	Email string
+}
+
+// CareteamInviteContent is the content of the care team invitation templates.
+type CareteamInviteContent struct {
+	BaseContent
+	CareteamName string
+	Email        string
+	WebPath      string
+}
+
+// PatientClinicInviteContent is the content of the patient clinic invitation
+// template.
+type PatientClinicInviteContent struct {
+	BaseContent
+	CareteamName string
+	ClinicName   string
+	WebPath      string
+}
+
+// ClinicianInviteContent is the content of the clinician invitation template.
+type ClinicianInviteContent struct {
+	BaseContent
+	ClinicName  string
+	CreatorName string
+	Email       string
+	WebPath     string
+}
+
+// InvitationReminderContent is the content of the invitation reminder
+// template. InviterName is the care team or clinic the invitation is from.
+type InvitationReminderContent struct {
+	BaseContent
+	InviterName string
+	Email       string
+	WebPath     string
+}
+
+// SignupContent is the content of the signup confirmation templates. Code is
+// set instead of linking to the Key when a code was requested.
+type SignupContent struct {
+	BaseContent
+	Key         string
+	Code        string
+	Email       string
+	FullName    string
+	CreatorName string
+	ClinicName  string
+}
+
+// templateContents creates empty content for each template.
+var templateContents = map[TemplateName]func() TemplateContent{
+	TemplateNamePatientClinicInvite:                func() TemplateContent { return &PatientClinicInviteContent{} },
+	TemplateNameCareteamInvite:                     func() TemplateContent { return &CareteamInviteContent{} },
+	TemplateNameCareteamInviteWithAlerting:         func() TemplateContent { return &CareteamInviteContent{} },
+	TemplateNameClinicianInvite:                    func() TemplateContent { return &ClinicianInviteContent{} },
+	TemplateNameInvitationReminder:                 func() TemplateContent { return &InvitationReminderContent{} },
+	TemplateNameNoAccount:                          func() TemplateContent { return &PasswordResetContent{} },
+	TemplateNamePasswordReset:                      func() TemplateContent { return &PasswordResetContent{} },
+	TemplateNameSignup:                             func() TemplateContent { return &SignupContent{} },
+	TemplateNameSignupClinic:                       func() TemplateContent { return &SignupContent{} },
+	TemplateNameSignupCustodial:                    func() TemplateContent { return &SignupContent{} },
+	TemplateNameSignupCustodialClinic:              func() TemplateContent { return &SignupContent{} },
+	TemplateNameSignupCustodialNewClinicExperience: func() TemplateContent { return &SignupContent{} },
+}
+
+// OptionalVariables may be left out of the content given for a template. The
+// templates render an alternative without them, like a link to the Key
+// without a Code.
+var OptionalVariables = []string{"Code"}
+
+// requiredVariables can't be blank when a template uses them, since the
+// emails link with them. Others, like names, render blank when they're
+// unknown.
+var requiredVariables = []string{"AssetURL", "Email", "Key", "WebPath", "WebURL"}
+
+// sampleValues are the values of sample content, by variable.
+var sampleValues = map[string]string{
+	"AssetURL":     "https://assets.example.org",
+	"CareteamName": "Sample Patient",
+	"ClinicName":   "Sample Clinic",
+	"CreatorName":  "Sample Clinician",
+	"Email":        "sample@example.org",
+	"FullName":     "Sample Patient",
+	"InviterName":  "Sample Clinic",
+	"Key":          "sample-key",
+	"WebPath":      "login",
+	"WebURL":       "https://app.example.org",
+}
+
+// NewTemplateContent returns empty content of the type the named template is
+// executed with.
+func NewTemplateContent(name TemplateName) (TemplateContent, error) {
+	newContent, ok := templateContents[name]
+	if !ok {
+		return nil, fmt.Errorf("models: no content type for template %s", name)
+	}
+	return newContent(), nil
+}
+
+// SampleTemplateContent returns content for the named template with a sample
+// value for every variable. It's used to validate and preview templates.
+func SampleTemplateContent(name TemplateName) (TemplateContent, error) {
+	content, err := NewTemplateContent(name)
+	if err != nil {
+		return nil, err
+	}
+	value := reflect.ValueOf(content).Elem()
+	for variable, sample := range sampleValues {
+		if field := value.FieldByName(variable); field.IsValid() {
+			field.SetString(sample)
+		}
+	}
+	return content, nil
+}
+
+// SetTemplateVariables sets the string variables of content by name. It fails
+// on variables that content doesn't declare, and on those of BaseContent,
+// which are always set by hydrophone.
+func SetTemplateVariables(content TemplateContent, variables map[string]string) error {
+	value := reflect.ValueOf(content).Elem()
+	base := reflect.TypeOf(BaseContent{})
+	for variable, variableValue := range variables {
+		if _, ok := base.FieldByName(variable); ok {
+			return fmt.Errorf("models: variable %s can't be set", variable)
+		}
+		field := value.FieldByName(variable)
+		if !field.IsValid() || field.Kind() != reflect.String || !field.CanSet() {
+			return fmt.Errorf("models: variable %s isn't declared by %s", variable, value.Type().Name())
+		}
+		field.SetString(variableValue)
+	}
+	return nil
+}
+
+// CheckTemplateContent checks that every variable the template uses is
+// declared by its content type.
+func CheckTemplateContent(template Template) error {
+	content, err := NewTemplateContent(template.Name())
+	if err != nil {
+		return err
+	}
+	contentType := reflect.TypeOf(content).Elem()
+	for _, variable := range template.Variables() {
+		if _, ok := contentType.FieldByName(variable); !ok {
+			return fmt.Errorf("models: template %s uses %s, which %s doesn't declare", template.Name(), variable, contentType.Name())
+		}
+	}
+	return nil
+}
+
+// checkRequiredVariables checks that struct content has a value for every
+// variable of requiredVariables the template uses. A missing key doesn't fail
+// executing a template with a struct, so a field the handler didn't set would
+// otherwise render empty.
+func checkRequiredVariables(name TemplateName, variables []string, content interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(content))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	for _, variable := range variables {
+		if !slices.Contains(requiredVariables, variable) {
+			continue
+		}
+		if field := value.FieldByName(variable); field.IsValid() && field.IsZero() {
+			return fmt.Errorf("models: template %s needs %s, which is missing", name, variable)
+		}
+	}
+	return nil
+}
+
+// checkContentType checks that content of a known template type is the type
+// the template is executed with.
+func checkContentType(name TemplateName, content interface{}) error {
+	newContent, ok := templateContents[name]
+	if !ok {
+		return nil
+	}
+	if expected, actual := reflect.TypeOf(newContent()), reflect.TypeOf(content); expected != actual {
+		return fmt.Errorf("models: template %s needs %s content, not %s", name, expected, actual)
+	}
+	return nil
+}
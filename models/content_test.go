@@ -0,0 +1,85 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_SampleTemplateContent(t *testing.T) {
+	for _, name := range TemplateNames {
+		content, err := SampleTemplateContent(name)
+		if err != nil {
+			t.Fatalf("no sample content for %s: %s", name, err)
+		}
+		if content.Base().WebURL == "" || content.Base().AssetURL == "" {
+			t.Errorf("expected sample URLs for %s", name)
+		}
+	}
+	if _, err := SampleTemplateContent(name); err == nil {
+		t.Errorf("expected an error for a template without a content type")
+	}
+}
+
+func Test_CheckTemplateContent(t *testing.T) {
+	tmpl, err := NewPrecompiledTemplate(TemplateNamePasswordReset, `Reset {{ .Email }}`, `{{ if .Key }}{{ .WebPath }}{{ end }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckTemplateContent(tmpl); err == nil || !strings.Contains(err.Error(), "WebPath") {
+		t.Fatalf(`Error is "%v", but should name the undeclared variable`, err)
+	}
+
+	tmpl, err = NewPrecompiledTemplate(TemplateNamePasswordReset, `Reset {{ .Email }}`, `{{ .WebURL }}/{{ .Key }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckTemplateContent(tmpl); err != nil {
+		t.Fatalf(`Error is "%s", but should be nil`, err)
+	}
+}
+
+func Test_PrecompiledTemplate_Execute_ContentType(t *testing.T) {
+	tmpl, err := NewPrecompiledTemplate(TemplateNamePasswordReset, `Reset {{ .Email }}`, `{{ .Key }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := tmpl.Execute(&SignupContent{Key: "key"}); err == nil {
+		t.Fatal("Execute should fail with the content of another template")
+	}
+	if _, _, _, err := tmpl.Execute(map[string]interface{}{"Key": "key"}); err == nil {
+		t.Fatal("Execute should fail with untyped content")
+	}
+	subject, body, _, err := tmpl.Execute(&PasswordResetContent{Key: "key", Email: "me@example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Reset me@example.org" || body != "key" {
+		t.Fatalf(`Rendered "%s" and "%s"`, subject, body)
+	}
+}
+
+func Test_PrecompiledTemplate_Execute_MissingKey(t *testing.T) {
+	tmpl, err := NewPrecompiledTemplate(name, subjectSuccessTemplate, bodySuccessTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := tmpl.Execute(map[string]interface{}{"Username": "Test User"}); err == nil {
+		t.Fatal("Execute should fail when a variable is missing")
+	}
+}
+
+func Test_SetTemplateVariables(t *testing.T) {
+	content := &PasswordResetContent{}
+	if err := SetTemplateVariables(content, map[string]string{"Key": "key", "Email": "me@example.org"}); err != nil {
+		t.Fatal(err)
+	}
+	if content.Key != "key" || content.Email != "me@example.org" {
+		t.Fatalf("Variables weren't set: %+v", content)
+	}
+	if err := SetTemplateVariables(content, map[string]string{"FullName": "Me"}); err == nil {
+		t.Fatal("SetTemplateVariables should fail on undeclared variables")
+	}
+	if err := SetTemplateVariables(content, map[string]string{"WebURL": "https://example.org"}); err == nil {
+		t.Fatal("SetTemplateVariables should fail on base variables")
+	}
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"errors"
+
+	"golang.org/x/text/language"
+)
+
+// Locale is a BCP 47 language tag, like "en", "fr" or "fr-CA".
+type Locale string
+
+// DefaultLocale is used when no better locale is available.
+const DefaultLocale Locale = "en"
+
+func (l Locale) String() string {
+	return string(l)
+}
+
+// ParseLocale parses and canonicalizes a language tag, so that "fr_ca" and
+// "FR-ca" are both "fr-CA".
+func ParseLocale(value string) (Locale, error) {
+	tag, err := language.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	if tag == language.Und {
+		return "", errors.New("models: locale is undefined")
+	}
+	return Locale(tag.String()), nil
+}
+
+// ParseAcceptLanguage returns the locales of an Accept-Language header,
+// most preferred first. Invalid entries and the "*" wildcard are ignored.
+func ParseAcceptLanguage(header string) []Locale {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil {
+		return nil
+	}
+	locales := make([]Locale, 0, len(tags))
+	for _, tag := range tags {
+		// The wildcard is parsed as "mul", multiple languages.
+		if tag != language.Und && tag.String() != "mul" {
+			locales = append(locales, Locale(tag.String()))
+		}
+	}
+	return locales
+}
+
+// Fallbacks returns l followed by its less specific locales, so "fr-CA" falls
+// back to "fr".
+func (l Locale) Fallbacks() []Locale {
+	tag, err := language.Parse(string(l))
+	if err != nil || tag == language.Und {
+		return nil
+	}
+	fallbacks := []Locale{Locale(tag.String())}
+	if base, confidence := tag.Base(); confidence != language.No {
+		if parent := Locale(base.String()); parent != fallbacks[0] {
+			fallbacks = append(fallbacks, parent)
+		}
+	}
+	return fallbacks
+}
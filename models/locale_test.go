@@ -0,0 +1,80 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_ParseLocale(t *testing.T) {
+	tests := map[string]Locale{
+		"fr":    "fr",
+		"fr_ca": "fr-CA",
+		"FR-ca": "fr-CA",
+		"de-DE": "de-DE",
+	}
+	for value, expected := range tests {
+		locale, err := ParseLocale(value)
+		if err != nil {
+			t.Fatalf(`Error parsing "%s": %s`, value, err)
+		}
+		if locale != expected {
+			t.Fatalf(`Locale is "%s", but should be "%s"`, locale, expected)
+		}
+	}
+
+	for _, value := range []string{"", "und", "not a locale"} {
+		if _, err := ParseLocale(value); err == nil {
+			t.Fatalf(`Parsing "%s" should fail`, value)
+		}
+	}
+}
+
+func Test_ParseAcceptLanguage(t *testing.T) {
+	expected := []Locale{"fr-CA", "fr", "en"}
+	locales := ParseAcceptLanguage("en;q=0.5, fr-CA, fr;q=0.8, *;q=0.1")
+	if !reflect.DeepEqual(locales, expected) {
+		t.Fatalf(`Locales are %v, but should be %v`, locales, expected)
+	}
+}
+
+func Test_Templates_Find(t *testing.T) {
+	mustTemplate := func(subject string) Template {
+		tmpl, err := NewPrecompiledTemplate(name, subject, bodySuccessTemplate)
+		if err != nil {
+			t.Fatalf("error with template: %s", err)
+		}
+		return tmpl
+	}
+	templates := Templates{}
+	templates.Add(DefaultLocale, mustTemplate("en"))
+	templates.Add("fr", mustTemplate("fr"))
+	templates.Add("es-MX", mustTemplate("es-MX"))
+
+	tests := []struct {
+		locales  []Locale
+		expected Locale
+	}{
+		{nil, DefaultLocale},
+		{[]Locale{"fr-CA"}, "fr"},
+		{[]Locale{"de", "fr"}, "fr"},
+		{[]Locale{"es"}, DefaultLocale},
+		{[]Locale{"es-MX", "fr"}, "es-MX"},
+		{[]Locale{"ja"}, DefaultLocale},
+	}
+	for _, test := range tests {
+		tmpl, locale, ok := templates.Find(name, test.locales...)
+		if !ok {
+			t.Fatalf(`Template for %v should be found`, test.locales)
+		}
+		if locale != test.expected {
+			t.Fatalf(`Locale for %v is "%s", but should be "%s"`, test.locales, locale, test.expected)
+		}
+		if subject, _, _, _ := tmpl.Execute(content); subject != test.expected.String() {
+			t.Fatalf(`Subject for %v is "%s", but should be "%s"`, test.locales, subject, test.expected)
+		}
+	}
+
+	if _, _, ok := templates.Find("missing", "fr"); ok {
+		t.Fatal("Missing template should not be found")
+	}
+}
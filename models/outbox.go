@@ -0,0 +1,151 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+type (
+	// OutboxMessage is an email waiting in (or processed by) the outbox.
+	//
+	// Handlers never talk to the email provider directly. Instead they store
+	// an OutboxMessage and the outbox dispatcher delivers it in the
+	// background, retrying failures with an exponential backoff until the
+	// message is either sent or dead-lettered.
+	//
+	// Confirmation events are published through the outbox too, so that they
+	// don't hold up requests and aren't lost while the broker is unavailable.
+	// Their messages have an Event instead of recipients and bodies.
+	OutboxMessage struct {
+		Id             string       `json:"id" bson:"_id"`
+		ConfirmationId string       `json:"confirmationId,omitempty" bson:"confirmationId,omitempty"`
+		TemplateName   TemplateName `json:"templateName,omitempty" bson:"templateName,omitempty"`
+		Recipients     []string     `json:"recipients" bson:"recipients"`
+		Subject        string       `json:"subject" bson:"subject"`
+		Body           string       `json:"body" bson:"body"`
+		TextBody       string       `json:"textBody,omitempty" bson:"textBody,omitempty"`
+		Event          *OutboxEvent `json:"event,omitempty" bson:"event,omitempty"`
+		Status         OutboxStatus `json:"status" bson:"status"`
+		Attempts       int          `json:"attempts" bson:"attempts"`
+		LastError      string       `json:"lastError,omitempty" bson:"lastError,omitempty"`
+		NextAttemptAt  time.Time    `json:"nextAttemptAt" bson:"nextAttemptAt"`
+		LockedUntil    *time.Time   `json:"lockedUntil,omitempty" bson:"lockedUntil,omitempty"`
+		Created        time.Time    `json:"created" bson:"created"`
+		Modified       time.Time    `json:"modified" bson:"modified"`
+	}
+
+	// OutboxEvent is an event waiting in the outbox to be published.
+	OutboxEvent struct {
+		Type string `json:"type" bson:"type"`
+		Key  string `json:"key,omitempty" bson:"key,omitempty"`
+		// Payload is the JSON of the event.
+		Payload string `json:"payload" bson:"payload"`
+	}
+
+	OutboxStatus string
+)
+
+const (
+	// OutboxStatusPending messages are waiting for their next delivery attempt.
+	OutboxStatusPending OutboxStatus = "pending"
+	// OutboxStatusSending messages have been claimed by a dispatcher.
+	OutboxStatusSending OutboxStatus = "sending"
+	// OutboxStatusSent messages were accepted by the email provider.
+	OutboxStatusSent OutboxStatus = "sent"
+	// OutboxStatusDead messages exhausted their delivery attempts.
+	OutboxStatusDead OutboxStatus = "dead"
+	// OutboxStatusSuppressed messages weren't sent, since all their
+	// recipients are suppressed.
+	OutboxStatusSuppressed OutboxStatus = "suppressed"
+)
+
+// NewOutboxMessage creates a pending message that's ready to be delivered.
+func NewOutboxMessage(templateName TemplateName, recipients []string, subject, body, textBody string) (*OutboxMessage, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("models: recipients are missing")
+	}
+
+	message, err := newOutboxMessage()
+	if err != nil {
+		return nil, err
+	}
+	message.TemplateName = templateName
+	message.Recipients = recipients
+	message.Subject = subject
+	message.Body = body
+	message.TextBody = textBody
+	return message, nil
+}
+
+// NewOutboxEvent creates a pending message that publishes the event with the
+// type, key and JSON payload.
+func NewOutboxEvent(eventType, key string, payload []byte) (*OutboxMessage, error) {
+	if eventType == "" {
+		return nil, errors.New("models: event type is missing")
+	}
+
+	message, err := newOutboxMessage()
+	if err != nil {
+		return nil, err
+	}
+	message.Event = &OutboxEvent{Type: eventType, Key: key, Payload: string(payload)}
+	return message, nil
+}
+
+func newOutboxMessage() (*OutboxMessage, error) {
+	id, err := NewKey()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &OutboxMessage{
+		Id:            id,
+		Status:        OutboxStatusPending,
+		NextAttemptAt: now,
+		Created:       now,
+		Modified:      now,
+	}, nil
+}
+
+// MarkSent records a successful delivery attempt. The bodies are dropped,
+// since they may have a confirmation key that mustn't be stored.
+func (m *OutboxMessage) MarkSent(now time.Time) {
+	m.Attempts++
+	m.Status = OutboxStatusSent
+	m.Body = ""
+	m.TextBody = ""
+	m.LastError = ""
+	m.LockedUntil = nil
+	m.Modified = now
+}
+
+// MarkSuppressed records that the message won't be sent, since all its
+// recipients are suppressed. The bodies are dropped like in MarkSent.
+func (m *OutboxMessage) MarkSuppressed(now time.Time) {
+	m.Status = OutboxStatusSuppressed
+	m.Body = ""
+	m.TextBody = ""
+	m.LockedUntil = nil
+	m.Modified = now
+}
+
+// MarkFailed records a failed delivery attempt.
+//
+// The message is rescheduled for retryAt, unless retryAt is nil, in which case
+// the message is dead-lettered. Like in MarkSent, the bodies of dead-lettered
+// messages are dropped.
+func (m *OutboxMessage) MarkFailed(now time.Time, reason string, retryAt *time.Time) {
+	m.Attempts++
+	m.LastError = reason
+	m.LockedUntil = nil
+	m.Modified = now
+	if retryAt == nil {
+		m.Status = OutboxStatusDead
+		m.Body = ""
+		m.TextBody = ""
+		return
+	}
+	m.Status = OutboxStatusPending
+	m.NextAttemptAt = *retryAt
+}
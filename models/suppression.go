@@ -0,0 +1,51 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+type (
+	// Suppression stops emails from being sent to an address, because they
+	// bounced, the recipient complained, or an admin added it.
+	Suppression struct {
+		Email    string            `json:"email" bson:"_id"`
+		Reason   SuppressionReason `json:"reason" bson:"reason"`
+		Detail   string            `json:"detail,omitempty" bson:"detail,omitempty"`
+		Created  time.Time         `json:"created" bson:"created"`
+		Modified time.Time         `json:"modified" bson:"modified"`
+	}
+
+	SuppressionReason string
+)
+
+const (
+	SuppressionReasonBounce    SuppressionReason = "bounce"
+	SuppressionReasonComplaint SuppressionReason = "complaint"
+	SuppressionReasonManual    SuppressionReason = "manual"
+)
+
+// NewSuppression suppresses the email address. Addresses are suppressed
+// case-insensitively.
+func NewSuppression(email string, reason SuppressionReason, detail string) (*Suppression, error) {
+	email = SuppressionEmail(email)
+	if email == "" {
+		return nil, errors.New("models: email is missing")
+	}
+
+	now := time.Now()
+	return &Suppression{
+		Email:    email,
+		Reason:   reason,
+		Detail:   detail,
+		Created:  now,
+		Modified: now,
+	}, nil
+}
+
+// SuppressionEmail returns the form of the email address suppressions are
+// stored under.
+func SuppressionEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -5,8 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"slices"
+	"sort"
 	"strconv"
 	textTemplate "text/template"
+	"text/template/parse"
 )
 
 type TemplateName string
@@ -23,6 +26,7 @@ const (
 	// notifications.
 	TemplateNameCareteamInviteWithAlerting         TemplateName = "careteam_invitation_with_alerting"
 	TemplateNameClinicianInvite                    TemplateName = "clinician_invitation"
+	TemplateNameInvitationReminder                 TemplateName = "invitation_reminder"
 	TemplateNameNoAccount                          TemplateName = "no_account"
 	TemplateNamePasswordReset                      TemplateName = "password_reset"
 	TemplateNameSignup                             TemplateName = "signup_confirmation"
@@ -33,19 +37,118 @@ const (
 	TemplateNameUndefined                          TemplateName = ""
 )
 
+// TemplateNames lists every TemplateName that's sent.
+var TemplateNames = []TemplateName{
+	TemplateNamePatientClinicInvite,
+	TemplateNameCareteamInvite,
+	TemplateNameCareteamInviteWithAlerting,
+	TemplateNameClinicianInvite,
+	TemplateNameInvitationReminder,
+	TemplateNameNoAccount,
+	TemplateNamePasswordReset,
+	TemplateNameSignup,
+	TemplateNameSignupClinic,
+	TemplateNameSignupCustodial,
+	TemplateNameSignupCustodialClinic,
+	TemplateNameSignupCustodialNewClinicExperience,
+}
+
 type Template interface {
 	Name() TemplateName
-	Execute(content interface{}) (string, string, error)
+	// Execute renders the subject, the HTML body and the plain text body.
+	Execute(content interface{}) (subject string, html string, text string, err error)
+	// Variables lists the top level fields of the content that the template
+	// uses, sorted by name.
+	Variables() []string
+}
+
+// TemplateProvider finds templates. The templates it provides may change at
+// any time, so they shouldn't be kept around.
+type TemplateProvider interface {
+	Find(name TemplateName, locales ...Locale) (Template, Locale, bool)
+	// Keys lists the translations available, sorted by name and locale.
+	Keys() []TemplateKey
+}
+
+// TemplateKey identifies a translation of a template.
+type TemplateKey struct {
+	Name   TemplateName
+	Locale Locale
+}
+
+// Templates holds every translation of every template.
+type Templates map[TemplateKey]Template
+
+// Add a translation of a template.
+func (t Templates) Add(locale Locale, template Template) {
+	t[TemplateKey{Name: template.Name(), Locale: locale}] = template
+}
+
+// Keys lists the translations, sorted by name and locale.
+func (t Templates) Keys() []TemplateKey {
+	keys := make([]TemplateKey, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Name != keys[j].Name {
+			return keys[i].Name < keys[j].Name
+		}
+		return keys[i].Locale < keys[j].Locale
+	})
+	return keys
 }
 
-type Templates map[TemplateName]Template
+// Find the best translation of the named template for the given locales,
+// which are in order of preference.
+//
+// Each locale falls back to its less specific locales before the next one is
+// tried, and DefaultLocale is tried last. The locale of the translation found
+// is returned along with it.
+func (t Templates) Find(name TemplateName, locales ...Locale) (Template, Locale, bool) {
+	for _, locale := range append(locales[:len(locales):len(locales)], DefaultLocale) {
+		for _, fallback := range locale.Fallbacks() {
+			if template, ok := t[TemplateKey{Name: name, Locale: fallback}]; ok {
+				return template, fallback, true
+			}
+		}
+	}
+	return nil, "", false
+}
+
+// ErrUnknownTemplate is returned when no translation of a template exists.
+var ErrUnknownTemplate = errors.New("models: unknown template")
+
+// RenderTemplate executes the best translation of the named template for the
+// given locales, returning the subject, the HTML and plain text bodies, and the
+// locale of the translation used.
+func RenderTemplate(provider TemplateProvider, name TemplateName, locales []Locale, content TemplateContent) (string, string, string, Locale, error) {
+	template, locale, ok := provider.Find(name, locales...)
+	if !ok {
+		return "", "", "", "", ErrUnknownTemplate
+	}
+	subject, html, text, err := template.Execute(content)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	return subject, html, text, locale, nil
+}
+
+// missingKeyOption makes executing a template with map content fail when a
+// variable is missing, rather than rendering it empty. Typed content is
+// checked by checkRequiredVariables instead.
+const missingKeyOption = "missingkey=error"
 
 type PrecompiledTemplate struct {
 	name               TemplateName
 	precompiledSubject *textTemplate.Template
 	precompiledBody    *template.Template
+	precompiledText    *textTemplate.Template
+	variables          []string
 }
 
+// NewPrecompiledTemplate creates a template whose plain text body is converted
+// from the HTML body.
 func NewPrecompiledTemplate(name TemplateName, subjectTemplate string, bodyTemplate string) (*PrecompiledTemplate, error) {
 	if name == TemplateNameUndefined {
 		return nil, errors.New("models: name is missing")
@@ -57,12 +160,12 @@ func NewPrecompiledTemplate(name TemplateName, subjectTemplate string, bodyTempl
 		return nil, errors.New("models: body template is missing")
 	}
 
-	precompiledSubject, err := textTemplate.New(name.String()).Parse(subjectTemplate)
+	precompiledSubject, err := textTemplate.New(name.String()).Option(missingKeyOption).Parse(subjectTemplate)
 	if err != nil {
 		return nil, fmt.Errorf("models: failure to precompile subject template: %s", err)
 	}
 
-	precompiledBody, err := template.New(name.String()).Parse(bodyTemplate)
+	precompiledBody, err := template.New(name.String()).Option(missingKeyOption).Parse(bodyTemplate)
 	if err != nil {
 		return nil, fmt.Errorf("models: failure to precompile body template: %s", err)
 	}
@@ -71,24 +174,129 @@ func NewPrecompiledTemplate(name TemplateName, subjectTemplate string, bodyTempl
 		name:               name,
 		precompiledSubject: precompiledSubject,
 		precompiledBody:    precompiledBody,
+		// html/template rewrites its tree when it's first executed, so the
+		// variables are found beforehand.
+		variables: templateVariables(nil, precompiledSubject.Tree, precompiledBody.Tree),
 	}, nil
 }
 
+// NewPrecompiledTemplateWithText creates a template with a companion plain
+// text body template.
+func NewPrecompiledTemplateWithText(name TemplateName, subjectTemplate string, bodyTemplate string, textBodyTemplate string) (*PrecompiledTemplate, error) {
+	if textBodyTemplate == "" {
+		return nil, errors.New("models: text template is missing")
+	}
+
+	precompiled, err := NewPrecompiledTemplate(name, subjectTemplate, bodyTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	if precompiled.precompiledText, err = textTemplate.New(name.String()).Option(missingKeyOption).Parse(textBodyTemplate); err != nil {
+		return nil, fmt.Errorf("models: failure to precompile text template: %s", err)
+	}
+	precompiled.variables = templateVariables(precompiled.variables, precompiled.precompiledText.Tree)
+
+	return precompiled, nil
+}
+
 func (p *PrecompiledTemplate) Name() TemplateName {
 	return p.name
 }
 
-func (p *PrecompiledTemplate) Execute(content interface{}) (string, string, error) {
+func (p *PrecompiledTemplate) Variables() []string {
+	return slices.Clone(p.variables)
+}
+
+func (p *PrecompiledTemplate) Execute(content interface{}) (string, string, string, error) {
+	if err := checkContentType(p.name, content); err != nil {
+		return "", "", "", err
+	}
+	if err := checkRequiredVariables(p.name, p.variables, content); err != nil {
+		return "", "", "", err
+	}
+
 	var subjectBuffer bytes.Buffer
 	var bodyBuffer bytes.Buffer
 
 	if err := p.precompiledSubject.Execute(&subjectBuffer, content); err != nil {
-		return "", "", fmt.Errorf("models: failure to execute subject template %s with content", strconv.Quote(p.name.String()))
+		return "", "", "", fmt.Errorf("models: failure to execute subject template %s with content: %w", strconv.Quote(p.name.String()), err)
 	}
 
 	if err := p.precompiledBody.Execute(&bodyBuffer, content); err != nil {
-		return "", "", fmt.Errorf("models: failure to execute body template %s with content", strconv.Quote(p.name.String()))
+		return "", "", "", fmt.Errorf("models: failure to execute body template %s with content: %w", strconv.Quote(p.name.String()), err)
 	}
 
-	return subjectBuffer.String(), bodyBuffer.String(), nil
+	if p.precompiledText == nil {
+		return subjectBuffer.String(), bodyBuffer.String(), HTMLToText(bodyBuffer.String()), nil
+	}
+
+	var textBuffer bytes.Buffer
+	if err := p.precompiledText.Execute(&textBuffer, content); err != nil {
+		return "", "", "", fmt.Errorf("models: failure to execute text template %s with content: %w", strconv.Quote(p.name.String()), err)
+	}
+
+	return subjectBuffer.String(), bodyBuffer.String(), textBuffer.String(), nil
+}
+
+// templateVariables adds the top level fields used by the trees to variables,
+// returning them sorted and without duplicates. Fields used within range and
+// with blocks belong to a nested value, so they aren't included.
+func templateVariables(variables []string, trees ...*parse.Tree) []string {
+	for _, tree := range trees {
+		if tree != nil {
+			variables = appendNodeVariables(variables, tree.Root, true)
+		}
+	}
+	sort.Strings(variables)
+	return slices.Compact(variables)
+}
+
+func appendNodeVariables(variables []string, node parse.Node, topLevel bool) []string {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node != nil {
+			for _, child := range node.Nodes {
+				variables = appendNodeVariables(variables, child, topLevel)
+			}
+		}
+	case *parse.ActionNode:
+		variables = appendNodeVariables(variables, node.Pipe, topLevel)
+	case *parse.IfNode:
+		variables = appendBranchVariables(variables, &node.BranchNode, topLevel, topLevel)
+	case *parse.RangeNode:
+		variables = appendBranchVariables(variables, &node.BranchNode, topLevel, false)
+	case *parse.WithNode:
+		variables = appendBranchVariables(variables, &node.BranchNode, topLevel, false)
+	case *parse.TemplateNode:
+		variables = appendNodeVariables(variables, node.Pipe, topLevel)
+	case *parse.PipeNode:
+		if node != nil {
+			for _, command := range node.Cmds {
+				variables = appendNodeVariables(variables, command, topLevel)
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			variables = appendNodeVariables(variables, arg, topLevel)
+		}
+	case *parse.ChainNode:
+		variables = appendNodeVariables(variables, node.Node, topLevel)
+	case *parse.FieldNode:
+		if topLevel {
+			variables = append(variables, node.Ident[0])
+		}
+	case *parse.VariableNode:
+		// $ is always the top level content.
+		if len(node.Ident) > 1 && node.Ident[0] == "$" {
+			variables = append(variables, node.Ident[1])
+		}
+	}
+	return variables
+}
+
+func appendBranchVariables(variables []string, node *parse.BranchNode, topLevel bool, listTopLevel bool) []string {
+	variables = appendNodeVariables(variables, node.Pipe, topLevel)
+	variables = appendNodeVariables(variables, node.List, listTopLevel)
+	return appendNodeVariables(variables, node.ElseList, topLevel)
 }
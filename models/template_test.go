@@ -19,6 +19,9 @@ var (
 
 	bodySuccessTemplate = `Key is '{{ .Key }}'`
 	bodyFailureTemplate = `{{define "bodyFailure"}}`
+
+	textSuccessTemplate = `Key is {{ .Key }}`
+	textFailureTemplate = `{{define "textFailure"}}`
 )
 
 func Test_NewPrecompiledTemplate_NameMissing(t *testing.T) {
@@ -103,7 +106,7 @@ func Test_NewPrecompiledTemplate_ExecuteSuccess(t *testing.T) {
 	if err != nil {
 		t.Fatalf("error with template: %s", err)
 	}
-	subject, body, err := tmpl.Execute(content)
+	subject, body, text, err := tmpl.Execute(content)
 	if err != nil {
 		t.Fatalf(`Error is "%s", but should be nil`, err)
 	}
@@ -113,4 +116,100 @@ func Test_NewPrecompiledTemplate_ExecuteSuccess(t *testing.T) {
 	if body != expectedBody {
 		t.Fatalf(`Body is "%s", but should be "%s"`, body, expectedBody)
 	}
+	if expectedText := "Key is '123.blah.456.blah'\n"; text != expectedText {
+		t.Fatalf(`Text is "%s", but should be "%s"`, text, expectedText)
+	}
+}
+
+func Test_NewPrecompiledTemplateWithText_TextTemplateMissing(t *testing.T) {
+	expectedError := "models: text template is missing"
+	tmpl, err := NewPrecompiledTemplateWithText(name, subjectSuccessTemplate, bodySuccessTemplate, "")
+	if err == nil || err.Error() != expectedError {
+		t.Fatalf(`Error is "%s", but should be "%s"`, err, expectedError)
+	}
+	if tmpl != nil {
+		t.Fatal("Template should be nil")
+	}
+}
+
+func Test_NewPrecompiledTemplateWithText_TextTemplateNotPrecompiled(t *testing.T) {
+	expectedError := "models: failure to precompile text template: template: test:1: unexpected EOF"
+	tmpl, err := NewPrecompiledTemplateWithText(name, subjectSuccessTemplate, bodySuccessTemplate, textFailureTemplate)
+	if err == nil || err.Error() != expectedError {
+		t.Fatalf(`Error is "%s", but should be "%s"`, err, expectedError)
+	}
+	if tmpl != nil {
+		t.Fatal("Template should be nil")
+	}
+}
+
+func Test_NewPrecompiledTemplateWithText_ExecuteSuccess(t *testing.T) {
+	expectedText := `Key is 123.blah.456.blah`
+	tmpl, err := NewPrecompiledTemplateWithText(name, subjectSuccessTemplate, bodySuccessTemplate, textSuccessTemplate)
+	if err != nil {
+		t.Fatalf("error with template: %s", err)
+	}
+	_, _, text, err := tmpl.Execute(content)
+	if err != nil {
+		t.Fatalf(`Error is "%s", but should be nil`, err)
+	}
+	if text != expectedText {
+		t.Fatalf(`Text is "%s", but should be "%s"`, text, expectedText)
+	}
+}
+
+func Test_PrecompiledTemplate_Variables(t *testing.T) {
+	tmpl, err := NewPrecompiledTemplateWithText(name,
+		`{{ .Username }} for {{ .ClinicName }}`,
+		`{{ if .Key }}{{ .Key }}{{ else }}{{ .WebURL }}{{ end }}{{ with .Creator }}{{ .Name }} {{ $.AssetURL }}{{ end }}`,
+		`{{ range .Items }}{{ .Count }}{{ end }}{{ .Username }}`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"AssetURL", "ClinicName", "Creator", "Items", "Key", "Username", "WebURL"}
+	variables := tmpl.Variables()
+	if len(variables) != len(expected) {
+		t.Fatalf(`Variables are %v, but should be %v`, variables, expected)
+	}
+	for i := range expected {
+		if variables[i] != expected[i] {
+			t.Fatalf(`Variables are %v, but should be %v`, variables, expected)
+		}
+	}
+}
+
+func Test_PrecompiledTemplate_ExecuteMissingVariable(t *testing.T) {
+	expectedError := "models: template test needs Key, which is missing"
+	tmpl, err := NewPrecompiledTemplate(name, subjectSuccessTemplate, bodySuccessTemplate)
+	if err != nil {
+		t.Fatalf("error with template: %s", err)
+	}
+	if _, _, _, err := tmpl.Execute(Data{Username: "Test User"}); err == nil || err.Error() != expectedError {
+		t.Fatalf(`Error is "%v", but should be "%s"`, err, expectedError)
+	}
+}
+
+func Test_PrecompiledTemplate_ExecuteMissingOptionalVariable(t *testing.T) {
+	tmpl, err := NewPrecompiledTemplate(name, `{{ if .Code }}{{ .Code }}{{ else }}{{ .Key }}{{ end }}`, bodySuccessTemplate)
+	if err != nil {
+		t.Fatalf("error with template: %s", err)
+	}
+	if _, _, _, err := tmpl.Execute(struct{ Code, Key string }{Key: "123"}); err != nil {
+		t.Fatalf(`Error is "%s", but should be nil`, err)
+	}
+}
+
+func Test_PrecompiledTemplate_ExecuteBlankName(t *testing.T) {
+	tmpl, err := NewPrecompiledTemplate(name, `Hi {{ .FullName }}`, `{{ .Key }}`)
+	if err != nil {
+		t.Fatalf("error with template: %s", err)
+	}
+	subject, _, _, err := tmpl.Execute(struct{ FullName, Key string }{Key: "123"})
+	if err != nil {
+		t.Fatalf(`Error is "%s", but should be nil`, err)
+	}
+	if subject != "Hi " {
+		t.Fatalf(`Subject is "%s", but should be "Hi "`, subject)
+	}
 }
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLToText converts an HTML email body to a plain text alternative.
+//
+// Paragraphs, table rows and line breaks are kept as line breaks, links are
+// written as their text followed by the URL in parentheses, and anything that
+// isn't rendered by an email client (head, style, comments...) is dropped.
+// Links without any text, like image-only social links, are dropped as well.
+func HTMLToText(body string) string {
+	converter := &htmlTextConverter{}
+	tokenizer := html.NewTokenizer(strings.NewReader(body))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return converter.String()
+		case html.TextToken:
+			if converter.skipping == 0 {
+				converter.text(string(tokenizer.Text()))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			converter.start(tokenizer.Token())
+		case html.EndTagToken:
+			converter.end(tokenizer.Token())
+		}
+	}
+}
+
+type htmlTextConverter struct {
+	lines    []string
+	line     strings.Builder
+	skipping int
+
+	// links are the currently open links, along with the length of the
+	// current line when each of them started.
+	links []htmlLink
+}
+
+type htmlLink struct {
+	href  string
+	start int
+}
+
+func (c *htmlTextConverter) text(text string) {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		if c.line.Len() > 0 && text != "" {
+			c.space()
+		}
+		return
+	}
+	if isSpace(text[0]) {
+		c.space()
+	}
+	c.line.WriteString(strings.Join(words, " "))
+	if isSpace(text[len(text)-1]) {
+		c.space()
+	}
+}
+
+func (c *htmlTextConverter) space() {
+	if current := c.line.String(); current != "" && !strings.HasSuffix(current, " ") {
+		c.line.WriteByte(' ')
+	}
+}
+
+func (c *htmlTextConverter) start(token html.Token) {
+	switch token.DataAtom {
+	case atom.Head, atom.Style, atom.Script, atom.Title:
+		if token.Type == html.StartTagToken {
+			c.skipping++
+		}
+	case atom.Br:
+		c.newline()
+	case atom.A:
+		c.links = append(c.links, htmlLink{href: attribute(token, "href"), start: c.line.Len()})
+	case atom.Li:
+		c.newline()
+		c.line.WriteString("- ")
+	default:
+		if isBlock(token.DataAtom) {
+			c.paragraph()
+		}
+	}
+}
+
+func (c *htmlTextConverter) end(token html.Token) {
+	switch token.DataAtom {
+	case atom.Head, atom.Style, atom.Script, atom.Title:
+		if c.skipping > 0 {
+			c.skipping--
+		}
+	case atom.A:
+		if len(c.links) == 0 {
+			return
+		}
+		link := c.links[len(c.links)-1]
+		c.links = c.links[:len(c.links)-1]
+
+		current := c.line.String()
+		if link.start > len(current) {
+			link.start = 0
+		}
+		label := strings.TrimSpace(current[link.start:])
+		if label == "" || link.href == "" || label == link.href || strings.HasPrefix(link.href, "mailto:") {
+			return
+		}
+		c.line.Reset()
+		c.line.WriteString(strings.TrimRight(current, " "))
+		c.line.WriteString(" (" + link.href + ")")
+	default:
+		if isBlock(token.DataAtom) {
+			c.paragraph()
+		}
+	}
+}
+
+// newline ends the current line.
+func (c *htmlTextConverter) newline() {
+	c.lines = append(c.lines, strings.TrimSpace(c.line.String()))
+	c.line.Reset()
+	for i := range c.links {
+		c.links[i].start = 0
+	}
+}
+
+// paragraph ends the current line, if any, and separates it from what
+// follows with a blank line.
+func (c *htmlTextConverter) paragraph() {
+	if strings.TrimSpace(c.line.String()) != "" {
+		c.newline()
+	}
+	if len(c.lines) > 0 && c.lines[len(c.lines)-1] != "" {
+		c.lines = append(c.lines, "")
+	}
+}
+
+func (c *htmlTextConverter) String() string {
+	c.newline()
+
+	var builder strings.Builder
+	blank := true
+	for _, line := range c.lines {
+		if line == "" {
+			if !blank {
+				builder.WriteString("\n")
+			}
+			blank = true
+			continue
+		}
+		builder.WriteString(line)
+		builder.WriteString("\n")
+		blank = false
+	}
+	return strings.TrimSpace(builder.String()) + "\n"
+}
+
+func attribute(token html.Token, key string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == key {
+			return strings.TrimSpace(attr.Val)
+		}
+	}
+	return ""
+}
+
+func isBlock(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.Table, atom.Tr, atom.Center, atom.Ul, atom.Ol, atom.Blockquote,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Hr:
+		return true
+	}
+	return false
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
@@ -0,0 +1,38 @@
+package models
+
+import "testing"
+
+func Test_HTMLToText(t *testing.T) {
+	body := `
+<html>
+  <head>
+    <title>Ignored</title>
+    <style type="text/css">p { color: red; }</style>
+  </head>
+  <body>
+    <!--[if (gte mso 9)|(IE)]><table><tr><td><![endif]-->
+    <p>Hey   there!</p>
+    <p>You requested a password reset.<br /><br />Otherwise, click the link below.</p>
+    <a class="btn" href="https://app.tidepool.org/confirm?key=a&amp;b">
+      Reset Password
+    </a>
+    <a href="https://www.twitter.com/Tidepool_org"><img src="twitter.png" alt="Twitter logo"/></a>
+    <p>Sincerely,<br/>The Tidepool Team &amp; friends</p>
+  </body>
+</html>`
+
+	expected := "Hey there!\n" +
+		"\n" +
+		"You requested a password reset.\n" +
+		"\n" +
+		"Otherwise, click the link below.\n" +
+		"\n" +
+		"Reset Password (https://app.tidepool.org/confirm?key=a&b)\n" +
+		"\n" +
+		"Sincerely,\n" +
+		"The Tidepool Team & friends\n"
+
+	if text := HTMLToText(body); text != expected {
+		t.Fatalf("Text is %q, but should be %q", text, expected)
+	}
+}
@@ -0,0 +1,280 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/tidepool-org/go-common/events"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/metrics"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/worker"
+)
+
+// Config controls how often the outbox is polled and how failed deliveries
+// are retried.
+type Config struct {
+	PollInterval   time.Duration `split_words:"true" default:"5s"`
+	BatchSize      int           `split_words:"true" default:"25"`
+	MaxAttempts    int           `split_words:"true" default:"8"`
+	InitialBackoff time.Duration `split_words:"true" default:"30s"`
+	MaxBackoff     time.Duration `split_words:"true" default:"1h"`
+	LockDuration   time.Duration `split_words:"true" default:"2m"`
+	// EventTimeout limits each attempt to publish an event.
+	EventTimeout time.Duration `split_words:"true" default:"10s"`
+}
+
+// Dispatcher delivers the emails stored in the outbox through a Notifier, and
+// publishes the events stored in it through an EventProducer. It's the one
+// place suppressed recipients are dropped, so that no email is sent to them
+// however it was queued.
+type Dispatcher struct {
+	config   Config
+	store    clients.StoreClient
+	notifier clients.Notifier
+	producer events.EventProducer
+	metrics  *metrics.Metrics
+	log      *zap.SugaredLogger
+	now      func() time.Time
+	periodic *worker.Periodic
+}
+
+func NewDispatcher(config Config, store clients.StoreClient, notifier clients.Notifier, producer events.EventProducer, m *metrics.Metrics, log *zap.SugaredLogger) *Dispatcher {
+	d := &Dispatcher{
+		config:   config,
+		store:    store,
+		notifier: notifier,
+		producer: producer,
+		metrics:  m,
+		log:      log,
+		now:      time.Now,
+	}
+	d.periodic = worker.NewPeriodic(config.PollInterval, d.poll)
+	return d
+}
+
+// Start polls the outbox in the background until Stop is called.
+func (d *Dispatcher) Start() {
+	d.periodic.Start()
+}
+
+// Stop waits for the current batch to finish, or for ctx to be done.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	return d.periodic.Stop(ctx)
+}
+
+func (d *Dispatcher) poll(ctx context.Context) bool {
+	if _, err := d.DispatchPending(ctx); err != nil && ctx.Err() == nil {
+		d.log.With(zap.Error(err)).Error("dispatching outbox messages")
+	}
+	return true
+}
+
+// DispatchPending delivers up to BatchSize messages that are due, returning
+// the number of messages claimed.
+func (d *Dispatcher) DispatchPending(ctx context.Context) (int, error) {
+	for count := 0; count < d.config.BatchSize; count++ {
+		if ctx.Err() != nil {
+			return count, nil
+		}
+		now := d.now()
+		message, err := d.store.ClaimMessage(ctx, now, now.Add(d.config.LockDuration))
+		if err != nil {
+			return count, fmt.Errorf("claiming outbox message: %w", err)
+		}
+		if message == nil {
+			return count, nil
+		}
+		if message.Event != nil {
+			d.publish(ctx, message)
+		} else {
+			d.deliver(ctx, message)
+		}
+	}
+	return d.config.BatchSize, nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, message *models.OutboxMessage) {
+	log := d.log.With(
+		zap.String("messageId", message.Id),
+		zap.String("template", message.TemplateName.String()),
+		zap.Int("attempt", message.Attempts+1),
+	)
+
+	recipients, err := d.withoutSuppressed(ctx, message, log)
+	if err != nil {
+		// The message is claimed again once its lock expires.
+		log.With(zap.Error(err)).Error("finding suppressed recipients")
+		return
+	}
+	if len(recipients) == 0 {
+		message.MarkSuppressed(d.now())
+		if err := d.store.UpdateMessage(ctx, message); err != nil {
+			log.With(zap.Error(err)).Error("updating outbox message")
+		}
+		log.Info("outbox message suppressed")
+		return
+	}
+	message.Recipients = recipients
+
+	result := d.notifier.Send(ctx, message.Recipients, message.Subject, message.Body, message.TextBody)
+	if result.Err == nil {
+		message.MarkSent(d.now())
+		d.metrics.ObserveNotifierSend(message.TemplateName.String(), metrics.OutcomeSuccess)
+		log.With(zap.String("providerMessageId", result.ProviderMessageId)).Info("outbox message sent")
+	} else {
+		reason := result.Err.Error()
+		message.MarkFailed(d.now(), reason, d.retryAt(message.Attempts+1))
+		d.metrics.ObserveNotifierSend(message.TemplateName.String(), metrics.OutcomeError)
+		if message.Status == models.OutboxStatusDead {
+			log.With(zap.String("reason", reason)).Error("outbox message dead-lettered")
+		} else {
+			log.With(zap.String("reason", reason), zap.Time("nextAttemptAt", message.NextAttemptAt)).
+				Warn("outbox message delivery failed")
+		}
+	}
+
+	if err := d.store.UpdateMessage(ctx, message); err != nil {
+		log.With(zap.Error(err)).Error("updating outbox message")
+	}
+
+	if message.ConfirmationId != "" {
+		attempt := models.DeliveryAttempt{Time: d.now(), ProviderMessageId: result.ProviderMessageId}
+		if result.Err != nil {
+			attempt.Error = result.Err.Error()
+		}
+		if err := d.store.RecordDeliveryAttempt(ctx, message.ConfirmationId, attempt); err != nil {
+			log.With(zap.Error(err)).Error("recording confirmation delivery attempt")
+		}
+	}
+}
+
+// publish sends the event of the message through the producer.
+func (d *Dispatcher) publish(ctx context.Context, message *models.OutboxMessage) {
+	log := d.log.With(
+		zap.String("messageId", message.Id),
+		zap.String("eventType", message.Event.Type),
+		zap.Int("attempt", message.Attempts+1),
+	)
+
+	sendCtx, cancel := context.WithTimeout(ctx, d.config.EventTimeout)
+	err := d.producer.Send(sendCtx, outboxEvent{message.Event})
+	cancel()
+	if err == nil {
+		message.MarkSent(d.now())
+		log.Debug("outbox event published")
+	} else {
+		reason := err.Error()
+		message.MarkFailed(d.now(), reason, d.retryAt(message.Attempts+1))
+		if message.Status == models.OutboxStatusDead {
+			log.With(zap.String("reason", reason)).Error("outbox event dead-lettered")
+		} else {
+			log.With(zap.String("reason", reason), zap.Time("nextAttemptAt", message.NextAttemptAt)).
+				Warn("outbox event publishing failed")
+		}
+	}
+
+	if err := d.store.UpdateMessage(ctx, message); err != nil {
+		log.With(zap.Error(err)).Error("updating outbox message")
+	}
+}
+
+// outboxEvent is the event of an outbox message. Its JSON is the stored
+// payload.
+type outboxEvent struct {
+	*models.OutboxEvent
+}
+
+func (e outboxEvent) GetEventType() string {
+	return e.Type
+}
+
+func (e outboxEvent) GetEventKey() string {
+	return e.Key
+}
+
+func (e outboxEvent) MarshalJSON() ([]byte, error) {
+	return []byte(e.Payload), nil
+}
+
+// withoutSuppressed returns the recipients of the message that aren't
+// suppressed. If the address of the message's confirmation is suppressed, the
+// pending confirmation is marked undeliverable.
+func (d *Dispatcher) withoutSuppressed(ctx context.Context, message *models.OutboxMessage, log *zap.SugaredLogger) ([]string, error) {
+	suppressions, err := d.store.FindSuppressions(ctx, message.Recipients...)
+	if err != nil || len(suppressions) == 0 {
+		return message.Recipients, err
+	}
+
+	suppressed := func(address string) bool {
+		return slices.ContainsFunc(suppressions, func(s *models.Suppression) bool {
+			return s.Email == models.SuppressionEmail(address)
+		})
+	}
+	for _, suppression := range suppressions {
+		log.With(zap.String("email", suppression.Email), zap.String("reason", string(suppression.Reason))).
+			Info("skipping suppressed recipient")
+	}
+
+	if message.ConfirmationId != "" {
+		confirmation, err := d.store.FindConfirmation(ctx, &models.Confirmation{Id: message.ConfirmationId})
+		if err != nil {
+			return nil, err
+		}
+		if confirmation != nil && confirmation.Status == models.StatusPending &&
+			confirmation.Email != "" && suppressed(confirmation.Email) {
+			confirmation.UpdateStatusBy(models.StatusUndeliverable, models.StatusChange{Actor: models.ActorServer})
+			// A confirmation accepted or expired since is left as it is.
+			err := d.store.UpsertConfirmation(ctx, confirmation)
+			if err == nil {
+				log.With(zap.String("confirmationId", confirmation.Id)).Info("confirmation undeliverable")
+			} else if !errors.Is(err, clients.ErrStatusChanged) {
+				return nil, err
+			}
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(message.Recipients), suppressed), nil
+}
+
+// retryAt calculates when the next attempt should happen after the given
+// number of attempts, or nil if no more attempts should be made.
+func (d *Dispatcher) retryAt(attempts int) *time.Time {
+	if attempts >= d.config.MaxAttempts {
+		return nil
+	}
+	backoff := d.config.InitialBackoff
+	for i := 1; i < attempts && backoff < d.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > d.config.MaxBackoff {
+		backoff = d.config.MaxBackoff
+	}
+	retryAt := d.now().Add(backoff)
+	return &retryAt
+}
+
+func configProvider() (Config, error) {
+	var config Config
+	if err := envconfig.Process("hydrophone_outbox", &config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+func startDispatcher(lifecycle fx.Lifecycle, dispatcher *Dispatcher) {
+	lifecycle.Append(worker.Hook(dispatcher))
+}
+
+// Module delivers outbox messages in the background. The EventProducer the
+// events are published with is provided by the publisher module.
+var Module = fx.Options(
+	fx.Provide(configProvider, NewDispatcher),
+	fx.Invoke(startDispatcher),
+)
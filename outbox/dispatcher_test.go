@@ -0,0 +1,336 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tidepool-org/go-common/events"
+
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/metrics"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+func TestDispatchPending(s *testing.T) {
+	s.Run("marks delivered messages as sent", func(t *testing.T) {
+		store, notifier, dispatcher := newDispatcherTest(t, nil)
+		store.enqueue(t, "one@example.org")
+		store.enqueue(t, "two@example.org")
+
+		count, err := dispatcher.DispatchPending(context.Background())
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if count != 2 {
+			t.Fatalf("expected 2 messages to be dispatched, got %d", count)
+		}
+		if len(notifier.sent) != 2 {
+			t.Fatalf("expected 2 messages to be sent, got %d", len(notifier.sent))
+		}
+		for _, message := range store.messages {
+			if message.Status != models.OutboxStatusSent {
+				t.Errorf("expected status %q, got %q", models.OutboxStatusSent, message.Status)
+			}
+			if message.Attempts != 1 {
+				t.Errorf("expected 1 attempt, got %d", message.Attempts)
+			}
+		}
+	})
+
+	s.Run("records delivery attempts on the confirmation", func(t *testing.T) {
+		store, notifier, dispatcher := newDispatcherTest(t, errors.New("unavailable"))
+		message := store.enqueue(t, "invitee@example.org")
+		message.ConfirmationId = "invite-key"
+		store.enqueue(t, "no-confirmation@example.org")
+
+		if _, err := dispatcher.DispatchPending(context.Background()); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		notifier.err = nil
+		store.advance(dispatcher, dispatcher.config.MaxBackoff)
+		if _, err := dispatcher.DispatchPending(context.Background()); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+
+		attempts := store.attempts["invite-key"]
+		if len(store.attempts) != 1 || len(attempts) != 2 {
+			t.Fatalf("expected 2 attempts for the confirmation, got %v", store.attempts)
+		}
+		if attempts[0].Status() != models.DeliveryStatusFailed || attempts[0].Error != "unavailable" {
+			t.Errorf("non-expected failed attempt %+v", attempts[0])
+		}
+		if attempts[1].Status() != models.DeliveryStatusSent || attempts[1].ProviderMessageId != "fake" {
+			t.Errorf("non-expected sent attempt %+v", attempts[1])
+		}
+	})
+
+	s.Run("doesn't send to suppressed recipients", func(t *testing.T) {
+		store, notifier, dispatcher := newDispatcherTest(t, nil)
+		store.suppressed = []string{"suppressed@example.org"}
+		message := store.enqueue(t, "Suppressed@example.org")
+		message.Recipients = append(message.Recipients, "other@example.org")
+
+		if _, err := dispatcher.DispatchPending(context.Background()); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if len(notifier.sent) != 1 || len(notifier.sent[0]) != 1 || notifier.sent[0][0] != "other@example.org" {
+			t.Fatalf("expected only the other recipient to be sent the message, got %v", notifier.sent)
+		}
+	})
+
+	s.Run("marks confirmations to suppressed addresses undeliverable", func(t *testing.T) {
+		store, notifier, dispatcher := newDispatcherTest(t, nil)
+		store.suppressed = []string{"invitee@example.org"}
+		confirmation := &models.Confirmation{Id: "invite-id", Email: "invitee@example.org", Status: models.StatusPending}
+		store.confirmations = []*models.Confirmation{confirmation}
+		message := store.enqueue(t, "invitee@example.org")
+		message.ConfirmationId = confirmation.Id
+
+		if _, err := dispatcher.DispatchPending(context.Background()); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if len(notifier.sent) != 0 || len(store.attempts) != 0 {
+			t.Fatalf("expected the message not to be sent, got %v", notifier.sent)
+		}
+		if message.Status != models.OutboxStatusSuppressed || message.Body != "" || message.TextBody != "" {
+			t.Errorf("expected the message to be suppressed without its bodies, got %+v", message)
+		}
+		if confirmation.Status != models.StatusUndeliverable || len(confirmation.History) != 1 ||
+			confirmation.History[0].From != models.StatusPending || confirmation.History[0].Actor != models.ActorServer {
+			t.Errorf("expected the confirmation to be marked undeliverable, got %+v", confirmation)
+		}
+	})
+
+	s.Run("counts send outcomes per template", func(t *testing.T) {
+		store, notifier, dispatcher := newDispatcherTest(t, errors.New("unavailable"))
+		registry := prometheus.NewRegistry()
+		dispatcher.metrics = metrics.New(registry)
+		store.enqueue(t, "one@example.org")
+
+		if _, err := dispatcher.DispatchPending(context.Background()); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		notifier.err = nil
+		store.advance(dispatcher, dispatcher.config.MaxBackoff)
+		if _, err := dispatcher.DispatchPending(context.Background()); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+
+		expected := `
+# HELP hydrophone_notifier_sends_total Number of attempts to send an email, by template and outcome.
+# TYPE hydrophone_notifier_sends_total counter
+hydrophone_notifier_sends_total{outcome="error",template="password_reset"} 1
+hydrophone_notifier_sends_total{outcome="success",template="password_reset"} 1
+`
+		if err := promtestutil.GatherAndCompare(registry, strings.NewReader(expected), "hydrophone_notifier_sends_total"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	s.Run("retries failed messages with an exponential backoff", func(t *testing.T) {
+		store, _, dispatcher := newDispatcherTest(t, errors.New("unavailable"))
+		message := store.enqueue(t, "retry@example.org")
+
+		expectedBackoffs := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute}
+		for i, expected := range expectedBackoffs {
+			if _, err := dispatcher.DispatchPending(context.Background()); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			if message.Status != models.OutboxStatusPending {
+				t.Fatalf("attempt %d: expected status %q, got %q", i+1, models.OutboxStatusPending, message.Status)
+			}
+			if backoff := message.NextAttemptAt.Sub(dispatcher.now()); backoff != expected {
+				t.Fatalf("attempt %d: expected backoff of %s, got %s", i+1, expected, backoff)
+			}
+			if message.LastError == "" {
+				t.Fatalf("attempt %d: expected the last error to be recorded", i+1)
+			}
+			store.advance(dispatcher, expected)
+		}
+	})
+
+	s.Run("dead-letters messages after the maximum attempts", func(t *testing.T) {
+		store, notifier, dispatcher := newDispatcherTest(t, errors.New("rejected"))
+		message := store.enqueue(t, "dead@example.org")
+
+		for i := 0; i < dispatcher.config.MaxAttempts; i++ {
+			if _, err := dispatcher.DispatchPending(context.Background()); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			store.advance(dispatcher, dispatcher.config.MaxBackoff)
+		}
+		if message.Status != models.OutboxStatusDead {
+			t.Fatalf("expected status %q, got %q", models.OutboxStatusDead, message.Status)
+		}
+		if message.Body != "" || message.TextBody != "" {
+			t.Errorf("expected the bodies of the dead-lettered message to be dropped, got %+v", message)
+		}
+
+		if _, err := dispatcher.DispatchPending(context.Background()); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if len(notifier.sent) != dispatcher.config.MaxAttempts {
+			t.Fatalf("expected %d attempts, got %d", dispatcher.config.MaxAttempts, len(notifier.sent))
+		}
+	})
+}
+
+func TestDispatchPendingEvents(t *testing.T) {
+	store, notifier, dispatcher := newDispatcherTest(t, nil)
+	producer := dispatcher.producer.(*fakeProducer)
+	producer.err = errors.New("unavailable")
+	message, err := models.NewOutboxEvent("confirmation:created", "creator", []byte(`{"type":"careteam_invitation"}`))
+	if err != nil {
+		t.Fatalf("error creating outbox event: %s", err)
+	}
+	message.NextAttemptAt = time.Time{}
+	store.messages = append(store.messages, message)
+
+	if _, err := dispatcher.DispatchPending(context.Background()); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if message.Status != models.OutboxStatusPending || message.LastError != "unavailable" {
+		t.Fatalf("expected the event to be retried, got %+v", message)
+	}
+
+	producer.err = nil
+	store.advance(dispatcher, dispatcher.config.MaxBackoff)
+	if _, err := dispatcher.DispatchPending(context.Background()); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if message.Status != models.OutboxStatusSent || len(producer.sent) != 2 {
+		t.Fatalf("expected the event to be published on the second attempt, got %+v", message)
+	}
+	event := producer.sent[1]
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("error encoding event: %s", err)
+	}
+	if event.GetEventType() != "confirmation:created" || event.GetEventKey() != "creator" ||
+		string(payload) != `{"type":"careteam_invitation"}` {
+		t.Errorf("unexpected event %s %s: %s", event.GetEventType(), event.GetEventKey(), payload)
+	}
+	if len(notifier.sent) != 0 || len(store.attempts) != 0 {
+		t.Errorf("expected the event not to be emailed")
+	}
+}
+
+func newDispatcherTest(t *testing.T, sendErr error) (*fakeOutboxStore, *fakeNotifier, *Dispatcher) {
+	config := Config{
+		BatchSize:      10,
+		MaxAttempts:    5,
+		InitialBackoff: time.Minute,
+		MaxBackoff:     5 * time.Minute,
+		LockDuration:   time.Minute,
+		EventTimeout:   time.Second,
+	}
+	store := &fakeOutboxStore{}
+	notifier := &fakeNotifier{err: sendErr}
+	dispatcher := NewDispatcher(config, store, notifier, &fakeProducer{}, metrics.New(prometheus.NewRegistry()), testutil.NewLogger(t))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dispatcher.now = func() time.Time { return now }
+	return store, notifier, dispatcher
+}
+
+// fakeOutboxStore implements just enough of clients.StoreClient to exercise
+// the Dispatcher.
+type fakeOutboxStore struct {
+	clients.StoreClient
+	messages      []*models.OutboxMessage
+	attempts      map[string][]models.DeliveryAttempt
+	confirmations []*models.Confirmation
+	suppressed    []string
+}
+
+func (s *fakeOutboxStore) enqueue(t *testing.T, recipient string) *models.OutboxMessage {
+	message, err := models.NewOutboxMessage(models.TemplateNamePasswordReset, []string{recipient}, "subject", "body", "text")
+	if err != nil {
+		t.Fatalf("error creating outbox message: %s", err)
+	}
+	message.NextAttemptAt = time.Time{}
+	s.messages = append(s.messages, message)
+	return message
+}
+
+// advance moves the dispatcher's clock forward.
+func (s *fakeOutboxStore) advance(dispatcher *Dispatcher, d time.Duration) {
+	now := dispatcher.now().Add(d)
+	dispatcher.now = func() time.Time { return now }
+}
+
+func (s *fakeOutboxStore) ClaimMessage(ctx context.Context, now, lockedUntil time.Time) (*models.OutboxMessage, error) {
+	for _, message := range s.messages {
+		if message.Status == models.OutboxStatusPending && !message.NextAttemptAt.After(now) {
+			message.Status = models.OutboxStatusSending
+			message.LockedUntil = &lockedUntil
+			return message, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakeOutboxStore) UpdateMessage(ctx context.Context, message *models.OutboxMessage) error {
+	return nil
+}
+
+func (s *fakeOutboxStore) RecordDeliveryAttempt(ctx context.Context, confirmationId string, attempt models.DeliveryAttempt) error {
+	if s.attempts == nil {
+		s.attempts = map[string][]models.DeliveryAttempt{}
+	}
+	s.attempts[confirmationId] = append(s.attempts[confirmationId], attempt)
+	return nil
+}
+
+func (s *fakeOutboxStore) FindSuppressions(ctx context.Context, emails ...string) ([]*models.Suppression, error) {
+	var found []*models.Suppression
+	for _, email := range emails {
+		if slices.Contains(s.suppressed, models.SuppressionEmail(email)) {
+			found = append(found, &models.Suppression{Email: models.SuppressionEmail(email)})
+		}
+	}
+	return found, nil
+}
+
+func (s *fakeOutboxStore) FindConfirmation(ctx context.Context, query *models.Confirmation) (*models.Confirmation, error) {
+	for _, confirmation := range s.confirmations {
+		if confirmation.Id == query.Id {
+			return confirmation, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakeOutboxStore) UpsertConfirmation(ctx context.Context, confirmation *models.Confirmation) error {
+	return nil
+}
+
+type fakeNotifier struct {
+	err  error
+	sent [][]string
+}
+
+func (n *fakeNotifier) Send(ctx context.Context, to []string, subject string, html string, text string) clients.SendResult {
+	n.sent = append(n.sent, to)
+	if n.err != nil {
+		return clients.SendResult{Err: n.err}
+	}
+	return clients.SendResult{ProviderMessageId: "fake"}
+}
+
+type fakeProducer struct {
+	err  error
+	sent []events.Event
+}
+
+func (p *fakeProducer) Send(ctx context.Context, event events.Event) error {
+	p.sent = append(p.sent, event)
+	return p.err
+}
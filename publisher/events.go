@@ -0,0 +1,72 @@
+package publisher
+
+import (
+	"github.com/tidepool-org/go-common/events"
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+// Confirmation event types
+const (
+	ConfirmationCreatedEventType  = "confirmation:created"
+	ConfirmationAcceptedEventType = "confirmation:accepted"
+	ConfirmationDeclinedEventType = "confirmation:declined"
+	ConfirmationCanceledEventType = "confirmation:canceled"
+	ConfirmationExpiredEventType  = "confirmation:expired"
+
+	ConfirmationUndeliverableEventType = "confirmation:undeliverable"
+)
+
+// eventTypes are the event types published when a confirmation moves to each
+// status.
+var eventTypes = map[models.Status]string{
+	models.StatusPending:   ConfirmationCreatedEventType,
+	models.StatusCompleted: ConfirmationAcceptedEventType,
+	models.StatusDeclined:  ConfirmationDeclinedEventType,
+	models.StatusCanceled:  ConfirmationCanceledEventType,
+	models.StatusExpired:   ConfirmationExpiredEventType,
+
+	models.StatusUndeliverable: ConfirmationUndeliverableEventType,
+}
+
+// ConfirmationEvent is published when a confirmation is created or its status
+// changes. It's identified by the confirmation's id, and doesn't include its
+// key or email address, since the key is the secret needed to accept it.
+type ConfirmationEvent struct {
+	EventType string        `json:"-"`
+	Id        string        `json:"id"`
+	Type      models.Type   `json:"type"`
+	Status    models.Status `json:"status"`
+	ClinicId  string        `json:"clinicId,omitempty"`
+	CreatorId string        `json:"creatorId,omitempty"`
+	UserId    string        `json:"userId,omitempty"`
+}
+
+var _ events.Event = ConfirmationEvent{}
+
+// NewConfirmationEvent returns the event for the confirmation's current
+// status, and false if no event is published for it.
+func NewConfirmationEvent(confirmation *models.Confirmation) (ConfirmationEvent, bool) {
+	eventType, ok := eventTypes[confirmation.Status]
+	if !ok {
+		return ConfirmationEvent{}, false
+	}
+	return ConfirmationEvent{
+		EventType: eventType,
+		Id:        confirmation.Id,
+		Type:      confirmation.Type,
+		Status:    confirmation.Status,
+		ClinicId:  confirmation.ClinicId,
+		CreatorId: confirmation.CreatorId,
+		UserId:    confirmation.UserId,
+	}, true
+}
+
+func (e ConfirmationEvent) GetEventType() string {
+	return e.EventType
+}
+
+// GetEventKey partitions events by creator, so that the events of each
+// creator's confirmations are consumed in order.
+func (e ConfirmationEvent) GetEventKey() string {
+	return e.CreatorId
+}
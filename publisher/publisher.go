@@ -0,0 +1,39 @@
+package publisher
+
+import (
+	"github.com/kelseyhightower/envconfig"
+	"go.uber.org/fx"
+
+	"github.com/tidepool-org/go-common/events"
+)
+
+// Config controls where confirmation events are published.
+type Config struct {
+	// Topic is the Kafka topic, before the prefix shared with the consumer.
+	Topic string `default:"confirmations"`
+}
+
+func configProvider() (Config, error) {
+	var config Config
+	if err := envconfig.Process("hydrophone_confirmation_events", &config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// senderProvider sends events to the configured topic, using the brokers and
+// credentials the consumer is configured with.
+func senderProvider(config Config, cloudEventsConfig *events.CloudEventsConfig) (events.EventProducer, error) {
+	topicConfig := *cloudEventsConfig
+	topicConfig.KafkaTopic = config.Topic
+	return events.NewKafkaCloudEventsProducer(&topicConfig)
+}
+
+// Module queues an event in the outbox whenever a confirmation is created or
+// its status changes, by decorating the store. The outbox dispatcher
+// publishes them with the EventProducer it provides, so that requests don't
+// wait for Kafka and the events outlast an outage.
+var Module = fx.Options(
+	fx.Provide(configProvider, senderProvider),
+	fx.Decorate(NewStore),
+)
@@ -0,0 +1,79 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+// Store queues an event in the outbox whenever a confirmation it saves is new
+// or has a new status.
+//
+// Every status change goes through UpsertConfirmation or ExpireConfirmations,
+// so wrapping the store catches them all, wherever they're made.
+type Store struct {
+	clients.StoreClient
+	log *zap.SugaredLogger
+}
+
+func NewStore(store clients.StoreClient, log *zap.SugaredLogger) clients.StoreClient {
+	return &Store{
+		StoreClient: store,
+		log:         log,
+	}
+}
+
+// UpsertConfirmation saves the confirmation, then queues the event for its
+// status if it's new or its status changed since it was found.
+func (s *Store) UpsertConfirmation(ctx context.Context, confirmation *models.Confirmation) error {
+	// Saving it forgets what changed.
+	previous, changed := confirmation.PreviousStatus()
+	publish := confirmation.IsNew() || changed && previous != confirmation.Status
+	if err := s.StoreClient.UpsertConfirmation(ctx, confirmation); err != nil {
+		return err
+	}
+	if publish {
+		s.publish(ctx, confirmation)
+	}
+	return nil
+}
+
+// ExpireConfirmations expires the confirmations, then queues an expired event
+// for each.
+func (s *Store) ExpireConfirmations(ctx context.Context, confirmationType models.Type, now time.Time, limit int) ([]*models.Confirmation, error) {
+	expired, err := s.StoreClient.ExpireConfirmations(ctx, confirmationType, now, limit)
+	for _, confirmation := range expired {
+		s.publish(ctx, confirmation)
+	}
+	return expired, err
+}
+
+// publish queues the event for the confirmation's current status.
+//
+// Failures are logged rather than returned, since the confirmation has already
+// been saved by then.
+func (s *Store) publish(ctx context.Context, confirmation *models.Confirmation) {
+	event, ok := NewConfirmationEvent(confirmation)
+	if !ok {
+		return
+	}
+	log := s.log.With(zap.String("eventType", event.EventType), zap.String("type", string(event.Type)))
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.With(zap.Error(err)).Error("encoding confirmation event")
+		return
+	}
+	message, err := models.NewOutboxEvent(event.EventType, event.GetEventKey(), payload)
+	if err == nil {
+		err = s.StoreClient.EnqueueMessage(ctx, message)
+	}
+	if err != nil {
+		log.With(zap.Error(err)).Error("queueing confirmation event")
+	}
+}
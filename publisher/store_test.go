@@ -0,0 +1,139 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+// memoryStore keeps confirmations in memory, by id, and the outbox messages
+// queued. Like the Mongo store, it doesn't keep the confirmations' keys.
+type memoryStore struct {
+	clients.StoreClient
+	confirmations map[string]models.Confirmation
+	messages      []*models.OutboxMessage
+}
+
+func (s *memoryStore) FindConfirmation(ctx context.Context, confirmation *models.Confirmation) (*models.Confirmation, error) {
+	if found, ok := s.confirmations[confirmation.Id]; ok {
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (s *memoryStore) UpsertConfirmation(ctx context.Context, confirmation *models.Confirmation) error {
+	confirmation.MarkSaved()
+	stored := *confirmation
+	stored.Key = ""
+	s.confirmations[confirmation.Id] = stored
+	return nil
+}
+
+func (s *memoryStore) ExpireConfirmations(ctx context.Context, confirmationType models.Type, now time.Time, limit int) ([]*models.Confirmation, error) {
+	var expired []*models.Confirmation
+	for key, confirmation := range s.confirmations {
+		if confirmation.Type == confirmationType && confirmation.Status == models.StatusPending {
+			confirmation.UpdateStatus(models.StatusExpired)
+			s.confirmations[key] = confirmation
+			expired = append(expired, &confirmation)
+		}
+	}
+	return expired, nil
+}
+
+func (s *memoryStore) EnqueueMessage(ctx context.Context, message *models.OutboxMessage) error {
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+func newStoreTest(t *testing.T) (clients.StoreClient, *memoryStore) {
+	t.Helper()
+	store := &memoryStore{
+		StoreClient:   clients.NewMockStoreClient(false, false),
+		confirmations: map[string]models.Confirmation{},
+	}
+	return NewStore(store, testutil.NewLogger(t)), store
+}
+
+func queuedEventTypes(messages []*models.OutboxMessage) []string {
+	var types []string
+	for _, message := range messages {
+		types = append(types, message.Event.Type)
+	}
+	return types
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store, memory := newStoreTest(t)
+
+	invite, err := models.NewConfirmation(models.TypeCareteamInvite, models.TemplateNameCareteamInvite, "creator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invite.ClinicId = "clinic"
+	if err := store.UpsertConfirmation(ctx, invite); err != nil {
+		t.Fatal(err)
+	}
+	// Saving it again without a status change publishes nothing, even once
+	// it's been found without its key.
+	invite, err = store.FindConfirmation(ctx, &models.Confirmation{Id: invite.Id})
+	if err != nil || invite == nil || invite.Key != "" {
+		t.Fatalf("expected the invite to be found without its key, got %+v: %v", invite, err)
+	}
+	invite.UserId = "user"
+	if err := store.UpsertConfirmation(ctx, invite); err != nil {
+		t.Fatal(err)
+	}
+	invite.UpdateStatus(models.StatusCompleted)
+	if err := store.UpsertConfirmation(ctx, invite); err != nil {
+		t.Fatal(err)
+	}
+
+	signup, err := models.NewConfirmation(models.TypeSignUp, models.TemplateNameSignup, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpsertConfirmation(ctx, signup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ExpireConfirmations(ctx, models.TypeSignUp, time.Now(), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{ConfirmationCreatedEventType, ConfirmationAcceptedEventType, ConfirmationCreatedEventType, ConfirmationExpiredEventType}
+	if actual := queuedEventTypes(memory.messages); !slices.Equal(actual, expected) {
+		t.Fatalf("expected events %v, got %v", expected, actual)
+	}
+
+	event := memory.messages[1].Event
+	if event.Key != "creator" {
+		t.Errorf("expected the event to be keyed by its creator, got %q", event.Key)
+	}
+	var accepted map[string]string
+	if err := json.Unmarshal([]byte(event.Payload), &accepted); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"id":        invite.Id,
+		"type":      string(models.TypeCareteamInvite),
+		"status":    string(models.StatusCompleted),
+		"clinicId":  "clinic",
+		"creatorId": "creator",
+		"userId":    "user",
+	}
+	if len(accepted) != len(want) {
+		t.Errorf("expected payload %v, got %v", want, accepted)
+	}
+	for key, value := range want {
+		if accepted[key] != value {
+			t.Errorf("expected %s %q, got %q", key, value, accepted[key])
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+// Config sets how many emails may be requested for each recipient and from
+// each source IP in a window, and in a shorter burst window. A zero limit or
+// window disables that limit.
+type Config struct {
+	Window      time.Duration `default:"1h"`
+	EmailLimit  int           `split_words:"true" default:"5"`
+	IPLimit     int           `split_words:"true" default:"50"`
+	BurstWindow time.Duration `split_words:"true" default:"1m"`
+	EmailBurst  int           `split_words:"true" default:"2"`
+	IPBurst     int           `split_words:"true" default:"10"`
+}
+
+// Counter counts requests in fixed windows. It's shared by every replica, so
+// that the limits hold across them.
+type Counter interface {
+	// IncrementRateLimit increments the counter with the given key, creating
+	// it if needed, and returns its new count. The counter may be removed
+	// after expiresAt.
+	IncrementRateLimit(ctx context.Context, key string, expiresAt time.Time) (int, error)
+}
+
+// Limiter limits the emails unauthenticated requests can send.
+type Limiter struct {
+	config  Config
+	counter Counter
+	now     func() time.Time
+}
+
+func New(config Config, counter Counter) *Limiter {
+	return &Limiter{
+		config:  config,
+		counter: counter,
+		now:     time.Now,
+	}
+}
+
+type limit struct {
+	scope  string
+	value  string
+	window time.Duration
+	max    int
+}
+
+// Allow counts a request to email the recipient from the source IP, and
+// reports whether it's within every limit for the confirmation type.
+//
+// If a counter can't be incremented, the request is allowed along with the
+// error, so that an outage of the counter store doesn't lock everyone out.
+func (l *Limiter) Allow(ctx context.Context, confirmationType models.Type, email, ip string) (bool, error) {
+	limits := []limit{
+		{scope: "email", value: strings.ToLower(email), window: l.config.Window, max: l.config.EmailLimit},
+		{scope: "ip", value: ip, window: l.config.Window, max: l.config.IPLimit},
+		{scope: "email", value: strings.ToLower(email), window: l.config.BurstWindow, max: l.config.EmailBurst},
+		{scope: "ip", value: ip, window: l.config.BurstWindow, max: l.config.IPBurst},
+	}
+
+	now := l.now()
+	allowed := true
+	for _, limit := range limits {
+		if limit.value == "" || limit.window <= 0 || limit.max <= 0 {
+			continue
+		}
+		start := now.Truncate(limit.window)
+		count, err := l.counter.IncrementRateLimit(ctx, limit.key(confirmationType, start), start.Add(limit.window))
+		if err != nil {
+			return true, err
+		}
+		if count > limit.max {
+			allowed = false
+		}
+	}
+	return allowed, nil
+}
+
+// key identifies the counter of the limit for the window starting at start.
+// Values are hashed so that the counters don't store email addresses.
+func (l limit) key(confirmationType models.Type, start time.Time) string {
+	hash := sha256.Sum256([]byte(l.value))
+	return fmt.Sprintf("%s:%s:%s:%d:%s", confirmationType, l.scope, l.window, start.Unix(), hex.EncodeToString(hash[:]))
+}
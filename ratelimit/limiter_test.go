@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+type memoryCounter struct {
+	counts map[string]int
+	err    error
+}
+
+func (m *memoryCounter) IncrementRateLimit(ctx context.Context, key string, expiresAt time.Time) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	m.counts[key]++
+	return m.counts[key], nil
+}
+
+func newTestLimiter(config Config) (*Limiter, *memoryCounter, *time.Time) {
+	counter := &memoryCounter{counts: map[string]int{}}
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	limiter := New(config, counter)
+	limiter.now = func() time.Time { return now }
+	return limiter, counter, &now
+}
+
+func allow(t *testing.T, limiter *Limiter, email, ip string) bool {
+	t.Helper()
+	allowed, err := limiter.Allow(context.Background(), models.TypePasswordReset, email, ip)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	return allowed
+}
+
+func TestLimiterEmail(t *testing.T) {
+	limiter, _, now := newTestLimiter(Config{Window: time.Hour, EmailLimit: 3, BurstWindow: time.Minute, EmailBurst: 2})
+
+	// The burst limit applies within a minute...
+	if !allow(t, limiter, "me@example.org", "1.2.3.4") || !allow(t, limiter, "ME@example.org", "5.6.7.8") {
+		t.Fatal("expected the first requests to be allowed")
+	}
+	if allow(t, limiter, "me@example.org", "1.2.3.4") {
+		t.Fatal("expected the burst limit to be exceeded")
+	}
+	if !allow(t, limiter, "other@example.org", "1.2.3.4") {
+		t.Fatal("expected other recipients to be allowed")
+	}
+
+	// ...and the window limit within an hour.
+	*now = now.Add(2 * time.Minute)
+	if allow(t, limiter, "me@example.org", "1.2.3.4") {
+		t.Fatal("expected the window limit to be exceeded")
+	}
+	*now = now.Add(time.Hour)
+	if !allow(t, limiter, "me@example.org", "1.2.3.4") {
+		t.Fatal("expected requests in the next window to be allowed")
+	}
+}
+
+func TestLimiterIP(t *testing.T) {
+	limiter, _, _ := newTestLimiter(Config{Window: time.Hour, IPLimit: 2})
+
+	if !allow(t, limiter, "a@example.org", "1.2.3.4") || !allow(t, limiter, "b@example.org", "1.2.3.4") {
+		t.Fatal("expected the first requests to be allowed")
+	}
+	if allow(t, limiter, "c@example.org", "1.2.3.4") {
+		t.Fatal("expected the IP limit to be exceeded")
+	}
+	if !allow(t, limiter, "c@example.org", "5.6.7.8") {
+		t.Fatal("expected other IPs to be allowed")
+	}
+}
+
+func TestLimiterTypes(t *testing.T) {
+	limiter, _, _ := newTestLimiter(Config{Window: time.Hour, EmailLimit: 1})
+
+	if !allow(t, limiter, "me@example.org", "") {
+		t.Fatal("expected the first request to be allowed")
+	}
+	if allowed, _ := limiter.Allow(context.Background(), models.TypeSignUp, "me@example.org", ""); !allowed {
+		t.Fatal("expected each confirmation type to be limited separately")
+	}
+}
+
+func TestLimiterCounterError(t *testing.T) {
+	limiter, counter, _ := newTestLimiter(Config{Window: time.Hour, EmailLimit: 1})
+	counter.err = errors.New("unavailable")
+
+	if allowed, err := limiter.Allow(context.Background(), models.TypePasswordReset, "me@example.org", ""); !allowed || err == nil {
+		t.Fatalf("expected the request to be allowed with an error, got %t and %v", allowed, err)
+	}
+}
+
+func TestLimiterKeys(t *testing.T) {
+	limiter, counter, _ := newTestLimiter(Config{Window: time.Hour, EmailLimit: 1})
+	allow(t, limiter, "me@example.org", "")
+	for key := range counter.counts {
+		if len(key) == 0 || strings.Contains(key, "me@example.org") {
+			t.Errorf("expected the email to be hashed in %q", key)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package reminder
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+// remindableTypes are the confirmation types that may be reminded. The emails
+// of the others link to the confirmation's key, which can't be emailed again
+// since only its hash is stored.
+var remindableTypes = []models.Type{
+	models.TypeCareteamInvite,
+	models.TypeClinicianInvite,
+}
+
+// Schedules are the times after a confirmation of each type was created at
+// which it's reminded, in order.
+//
+// They're configured as a comma separated list of a type, an equals sign and
+// the times separated by semicolons, like
+// "careteam_invitation=3d;6d,clinician_invitation=72h". A time is a number of
+// days, or a duration like "36h".
+type Schedules map[models.Type][]time.Duration
+
+// Decode implements envconfig.Decoder.
+func (s *Schedules) Decode(value string) error {
+	schedules := Schedules{}
+	for _, schedule := range strings.Split(value, ",") {
+		schedule = strings.TrimSpace(schedule)
+		if schedule == "" {
+			continue
+		}
+		name, times, ok := strings.Cut(schedule, "=")
+		if !ok {
+			return fmt.Errorf("reminder schedule %q has no times", schedule)
+		}
+		confirmationType := models.Type(strings.TrimSpace(name))
+		if _, ok := schedules[confirmationType]; ok {
+			return fmt.Errorf("reminder schedule for %s is repeated", confirmationType)
+		}
+		var offsets []time.Duration
+		for _, offset := range strings.Split(times, ";") {
+			duration, err := parseOffset(strings.TrimSpace(offset))
+			if err != nil {
+				return fmt.Errorf("reminder schedule for %s: %w", confirmationType, err)
+			}
+			offsets = append(offsets, duration)
+		}
+		schedules[confirmationType] = offsets
+	}
+	*s = schedules
+	return nil
+}
+
+// parseOffset parses a number of days, like "3d", or a duration.
+func parseOffset(offset string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(offset, "d"); ok {
+		count, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days %q", offset)
+		}
+		return time.Duration(count) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(offset)
+}
+
+// Validate checks that the schedules are for types that may be reminded, and
+// that their reminders are in order and before the confirmations expire.
+func (s Schedules) Validate() error {
+	for confirmationType, offsets := range s {
+		if !slices.Contains(remindableTypes, confirmationType) {
+			return fmt.Errorf("%s confirmations can't be reminded", confirmationType)
+		}
+		if len(offsets) == 0 {
+			return fmt.Errorf("reminder schedule for %s is empty", confirmationType)
+		}
+		for i, offset := range offsets {
+			if offset <= 0 {
+				return fmt.Errorf("reminder schedule for %s: %s isn't positive", confirmationType, offset)
+			}
+			if i > 0 && offset <= offsets[i-1] {
+				return fmt.Errorf("reminder schedule for %s isn't in order", confirmationType)
+			}
+			if timeout, ok := models.Timeouts[confirmationType]; ok && offset >= timeout {
+				return fmt.Errorf("reminder schedule for %s: %s isn't before the confirmations expire after %s", confirmationType, offset, timeout)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package reminder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/models"
+)
+
+func TestSchedules(t *testing.T) {
+	var schedules Schedules
+	if err := schedules.Decode("careteam_invitation=3d;144h, clinician_invitation=30m"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	careteam, clinician := schedules[models.TypeCareteamInvite], schedules[models.TypeClinicianInvite]
+	if len(schedules) != 2 || len(careteam) != 2 || careteam[0] != 72*time.Hour || careteam[1] != 144*time.Hour ||
+		len(clinician) != 1 || clinician[0] != 30*time.Minute {
+		t.Fatalf("unexpected schedules: %v", schedules)
+	}
+	if err := schedules.Validate(); err != nil {
+		t.Errorf("expected the schedules to be valid, got: %s", err)
+	}
+}
+
+func TestInvalidSchedules(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "no times", value: "careteam_invitation"},
+		{name: "invalid time", value: "careteam_invitation=3 days"},
+		{name: "repeated type", value: "careteam_invitation=3d,careteam_invitation=6d"},
+		{name: "type with a key", value: "signup_confirmation=3d"},
+		{name: "unknown type", value: "unknown=3d"},
+		{name: "out of order", value: "careteam_invitation=6d;3d"},
+		{name: "not positive", value: "clinician_invitation=0d"},
+		{name: "after expiry", value: "careteam_invitation=3d;7d"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var schedules Schedules
+			err := schedules.Decode(test.value)
+			if err == nil {
+				err = schedules.Validate()
+			}
+			if err == nil {
+				t.Errorf("expected %q to be invalid", test.value)
+			}
+		})
+	}
+}
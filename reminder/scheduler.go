@@ -0,0 +1,264 @@
+package reminder
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	commonClients "github.com/tidepool-org/go-common/clients"
+	"github.com/tidepool-org/go-common/clients/highwater"
+	"github.com/tidepool-org/go-common/clients/shoreline"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/events"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/worker"
+)
+
+const remindedMetric = "confirmation reminders sent"
+
+// Config controls which confirmations are reminded, and how often the due
+// reminders are sent. Without schedules, no reminders are sent.
+type Config struct {
+	Interval  time.Duration `split_words:"true" default:"15m"`
+	BatchSize int           `split_words:"true" default:"500"`
+	// MaxAttempts is the most times a confirmation's reminders are tried
+	// before they're given up on.
+	MaxAttempts int `split_words:"true" default:"3"`
+	Schedules   Schedules
+}
+
+// Scheduler emails reminders for pending confirmations on the schedule of
+// their type, until they're accepted, dismissed, canceled or expired.
+//
+// Each reminder is recorded on its confirmation as it's claimed, so it's safe
+// for every replica to run a Scheduler at the same time. A reminder that
+// can't be queued is released, so that it's claimed again on the next run,
+// until the confirmation's reminders have failed MaxAttempts times. Then the
+// failure is recorded on the reminder, and it isn't tried again. A
+// confirmation that missed several reminders, e.g. while no Scheduler was
+// running, is only sent the latest.
+type Scheduler struct {
+	config      Config
+	emailConfig events.EmailConfig
+	store       clients.StoreClient
+	templates   models.TemplateProvider
+	seagull     commonClients.Seagull
+	metrics     highwater.Client
+	sl          shoreline.Client
+	log         *zap.SugaredLogger
+	now         func() time.Time
+	periodic    *worker.Periodic
+}
+
+func NewScheduler(
+	config Config,
+	emailConfig events.EmailConfig,
+	store clients.StoreClient,
+	templates models.TemplateProvider,
+	seagull commonClients.Seagull,
+	metrics highwater.Client,
+	sl shoreline.Client,
+	log *zap.SugaredLogger,
+) *Scheduler {
+	s := &Scheduler{
+		config:      config,
+		emailConfig: emailConfig,
+		store:       store,
+		templates:   templates,
+		seagull:     seagull,
+		metrics:     metrics,
+		sl:          sl,
+		log:         log,
+		now:         time.Now,
+	}
+	s.periodic = worker.NewPeriodic(config.Interval, s.remind)
+	return s
+}
+
+// Start sends the due reminders in the background until Stop is called.
+func (s *Scheduler) Start() {
+	if len(s.config.Schedules) == 0 {
+		return
+	}
+	s.periodic.Start()
+}
+
+// Stop waits for the current reminders to be sent, or for ctx to be done.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	return s.periodic.Stop(ctx)
+}
+
+func (s *Scheduler) remind(ctx context.Context) bool {
+	if _, err := s.Remind(ctx); err != nil && ctx.Err() == nil {
+		s.log.With(zap.Error(err)).Error("sending confirmation reminders")
+	}
+	return true
+}
+
+// Remind sends the reminders that are due, returning the number of
+// confirmations reminded per type.
+func (s *Scheduler) Remind(ctx context.Context) (map[models.Type]int, error) {
+	counts := make(map[models.Type]int)
+	now := s.now()
+	for _, confirmationType := range models.Types {
+		offsets, ok := s.config.Schedules[confirmationType]
+		if !ok {
+			continue
+		}
+		count, err := s.remindType(ctx, confirmationType, offsets, now)
+		if count > 0 {
+			counts[confirmationType] = count
+			s.log.With(zap.String("type", string(confirmationType)), zap.Int("count", count)).
+				Info("reminded confirmations")
+			s.metrics.PostServer(remindedMetric, s.sl.TokenProvide(), map[string]string{
+				"type":  string(confirmationType),
+				"count": strconv.Itoa(count),
+			})
+		}
+		if err != nil {
+			return counts, fmt.Errorf("reminding %s confirmations: %w", confirmationType, err)
+		}
+	}
+	return counts, nil
+}
+
+// remindType claims the reminders of the type from the latest step of the
+// schedule to the first, so that a confirmation that's due several reminders
+// is only sent the latest.
+func (s *Scheduler) remindType(ctx context.Context, confirmationType models.Type, offsets []time.Duration, now time.Time) (int, error) {
+	total := 0
+	for step := len(offsets) - 1; step >= 0; step-- {
+		count, err := s.remindStep(ctx, confirmationType, step, now.Add(-offsets[step]), now)
+		total += count
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// remindStep sends up to BatchSize reminders at the step of the schedule,
+// returning the number sent.
+//
+// The reminder is recorded once it's claimed. The reminders that can't be
+// queued are released once the batch is done, so that they're claimed again
+// on the next run rather than again in this one.
+func (s *Scheduler) remindStep(ctx context.Context, confirmationType models.Type, step int, createdBefore, now time.Time) (int, error) {
+	var failed []string
+	defer func() {
+		for _, confirmationId := range failed {
+			if err := s.store.ReleaseReminder(context.WithoutCancel(ctx), confirmationId, step); err != nil {
+				s.log.With(zap.Error(err), zap.String("confirmationId", confirmationId), zap.Int("step", step)).
+					Error("releasing confirmation reminder")
+			}
+		}
+	}()
+
+	count := 0
+	for claimed := 0; claimed < s.config.BatchSize && ctx.Err() == nil; claimed++ {
+		confirmation, err := s.store.ClaimReminder(ctx, confirmationType, step, createdBefore, now)
+		if err != nil {
+			return count, err
+		}
+		if confirmation == nil {
+			break
+		}
+		if err := s.send(ctx, confirmation); err != nil {
+			log := s.log.With(zap.Error(err), zap.String("confirmationId", confirmation.Id), zap.Int("step", step))
+			if confirmation.ReminderFailures+1 < s.config.MaxAttempts {
+				log.Warn("sending confirmation reminder")
+				failed = append(failed, confirmation.Id)
+				continue
+			}
+			log.Error("giving up on confirmation reminder")
+			if err := s.store.FailReminder(context.WithoutCancel(ctx), confirmation.Id, step, err.Error()); err != nil {
+				log.With(zap.Error(err)).Error("recording confirmation reminder failure")
+			}
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// send queues the reminder of the confirmation in the outbox.
+func (s *Scheduler) send(ctx context.Context, confirmation *models.Confirmation) error {
+	content, err := s.content(confirmation)
+	if err != nil {
+		return err
+	}
+	content.WebURL = s.emailConfig.WebUrl
+	content.AssetURL = s.emailConfig.AssetUrl
+
+	var locales []models.Locale
+	if confirmation.Locale != "" {
+		locales = append(locales, confirmation.Locale)
+	}
+	subject, body, text, _, err := models.RenderTemplate(s.templates, models.TemplateNameInvitationReminder, locales, content)
+	if err != nil {
+		return err
+	}
+	message, err := models.NewOutboxMessage(models.TemplateNameInvitationReminder, []string{confirmation.Email}, subject, body, text)
+	if err != nil {
+		return err
+	}
+	message.ConfirmationId = confirmation.Id
+	return s.store.EnqueueMessage(ctx, message)
+}
+
+// content returns the content of the reminder of the confirmation, linking
+// to where its invitation was accepted.
+func (s *Scheduler) content(confirmation *models.Confirmation) (*models.InvitationReminderContent, error) {
+	content := &models.InvitationReminderContent{
+		Email:   confirmation.Email,
+		WebPath: "login",
+	}
+	switch confirmation.Type {
+	case models.TypeClinicianInvite:
+		content.InviterName = confirmation.Creator.ClinicName
+		if confirmation.UserId == "" {
+			content.WebPath = "signup/clinician"
+		}
+	case models.TypeCareteamInvite:
+		profile := &models.Profile{}
+		if err := s.seagull.GetCollection(confirmation.CreatorId, "profile", s.sl.TokenProvide(), profile); err != nil {
+			return nil, fmt.Errorf("getting the creator's profile: %w", err)
+		}
+		content.InviterName = profile.FullName
+		if profile.Patient.IsOtherPerson {
+			content.InviterName = profile.Patient.FullName
+		}
+		if confirmation.UserId == "" {
+			content.WebPath = "signup/personal"
+		}
+	default:
+		return nil, fmt.Errorf("%s confirmations can't be reminded", confirmation.Type)
+	}
+	return content, nil
+}
+
+func configProvider() (Config, error) {
+	var config Config
+	if err := envconfig.Process("hydrophone_reminder", &config); err != nil {
+		return Config{}, err
+	}
+	if err := config.Schedules.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+func startScheduler(lifecycle fx.Lifecycle, scheduler *Scheduler) {
+	lifecycle.Append(worker.Hook(scheduler))
+}
+
+// Module emails reminders for pending confirmations in the background.
+var Module = fx.Options(
+	fx.Provide(configProvider, NewScheduler),
+	fx.Invoke(startScheduler),
+)
@@ -0,0 +1,275 @@
+package reminder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	commonClients "github.com/tidepool-org/go-common/clients"
+	"github.com/tidepool-org/go-common/clients/shoreline"
+
+	"github.com/tidepool-org/hydrophone/clients"
+	"github.com/tidepool-org/hydrophone/events"
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/templates"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+const day = 24 * time.Hour
+
+func TestRemind(s *testing.T) {
+	s.Run("reminds pending confirmations on their schedule", func(t *testing.T) {
+		store, metrics, scheduler := newSchedulerTest(t)
+		careteam := store.add(models.TypeCareteamInvite, models.StatusPending, 4*day)
+		clinician := store.add(models.TypeClinicianInvite, models.StatusPending, 2*day)
+		clinician.Creator.ClinicName = "Sample Clinic"
+		clinician.UserId = "clinician-id"
+		untouched := []*models.Confirmation{
+			store.add(models.TypeCareteamInvite, models.StatusPending, 2*day),
+			store.add(models.TypeCareteamInvite, models.StatusCompleted, 4*day),
+			store.add(models.TypeCareteamInvite, models.StatusCanceled, 4*day),
+			store.add(models.TypeSignUp, models.StatusPending, 4*day),
+		}
+
+		counts, err := scheduler.Remind(context.Background())
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if counts[models.TypeCareteamInvite] != 1 || counts[models.TypeClinicianInvite] != 1 || len(counts) != 2 {
+			t.Fatalf("unexpected counts: %v", counts)
+		}
+		for _, confirmation := range []*models.Confirmation{careteam, clinician} {
+			if len(confirmation.Reminders) != 1 || confirmation.Reminders[0].Step != 0 {
+				t.Errorf("expected the first reminder of the %s to be recorded, got %+v", confirmation.Type, confirmation.Reminders)
+			}
+		}
+		for _, confirmation := range untouched {
+			if len(confirmation.Reminders) != 0 {
+				t.Errorf("expected %s %s confirmation not to be reminded", confirmation.Status, confirmation.Type)
+			}
+		}
+
+		if len(store.messages) != 2 {
+			t.Fatalf("expected 2 reminders to be queued, got %d", len(store.messages))
+		}
+		for _, message := range store.messages {
+			if message.TemplateName != models.TemplateNameInvitationReminder {
+				t.Errorf("expected the reminder template, got %s", message.TemplateName)
+			}
+		}
+		careteamMessage, clinicianMessage := store.message(careteam), store.message(clinician)
+		if !strings.Contains(careteamMessage.TextBody, "Sample Patient") ||
+			!strings.Contains(careteamMessage.TextBody, "https://app.tidepool.test/signup/personal?inviteEmail="+url.QueryEscape(careteam.Email)) {
+			t.Errorf("unexpected care team reminder: %s", careteamMessage.TextBody)
+		}
+		if !strings.Contains(clinicianMessage.TextBody, "Sample Clinic") ||
+			!strings.Contains(clinicianMessage.TextBody, "https://app.tidepool.test/login?inviteEmail="+url.QueryEscape(clinician.Email)) {
+			t.Errorf("unexpected clinician reminder: %s", clinicianMessage.TextBody)
+		}
+		if len(metrics.posted) != 2 {
+			t.Errorf("expected 2 metrics, got %d", len(metrics.posted))
+		}
+	})
+
+	s.Run("sends each reminder once", func(t *testing.T) {
+		store, _, scheduler := newSchedulerTest(t)
+		confirmation := store.add(models.TypeCareteamInvite, models.StatusPending, 4*day)
+
+		for i := 0; i < 2; i++ {
+			if _, err := scheduler.Remind(context.Background()); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+		}
+		if len(store.messages) != 1 {
+			t.Fatalf("expected 1 reminder, got %d", len(store.messages))
+		}
+
+		scheduler.now = func() time.Time { return store.now.Add(3 * day) }
+		if _, err := scheduler.Remind(context.Background()); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if len(confirmation.Reminders) != 2 || confirmation.Reminders[1].Step != 1 || len(store.messages) != 2 {
+			t.Fatalf("expected the second reminder, got %+v", confirmation.Reminders)
+		}
+	})
+
+	s.Run("releases reminders that can't be queued", func(t *testing.T) {
+		store, _, scheduler := newSchedulerTest(t)
+		confirmation := store.add(models.TypeCareteamInvite, models.StatusPending, 4*day)
+		store.enqueueErr = errors.New("unavailable")
+
+		counts, err := scheduler.Remind(context.Background())
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if len(counts) != 0 || len(confirmation.Reminders) != 0 || store.claims != 1 {
+			t.Fatalf("expected the reminder to be claimed once and released, got %v after %d claims", confirmation.Reminders, store.claims)
+		}
+
+		store.enqueueErr = nil
+		if _, err := scheduler.Remind(context.Background()); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if len(confirmation.Reminders) != 1 || len(store.messages) != 1 {
+			t.Fatalf("expected the reminder to be sent on the next run, got %+v", confirmation.Reminders)
+		}
+	})
+
+	s.Run("gives up on reminders that keep failing", func(t *testing.T) {
+		store, _, scheduler := newSchedulerTest(t)
+		confirmation := store.add(models.TypeCareteamInvite, models.StatusPending, 4*day)
+		store.enqueueErr = errors.New("unavailable")
+
+		for i := 0; i < 3; i++ {
+			if _, err := scheduler.Remind(context.Background()); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+		}
+		if store.claims != 2 || confirmation.ReminderFailures != 1 {
+			t.Fatalf("expected the reminder to be tried twice, got %d claims and %d failures", store.claims, confirmation.ReminderFailures)
+		}
+		if len(confirmation.Reminders) != 1 || confirmation.Reminders[0].Error != "unavailable" {
+			t.Fatalf("expected the failure to be recorded on the reminder, got %+v", confirmation.Reminders)
+		}
+	})
+
+	s.Run("only sends the latest of the reminders due", func(t *testing.T) {
+		store, _, scheduler := newSchedulerTest(t)
+		confirmation := store.add(models.TypeCareteamInvite, models.StatusPending, 6*day+time.Hour)
+
+		if _, err := scheduler.Remind(context.Background()); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if len(confirmation.Reminders) != 1 || confirmation.Reminders[0].Step != 1 || len(store.messages) != 1 {
+			t.Fatalf("expected only the second reminder, got %+v", confirmation.Reminders)
+		}
+	})
+}
+
+func newSchedulerTest(t *testing.T) (*fakeReminderStore, *fakeMetrics, *Scheduler) {
+	t.Helper()
+	config := Config{
+		Interval:    time.Minute,
+		BatchSize:   10,
+		MaxAttempts: 2,
+		Schedules: Schedules{
+			models.TypeCareteamInvite:  {3 * day, 6 * day},
+			models.TypeClinicianInvite: {day},
+		},
+	}
+	defaults, err := templates.New()
+	if err != nil {
+		t.Fatalf("error creating templates: %s", err)
+	}
+	emailConfig := events.EmailConfig{WebUrl: "https://app.tidepool.test", AssetUrl: "https://assets.tidepool.test"}
+	store := &fakeReminderStore{now: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)}
+	metrics := &fakeMetrics{}
+	scheduler := NewScheduler(config, emailConfig, store, defaults, &fakeSeagull{}, metrics, shoreline.NewMock("token"), testutil.NewLogger(t))
+	scheduler.now = func() time.Time { return store.now }
+	return store, metrics, scheduler
+}
+
+// fakeReminderStore implements just enough of clients.StoreClient to
+// exercise the Scheduler.
+type fakeReminderStore struct {
+	clients.StoreClient
+	now           time.Time
+	confirmations []*models.Confirmation
+	messages      []*models.OutboxMessage
+	enqueueErr    error
+	claims        int
+}
+
+func (s *fakeReminderStore) add(confirmationType models.Type, status models.Status, age time.Duration) *models.Confirmation {
+	confirmation := &models.Confirmation{
+		Id:        string(confirmationType) + "-" + string(rune('a'+len(s.confirmations))),
+		Type:      confirmationType,
+		Status:    status,
+		Email:     "invitee" + string(rune('a'+len(s.confirmations))) + "@example.org",
+		CreatorId: "creator-id",
+		Created:   s.now.Add(-age),
+	}
+	s.confirmations = append(s.confirmations, confirmation)
+	return confirmation
+}
+
+func (s *fakeReminderStore) message(confirmation *models.Confirmation) *models.OutboxMessage {
+	for _, message := range s.messages {
+		if message.ConfirmationId == confirmation.Id {
+			return message
+		}
+	}
+	return &models.OutboxMessage{}
+}
+
+func (s *fakeReminderStore) ClaimReminder(ctx context.Context, confirmationType models.Type, step int, createdBefore, now time.Time) (*models.Confirmation, error) {
+	for _, confirmation := range s.confirmations {
+		if confirmation.Type != confirmationType || confirmation.Status != models.StatusPending ||
+			confirmation.Email == "" || confirmation.Created.After(createdBefore) ||
+			(confirmation.ExpiresAt != nil && !confirmation.ExpiresAt.After(now)) {
+			continue
+		}
+		if slices.ContainsFunc(confirmation.Reminders, func(r models.Reminder) bool { return r.Step >= step }) {
+			continue
+		}
+		confirmation.Reminders = append(confirmation.Reminders, models.Reminder{Step: step, Time: now})
+		s.claims++
+		return confirmation, nil
+	}
+	return nil, nil
+}
+
+func (s *fakeReminderStore) ReleaseReminder(ctx context.Context, confirmationId string, step int) error {
+	for _, confirmation := range s.confirmations {
+		if confirmation.Id == confirmationId {
+			confirmation.Reminders = slices.DeleteFunc(confirmation.Reminders, func(r models.Reminder) bool { return r.Step == step })
+			confirmation.ReminderFailures++
+		}
+	}
+	return nil
+}
+
+func (s *fakeReminderStore) FailReminder(ctx context.Context, confirmationId string, step int, reason string) error {
+	for _, confirmation := range s.confirmations {
+		for i := range confirmation.Reminders {
+			if confirmation.Id == confirmationId && confirmation.Reminders[i].Step == step {
+				confirmation.Reminders[i].Error = reason
+			}
+		}
+	}
+	return nil
+}
+
+func (s *fakeReminderStore) EnqueueMessage(ctx context.Context, message *models.OutboxMessage) error {
+	if s.enqueueErr != nil {
+		return s.enqueueErr
+	}
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+// fakeSeagull has a profile for every user.
+type fakeSeagull struct {
+	commonClients.SeagullMock
+}
+
+func (s *fakeSeagull) GetCollection(userID, collectionName, token string, v interface{}) error {
+	return json.Unmarshal([]byte(`{"fullName": "Sample Patient"}`), v)
+}
+
+type fakeMetrics struct {
+	posted []map[string]string
+}
+
+func (m *fakeMetrics) PostServer(eventName, token string, params map[string]string) {
+	m.posted = append(m.posted, params)
+}
+
+func (m *fakeMetrics) PostThisUser(eventName, token string, params map[string]string) {}
+
+func (m *fakeMetrics) PostWithUser(userId, eventName, token string, params map[string]string) {}
@@ -0,0 +1,70 @@
+package sns
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SES notification types
+const (
+	SESNotificationBounce    = "Bounce"
+	SESNotificationComplaint = "Complaint"
+	SESNotificationDelivery  = "Delivery"
+
+	// SESBounceTypePermanent bounces won't succeed if they're retried.
+	SESBounceTypePermanent = "Permanent"
+)
+
+type (
+	// SESNotification is an Amazon SES feedback notification, as published to
+	// an SNS topic either by the identity's notifications or by an event
+	// destination.
+	SESNotification struct {
+		NotificationType string        `json:"notificationType,omitempty"`
+		EventType        string        `json:"eventType,omitempty"`
+		Mail             SESMail       `json:"mail"`
+		Bounce           *SESBounce    `json:"bounce,omitempty"`
+		Complaint        *SESComplaint `json:"complaint,omitempty"`
+	}
+
+	SESMail struct {
+		MessageId   string   `json:"messageId"`
+		Destination []string `json:"destination"`
+	}
+
+	SESBounce struct {
+		BounceType        string         `json:"bounceType"`
+		BounceSubType     string         `json:"bounceSubType"`
+		BouncedRecipients []SESRecipient `json:"bouncedRecipients"`
+	}
+
+	SESComplaint struct {
+		ComplaintFeedbackType string         `json:"complaintFeedbackType,omitempty"`
+		ComplainedRecipients  []SESRecipient `json:"complainedRecipients"`
+	}
+
+	SESRecipient struct {
+		EmailAddress   string `json:"emailAddress"`
+		DiagnosticCode string `json:"diagnosticCode,omitempty"`
+	}
+)
+
+// ParseSESNotification decodes the SES notification in the message.
+func ParseSESNotification(m *Message) (*SESNotification, error) {
+	if m.Type != TypeNotification {
+		return nil, fmt.Errorf("sns: %q isn't a notification", m.Type)
+	}
+	var notification SESNotification
+	if err := json.Unmarshal([]byte(m.Message), &notification); err != nil {
+		return nil, fmt.Errorf("sns: decoding SES notification: %w", err)
+	}
+	return &notification, nil
+}
+
+// Type returns the type of notification, whichever way it was published.
+func (n *SESNotification) Type() string {
+	if n.NotificationType != "" {
+		return n.NotificationType
+	}
+	return n.EventType
+}
@@ -0,0 +1,213 @@
+package sns
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// maxCertSize limits the size of the signing certificates fetched.
+	maxCertSize = 64 * 1024
+	// maxCachedCerts limits the number of signing certificates kept.
+	maxCachedCerts = 16
+	// maxMessageAge is how long after it was sent a message is accepted,
+	// so that a captured message can't be replayed later.
+	maxMessageAge = time.Hour
+	// maxClockSkew is how far in the future a message's timestamp may be.
+	maxClockSkew = 5 * time.Minute
+)
+
+// Config controls which SNS messages are accepted.
+type Config struct {
+	// CertURLPattern matches the URLs that signing certificates and
+	// subscription confirmations may be fetched from. It defaults to
+	// Amazon SNS, and can match a local server in tests.
+	CertURLPattern string `split_words:"true" default:"^https://sns\\.[a-z0-9-]+\\.amazonaws\\.com(\\.cn)?/"`
+	// TopicArns are the topics messages are accepted from. Without them no
+	// message is accepted, since any AWS account can sign messages from its
+	// own topics.
+	TopicArns []string `split_words:"true"`
+}
+
+// Enabled returns whether any messages are accepted.
+func (c Config) Enabled() bool {
+	return len(c.TopicArns) > 0
+}
+
+// Validate returns an error if the configuration can't be used.
+func (c Config) Validate() error {
+	if _, err := regexp.Compile(c.CertURLPattern); err != nil {
+		return fmt.Errorf("sns: invalid certificate URL pattern: %w", err)
+	}
+	return nil
+}
+
+// Verifier checks that messages were signed by SNS.
+type Verifier struct {
+	config     Config
+	certURL    *regexp.Regexp
+	httpClient *http.Client
+
+	now func() time.Time
+
+	mu    sync.Mutex
+	certs map[string]*rsa.PublicKey
+}
+
+// NewVerifier creates a Verifier. If the configuration is invalid, or doesn't
+// give a certificate URL pattern and topics, every message is rejected.
+func NewVerifier(config Config, httpClient *http.Client) *Verifier {
+	v := &Verifier{
+		config:     config,
+		httpClient: httpClient,
+		now:        time.Now,
+		certs:      map[string]*rsa.PublicKey{},
+	}
+	if config.CertURLPattern != "" {
+		v.certURL, _ = regexp.Compile(config.CertURLPattern)
+	}
+	if v.httpClient == nil {
+		v.httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return v
+}
+
+// Verify returns an error unless the message is from an accepted topic, was
+// sent recently, and its signature is valid.
+func (v *Verifier) Verify(ctx context.Context, m *Message) error {
+	if !slices.Contains(v.config.TopicArns, m.TopicArn) {
+		return fmt.Errorf("sns: topic %q isn't accepted", m.TopicArn)
+	}
+	sent, err := time.Parse(time.RFC3339, m.Timestamp)
+	if err != nil {
+		return fmt.Errorf("sns: invalid timestamp %q", m.Timestamp)
+	}
+	if age := v.now().Sub(sent); age > maxMessageAge || age < -maxClockSkew {
+		return fmt.Errorf("sns: message sent at %s isn't recent", m.Timestamp)
+	}
+
+	var hash crypto.Hash
+	var digest []byte
+	content, err := m.StringToSign()
+	if err != nil {
+		return err
+	}
+	switch m.SignatureVersion {
+	case "1":
+		sum := sha1.Sum([]byte(content))
+		hash, digest = crypto.SHA1, sum[:]
+	case "2":
+		sum := sha256.Sum256([]byte(content))
+		hash, digest = crypto.SHA256, sum[:]
+	default:
+		return fmt.Errorf("sns: unknown signature version %q", m.SignatureVersion)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("sns: decoding signature: %w", err)
+	}
+	key, err := v.signingKey(ctx, m.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	if err := rsa.VerifyPKCS1v15(key, hash, digest, signature); err != nil {
+		return fmt.Errorf("sns: invalid signature: %w", err)
+	}
+	return nil
+}
+
+// ConfirmSubscription confirms a verified subscription confirmation, so that
+// SNS starts delivering notifications.
+func (v *Verifier) ConfirmSubscription(ctx context.Context, m *Message) error {
+	if m.Type != TypeSubscriptionConfirmation {
+		return fmt.Errorf("sns: %q isn't a subscription confirmation", m.Type)
+	}
+	resp, err := v.get(ctx, m.SubscribeURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxCertSize))
+	return nil
+}
+
+// signingKey returns the public key of the certificate at url, fetching it
+// the first time it's used. Once maxCachedCerts are kept, one is dropped for
+// each new one.
+func (v *Verifier) signingKey(ctx context.Context, url string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	key, ok := v.certs[url]
+	v.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	resp, err := v.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCertSize))
+	if err != nil {
+		return nil, fmt.Errorf("sns: reading signing certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(body)
+	if block == nil {
+		return nil, errors.New("sns: signing certificate isn't PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("sns: parsing signing certificate: %w", err)
+	}
+	key, ok = cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("sns: signing certificate doesn't have an RSA key")
+	}
+
+	v.mu.Lock()
+	if len(v.certs) >= maxCachedCerts {
+		for cached := range v.certs {
+			delete(v.certs, cached)
+			break
+		}
+	}
+	v.certs[url] = key
+	v.mu.Unlock()
+	return key, nil
+}
+
+// get fetches a URL that matches the certificate URL pattern.
+func (v *Verifier) get(ctx context.Context, url string) (*http.Response, error) {
+	if v.certURL == nil || !v.certURL.MatchString(url) {
+		return nil, fmt.Errorf("sns: URL %q isn't allowed", url)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("sns: fetching %q: unexpected status %d", url, resp.StatusCode)
+	}
+	return resp, nil
+}
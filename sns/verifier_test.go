@@ -0,0 +1,91 @@
+package sns_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/sns"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+func TestVerifier(t *testing.T) {
+	ctx := context.Background()
+	topic := testutil.NewSNSTopic(t)
+	verifier := sns.NewVerifier(topic.Config(), nil)
+
+	notification := topic.Notification(map[string]string{"notificationType": sns.SESNotificationBounce})
+	if err := verifier.Verify(ctx, notification); err != nil {
+		t.Fatalf("expected the notification to be verified, got %s", err)
+	}
+
+	tampered := *notification
+	tampered.Message = `{"notificationType":"Complaint"}`
+	if err := verifier.Verify(ctx, &tampered); err == nil {
+		t.Error("expected a tampered notification to be rejected")
+	}
+
+	otherTopic := *notification
+	otherTopic.TopicArn = "arn:aws:sns:us-west-2:123456789012:other"
+	if err := verifier.Verify(ctx, &otherTopic); err == nil {
+		t.Error("expected a notification from another topic to be rejected")
+	}
+
+	stale := topic.SignAt(&sns.Message{Type: sns.TypeNotification, Message: notification.Message}, time.Now().Add(-2*time.Hour))
+	if err := verifier.Verify(ctx, stale); err == nil {
+		t.Error("expected a stale notification to be rejected")
+	}
+
+	otherCert := *notification
+	otherCert.SigningCertURL = "https://example.org/cert.pem"
+	if err := verifier.Verify(ctx, &otherCert); err == nil {
+		t.Error("expected a certificate from another host to be rejected")
+	}
+
+	if err := sns.NewVerifier(sns.Config{}, nil).Verify(ctx, notification); err == nil {
+		t.Error("expected a verifier without a certificate URL pattern to reject every message")
+	}
+	withoutTopics := topic.Config()
+	withoutTopics.TopicArns = nil
+	if err := sns.NewVerifier(withoutTopics, nil).Verify(ctx, notification); err == nil {
+		t.Error("expected a verifier without topics to reject every message")
+	}
+	if withoutTopics.Enabled() {
+		t.Error("expected a configuration without topics to be disabled")
+	}
+}
+
+func TestVerifierConfirmSubscription(t *testing.T) {
+	ctx := context.Background()
+	topic := testutil.NewSNSTopic(t)
+	verifier := sns.NewVerifier(topic.Config(), nil)
+
+	confirmation := topic.SubscriptionConfirmation()
+	if err := verifier.Verify(ctx, confirmation); err != nil {
+		t.Fatalf("expected the subscription confirmation to be verified, got %s", err)
+	}
+	if err := verifier.ConfirmSubscription(ctx, confirmation); err != nil {
+		t.Fatalf("expected the subscription to be confirmed, got %s", err)
+	}
+	if !topic.Confirmed() {
+		t.Error("expected the topic to have received the confirmation")
+	}
+}
+
+func TestParseSESNotification(t *testing.T) {
+	topic := testutil.NewSNSTopic(t)
+	notification, err := sns.ParseSESNotification(topic.Notification(map[string]any{
+		"eventType": sns.SESNotificationBounce,
+		"bounce": map[string]any{
+			"bounceType":        sns.SESBounceTypePermanent,
+			"bouncedRecipients": []map[string]string{{"emailAddress": "bounced@example.org"}},
+		},
+	}))
+	if err != nil {
+		t.Fatalf("expected the notification to be parsed, got %s", err)
+	}
+	if notification.Type() != sns.SESNotificationBounce || notification.Bounce == nil ||
+		notification.Bounce.BouncedRecipients[0].EmailAddress != "bounced@example.org" {
+		t.Errorf("non-expected notification %+v", notification)
+	}
+}
@@ -1,79 +1,165 @@
 package templates
 
 import (
+	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
+	"path"
+	"strings"
 
 	"github.com/tidepool-org/hydrophone/models"
 )
 
+// Templates are laid out as <locale>/<name>.subject.tmpl and
+// <locale>/<name>.html.tmpl, with an optional <locale>/<name>.txt.tmpl. The
+// text body is converted from the HTML body when there's no text template.
+const (
+	subjectSuffix = ".subject.tmpl"
+	htmlSuffix    = ".html.tmpl"
+	textSuffix    = ".txt.tmpl"
+)
+
+//go:embed defaults
+var defaults embed.FS
+
+// New creates the default templates that are embedded in hydrophone.
 func New() (models.Templates, error) {
-	templates := models.Templates{}
+	fsys, err := fs.Sub(defaults, "defaults")
+	if err != nil {
+		return nil, fmt.Errorf("templates: failure to open defaults: %w", err)
+	}
 
-	if template, err := NewCareteamInviteTemplate(); err != nil {
-		return nil, fmt.Errorf("templates: failure to create careteam invite template: %s", err)
-	} else {
-		templates[template.Name()] = template
+	templates, err := Load(fsys)
+	if err != nil {
+		return nil, err
 	}
 
-	if template, err := NewCareteamInviteWithAlertingTemplate(); err != nil {
-		return nil, fmt.Errorf("templates: failure to create careteam invite with alerting template: %w", err)
-	} else {
-		templates[template.Name()] = template
+	if err := Validate(templates); err != nil {
+		return nil, err
 	}
 
-	if template, err := NewNoAccountTemplate(); err != nil {
-		return nil, fmt.Errorf("templates: failure to create no account template: %s", err)
-	} else {
-		templates[template.Name()] = template
+	return templates, nil
+}
+
+// Load compiles every template in fsys.
+func Load(fsys fs.FS) (models.Templates, error) {
+	templates := models.Templates{}
+
+	locales, err := readDirs(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("templates: failure to read locales: %w", err)
 	}
 
-	if template, err := NewPasswordResetTemplate(); err != nil {
-		return nil, fmt.Errorf("templates: failure to create password reset template: %s", err)
-	} else {
-		templates[template.Name()] = template
+	for _, dir := range locales {
+		locale, err := models.ParseLocale(dir)
+		if err != nil {
+			return nil, fmt.Errorf("templates: invalid locale directory %s: %w", dir, err)
+		}
+
+		entries, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			return nil, fmt.Errorf("templates: failure to read %s templates: %w", locale, err)
+		}
+
+		for _, entry := range entries {
+			name, ok := strings.CutSuffix(entry.Name(), subjectSuffix)
+			if !ok {
+				continue
+			}
+
+			template, err := loadTemplate(fsys, dir, models.TemplateName(name))
+			if err != nil {
+				return nil, fmt.Errorf("templates: failure to create %s %s template: %w", locale, name, err)
+			}
+			templates.Add(locale, template)
+		}
 	}
 
-	if template, err := NewSignupTemplate(); err != nil {
-		return nil, fmt.Errorf("templates: failure to create signup template: %s", err)
-	} else {
-		templates[template.Name()] = template
+	return templates, nil
+}
+
+func loadTemplate(fsys fs.FS, dir string, name models.TemplateName) (models.Template, error) {
+	if !isKnown(name) {
+		return nil, fmt.Errorf("unknown template name %s", name)
 	}
 
-	if template, err := NewSignupClinicTemplate(); err != nil {
-		return nil, fmt.Errorf("templates: failure to create signup clinic template: %s", err)
-	} else {
-		templates[template.Name()] = template
+	subject, err := fs.ReadFile(fsys, path.Join(dir, name.String()+subjectSuffix))
+	if err != nil {
+		return nil, err
+	}
+	body, err := fs.ReadFile(fsys, path.Join(dir, name.String()+htmlSuffix))
+	if err != nil {
+		return nil, err
 	}
 
-	if template, err := NewSignupCustodialTemplate(); err != nil {
-		return nil, fmt.Errorf("templates: failure to create signup custodial template: %s", err)
-	} else {
-		templates[template.Name()] = template
+	// Editors like to end files with a newline, which doesn't belong in a subject.
+	subjectTemplate := strings.TrimSpace(string(subject))
+
+	text, err := fs.ReadFile(fsys, path.Join(dir, name.String()+textSuffix))
+	if err == nil {
+		return models.NewPrecompiledTemplateWithText(name, subjectTemplate, string(body), string(text))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
 	}
+	return models.NewPrecompiledTemplate(name, subjectTemplate, string(body))
+}
 
-	if template, err := NewSignupCustodialClinicTemplate(); err != nil {
-		return nil, fmt.Errorf("templates: failure to create signup custodial clinic template: %s", err)
-	} else {
-		templates[template.Name()] = template
+// Validate checks that every template name has a DefaultLocale template, that
+// every template only uses the variables its content type declares, and
+// test-executes every template with sample content.
+func Validate(templates models.Templates) error {
+	for _, name := range models.TemplateNames {
+		if _, ok := templates[models.TemplateKey{Name: name, Locale: models.DefaultLocale}]; !ok {
+			return fmt.Errorf("templates: %s template is missing", name)
+		}
 	}
 
-	if template, err := NewClinicianInviteTemplate(); err != nil {
-		return nil, fmt.Errorf("templates: failure to create clinician template: %s", err)
-	} else {
-		templates[template.Name()] = template
+	for key, template := range templates {
+		if err := models.CheckTemplateContent(template); err != nil {
+			return fmt.Errorf("templates: failure to validate %s %s template: %w", key.Locale, key.Name, err)
+		}
+		content, err := models.SampleTemplateContent(key.Name)
+		if err != nil {
+			return err
+		}
+		if _, _, _, err := template.Execute(content); err != nil {
+			return fmt.Errorf("templates: failure to validate %s %s template: %w", key.Locale, key.Name, err)
+		}
 	}
 
-	if template, err := NewPatientClinicInviteTemplate(); err != nil {
-		return nil, fmt.Errorf("templates: failure to create patient clinic template: %s", err)
-	} else {
-		templates[template.Name()] = template
+	return nil
+}
+
+// readDirs returns the directories in dir, following symbolic links so that
+// Kubernetes ConfigMap volumes can be loaded. Hidden directories are skipped.
+func readDirs(fsys fs.FS, dir string) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
 	}
 
-	if template, err := NewSignupCustodialNewClinicExperienceTemplate(); err != nil {
-		return nil, fmt.Errorf("templates: failure to create custodial signup new clinicic experience template: %s", err)
-	} else {
-		templates[template.Name()] = template
+	var dirs []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := fs.Stat(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			dirs = append(dirs, path.Join(dir, entry.Name()))
+		}
 	}
+	return dirs, nil
+}
 
-	return templates, nil
+func isKnown(name models.TemplateName) bool {
+	for _, known := range models.TemplateNames {
+		if name == known {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,177 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/testutil"
+)
+
+func TestNew(t *testing.T) {
+	templates, err := New()
+	if err != nil {
+		t.Fatalf("error creating templates: %s", err)
+	}
+	for _, name := range models.TemplateNames {
+		if _, locale, ok := templates.Find(name); !ok || locale != models.DefaultLocale {
+			t.Errorf("expected a %s template for %s, got %q", models.DefaultLocale, name, locale)
+		}
+	}
+	if _, locale, _ := templates.Find(models.TemplateNamePasswordReset, "fr-CA"); locale != "fr" {
+		t.Errorf("expected the fr password reset template, got %q", locale)
+	}
+}
+
+func TestLoad(s *testing.T) {
+	s.Run("loads text templates", func(t *testing.T) {
+		templates, err := Load(fstest.MapFS{
+			"fr/password_reset.subject.tmpl": {Data: []byte("Réinitialisation\n")},
+			"fr/password_reset.html.tmpl":    {Data: []byte("<p>Clé {{ .Key }}</p>")},
+			"fr/password_reset.txt.tmpl":     {Data: []byte("Clé : {{ .Key }}")},
+			"fr/README.md":                   {Data: []byte("ignored")},
+		})
+		if err != nil {
+			t.Fatalf("error loading templates: %s", err)
+		}
+		template, _, ok := templates.Find(models.TemplateNamePasswordReset, "fr")
+		if !ok {
+			t.Fatalf("expected the fr password reset template")
+		}
+		subject, _, text, err := template.Execute(sampleContent(t, models.TemplateNamePasswordReset))
+		if err != nil {
+			t.Fatalf("error executing template: %s", err)
+		}
+		if subject != "Réinitialisation" {
+			t.Errorf("expected the subject to be trimmed, got %q", subject)
+		}
+		if text != "Clé : sample-key" {
+			t.Errorf("expected the text template to be used, got %q", text)
+		}
+	})
+
+	s.Run("rejects unknown template names", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{
+			"en/password_rest.subject.tmpl": {Data: []byte("subject")},
+			"en/password_rest.html.tmpl":    {Data: []byte("body")},
+		})
+		if err == nil || !strings.Contains(err.Error(), "unknown template name") {
+			t.Fatalf("expected an unknown template name error, got %v", err)
+		}
+	})
+
+	s.Run("rejects undeclared variables", func(t *testing.T) {
+		templates, err := Load(fstest.MapFS{
+			"en/password_reset.subject.tmpl": {Data: []byte("subject")},
+			"en/password_reset.html.tmpl":    {Data: []byte("<p>{{ if .Key }}{{ .Nickname }}{{ end }}</p>")},
+		})
+		if err != nil {
+			t.Fatalf("error loading templates: %s", err)
+		}
+		template, _, _ := templates.Find(models.TemplateNamePasswordReset)
+		if err := models.CheckTemplateContent(template); err == nil || !strings.Contains(err.Error(), "Nickname") {
+			t.Fatalf("expected an undeclared variable error, got %v", err)
+		}
+	})
+
+	s.Run("rejects templates without a body", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{
+			"en/password_reset.subject.tmpl": {Data: []byte("subject")},
+		})
+		if err == nil {
+			t.Fatalf("expected an error")
+		}
+	})
+}
+
+func TestWatcher(s *testing.T) {
+	s.Run("reloads changed templates", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "en", models.TemplateNamePasswordReset, "First", "<p>first</p>")
+		watcher, err := NewWatcher(Config{Directory: dir, ReloadInterval: time.Minute}, testutil.NewLogger(t))
+		if err != nil {
+			t.Fatalf("error creating watcher: %s", err)
+		}
+		assertSubject(t, watcher, models.TemplateNamePasswordReset, "First")
+		// Templates that aren't overridden use the defaults.
+		assertSubject(t, watcher, models.TemplateNameNoAccount, "Password reset for your Tidepool account")
+
+		if reloaded, err := watcher.Reload(); err != nil || reloaded {
+			t.Fatalf("expected no reload of unchanged templates, got %t, %v", reloaded, err)
+		}
+
+		writeTemplate(t, dir, "en", models.TemplateNamePasswordReset, "Second", "<p>second</p>")
+		if reloaded, err := watcher.Reload(); err != nil || !reloaded {
+			t.Fatalf("expected changed templates to be reloaded, got %t, %v", reloaded, err)
+		}
+		assertSubject(t, watcher, models.TemplateNamePasswordReset, "Second")
+	})
+
+	s.Run("keeps the previous templates when invalid", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "en", models.TemplateNamePasswordReset, "First", "<p>first</p>")
+		watcher, err := NewWatcher(Config{Directory: dir, ReloadInterval: time.Minute}, testutil.NewLogger(t))
+		if err != nil {
+			t.Fatalf("error creating watcher: %s", err)
+		}
+
+		writeTemplate(t, dir, "en", models.TemplateNamePasswordReset, "Second", "<p>{{ .Key }</p>")
+		if _, err := watcher.Reload(); err == nil {
+			t.Fatalf("expected an error reloading invalid templates")
+		}
+		assertSubject(t, watcher, models.TemplateNamePasswordReset, "First")
+	})
+
+	s.Run("fails to start with invalid templates", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "en", models.TemplateNamePasswordReset, "{{ if }}", "<p>body</p>")
+		if _, err := NewWatcher(Config{Directory: dir}, testutil.NewLogger(t)); err == nil {
+			t.Fatalf("expected an error")
+		}
+	})
+}
+
+func writeTemplate(t *testing.T, dir string, locale models.Locale, name models.TemplateName, subject, body string) {
+	t.Helper()
+	localeDir := filepath.Join(dir, locale.String())
+	if err := os.MkdirAll(localeDir, 0o755); err != nil {
+		t.Fatalf("error creating locale directory: %s", err)
+	}
+	files := map[string]string{
+		name.String() + subjectSuffix: subject,
+		name.String() + htmlSuffix:    body,
+	}
+	for file, content := range files {
+		if err := os.WriteFile(filepath.Join(localeDir, file), []byte(content), 0o644); err != nil {
+			t.Fatalf("error writing template: %s", err)
+		}
+	}
+}
+
+func assertSubject(t *testing.T, provider models.TemplateProvider, name models.TemplateName, expected string) {
+	t.Helper()
+	template, _, ok := provider.Find(name)
+	if !ok {
+		t.Fatalf("expected the %s template", name)
+	}
+	subject, _, _, err := template.Execute(sampleContent(t, name))
+	if err != nil {
+		t.Fatalf("error executing template: %s", err)
+	}
+	if subject != expected {
+		t.Fatalf("expected subject %q, got %q", expected, subject)
+	}
+}
+
+func sampleContent(t *testing.T, name models.TemplateName) models.TemplateContent {
+	t.Helper()
+	content, err := models.SampleTemplateContent(name)
+	if err != nil {
+		t.Fatalf("error creating sample content: %s", err)
+	}
+	return content
+}
@@ -0,0 +1,185 @@
+package templates
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/hydrophone/models"
+	"github.com/tidepool-org/hydrophone/worker"
+)
+
+// Config controls where templates are loaded from.
+type Config struct {
+	// Directory overrides the default templates, using the same layout. It's
+	// watched for changes. Defaults are used when it's empty.
+	Directory      string        `split_words:"true"`
+	ReloadInterval time.Duration `split_words:"true" default:"30s"`
+}
+
+// Watcher provides the default templates, overridden by those of a
+// directory. The directory is polled, and its templates are recompiled
+// whenever it changes. Templates that fail to compile or validate are
+// rejected, and the previous templates remain in use.
+type Watcher struct {
+	config    Config
+	fsys      fs.FS
+	log       *zap.SugaredLogger
+	templates atomic.Pointer[models.Templates]
+	checksum  string
+	periodic  *worker.Periodic
+}
+
+// NewWatcher loads the templates, failing if they're invalid.
+func NewWatcher(config Config, log *zap.SugaredLogger) (*Watcher, error) {
+	w := &Watcher{
+		config: config,
+		log:    log,
+	}
+	if config.Directory != "" {
+		w.fsys = os.DirFS(config.Directory)
+	}
+	w.periodic = worker.NewPeriodic(config.ReloadInterval, w.poll)
+	if _, err := w.Reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Find implements models.TemplateProvider.
+func (w *Watcher) Find(name models.TemplateName, locales ...models.Locale) (models.Template, models.Locale, bool) {
+	return w.Templates().Find(name, locales...)
+}
+
+// Keys implements models.TemplateProvider.
+func (w *Watcher) Keys() []models.TemplateKey {
+	return w.Templates().Keys()
+}
+
+// Templates returns the current templates.
+func (w *Watcher) Templates() models.Templates {
+	return *w.templates.Load()
+}
+
+// Reload recompiles the templates if the directory changed since they were
+// last loaded, returning whether they were replaced.
+func (w *Watcher) Reload() (bool, error) {
+	if w.fsys == nil {
+		if w.templates.Load() != nil {
+			return false, nil
+		}
+		templates, err := New()
+		if err != nil {
+			return false, err
+		}
+		w.templates.Store(&templates)
+		return true, nil
+	}
+
+	checksum, err := checksum(w.fsys)
+	if err != nil {
+		return false, fmt.Errorf("templates: failure to read %s: %w", w.config.Directory, err)
+	}
+	if checksum == w.checksum {
+		return false, nil
+	}
+
+	templates, err := New()
+	if err != nil {
+		return false, err
+	}
+	overrides, err := Load(w.fsys)
+	if err != nil {
+		return false, err
+	}
+	for key, template := range overrides {
+		templates[key] = template
+	}
+	if err := Validate(templates); err != nil {
+		return false, err
+	}
+
+	w.templates.Store(&templates)
+	w.checksum = checksum
+	return true, nil
+}
+
+// Start polls the directory in the background until Stop is called.
+func (w *Watcher) Start() {
+	if w.fsys == nil {
+		return
+	}
+	w.periodic.Start()
+}
+
+// Stop polling the directory.
+func (w *Watcher) Stop(ctx context.Context) error {
+	return w.periodic.Stop(ctx)
+}
+
+func (w *Watcher) poll(ctx context.Context) bool {
+	if reloaded, err := w.Reload(); err != nil {
+		w.log.With(zap.Error(err)).Error("reloading templates")
+	} else if reloaded {
+		w.log.With(zap.String("directory", w.config.Directory)).Info("reloaded templates")
+	}
+	return true
+}
+
+// checksum hashes the names and contents of the template files, so changes
+// are detected however the files were updated.
+func checksum(fsys fs.FS) (string, error) {
+	hash := sha256.New()
+	dirs, err := readDirs(fsys, ".")
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range dirs {
+		entries, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			return "", err
+		}
+		for _, entry := range entries {
+			name := path.Join(dir, entry.Name())
+			content, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(hash, "%s\x00%d\x00", name, len(content))
+			hash.Write(content)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func configProvider() (Config, error) {
+	var config Config
+	if err := envconfig.Process("hydrophone_templates", &config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+func startWatcher(lifecycle fx.Lifecycle, watcher *Watcher) {
+	lifecycle.Append(worker.Hook(watcher))
+}
+
+// Module provides the email templates, reloading them when they change.
+var Module = fx.Options(
+	fx.Provide(
+		configProvider,
+		NewWatcher,
+		func(w *Watcher) models.TemplateProvider { return w },
+	),
+	fx.Invoke(startWatcher),
+)
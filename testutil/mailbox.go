@@ -0,0 +1,165 @@
+package testutil
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// Mailbox reads the emails written by the file notifier, in either its .eml
+// or maildir format, so tests can assert on what would have been sent.
+type Mailbox struct {
+	t   *testing.T
+	dir string
+}
+
+// NewMailbox reads the emails written to dir.
+func NewMailbox(t *testing.T, dir string) *Mailbox {
+	return &Mailbox{t: t, dir: dir}
+}
+
+// Email is a sent email, with its parts decoded.
+type Email struct {
+	Header  mail.Header
+	From    string
+	To      []string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Emails returns every email in the mailbox, oldest first.
+func (m *Mailbox) Emails() []*Email {
+	m.t.Helper()
+	var files []string
+	for _, pattern := range []string{"*.eml", "new/*", "cur/*"} {
+		matches, err := filepath.Glob(filepath.Join(m.dir, pattern))
+		if err != nil {
+			m.t.Fatalf("listing emails: %s", err)
+		}
+		files = append(files, matches...)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return filepath.Base(files[i]) < filepath.Base(files[j])
+	})
+
+	emails := make([]*Email, 0, len(files))
+	for _, file := range files {
+		emails = append(emails, m.read(file))
+	}
+	return emails
+}
+
+// Only returns the only email in the mailbox, failing the test if there isn't
+// exactly one.
+func (m *Mailbox) Only() *Email {
+	m.t.Helper()
+	emails := m.Emails()
+	if len(emails) != 1 {
+		m.t.Fatalf("expected 1 email, got %d", len(emails))
+	}
+	return emails[0]
+}
+
+func (m *Mailbox) read(file string) *Email {
+	m.t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		m.t.Fatalf("opening email: %s", err)
+	}
+	defer f.Close()
+
+	message, err := mail.ReadMessage(f)
+	if err != nil {
+		m.t.Fatalf("reading email %s: %s", file, err)
+	}
+
+	decoder := &mime.WordDecoder{}
+	subject, err := decoder.DecodeHeader(message.Header.Get("Subject"))
+	if err != nil {
+		m.t.Fatalf("decoding subject of %s: %s", file, err)
+	}
+	email := &Email{
+		Header:  message.Header,
+		From:    message.Header.Get("From"),
+		Subject: subject,
+	}
+	if to, err := message.Header.AddressList("To"); err == nil {
+		for _, address := range to {
+			email.To = append(email.To, address.Address)
+		}
+	}
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		m.t.Fatalf("expected a multipart email in %s, got %q", file, mediaType)
+	}
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := parts.NextRawPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			m.t.Fatalf("reading parts of %s: %s", file, err)
+		}
+
+		var body io.Reader = part
+		if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+			body = quotedprintable.NewReader(part)
+		}
+		content, err := io.ReadAll(body)
+		if err != nil {
+			m.t.Fatalf("decoding part of %s: %s", file, err)
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "text/html":
+			email.HTML = string(content)
+		case "text/plain":
+			email.Text = string(content)
+		}
+	}
+	return email
+}
+
+// Links returns the targets of the links in the HTML body.
+func (e *Email) Links() []string {
+	var links []string
+	tokenizer := html.NewTokenizer(strings.NewReader(e.HTML))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken:
+			token := tokenizer.Token()
+			if token.Data != "a" {
+				continue
+			}
+			for _, attr := range token.Attr {
+				if attr.Key == "href" {
+					links = append(links, strings.TrimSpace(attr.Val))
+				}
+			}
+		}
+	}
+}
+
+// HasLink reports whether the HTML body links to a URL starting with prefix.
+func (e *Email) HasLink(prefix string) bool {
+	for _, link := range e.Links() {
+		if strings.HasPrefix(link, prefix) {
+			return true
+		}
+	}
+	return false
+}
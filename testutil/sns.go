@@ -0,0 +1,137 @@
+package testutil
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tidepool-org/hydrophone/sns"
+)
+
+// SNSTopic stands in for an Amazon SNS topic. It signs messages the way SNS
+// does, with a certificate served by a local server, and records
+// subscription confirmations.
+type SNSTopic struct {
+	Arn string
+
+	t          *testing.T
+	server     *httptest.Server
+	key        *rsa.PrivateKey
+	confirmed  atomic.Bool
+	messageIds atomic.Int64
+}
+
+// NewSNSTopic starts a topic that's stopped at the end of the test.
+func NewSNSTopic(t *testing.T) *SNSTopic {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating SNS key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating SNS certificate: %s", err)
+	}
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	topic := &SNSTopic{
+		Arn: "arn:aws:sns:us-west-2:123456789012:ses-feedback",
+		t:   t,
+		key: key,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cert.pem", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(cert)
+	})
+	mux.HandleFunc("/confirm", func(w http.ResponseWriter, r *http.Request) {
+		topic.confirmed.Store(true)
+	})
+	topic.server = httptest.NewServer(mux)
+	t.Cleanup(topic.server.Close)
+	return topic
+}
+
+// Config returns an sns.Config that accepts the topic's messages.
+func (s *SNSTopic) Config() sns.Config {
+	return sns.Config{
+		CertURLPattern: "^" + regexp.QuoteMeta(s.server.URL) + "/",
+		TopicArns:      []string{s.Arn},
+	}
+}
+
+// Notification returns a signed notification of the payload, encoded as JSON.
+func (s *SNSTopic) Notification(payload any) *sns.Message {
+	s.t.Helper()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		s.t.Fatalf("encoding SNS notification: %s", err)
+	}
+	return s.Sign(&sns.Message{
+		Type:    sns.TypeNotification,
+		Message: string(body),
+	})
+}
+
+// SubscriptionConfirmation returns a signed subscription confirmation.
+func (s *SNSTopic) SubscriptionConfirmation() *sns.Message {
+	s.t.Helper()
+	return s.Sign(&sns.Message{
+		Type:         sns.TypeSubscriptionConfirmation,
+		Token:        "token",
+		Message:      "You have chosen to subscribe to the topic.",
+		SubscribeURL: s.server.URL + "/confirm",
+	})
+}
+
+// Confirmed reports whether a subscription was confirmed.
+func (s *SNSTopic) Confirmed() bool {
+	return s.confirmed.Load()
+}
+
+// Sign fills in the message's topic, id, timestamp and signature.
+func (s *SNSTopic) Sign(m *sns.Message) *sns.Message {
+	s.t.Helper()
+	return s.SignAt(m, time.Now())
+}
+
+// SignAt signs the message as if it was sent at the given time.
+func (s *SNSTopic) SignAt(m *sns.Message, sent time.Time) *sns.Message {
+	s.t.Helper()
+	m.TopicArn = s.Arn
+	m.MessageId = strconv.FormatInt(s.messageIds.Add(1), 10)
+	m.Timestamp = sent.UTC().Format(time.RFC3339)
+	m.SignatureVersion = "2"
+	m.SigningCertURL = s.server.URL + "/cert.pem"
+
+	content, err := m.StringToSign()
+	if err != nil {
+		s.t.Fatalf("signing SNS message: %s", err)
+	}
+	digest := sha256.Sum256([]byte(content))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		s.t.Fatalf("signing SNS message: %s", err)
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(signature)
+	return m
+}
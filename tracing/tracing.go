@@ -0,0 +1,136 @@
+// Package tracing configures OpenTelemetry tracing.
+//
+// Spans are exported with OTLP over HTTP when tracing is enabled. The exporter
+// is configured with the standard OTEL_EXPORTER_OTLP_* variables, and the
+// sampler with OTEL_TRACES_SAMPLER. The W3C trace context is propagated
+// whether or not it's enabled.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/kelseyhightower/envconfig"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// TracerName names the tracer of hydrophone's own spans.
+const TracerName = "github.com/tidepool-org/hydrophone"
+
+// Propagator propagates the W3C trace context and baggage.
+var Propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// Config controls whether spans are exported.
+type Config struct {
+	Enabled     bool   `default:"false"`
+	ServiceName string `split_words:"true" default:"hydrophone"`
+}
+
+func configProvider() (Config, error) {
+	var config Config
+	if err := envconfig.Process("hydrophone_tracing", &config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// NewTracerProvider creates the TracerProvider that exports spans, or a no-op
+// one when tracing is disabled. The spans that are left are flushed on stop.
+func NewTracerProvider(lifecycle fx.Lifecycle, config Config) (trace.TracerProvider, error) {
+	if !config.Enabled {
+		return noop.NewTracerProvider(), nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", config.ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	lifecycle.Append(fx.Hook{
+		OnStop: provider.Shutdown,
+	})
+	return provider, nil
+}
+
+// Middleware starts a span for each request to a mux route, continuing the
+// trace of the request's trace context.
+func Middleware(provider trace.TracerProvider) mux.MiddlewareFunc {
+	return otelmux.Middleware("hydrophone",
+		otelmux.WithTracerProvider(provider),
+		otelmux.WithPropagators(Propagator),
+	)
+}
+
+// Transport starts a span for each request sent through base, and
+// propagates the trace context to the server.
+func Transport(base http.RoundTripper, provider trace.TracerProvider) http.RoundTripper {
+	return otelhttp.NewTransport(base,
+		otelhttp.WithTracerProvider(provider),
+		otelhttp.WithPropagators(Propagator),
+	)
+}
+
+// Tracer returns the tracer of hydrophone's own spans.
+func Tracer(provider trace.TracerProvider) trace.Tracer {
+	return provider.Tracer(TracerName)
+}
+
+// End ends the span, recording err if it isn't nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// LogFields returns the ids of the span in ctx, to be logged with the
+// messages about it. It returns nothing if there's no span.
+func LogFields(ctx context.Context) []zap.Field {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return nil
+	}
+	return []zap.Field{
+		zap.String("traceId", spanContext.TraceID().String()),
+		zap.String("spanId", spanContext.SpanID().String()),
+	}
+}
+
+// setGlobals makes the provider and propagator the defaults of libraries
+// that aren't given them.
+func setGlobals(provider trace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(Propagator)
+}
+
+// Module provides the TracerProvider, and makes it the global one.
+var Module = fx.Options(
+	fx.Provide(configProvider, NewTracerProvider),
+	fx.Invoke(setGlobals),
+)
@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestPropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	var outbound http.Header
+	downstream := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		outbound = req.Header.Clone()
+	}))
+	defer downstream.Close()
+	client := &http.Client{Transport: Transport(http.DefaultTransport, provider)}
+
+	var fields []zap.Field
+	rtr := mux.NewRouter()
+	rtr.Use(Middleware(provider))
+	rtr.HandleFunc("/confirm/invite/{userid}", func(res http.ResponseWriter, req *http.Request) {
+		fields = LogFields(req.Context())
+		outReq, _ := http.NewRequestWithContext(req.Context(), http.MethodGet, downstream.URL, nil)
+		if outRes, err := client.Do(outReq); err == nil {
+			outRes.Body.Close()
+		}
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/confirm/invite/1234", nil)
+	request.Header.Set("traceparent", traceparent)
+	rtr.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected a server and a client span, got %d", len(spans))
+	}
+	for _, span := range spans {
+		if traceId := span.SpanContext().TraceID().String(); traceId != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("expected span %q to continue the request's trace, got %s", span.Name(), traceId)
+		}
+	}
+	server := spans[1]
+	if server.Name() != "/confirm/invite/{userid}" || server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("expected a server span named after the route, got %q", server.Name())
+	}
+
+	if len(fields) != 2 || fields[0].String != "4bf92f3577b34da6a3ce929d0e0e4736" || fields[1].String != server.SpanContext().SpanID().String() {
+		t.Errorf("expected the trace and server span ids to be logged, got %v", fields)
+	}
+	if got := outbound.Get("traceparent"); got == "" || got[3:35] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the trace context to be propagated, got %q", got)
+	}
+}
+
+func TestEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := Tracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	_, span := tracer.Start(context.Background(), "failed")
+	End(span, errors.New("unavailable"))
+	_, span = tracer.Start(context.Background(), "succeeded")
+	End(span, nil)
+
+	spans := recorder.Ended()
+	if status := spans[0].Status(); status.Code != codes.Error || status.Description != "unavailable" {
+		t.Errorf("expected the error to be recorded, got %+v", status)
+	}
+	if status := spans[1].Status(); status.Code != codes.Unset {
+		t.Errorf("expected no error to be recorded, got %+v", status)
+	}
+}
+
+func TestLogFieldsWithoutSpan(t *testing.T) {
+	if fields := LogFields(httptest.NewRequest(http.MethodGet, "/", nil).Context()); fields != nil {
+		t.Errorf("expected no fields, got %v", fields)
+	}
+}
@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/fx"
+)
+
+// Periodic runs a function in the background, once when it's started and
+// then every interval, until it's stopped or the function returns false.
+type Periodic struct {
+	interval time.Duration
+	run      func(ctx context.Context) bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
+}
+
+// NewPeriodic creates a Periodic that calls run every interval. run is given
+// a context that's canceled when the Periodic is stopped, and returns whether
+// to keep running.
+func NewPeriodic(interval time.Duration, run func(ctx context.Context) bool) *Periodic {
+	return &Periodic{
+		interval: interval,
+		run:      run,
+	}
+}
+
+// Start running in the background. Starting a Periodic that's running does
+// nothing.
+func (p *Periodic) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.done = make(chan struct{})
+
+	go func(done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for p.run(ctx) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}(p.done)
+}
+
+// Stop waits for the current run to finish, or for ctx to be done.
+func (p *Periodic) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if p.cancel == nil {
+		p.mu.Unlock()
+		return nil
+	}
+	p.cancel()
+	p.cancel = nil
+	done := p.done
+	p.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Worker is started and stopped with the application.
+type Worker interface {
+	Start()
+	Stop(ctx context.Context) error
+}
+
+// Hook starts the worker when the application starts, and stops it when the
+// application stops.
+func Hook(worker Worker) fx.Hook {
+	return fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			worker.Start()
+			return nil
+		},
+		OnStop: worker.Stop,
+	}
+}
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPeriodic(t *testing.T) {
+	var runs atomic.Int32
+	periodic := NewPeriodic(time.Millisecond, func(ctx context.Context) bool {
+		runs.Add(1)
+		return true
+	})
+
+	periodic.Start()
+	periodic.Start()
+	deadline := time.Now().Add(time.Second)
+	for runs.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the function to run every interval, got %d runs", runs.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := periodic.Stop(context.Background()); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	stopped := runs.Load()
+	time.Sleep(10 * time.Millisecond)
+	if runs.Load() != stopped {
+		t.Errorf("expected no runs after stopping")
+	}
+	if err := periodic.Stop(context.Background()); err != nil {
+		t.Errorf("expected stopping again to do nothing, got: %s", err)
+	}
+}
+
+func TestPeriodicDone(t *testing.T) {
+	var runs atomic.Int32
+	periodic := NewPeriodic(time.Millisecond, func(ctx context.Context) bool {
+		return runs.Add(1) < 2
+	})
+
+	periodic.Start()
+	defer periodic.Stop(context.Background())
+	time.Sleep(20 * time.Millisecond)
+	if runs.Load() != 2 {
+		t.Errorf("expected the function to stop running once it returns false, got %d runs", runs.Load())
+	}
+}
+
+func TestPeriodicStopTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	periodic := NewPeriodic(time.Minute, func(ctx context.Context) bool {
+		close(started)
+		<-release
+		return false
+	})
+
+	periodic.Start()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := periodic.Stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected stopping to time out, got: %v", err)
+	}
+}